@@ -1,8 +1,17 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/user/cma/models"
@@ -11,29 +20,174 @@ import (
 
 // Handler struct contains all the dependencies for the API handlers
 type Handler struct {
+	dataFetcher    *modules.DataFetcher
 	marketAnalyzer *modules.MarketAnalyzer
 	cmaAnalyzer    *modules.CMAAnalyzer
+	pricingAdvisor *modules.PricingAdvisor
+	investments    *modules.InvestmentAnalyzer
+	batches        *modules.BatchProcessor
+	jobs           *modules.JobQueue
+	webhooks       *modules.WebhookDispatcher
+	searches       *modules.SavedSearchStore
+	stream         *modules.MarketStream
+	valuations     *modules.ValuationStore
+	requestTimeout time.Duration
 }
 
-// NewHandler creates a new Handler instance
-func NewHandler(marketAnalyzer *modules.MarketAnalyzer, cmaAnalyzer *modules.CMAAnalyzer) *Handler {
-	return &Handler{
+// defaultRequestTimeout bounds the analysis work done for a single API request
+const defaultRequestTimeout = 30 * time.Second
+
+// NewHandler creates a new Handler instance. Its background job queue and market stream run
+// once Start is called, after the Set methods have configured them.
+func NewHandler(dataFetcher *modules.DataFetcher, marketAnalyzer *modules.MarketAnalyzer, cmaAnalyzer *modules.CMAAnalyzer) *Handler {
+	h := &Handler{
+		dataFetcher:    dataFetcher,
 		marketAnalyzer: marketAnalyzer,
 		cmaAnalyzer:    cmaAnalyzer,
+		pricingAdvisor: modules.NewPricingAdvisor(cmaAnalyzer),
+		investments:    modules.NewInvestmentAnalyzer(cmaAnalyzer, marketAnalyzer),
+		batches:        modules.NewBatchProcessor(cmaAnalyzer, modules.DefaultBatchConfig()),
+		stream:         modules.NewMarketStream(marketAnalyzer, modules.DefaultStreamConfig()),
+		requestTimeout: defaultRequestTimeout,
+	}
+	// An in-memory queue and stores never fail to open
+	h.jobs, _ = h.newJobQueue(modules.DefaultJobConfig())
+	h.webhooks, _ = modules.NewWebhookDispatcher(modules.DefaultWebhookConfig())
+	h.searches, _ = modules.NewSavedSearchStore("")
+	h.valuations, _ = modules.NewValuationStore("")
+	return h
+}
+
+// Start runs the background job queue, resuming persisted jobs, and starts fetching the market
+// stream. It must be called once, after the handler is configured and before the server starts.
+func (h *Handler) Start() {
+	h.jobs.Start()
+	h.stream.Start()
+}
+
+// SetRequestTimeout sets the deadline applied to the analysis work of each request
+func (h *Handler) SetRequestTimeout(timeout time.Duration) {
+	h.requestTimeout = timeout
+}
+
+// SetBatchConfig sets the worker pool size of batch CMAs
+func (h *Handler) SetBatchConfig(cfg modules.BatchConfig) {
+	h.batches = modules.NewBatchProcessor(h.cmaAnalyzer, cfg)
+}
+
+// SetJobConfig replaces the background job queue with one using cfg, loading the jobs persisted
+// in its directory to resume on Start. It must be called before Start.
+func (h *Handler) SetJobConfig(cfg modules.JobConfig) error {
+	jobs, err := h.newJobQueue(cfg)
+	if err != nil {
+		return err
+	}
+	h.jobs = jobs
+	return nil
+}
+
+// SetWebhookDispatcher sets the dispatcher webhooks are registered with and job.finished events
+// are delivered by. It must be called before Start.
+func (h *Handler) SetWebhookDispatcher(wd *modules.WebhookDispatcher) {
+	h.webhooks = wd
+}
+
+// SetSavedSearchStore sets the store saved searches and their alerts are kept in. It must be
+// called before the server starts.
+func (h *Handler) SetSavedSearchStore(store *modules.SavedSearchStore) {
+	h.searches = store
+}
+
+// SetValuationStore sets the store the estimated value of every CMA served is recorded in. It
+// must be called before the server starts.
+func (h *Handler) SetValuationStore(store *modules.ValuationStore) {
+	h.valuations = store
+}
+
+// SetStreamConfig replaces the market stream with one using cfg. It must be called before Start.
+func (h *Handler) SetStreamConfig(cfg modules.StreamConfig) {
+	h.stream = modules.NewMarketStream(h.marketAnalyzer, cfg)
+}
+
+// CloseStreams ends the open market stream connections so they don't hold up a graceful shutdown
+func (h *Handler) CloseStreams() {
+	h.stream.Stop()
+}
+
+// Close stops the background job queue, persisting running jobs to resume after a restart,
+// stops retrying webhook deliveries, ends the market stream and closes the valuations file
+func (h *Handler) Close() {
+	h.jobs.Stop()
+	h.webhooks.Close()
+	h.stream.Stop()
+	_ = h.valuations.Close()
+}
+
+// recordValuation adds the estimated value of a CMA served to its property's valuation history.
+// Without a listings provider CMAs are mock data, which is never recorded.
+func (h *Handler) recordValuation(req models.CMARequest, cma *models.CMAResponse) {
+	if h.dataFetcher.Provider() == nil {
+		return
+	}
+	// A valuation that can't be written to the valuations file doesn't fail the CMA it is for
+	_ = h.valuations.Record(req, cma)
+}
+
+// newJobQueue creates a job queue running the API's job types
+func (h *Handler) newJobQueue(cfg modules.JobConfig) (*modules.JobQueue, error) {
+	jobs, err := modules.NewJobQueue(cfg)
+	if err != nil {
+		return nil, err
+	}
+	jobs.Register(models.JobTypeCMABatch, h.runCMABatchJob)
+	jobs.Register(models.JobTypeMarketRollup, h.runMarketRollupJob)
+	jobs.OnFinish(func(job models.Job) {
+		// Failed deliveries are in the webhooks' delivery logs
+		_ = h.webhooks.Publish(models.EventJobFinished, "", job)
+	})
+	return jobs, nil
+}
+
+// requestContext derives a context from the client's request that is canceled when the client
+// disconnects, the server shuts down or the request timeout expires
+func (h *Handler) requestContext(c echo.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request().Context(), h.requestTimeout)
+}
+
+// analysisError writes the error response for a failed analysis, returning 504 when the
+// request deadline expired before upstream data could be fetched
+func analysisError(c echo.Context, message string, err error) error {
+	status, response := analysisErrorResponse(message, err)
+	return c.JSON(status, response)
+}
+
+// analysisErrorResponse returns the status and error response for a failed analysis
+func analysisErrorResponse(message string, err error) (int, models.ErrorResponse) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, models.ErrorResponse{
+			Error: message + ": upstream data source did not respond before the request deadline",
+		}
+	}
+	return http.StatusInternalServerError, models.ErrorResponse{
+		Error: message + ": " + err.Error(),
 	}
 }
 
 // GetMarketTrends handles the GET /market-trends endpoint
 // @Summary Get real estate market trends
-// @Description Fetches and analyzes real estate pricing trends for a specific location
+// @Description Fetches and analyzes real estate pricing trends for a specific location, with the mortgage payment at the median price and its share of household income
 // @ID get-market-trends
 // @Produce json
 // @Param location query string true "City, state, or ZIP code"
 // @Param property_type query string false "Type of property (Single-family, condo, etc.)"
 // @Param time_range query string false "Time range for analysis (e.g., Last 6 months, 1 year, etc.)" default(6 months)
+// @Param household_income query integer false "Annual median household income for the payment-to-income ratio and affordability index"
+// @Param down_payment_rate query number false "Down payment as a share of the price, e.g. 0.2; defaults to the configured down payment"
+// @Param loan_term_years query integer false "Mortgage term in years; must have a configured rate"
 // @Success 200 {object} models.MarketTrends
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /market-trends [get]
 func (h *Handler) GetMarketTrends(c echo.Context) error {
 	// Extract query parameters
@@ -56,67 +210,1342 @@ func (h *Handler) GetMarketTrends(c echo.Context) error {
 		PropertyType: propertyType,
 		TimeRange:    timeRange,
 	}
+	if fieldErrs := parseAffordabilityQuery(c, &req); len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid market trends request",
+			Fields: fieldErrs,
+		})
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
 
 	// Get market trends
-	trends, err := h.marketAnalyzer.GetMarketTrends(req)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to fetch market trends: " + err.Error(),
+	trends, err := h.marketAnalyzer.GetMarketTrends(ctx, req)
+	if errors.Is(err, modules.ErrNoMortgageRate) {
+		var terms []string
+		for _, term := range h.marketAnalyzer.MortgageRates().Terms() {
+			terms = append(terms, strconv.Itoa(term))
+		}
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "invalid market trends request",
+			Fields: []models.FieldError{{
+				Field:   "loan_term_years",
+				Message: "must be one of " + strings.Join(terms, ", "),
+			}},
 		})
 	}
+	if err != nil {
+		return analysisError(c, "failed to fetch market trends", err)
+	}
 
 	return c.JSON(http.StatusOK, trends)
 }
 
+// maxStreamLocations is the largest number of locations a market stream connection subscribes to
+const maxStreamLocations = 20
+
+// GetMarketStream handles the GET /market-trends/stream endpoint
+// @Summary Stream market trend updates
+// @Description Opens a Server-Sent Events stream of the market trends of the given locations. Each location's current trends are sent first as a market-update event, then again whenever its underlying data changes. Event ids increase; a client reconnecting with the Last-Event-ID header, or the last_event_id parameter, only receives the trends that changed since that event. An idle connection receives a heartbeat comment every interval. A client that reads slowly receives only the latest trends of each location, and a connection whose writes stall is closed.
+// @ID get-market-stream
+// @Produce text/event-stream
+// @Param location query []string true "Locations to subscribe to (repeat the parameter for each location, up to 20)" collectionFormat(multi)
+// @Param property_type query string false "Property type (e.g., Single-family, Condo)"
+// @Param time_range query string false "Time range for analysis (e.g., Last 6 months, Last 1 year)"
+// @Param last_event_id query int false "Id of the last event received, when the Last-Event-ID header can't be set"
+// @Success 200 {object} models.MarketUpdate "Stream of market-update events"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /market-trends/stream [get]
+func (h *Handler) GetMarketStream(c echo.Context) error {
+	var fieldErrs []models.FieldError
+	locations := c.QueryParams()["location"]
+	switch {
+	case len(locations) == 0:
+		fieldErrs = append(fieldErrs, models.FieldError{Field: "location", Message: "is required"})
+	case len(locations) > maxStreamLocations:
+		fieldErrs = append(fieldErrs, models.FieldError{Field: "location", Message: fmt.Sprintf("must not be given more than %d times", maxStreamLocations)})
+	}
+	timeRange := c.QueryParam("time_range")
+	if timeRange == "" {
+		timeRange = "6 months"
+	}
+	var queries []models.MarketTrendsRequest
+	for i, location := range locations {
+		if location = strings.TrimSpace(location); location == "" {
+			fieldErrs = append(fieldErrs, models.FieldError{Field: fmt.Sprintf("location[%d]", i), Message: "must not be empty"})
+			continue
+		}
+		queries = append(queries, models.MarketTrendsRequest{
+			Location:     location,
+			PropertyType: c.QueryParam("property_type"),
+			TimeRange:    timeRange,
+		})
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+	var since uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			fieldErrs = append(fieldErrs, models.FieldError{Field: "last_event_id", Message: "must be an event id"})
+		}
+		since = id
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid market stream request",
+			Fields: fieldErrs,
+		})
+	}
+
+	sub, err := h.stream.Subscribe(queries, since)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+	defer sub.Close()
+
+	cfg := h.stream.Config()
+	res := c.Response()
+	rc := http.NewResponseController(res)
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Keep reverse proxies from buffering the stream
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	// write sends a chunk of the stream, giving up on a client that doesn't take it in time
+	write := func(chunk string) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := io.WriteString(res, chunk); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := write(fmt.Sprintf("retry: %d\n\n", streamRetry.Milliseconds())); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-sub.Done():
+			return nil
+		case <-heartbeat.C:
+			if err := write(": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		case <-sub.Ready():
+			updates, skipped := sub.Next()
+			var chunk strings.Builder
+			if skipped > 0 {
+				fmt.Fprintf(&chunk, ": %d superseded updates skipped\n", skipped)
+			}
+			for _, update := range updates {
+				data, err := json.Marshal(update)
+				if err != nil {
+					return nil
+				}
+				fmt.Fprintf(&chunk, "id: %d\nevent: %s\ndata: %s\n\n", update.ID, marketUpdateEvent, data)
+			}
+			if err := write(chunk.String()); err != nil {
+				return nil
+			}
+			heartbeat.Reset(cfg.Heartbeat)
+		}
+	}
+}
+
+const (
+	// marketUpdateEvent is the SSE event type of market updates
+	marketUpdateEvent = "market-update"
+
+	// streamRetry is the reconnection delay suggested to market stream clients
+	streamRetry = 5 * time.Second
+)
+
+// parseAffordabilityQuery reads the mortgage assumptions for affordability from the query
+// parameters into a market trends request, returning a field error for every invalid one
+func parseAffordabilityQuery(c echo.Context, req *models.MarketTrendsRequest) []models.FieldError {
+	var errs []models.FieldError
+	if s := c.QueryParam("household_income"); s != "" {
+		income, err := strconv.Atoi(s)
+		if err != nil || income <= 0 {
+			errs = append(errs, models.FieldError{Field: "household_income", Message: "must be a positive integer"})
+		}
+		req.HouseholdIncome = income
+	}
+	if s := c.QueryParam("down_payment_rate"); s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			errs = append(errs, models.FieldError{Field: "down_payment_rate", Message: "must be a number between 0 and 1"})
+		}
+		req.DownPaymentRate = &rate
+	}
+	if s := c.QueryParam("loan_term_years"); s != "" {
+		term, err := strconv.Atoi(s)
+		if err != nil || term <= 0 {
+			errs = append(errs, models.FieldError{Field: "loan_term_years", Message: "must be a positive integer"})
+		}
+		req.LoanTermYears = term
+	}
+	return errs
+}
+
 // GetCMA handles the GET /cma endpoint
 // @Summary Get Comparative Market Analysis
-// @Description Compares recent sales for a selected property to determine its market value
+// @Description Compares recent sales for a selected property to determine its market value. The property is given by property_id, by address, or by latitude and longitude; when an address or location matches several properties, the candidates are returned with 300 Multiple Choices.
 // @ID get-cma
 // @Produce json
-// @Param property_id query string true "Unique property identifier"
+// @Param property_id query string false "Unique property identifier"
+// @Param address query string false "Street address, e.g. 123 Main St, San Francisco, CA 94110"
+// @Param latitude query number false "Latitude of the property"
+// @Param longitude query number false "Longitude of the property"
 // @Param radius query integer false "Search radius in miles" default(5)
 // @Param property_type query string false "Filter by property type"
+// @Param include_ids query string false "Comma-separated listing IDs to always use as comparables"
+// @Param exclude_ids query string false "Comma-separated listing IDs never to use as comparables"
+// @Param sale_conditions query string false "Comma-separated sale conditions accepted for comparables, or all" default(standard)
 // @Success 200 {object} models.CMAResponse
+// @Success 300 {object} models.SubjectCandidatesResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /cma [get]
 func (h *Handler) GetCMA(c echo.Context) error {
+	req, errResponse := cmaQuery(c)
+	if errResponse != nil {
+		return c.JSON(http.StatusBadRequest, errResponse)
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	// Get CMA
+	cma, err := h.cmaAnalyzer.GetComparableProperties(ctx, req)
+	if err != nil {
+		return cmaError(c, req, err)
+	}
+	h.recordValuation(req, cma)
+
+	return c.JSON(http.StatusOK, cma)
+}
+
+// cmaQuery builds a CMA request from the query parameters of GET /cma, returning the error
+// response for invalid parameters
+func cmaQuery(c echo.Context) (models.CMARequest, *models.ErrorResponse) {
+	req, errResponse := subjectQuery(c)
+	if errResponse != nil {
+		return req, errResponse
+	}
+
+	req.IncludeIDs = splitList(c.QueryParam("include_ids"))
+	req.ExcludeIDs = splitList(c.QueryParam("exclude_ids"))
+	req.SaleConditions = splitList(c.QueryParam("sale_conditions"))
+
+	fieldErrs := validateComparableOverrides(req)
+	fieldErrs = append(fieldErrs, validateSaleConditions("sale_conditions", req.SaleConditions, true)...)
+	if len(fieldErrs) > 0 {
+		return req, &models.ErrorResponse{
+			Error:  "invalid CMA request",
+			Fields: fieldErrs,
+		}
+	}
+	return req, nil
+}
+
+// subjectQuery builds a request for the subject property, search radius and property type given
+// in the query parameters, returning the error response for invalid parameters
+func subjectQuery(c echo.Context) (models.CMARequest, *models.ErrorResponse) {
 	// Extract query parameters
 	propertyID := c.QueryParam("property_id")
-	if propertyID == "" {
-		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "property_id is required",
-		})
+	address := c.QueryParam("address")
+
+	var latitude, longitude float64
+	latitudeStr, longitudeStr := c.QueryParam("latitude"), c.QueryParam("longitude")
+	if (latitudeStr == "") != (longitudeStr == "") {
+		return models.CMARequest{}, &models.ErrorResponse{
+			Error: "latitude and longitude must be given together",
+		}
+	}
+	if latitudeStr != "" {
+		var errLat, errLng error
+		latitude, errLat = strconv.ParseFloat(latitudeStr, 64)
+		longitude, errLng = strconv.ParseFloat(longitudeStr, 64)
+		if errLat != nil || errLng != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return models.CMARequest{}, &models.ErrorResponse{
+				Error: "latitude and longitude must be valid coordinates",
+			}
+		}
 	}
 
-	radiusStr := c.QueryParam("radius")
-	radius := 5 // Default radius is 5 miles
-	if radiusStr != "" {
-		var err error
-		radius, err = strconv.Atoi(radiusStr)
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"error": "radius must be a valid integer",
-			})
+	if propertyID == "" && address == "" && latitudeStr == "" {
+		return models.CMARequest{}, &models.ErrorResponse{
+			Error: "property_id, address, or latitude and longitude are required",
+		}
+	}
+
+	radius, fieldErrs := parseRadius(c.QueryParam("radius"))
+	if len(fieldErrs) > 0 {
+		return models.CMARequest{}, &models.ErrorResponse{
+			Error:  "invalid CMA request",
+			Fields: fieldErrs,
 		}
 	}
 
 	propertyType := c.QueryParam("property_type")
 
 	// Create request model
-	req := models.CMARequest{
+	return models.CMARequest{
 		PropertyID:   propertyID,
+		Address:      address,
+		Latitude:     latitude,
+		Longitude:    longitude,
 		Radius:       radius,
 		PropertyType: propertyType,
+	}, nil
+}
+
+// GetPricing handles the GET /pricing endpoint
+// @Summary Get a suggested list price
+// @Description Runs a CMA for a property and recommends a list price from the estimate, the comparables' sale-to-list ratios and the asking prices of active competition, with conservative and aggressive alternatives and the expected days on market at each. Takes the same parameters as GET /cma.
+// @ID get-pricing
+// @Produce json
+// @Param property_id query string false "Unique property identifier"
+// @Param address query string false "Street address, e.g. 123 Main St, San Francisco, CA 94110"
+// @Param latitude query number false "Latitude of the property"
+// @Param longitude query number false "Longitude of the property"
+// @Param radius query integer false "Search radius in miles" default(5)
+// @Param property_type query string false "Filter by property type"
+// @Param include_ids query string false "Comma-separated listing IDs to always use as comparables"
+// @Param exclude_ids query string false "Comma-separated listing IDs never to use as comparables"
+// @Param sale_conditions query string false "Comma-separated sale conditions accepted for comparables, or all" default(standard)
+// @Success 200 {object} models.PricingStrategy
+// @Success 300 {object} models.SubjectCandidatesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /pricing [get]
+func (h *Handler) GetPricing(c echo.Context) error {
+	req, errResponse := cmaQuery(c)
+	if errResponse != nil {
+		return c.JSON(http.StatusBadRequest, errResponse)
 	}
 
-	// Get CMA
-	cma, err := h.cmaAnalyzer.GetComparableProperties(req)
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	pricing, err := h.pricingAdvisor.GetPricingStrategy(ctx, req)
+	if errors.Is(err, modules.ErrNoComparables) {
+		return c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to fetch CMA: " + err.Error(),
+		return cmaError(c, req, err)
+	}
+
+	return c.JSON(http.StatusOK, pricing)
+}
+
+// GetRentCMA handles the GET /rent-cma endpoint
+// @Summary Get rental comparables and a rent estimate
+// @Description Finds recently leased rentals comparable to a property, using the same similarity ranking and outlier filtering as GET /cma, and estimates the property's monthly rent with a likely range
+// @ID get-rent-cma
+// @Produce json
+// @Param property_id query string false "Unique property identifier"
+// @Param address query string false "Street address, e.g. 123 Main St, San Francisco, CA 94110"
+// @Param latitude query number false "Latitude of the property"
+// @Param longitude query number false "Longitude of the property"
+// @Param radius query integer false "Search radius in miles" default(5)
+// @Param property_type query string false "Filter by property type"
+// @Success 200 {object} models.RentCMAResponse
+// @Success 300 {object} models.SubjectCandidatesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 501 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /rent-cma [get]
+func (h *Handler) GetRentCMA(c echo.Context) error {
+	req, errResponse := subjectQuery(c)
+	if errResponse != nil {
+		return c.JSON(http.StatusBadRequest, errResponse)
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	rentCMA, err := h.cmaAnalyzer.GetRentalComparables(ctx, req)
+	if errors.Is(err, modules.ErrRentalsUnavailable) {
+		return c.JSON(http.StatusNotImplemented, models.ErrorResponse{
+			Error: err.Error(),
 		})
 	}
+	if err != nil {
+		return cmaError(c, req, err)
+	}
+
+	return c.JSON(http.StatusOK, rentCMA)
+}
+
+// PostCMA handles the POST /cma endpoint
+// @Summary Get Comparative Market Analysis for a request body
+// @Description Runs the same analysis as GET /cma. Besides property_id, address or coordinates, the body may describe a subject property that has no listing, such as an off-market home or new construction. Invalid fields are reported individually.
+// @ID post-cma
+// @Accept json
+// @Produce json
+// @Param request body models.CMARequest true "CMA request"
+// @Success 200 {object} models.CMAResponse
+// @Success 300 {object} models.SubjectCandidatesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /cma [post]
+func (h *Handler) PostCMA(c echo.Context) error {
+	var req models.CMARequest
+	fieldErrs, err := decodeJSONBody(c.Request().Body, &req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validateCMARequest(req)
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid CMA request",
+			Fields: fieldErrs,
+		})
+	}
+
+	req.Radius = radiusOrDefault(req.Radius)
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	cma, err := h.cmaAnalyzer.GetComparableProperties(ctx, req)
+	if err != nil {
+		return cmaError(c, req, err)
+	}
+	h.recordValuation(req, cma)
 
 	return c.JSON(http.StatusOK, cma)
 }
+
+// PostInvestmentAnalysis handles the POST /investment-analysis endpoint
+// @Summary Analyze a property as a rental investment
+// @Description Values a property with a CMA and evaluates buying it as a rental under the given purchase and operating assumptions: cap rate, gross rent multiplier, cash-on-cash return, monthly cash flow and a 10-year projection. The purchase price, rent and appreciation default to the CMA's estimate, the rent estimated from rental comparables and the location's market trend.
+// @ID post-investment-analysis
+// @Accept json
+// @Produce json
+// @Param request body models.InvestmentRequest true "Property and purchase assumptions"
+// @Success 200 {object} models.InvestmentAnalysis
+// @Success 300 {object} models.SubjectCandidatesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /investment-analysis [post]
+func (h *Handler) PostInvestmentAnalysis(c echo.Context) error {
+	var req models.InvestmentRequest
+	fieldErrs, err := decodeJSONBody(c.Request().Body, &req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validateInvestmentRequest(req)
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid investment analysis request",
+			Fields: fieldErrs,
+		})
+	}
+
+	req.Radius = radiusOrDefault(req.Radius)
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	analysis, err := h.investments.GetInvestmentAnalysis(ctx, req)
+	switch {
+	case errors.Is(err, modules.ErrRentUnknown):
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "invalid investment analysis request",
+			Fields: []models.FieldError{{
+				Field:   "monthly_rent",
+				Message: "is required when no rental data is available",
+			}},
+		})
+	case errors.Is(err, modules.ErrNoComparables):
+		return c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: err.Error() + "; give a purchase_price",
+		})
+	case err != nil:
+		return cmaError(c, models.CMARequest{
+			PropertyID: req.PropertyID,
+			Address:    req.Address,
+			Latitude:   req.Latitude,
+			Longitude:  req.Longitude,
+		}, err)
+	}
+
+	return c.JSON(http.StatusOK, analysis)
+}
+
+// maxSyncBatchItems is the largest batch CMA computed within the request; larger batches run
+// in the background
+const maxSyncBatchItems = 50
+
+// PostCMABatch handles the POST /cma/batch endpoint
+// @Summary Get CMAs for a portfolio of properties
+// @Description Computes the CMA of each item concurrently with a bounded worker pool and returns each item's result or error, with the total estimated value of the properties valued. Batches of more than 50 items, or with async set, run in the background: the response is 202 Accepted with an id to poll at GET /cma/batch/{id}.
+// @ID post-cma-batch
+// @Accept json
+// @Produce json
+// @Param request body models.BatchCMARequest true "Batch CMA request"
+// @Success 200 {object} models.BatchCMAResponse
+// @Success 202 {object} models.BatchCMAResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /cma/batch [post]
+func (h *Handler) PostCMABatch(c echo.Context) error {
+	var req models.BatchCMARequest
+	fieldErrs, err := decodeJSONBody(c.Request().Body, &req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validateBatchCMARequest(req)
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid batch CMA request",
+			Fields: fieldErrs,
+		})
+	}
+
+	for i := range req.Items {
+		req.Items[i].Radius = radiusOrDefault(req.Items[i].Radius)
+	}
+
+	if req.Async || len(req.Items) > maxSyncBatchItems {
+		params, err := json.Marshal(models.BatchCMARequest{Items: req.Items})
+		if err != nil {
+			return analysisError(c, "failed to queue batch", err)
+		}
+		job, err := h.jobs.Submit(models.JobTypeCMABatch, params, len(req.Items))
+		if err != nil {
+			return jobSubmitError(c, err)
+		}
+		c.Response().Header().Set(echo.HeaderLocation, "/cma/batch/"+job.ID)
+		return c.JSON(http.StatusAccepted, models.BatchCMAResponse{
+			ID:     job.ID,
+			Status: models.BatchStatusPending,
+			Total:  len(req.Items),
+		})
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	results := h.batches.Run(ctx, req.Items, nil)
+	h.recordValuations(req.Items, results)
+	return c.JSON(http.StatusOK, batchResponse(req.Items, results))
+}
+
+// GetCMABatch handles the GET /cma/batch/{id} endpoint
+// @Summary Get the progress or results of a background batch CMA
+// @Description Returns the status and progress of a batch submitted to POST /cma/batch, with each item's result once it has completed. Background batches are cma-batch jobs, so they can also be followed and canceled at /jobs/{id}. Results are kept for a day after the batch completes.
+// @ID get-cma-batch
+// @Produce json
+// @Param id path string true "Batch identifier"
+// @Success 200 {object} models.BatchCMAResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /cma/batch/{id} [get]
+func (h *Handler) GetCMABatch(c echo.Context) error {
+	job, result, err := h.jobs.Result(c.Param("id"))
+	if err == nil && job.Type != models.JobTypeCMABatch {
+		err = modules.ErrJobNotFound
+	}
+	if err != nil {
+		return c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "batch not found: " + c.Param("id"),
+		})
+	}
+
+	response := models.BatchCMAResponse{
+		Total:     job.Progress.Total,
+		Completed: job.Progress.Completed,
+		Error:     job.Error,
+	}
+	switch job.Status {
+	case models.JobStatusQueued:
+		response.Status = models.BatchStatusPending
+	case models.JobStatusRunning:
+		response.Status = models.BatchStatusRunning
+	case models.JobStatusFailed:
+		response.Status = models.BatchStatusFailed
+	case models.JobStatusCanceled:
+		response.Status = models.BatchStatusCanceled
+	case models.JobStatusSucceeded:
+		if err := json.Unmarshal(result, &response); err != nil {
+			return analysisError(c, "failed to read batch results", err)
+		}
+	}
+	response.ID = job.ID
+	return c.JSON(http.StatusOK, response)
+}
+
+// runCMABatchJob runs a cma-batch job: the CMAs of a models.BatchCMARequest, reported as a
+// models.BatchCMAResponse
+func (h *Handler) runCMABatchJob(ctx context.Context, params json.RawMessage, progress func(completed int)) (interface{}, error) {
+	var req models.BatchCMARequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var completed int
+	results := h.batches.Run(ctx, req.Items, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		completed++
+		progress(completed)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	h.recordValuations(req.Items, results)
+	return batchResponse(req.Items, results), nil
+}
+
+// recordValuations adds the estimated values of the CMAs of a batch to their properties' valuation histories
+func (h *Handler) recordValuations(reqs []models.CMARequest, results []modules.BatchResult) {
+	for i, result := range results {
+		if result.CMA != nil {
+			h.recordValuation(reqs[i], result.CMA)
+		}
+	}
+}
+
+// batchResponse builds the response for a completed batch: the result or error of each item,
+// with the error each would have had as a single request, and the portfolio totals
+func batchResponse(reqs []models.CMARequest, results []modules.BatchResult) models.BatchCMAResponse {
+	response := models.BatchCMAResponse{
+		Status:    models.BatchStatusCompleted,
+		Total:     len(reqs),
+		Completed: len(results),
+		Items:     make([]models.BatchCMAItem, 0, len(results)),
+	}
+
+	var freshness []string
+	for i, result := range results {
+		item := models.BatchCMAItem{Index: i}
+		if result.Err == nil {
+			item.StatusCode = http.StatusOK
+			item.Result = result.CMA
+			response.Succeeded++
+			response.PortfolioValue += result.CMA.EstimatedValue
+			freshness = append(freshness, result.CMA.DataFreshness)
+			response.Items = append(response.Items, item)
+			continue
+		}
+
+		response.Failed++
+		status, body := cmaErrorResponse(reqs[i], result.Err)
+		item.StatusCode = status
+		switch body := body.(type) {
+		case models.SubjectCandidatesResponse:
+			item.Error = body.Error
+			item.Candidates = body.Candidates
+		case models.ErrorResponse:
+			item.Error = body.Error
+			item.Fields = body.Fields
+		}
+		response.Items = append(response.Items, item)
+	}
+	if response.Succeeded > 0 {
+		response.DataFreshness = modules.LeastFresh(freshness...)
+	}
+	return response
+}
+
+// PostJob handles the POST /jobs endpoint
+// @Summary Run a long-running operation in the background
+// @Description Queues a job and returns it with status queued; poll GET /jobs/{id} for its progress and fetch GET /jobs/{id}/result once it has succeeded. A cma-batch job takes a BatchCMARequest and produces a BatchCMAResponse; a market-rollup job takes a MarketRollupRequest and produces a MarketRollup. A bounded number of jobs run at a time, and with a job directory configured, queued and running jobs resume after a restart.
+// @ID post-job
+// @Accept json
+// @Produce json
+// @Param request body models.JobRequest true "Job request"
+// @Success 202 {object} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /jobs [post]
+func (h *Handler) PostJob(c echo.Context) error {
+	var req models.JobRequest
+	fieldErrs, err := decodeJSONBody(c.Request().Body, &req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+
+	var params interface{}
+	var total int
+	if len(fieldErrs) == 0 {
+		params, total, fieldErrs = jobParams(req)
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid job request",
+			Fields: fieldErrs,
+		})
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return analysisError(c, "failed to queue job", err)
+	}
+	job, err := h.jobs.Submit(req.Type, data, total)
+	if err != nil {
+		return jobSubmitError(c, err)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/jobs/"+job.ID)
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// GetJob handles the GET /jobs/{id} endpoint
+// @Summary Get the status and progress of a job
+// @Description Returns the status of a job submitted to POST /jobs and how much of its work is done. Finished jobs are kept for a day.
+// @ID get-job
+// @Produce json
+// @Param id path string true "Job identifier"
+// @Success 200 {object} models.Job
+// @Failure 404 {object} models.ErrorResponse
+// @Router /jobs/{id} [get]
+func (h *Handler) GetJob(c echo.Context) error {
+	job, err := h.jobs.Get(c.Param("id"))
+	if err != nil {
+		return jobNotFound(c)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// GetJobResult handles the GET /jobs/{id}/result endpoint
+// @Summary Get the result of a job
+// @Description Returns the result of a job that has succeeded: a BatchCMAResponse for a cma-batch job or a MarketRollup for a market-rollup job. Jobs that are still queued or running, failed, or were canceled have no result.
+// @ID get-job-result
+// @Produce json
+// @Param id path string true "Job identifier"
+// @Success 200 {object} object
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /jobs/{id}/result [get]
+func (h *Handler) GetJobResult(c echo.Context) error {
+	job, result, err := h.jobs.Result(c.Param("id"))
+	if err != nil {
+		return jobNotFound(c)
+	}
+
+	switch job.Status {
+	case models.JobStatusSucceeded:
+		return c.JSONBlob(http.StatusOK, result)
+	case models.JobStatusFailed:
+		return c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "job failed: " + job.Error,
+		})
+	}
+	return c.JSON(http.StatusConflict, models.ErrorResponse{
+		Error: "job has no result: it is " + job.Status,
+	})
+}
+
+// DeleteJob handles the DELETE /jobs/{id} endpoint
+// @Summary Cancel a job
+// @Description Cancels a queued or running job. A running job stops at its next unit of work; its partial results are discarded.
+// @ID delete-job
+// @Produce json
+// @Param id path string true "Job identifier"
+// @Success 200 {object} models.Job
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /jobs/{id} [delete]
+func (h *Handler) DeleteJob(c echo.Context) error {
+	job, err := h.jobs.Cancel(c.Param("id"))
+	switch {
+	case errors.Is(err, modules.ErrJobFinished):
+		return c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: err.Error() + " with status " + job.Status,
+		})
+	case err != nil:
+		return jobNotFound(c)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// jobNotFound writes the response for an unknown or expired job
+func jobNotFound(c echo.Context) error {
+	return c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error: modules.ErrJobNotFound.Error() + ": " + c.Param("id"),
+	})
+}
+
+// jobSubmitError writes the error response for a job that could not be queued
+func jobSubmitError(c echo.Context, err error) error {
+	if errors.Is(err, modules.ErrJobQueueFull) {
+		return c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: err.Error() + ", retry later",
+		})
+	}
+	return analysisError(c, "failed to queue job", err)
+}
+
+// jobParams decodes and validates the parameters of a job request, returning them with their
+// defaults applied and the number of units of work in the job
+func jobParams(req models.JobRequest) (interface{}, int, []models.FieldError) {
+	switch req.Type {
+	case models.JobTypeCMABatch:
+		var params models.BatchCMARequest
+		if errs := decodeJobParams(req.Params, &params); len(errs) > 0 {
+			return nil, 0, errs
+		}
+		if errs := prefixFields("params.", validateBatchCMARequest(params)); len(errs) > 0 {
+			return nil, 0, errs
+		}
+		for i := range params.Items {
+			params.Items[i].Radius = radiusOrDefault(params.Items[i].Radius)
+		}
+		return models.BatchCMARequest{Items: params.Items}, len(params.Items), nil
+
+	case models.JobTypeMarketRollup:
+		var params models.MarketRollupRequest
+		if errs := decodeJobParams(req.Params, &params); len(errs) > 0 {
+			return nil, 0, errs
+		}
+		if errs := prefixFields("params.", validateMarketRollupRequest(params)); len(errs) > 0 {
+			return nil, 0, errs
+		}
+		if params.TimeRange == "" {
+			params.TimeRange = "6 months" // Default to 6 months if not specified
+		}
+		return params, len(params.Locations), nil
+	}
+
+	return nil, 0, []models.FieldError{{
+		Field:   "type",
+		Message: fmt.Sprintf("must be one of %s, %s", models.JobTypeCMABatch, models.JobTypeMarketRollup),
+	}}
+}
+
+// decodeJobParams strictly decodes the parameters of a job request into target
+func decodeJobParams(params json.RawMessage, target interface{}) []models.FieldError {
+	if len(params) == 0 || string(params) == "null" {
+		return []models.FieldError{{Field: "params", Message: "is required"}}
+	}
+	fieldErrs, err := decodeJSONBody(bytes.NewReader(params), target)
+	if err != nil {
+		return []models.FieldError{{Field: "params", Message: "must be an object"}}
+	}
+	return prefixFields("params.", fieldErrs)
+}
+
+// prefixFields prefixes the field of each error, for errors found in a nested object
+func prefixFields(prefix string, errs []models.FieldError) []models.FieldError {
+	for i := range errs {
+		errs[i].Field = prefix + errs[i].Field
+	}
+	return errs
+}
+
+// runMarketRollupJob runs a market-rollup job: the market trends of every location of a
+// models.MarketRollupRequest, reported as a models.MarketRollup
+func (h *Handler) runMarketRollupJob(ctx context.Context, params json.RawMessage, progress func(completed int)) (interface{}, error) {
+	var req models.MarketRollupRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, err
+	}
+
+	rollup := models.MarketRollup{Items: make([]models.MarketRollupItem, 0, len(req.Locations))}
+	for i, location := range req.Locations {
+		trends, err := h.marketAnalyzer.GetMarketTrends(ctx, models.MarketTrendsRequest{
+			Location:     location,
+			PropertyType: req.PropertyType,
+			TimeRange:    req.TimeRange,
+		})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		item := models.MarketRollupItem{Location: location, Trends: trends}
+		if err != nil {
+			_, body := analysisErrorResponse("failed to fetch market trends", err)
+			item.Error = body.Error
+		}
+		rollup.Items = append(rollup.Items, item)
+		progress(i + 1)
+	}
+	return rollup, nil
+}
+
+// PostWebhook handles the POST /webhooks endpoint
+// @Summary Register a webhook
+// @Description Registers a URL to receive a signed POST when a background job finishes (job.finished) or when the trend classification of a watched location changes (market.trend_changed). Each delivery has the headers X-CMA-Event, X-CMA-Delivery, X-CMA-Timestamp and X-CMA-Signature, which is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook's secret. The secret is only returned in this response. Deliveries answered with anything but 2xx are retried with exponential backoff. URLs on loopback, private and link-local addresses are refused unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is set.
+// @ID post-webhook
+// @Accept json
+// @Produce json
+// @Param request body models.WebhookRequest true "Webhook request"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [post]
+func (h *Handler) PostWebhook(c echo.Context) error {
+	var req models.WebhookRequest
+	fieldErrs, err := decodeJSONBody(c.Request().Body, &req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validateWebhookRequest(req)
+	}
+	if len(fieldErrs) == 0 && errors.Is(h.webhooks.CheckURL(req.URL), modules.ErrPrivateAddress) {
+		fieldErrs = []models.FieldError{{Field: "url", Message: "must not point to a loopback, private or link-local address"}}
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid webhook request",
+			Fields: fieldErrs,
+		})
+	}
+
+	if len(req.Events) == 0 {
+		req.Events = []string{models.EventJobFinished}
+		if len(req.Locations) > 0 {
+			req.Events = append(req.Events, models.EventMarketTrendChange)
+		}
+	}
+	webhook, err := h.webhooks.Register(req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "failed to save webhook: " + err.Error(),
+		})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/webhooks/"+webhook.ID)
+	return c.JSON(http.StatusCreated, webhook)
+}
+
+// GetWebhooks handles the GET /webhooks endpoint
+// @Summary List webhooks
+// @Description Returns the registered webhooks, oldest first, without their secrets
+// @ID get-webhooks
+// @Produce json
+// @Success 200 {array} models.Webhook
+// @Router /webhooks [get]
+func (h *Handler) GetWebhooks(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.webhooks.Webhooks())
+}
+
+// GetWebhook handles the GET /webhooks/{id} endpoint
+// @Summary Get a webhook
+// @Description Returns a registered webhook without its secret
+// @ID get-webhook
+// @Produce json
+// @Param id path string true "Webhook identifier"
+// @Success 200 {object} models.Webhook
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id} [get]
+func (h *Handler) GetWebhook(c echo.Context) error {
+	webhook, err := h.webhooks.Get(c.Param("id"))
+	if err != nil {
+		return webhookNotFound(c, err)
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook handles the DELETE /webhooks/{id} endpoint
+// @Summary Delete a webhook
+// @Description Unregisters a webhook; pending retries of its deliveries stop
+// @ID delete-webhook
+// @Param id path string true "Webhook identifier"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(c echo.Context) error {
+	err := h.webhooks.Delete(c.Param("id"))
+	if errors.Is(err, modules.ErrWebhookNotFound) {
+		return webhookNotFound(c, err)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "failed to delete webhook: " + err.Error(),
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries handles the GET /webhooks/{id}/deliveries endpoint
+// @Summary Get the delivery log of a webhook
+// @Description Returns the deliveries of events to a webhook, newest first, with their status, attempts, last response status or error, and payload
+// @ID get-webhook-deliveries
+// @Produce json
+// @Param id path string true "Webhook identifier"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+func (h *Handler) GetWebhookDeliveries(c echo.Context) error {
+	deliveries, err := h.webhooks.Deliveries(c.Param("id"))
+	if err != nil {
+		return webhookNotFound(c, err)
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// PostWebhookRedelivery handles the POST /webhooks/{id}/deliveries/{delivery_id}/redeliver endpoint
+// @Summary Redeliver an event to a webhook
+// @Description Sends the payload of a logged delivery to the webhook again as a new delivery, with the same event id and a fresh signature
+// @ID post-webhook-redelivery
+// @Produce json
+// @Param id path string true "Webhook identifier"
+// @Param delivery_id path string true "Delivery identifier"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (h *Handler) PostWebhookRedelivery(c echo.Context) error {
+	delivery, err := h.webhooks.Redeliver(c.Param("id"), c.Param("delivery_id"))
+	if errors.Is(err, modules.ErrDeliveryNotFound) {
+		return c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: err.Error() + ": " + c.Param("delivery_id"),
+		})
+	}
+	if err != nil {
+		return webhookNotFound(c, err)
+	}
+	return c.JSON(http.StatusAccepted, delivery)
+}
+
+// webhookNotFound writes the response for an unknown webhook
+func webhookNotFound(c echo.Context, err error) error {
+	return c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error: err.Error() + ": " + c.Param("id"),
+	})
+}
+
+// maxAlertsLimit is the largest number of alerts returned by GET /alerts
+const maxAlertsLimit = 500
+
+// PostSavedSearch handles the POST /saved-searches endpoint
+// @Summary Save a search
+// @Description Saves a market-trends or cma query with alert rules. Saved searches are re-evaluated periodically with the same analysis as GET /market-trends and POST /cma; the first evaluation sets the baseline and later ones raise alerts, listed by GET /alerts, when the median price moves by median_price_change since the baseline or the last alert, when active listings grow by inventory_change since the previous evaluation, or when a comparable sale the search hasn't seen before appears.
+// @ID post-saved-search
+// @Accept json
+// @Produce json
+// @Param request body models.SavedSearchRequest true "Saved search request"
+// @Success 201 {object} models.SavedSearch
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /saved-searches [post]
+func (h *Handler) PostSavedSearch(c echo.Context) error {
+	var req models.SavedSearchRequest
+	fieldErrs, err := decodeJSONBody(c.Request().Body, &req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validateSavedSearchRequest(req)
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid saved search request",
+			Fields: fieldErrs,
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.MarketTrends != nil && req.MarketTrends.TimeRange == "" {
+		req.MarketTrends.TimeRange = "6 months"
+	}
+	if req.CMA != nil {
+		req.CMA.Radius = radiusOrDefault(req.CMA.Radius)
+	}
+	search, err := h.searches.Create(req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "failed to save search: " + err.Error(),
+		})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/saved-searches/"+search.ID)
+	return c.JSON(http.StatusCreated, search)
+}
+
+// GetSavedSearches handles the GET /saved-searches endpoint
+// @Summary List saved searches
+// @Description Returns the saved searches, oldest first, with the time and error of their last evaluation
+// @ID get-saved-searches
+// @Produce json
+// @Success 200 {array} models.SavedSearch
+// @Router /saved-searches [get]
+func (h *Handler) GetSavedSearches(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.searches.List())
+}
+
+// GetSavedSearch handles the GET /saved-searches/{id} endpoint
+// @Summary Get a saved search
+// @Description Returns a saved search with the time and error of its last evaluation
+// @ID get-saved-search
+// @Produce json
+// @Param id path string true "Saved search identifier"
+// @Success 200 {object} models.SavedSearch
+// @Failure 404 {object} models.ErrorResponse
+// @Router /saved-searches/{id} [get]
+func (h *Handler) GetSavedSearch(c echo.Context) error {
+	search, err := h.searches.Get(c.Param("id"))
+	if err != nil {
+		return savedSearchNotFound(c, err)
+	}
+	return c.JSON(http.StatusOK, search)
+}
+
+// DeleteSavedSearch handles the DELETE /saved-searches/{id} endpoint
+// @Summary Delete a saved search
+// @Description Stops re-evaluating a saved search; the alerts it raised stay in the feed
+// @ID delete-saved-search
+// @Param id path string true "Saved search identifier"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /saved-searches/{id} [delete]
+func (h *Handler) DeleteSavedSearch(c echo.Context) error {
+	err := h.searches.Delete(c.Param("id"))
+	if errors.Is(err, modules.ErrSavedSearchNotFound) {
+		return savedSearchNotFound(c, err)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "failed to delete saved search: " + err.Error(),
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetAlerts handles the GET /alerts endpoint
+// @Summary Get the alerts feed
+// @Description Returns the alerts raised by saved searches, newest first
+// @ID get-alerts
+// @Produce json
+// @Param search_id query string false "Only alerts of this saved search"
+// @Param since query string false "Only alerts raised after this RFC 3339 time"
+// @Param limit query int false "Largest number of alerts returned (default 50, max 500)"
+// @Success 200 {array} models.Alert
+// @Failure 400 {object} models.ErrorResponse
+// @Router /alerts [get]
+func (h *Handler) GetAlerts(c echo.Context) error {
+	filter := modules.AlertFilter{SearchID: c.QueryParam("search_id"), Limit: 50}
+	var fieldErrs []models.FieldError
+	if s := c.QueryParam("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			fieldErrs = append(fieldErrs, models.FieldError{Field: "since", Message: "must be an RFC 3339 time"})
+		}
+		filter.Since = since
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxAlertsLimit {
+			fieldErrs = append(fieldErrs, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be an integer between 1 and %d", maxAlertsLimit)})
+		}
+		filter.Limit = limit
+	}
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid alerts request",
+			Fields: fieldErrs,
+		})
+	}
+	return c.JSON(http.StatusOK, h.searches.Alerts(filter))
+}
+
+// savedSearchNotFound writes the response for an unknown saved search
+func savedSearchNotFound(c echo.Context, err error) error {
+	return c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error: err.Error() + ": " + c.Param("id"),
+	})
+}
+
+// maxRetroactiveDates is the largest number of as-of dates a valuation history is recomputed at
+const maxRetroactiveDates = 24
+
+// GetPropertyValuations handles the GET /properties/{id}/valuations endpoint
+// @Summary Get the valuation history of a property
+// @Description Returns the estimated value of every CMA served for a property without comparable overrides (include_ids, exclude_ids, comparables or non-standard sale_conditions), oldest first, with the change from each valuation to the next and over the whole timeline. Each as_of date adds a retroactive valuation recomputed with only the sales closed by that date, so a timeline can be built for a property that was never valued before.
+// @ID get-property-valuations
+// @Produce json
+// @Param id path string true "Unique property identifier"
+// @Param as_of query []string false "Dates to recompute the CMA as of (YYYY-MM-DD); repeat the parameter for each date, up to 24" collectionFormat(multi)
+// @Param radius query integer false "Search radius in miles of retroactive CMAs" default(5)
+// @Success 200 {object} models.ValuationHistory
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 501 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /properties/{id}/valuations [get]
+func (h *Handler) GetPropertyValuations(c echo.Context) error {
+	propertyID := c.Param("id")
+	var fieldErrs []models.FieldError
+	dates := c.QueryParams()["as_of"]
+	if len(dates) > maxRetroactiveDates {
+		fieldErrs = append(fieldErrs, models.FieldError{Field: "as_of", Message: fmt.Sprintf("must not be given more than %d times", maxRetroactiveDates)})
+	}
+	for i, date := range dates {
+		fieldErrs = append(fieldErrs, validateAsOf(fmt.Sprintf("as_of[%d]", i), date)...)
+	}
+	radius, radiusErrs := parseRadius(c.QueryParam("radius"))
+	fieldErrs = append(fieldErrs, radiusErrs...)
+	if len(fieldErrs) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "invalid valuations request",
+			Fields: fieldErrs,
+		})
+	}
+
+	// Without a listings provider CMAs are mock data, which can't be valued as of a past date
+	if len(dates) > 0 && h.dataFetcher.Provider() == nil {
+		return c.JSON(http.StatusNotImplemented, models.ErrorResponse{
+			Error: "retroactive valuations need a listings provider",
+		})
+	}
+
+	valuations, address := h.valuations.History(propertyID)
+	if len(valuations) == 0 && len(dates) == 0 {
+		return c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "no valuations recorded for property: " + propertyID,
+		})
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	for _, date := range dates {
+		req := models.CMARequest{PropertyID: propertyID, Radius: radius, AsOf: date}
+		cma, err := h.cmaAnalyzer.GetComparableProperties(ctx, req)
+		if err != nil {
+			return cmaError(c, req, err)
+		}
+		if cma.Address != "" {
+			address = cma.Address
+		}
+		if len(cma.Comparables) == 0 {
+			// Nothing had sold nearby yet, so there is no value to chart
+			continue
+		}
+		valuations = append(valuations, h.valuations.Retroactive(cma))
+	}
+
+	return c.JSON(http.StatusOK, modules.ValuationTimeline(propertyID, address, valuations))
+}
+
+// splitList splits a comma-separated query parameter, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// cmaError writes the error response for a CMA that could not be produced
+func cmaError(c echo.Context, req models.CMARequest, err error) error {
+	status, response := cmaErrorResponse(req, err)
+	return c.JSON(status, response)
+}
+
+// cmaErrorResponse returns the status and response for a CMA that could not be produced: a
+// models.SubjectCandidatesResponse for an ambiguous subject, or a models.ErrorResponse
+func cmaErrorResponse(req models.CMARequest, err error) (int, interface{}) {
+	var ambiguous *modules.AmbiguousSubjectError
+	var comparableErr *modules.ComparableError
+	switch {
+	case errors.As(err, &ambiguous):
+		return http.StatusMultipleChoices, subjectCandidates(ambiguous)
+	case errors.As(err, &comparableErr):
+		return http.StatusBadRequest, models.ErrorResponse{
+			Error: "invalid CMA request",
+			Fields: []models.FieldError{{
+				Field:   "include_ids",
+				Message: comparableErr.Error(),
+			}},
+		}
+	case errors.Is(err, modules.ErrIncompleteAddress):
+		return http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		}
+	case errors.Is(err, modules.ErrSubjectNotLocated):
+		return http.StatusBadRequest, models.ErrorResponse{
+			Error: "invalid CMA request",
+			Fields: []models.FieldError{{
+				Field:   "subject.latitude",
+				Message: "is required when the subject's address can't be geocoded",
+			}},
+		}
+	case errors.Is(err, modules.ErrListingNotFound):
+		subject := req.PropertyID
+		if subject == "" {
+			subject = req.Address
+		}
+		if subject == "" {
+			subject = strconv.FormatFloat(req.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(req.Longitude, 'f', -1, 64)
+		}
+		return http.StatusNotFound, models.ErrorResponse{
+			Error: "property not found: " + subject,
+		}
+	}
+	return analysisErrorResponse("failed to fetch CMA", err)
+}
+
+// subjectCandidates builds the disambiguation response for an address or location matching several properties
+func subjectCandidates(err *modules.AmbiguousSubjectError) models.SubjectCandidatesResponse {
+	response := models.SubjectCandidatesResponse{
+		Error:      err.Error() + "; request the CMA again with one of the candidates' property_id",
+		Candidates: make([]models.SubjectCandidate, 0, len(err.Candidates)),
+	}
+	for _, l := range err.Candidates {
+		response.Candidates = append(response.Candidates, models.SubjectCandidate{
+			PropertyID:   l.ID,
+			Address:      modules.ListingAddress(l).String(),
+			Latitude:     l.Latitude,
+			Longitude:    l.Longitude,
+			PropertyType: l.PropertyType,
+			Status:       l.Status,
+		})
+	}
+	return response
+}
@@ -21,7 +21,10 @@ paths:
   /market-trends:
     get:
       summary: Get real estate market trends
-      description: Fetches and analyzes real estate pricing trends for a specific location
+      description: |
+        Fetches and analyzes real estate pricing trends for a specific location. The affordability
+        section has the monthly mortgage payment at the median price, using the configured rate for
+        the loan term, and with household_income its share of income.
       operationId: getMarketTrends
       parameters:
         - name: location
@@ -46,6 +49,30 @@ paths:
             type: string
             default: 6 months
           example: 1 year
+        - name: household_income
+          in: query
+          required: false
+          description: Annual median household income for the payment-to-income ratio and affordability index
+          schema:
+            type: integer
+            minimum: 1
+          example: 150000
+        - name: down_payment_rate
+          in: query
+          required: false
+          description: Down payment as a share of the price; defaults to the configured down payment
+          schema:
+            type: number
+            minimum: 0
+            maximum: 1
+          example: 0.2
+        - name: loan_term_years
+          in: query
+          required: false
+          description: Mortgage term in years; defaults to the configured term and must have a configured rate
+          schema:
+            type: integer
+          example: 30
       responses:
         200:
           description: Market trends data retrieved successfully
@@ -62,6 +89,17 @@ paths:
                     price_per_sqft: 900
                     sales_volume: 120
                     trend: upward
+                    annual_appreciation: 0.045
+                    distressed_share: 0.04
+                    affordability:
+                      interest_rate: 0.0695
+                      rates_as_of: "2024-06-01"
+                      down_payment_rate: 0.2
+                      loan_term_years: 30
+                      monthly_payment: 6355
+                      household_income: 140000
+                      payment_to_income: 0.545
+                      affordability_index: 45.9
                 newYork:
                   summary: Market trend data for New York City
                   value:
@@ -70,14 +108,32 @@ paths:
                     price_per_sqft: 800
                     sales_volume: 200
                     trend: stable
+                    annual_appreciation: 0.012
+                    distressed_share: 0.09
+                    affordability:
+                      interest_rate: 0.0695
+                      rates_as_of: "2024-06-01"
+                      down_payment_rate: 0.2
+                      loan_term_years: 30
+                      monthly_payment: 5031
         400:
-          description: Bad request - missing required parameters
+          description: Bad request - missing or invalid parameters, or a loan term with no configured rate
           content:
             application/json:
               schema:
                 $ref: '#/components/schemas/Error'
-              example:
-                error: location is required
+              examples:
+                missingLocation:
+                  summary: No location
+                  value:
+                    error: location is required
+                unknownTerm:
+                  summary: No rate for the loan term
+                  value:
+                    error: invalid market trends request
+                    fields:
+                      - field: loan_term_years
+                        message: must be one of 15, 30
         500:
           description: Internal server error
           content:
@@ -86,37 +142,125 @@ paths:
                 $ref: '#/components/schemas/Error'
               example:
                 error: failed to fetch market trends
+        504:
+          description: Upstream data source did not respond before the request deadline
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "failed to fetch market trends: upstream data source did not respond before the request deadline"
 
-  /cma:
+  /market-trends/stream:
     get:
-      summary: Get Comparative Market Analysis
+      summary: Stream market trend updates
       description: |
-        Compares recent sales for a selected property to determine its market value.
-        Returns comparable properties and an estimated property value.
-      operationId: getCMA
+        Opens a Server-Sent Events stream of the market trends of the given locations. Each
+        location's current trends are sent first as a market-update event, then again whenever its
+        underlying data changes. Event ids increase; a client reconnecting with the Last-Event-ID
+        header, or the last_event_id parameter, only receives the trends that changed since that
+        event. An idle connection receives a heartbeat comment every interval. A client that reads
+        slowly receives only the latest trends of each location, and a connection whose writes
+        stall is closed.
+      operationId: getMarketStream
       parameters:
-        - name: property_id
+        - name: location
           in: query
           required: true
-          description: Unique property identifier
+          description: Location to subscribe to; repeat the parameter for each location, up to 20
+          style: form
+          explode: true
+          schema:
+            type: array
+            maxItems: 20
+            items:
+              type: string
+          example: ["San Francisco, CA", "94110"]
+        - name: property_type
+          in: query
+          required: false
+          description: Type of property (Single-family, condo, etc.)
           schema:
             type: string
-          example: 12345
-        - name: radius
+          example: Single-family
+        - name: time_range
           in: query
           required: false
-          description: Search radius in miles
+          description: Time range for analysis (e.g., Last 6 months, 1 year, etc.)
+          schema:
+            type: string
+            default: 6 months
+        - name: Last-Event-ID
+          in: header
+          required: false
+          description: Id of the last event received; sent by EventSource clients when they reconnect
           schema:
             type: integer
-            default: 5
-          example: 3
-        - name: property_type
+            format: int64
+        - name: last_event_id
           in: query
           required: false
-          description: Filter by property type
+          description: Id of the last event received, for clients that can't set the Last-Event-ID header
           schema:
-            type: string
-          example: Single-family
+            type: integer
+            format: int64
+      responses:
+        200:
+          description: |
+            Stream of market-update events whose data is a MarketUpdate, and heartbeat comments
+          content:
+            text/event-stream:
+              schema:
+                type: string
+              example: |
+                retry: 5000
+
+                id: 1717243200000001
+                event: market-update
+                data: {"id":1717243200000001,"location":"94110","time_range":"6 months","trends":{"location":"94110","median_price":1450000,"price_per_sqft":1020,"sales_volume":48,"trend":"upward"},"updated_at":"2024-06-01T12:00:00Z"}
+
+                : heartbeat
+        400:
+          description: Bad request - missing locations or an invalid event id
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid market stream request
+                fields:
+                  - field: location
+                    message: is required
+        503:
+          description: The stream has its largest number of connections
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: too many market stream subscribers
+
+  /cma:
+    get:
+      summary: Get Comparative Market Analysis
+      description: |
+        Compares recent sales for a selected property to determine its market value.
+        Returns comparable properties, an estimated property value and the active and pending
+        listings competing with the property.
+        The property is given by property_id, by address, or by latitude and longitude. When an
+        address or location matches more than one property, the candidates are returned with
+        300 Multiple Choices so the request can be repeated with one of their property IDs.
+      operationId: getCMA
+      parameters:
+        - $ref: '#/components/parameters/CMAPropertyID'
+        - $ref: '#/components/parameters/CMAAddress'
+        - $ref: '#/components/parameters/CMALatitude'
+        - $ref: '#/components/parameters/CMALongitude'
+        - $ref: '#/components/parameters/CMARadius'
+        - $ref: '#/components/parameters/CMAPropertyType'
+        - $ref: '#/components/parameters/CMAIncludeIDs'
+        - $ref: '#/components/parameters/CMAExcludeIDs'
+        - $ref: '#/components/parameters/CMASaleConditions'
       responses:
         200:
           description: CMA data retrieved successfully
@@ -143,6 +287,26 @@ paths:
                         sqft: 1380
                         price_per_sqft: 870
                     estimated_value: 1150000
+                    active_listings:
+                      - id: "24680"
+                        address: "77 Hayes St"
+                        status: active
+                        list_price: 1249000
+                        sqft: 1450
+                        price_per_sqft: 861
+                        list_date: "2024-04-18"
+                        days_on_market: 23
+                        distance_miles: 0.46
+                    pending_listings:
+                      - id: "13579"
+                        address: "15 Fell St"
+                        status: pending
+                        list_price: 1150000
+                        sqft: 1380
+                        price_per_sqft: 833
+                        list_date: "2024-04-20"
+                        days_on_market: 8
+                        distance_miles: 0.38
                 condo:
                   summary: CMA for a condominium
                   value:
@@ -161,14 +325,43 @@ paths:
                         sqft: 910
                         price_per_sqft: 835
                     estimated_value: 763333
+        300:
+          description: The address or location matches more than one property
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SubjectCandidates'
+              example:
+                error: "2 properties match the requested address or location; request the CMA again with one of the candidates' property_id"
+                candidates:
+                  - property_id: "U2"
+                    address: "45 Oak Ave Apt 2, San Francisco, CA 94102"
+                    latitude: 37.7755
+                    longitude: -122.421
+                    property_type: Condo
+                    status: active
+                  - property_id: "U3"
+                    address: "45 Oak Ave Apt 3, San Francisco, CA 94102"
+                    latitude: 37.7755
+                    longitude: -122.421
+                    property_type: Condo
+                    status: sold
         400:
-          description: Bad request - missing required parameters
+          description: Bad request - missing or invalid parameters
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: property_id, address, or latitude and longitude are required
+        404:
+          description: Property not found in the listings provider
           content:
             application/json:
               schema:
                 $ref: '#/components/schemas/Error'
               example:
-                error: property_id is required
+                error: "property not found: 12345"
         500:
           description: Internal server error
           content:
@@ -177,114 +370,2725 @@ paths:
                 $ref: '#/components/schemas/Error'
               example:
                 error: failed to fetch CMA
+        504:
+          description: Upstream data source did not respond before the request deadline
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "failed to fetch CMA: upstream data source did not respond before the request deadline"
 
-  /health:
-    get:
-      summary: Health check endpoint
-      description: Returns the current health status of the API
-      operationId: healthCheck
+    post:
+      summary: Get Comparative Market Analysis for a request body
+      description: |
+        Runs the same analysis as GET /cma for a JSON request body. Besides property_id, address
+        or coordinates, the body may describe a subject property that has no listing, such as an
+        off-market home or new construction. Its coordinates are geocoded from the address when
+        omitted. Every invalid field is reported in the error's fields.
+      operationId: postCMA
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/CMARequest'
+            example:
+              subject:
+                address: 100 Valencia St
+                city: San Francisco
+                state: CA
+                zip_code: "94103"
+                property_type: Single-family
+                bedrooms: 3
+                bathrooms: 2
+                sqft: 1400
+                year_built: 2024
+                lot_size: 2500
+                features:
+                  - garage
+                  - roof deck
+              radius: 3
       responses:
         200:
-          description: Service is healthy
+          description: CMA data retrieved successfully
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/CMAResponse'
+        300:
+          description: The address or location matches more than one property
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SubjectCandidates'
+        400:
+          description: Bad request - invalid JSON or invalid fields
           content:
             application/json:
               schema:
-                type: object
-                properties:
-                  status:
-                    type: string
+                $ref: '#/components/schemas/Error'
               example:
-                status: healthy
-
-components:
-  schemas:
-    MarketTrends:
-      type: object
-      required:
-        - location
-        - median_price
-        - price_per_sqft
-        - sales_volume
-        - trend
-      properties:
-        location:
-          type: string
-          description: The location (city, state, or ZIP code)
-          example: San Francisco, CA
-        median_price:
-          type: integer
-          description: The median sale price in the area
-          example: 1200000
-        price_per_sqft:
-          type: integer
-          description: The average price per square foot
-          example: 900
-        sales_volume:
-          type: integer
-          description: The number of sales in the given time period
-          example: 120
-        trend:
-          type: string
-          description: Market trend direction (upward, downward, or stable)
-          enum:
-            - upward
-            - downward
-            - stable
-          example: upward
+                error: invalid CMA request
+                fields:
+                  - field: subject.sqft
+                    message: must be greater than 0
+                  - field: subject.zip_code
+                    message: must be a 5-digit ZIP code or ZIP+4
+        404:
+          description: Property not found in the listings provider
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        500:
+          description: Internal server error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        504:
+          description: Upstream data source did not respond before the request deadline
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
 
-    Comparable:
-      type: object
-      required:
-        - address
-        - sale_price
-        - sqft
-        - price_per_sqft
-      properties:
-        address:
-          type: string
-          description: Property address
-          example: 123 Main St
-        sale_price:
-          type: integer
-          description: Sale price of the property
-          example: 1100000
-        sqft:
-          type: integer
-          description: Square footage of the property
-          example: 1300
-        price_per_sqft:
-          type: integer
-          description: Price per square foot
-          example: 846
+  /cma/batch:
+    post:
+      summary: Get CMAs for a portfolio of properties
+      description: |
+        Computes the CMA of each item concurrently with a bounded pool of workers and returns the
+        result or error of each item, with the sum of the estimated values of the properties valued.
+        Each item is a CMA request in the POST /cma format and is validated the same way. Batches
+        of more than 50 items, or with async set, run in the background: the response is
+        202 Accepted with an id to poll at GET /cma/batch/{id}.
+      operationId: postCMABatch
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/BatchCMARequest'
+            example:
+              items:
+                - property_id: S1
+                - address: 22 Guerrero St, San Francisco, CA 94110
+                - property_id: "99999"
+      responses:
+        200:
+          description: Batch computed within the request
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/BatchCMAResponse'
+              example:
+                status: completed
+                total: 3
+                completed: 3
+                succeeded: 2
+                failed: 1
+                portfolio_value: 2490400
+                items:
+                  - index: 0
+                    status_code: 200
+                    result:
+                      property_id: S1
+                      estimated_value: 1170400
+                      comparables: []
+                  - index: 1
+                    status_code: 200
+                    result:
+                      property_id: C4
+                      estimated_value: 1320000
+                      comparables: []
+                  - index: 2
+                    status_code: 404
+                    error: "property not found: 99999"
+                data_freshness: live
+        202:
+          description: Batch accepted to run in the background
+          headers:
+            Location:
+              description: URL to poll for the batch
+              schema:
+                type: string
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/BatchCMAResponse'
+              example:
+                id: 3f2a9c1e7b4d5a60
+                status: pending
+                total: 120
+                completed: 0
+                succeeded: 0
+                failed: 0
+                portfolio_value: 0
+        400:
+          description: Bad request - invalid JSON or invalid items
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid batch CMA request
+                fields:
+                  - field: items[1].radius
+                    message: must be between 1 and 100
+        503:
+          description: The job queue is full
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: job queue is full, retry later
 
-    CMAResponse:
-      type: object
-      required:
-        - property_id
-        - comparables
-        - estimated_value
-      properties:
-        property_id:
-          type: string
-          description: Unique property identifier
-          example: "12345"
-        comparables:
-          type: array
-          description: List of comparable properties
-          items:
-            $ref: '#/components/schemas/Comparable'
-        estimated_value:
-          type: integer
-          description: Estimated property value based on comparables
-          example: 1150000
+  /cma/batch/{id}:
+    get:
+      summary: Get the progress or results of a background batch CMA
+      description: |
+        Returns the status and progress of a batch submitted to POST /cma/batch, with each item's
+        result once it has completed. Background batches are cma-batch jobs, so they can also be
+        followed and canceled at /jobs/{id}. Results are kept for a day after the batch completes.
+      operationId: getCMABatch
+      parameters:
+        - name: id
+          in: path
+          required: true
+          description: Batch identifier
+          schema:
+            type: string
+      responses:
+        200:
+          description: Batch status
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/BatchCMAResponse'
+              example:
+                id: 3f2a9c1e7b4d5a60
+                status: running
+                total: 120
+                completed: 45
+                succeeded: 0
+                failed: 0
+                portfolio_value: 0
+        404:
+          description: Unknown or expired batch
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "batch not found: 3f2a9c1e7b4d5a60"
 
-    Error:
-      type: object
-      required:
-        - error
-      properties:
-        error:
-          type: string
-          description: Error message
-          example: Internal server error
+  /pricing:
+    get:
+      summary: Get a suggested list price
+      description: |
+        Runs a CMA for a property and recommends a list price. The estimate is grossed up by the
+        comparables' median sale-to-list ratio and blended with the asking prices of active
+        competition. Conservative and aggressive list prices are spread around it by the dispersion
+        of the comparables' price per square foot, each with the days on market expected from the
+        comparables' days on market against how far they were listed above their sale price.
+        Takes the same parameters as GET /cma.
+      operationId: getPricing
+      parameters:
+        - $ref: '#/components/parameters/CMAPropertyID'
+        - $ref: '#/components/parameters/CMAAddress'
+        - $ref: '#/components/parameters/CMALatitude'
+        - $ref: '#/components/parameters/CMALongitude'
+        - $ref: '#/components/parameters/CMARadius'
+        - $ref: '#/components/parameters/CMAPropertyType'
+        - $ref: '#/components/parameters/CMAIncludeIDs'
+        - $ref: '#/components/parameters/CMAExcludeIDs'
+        - $ref: '#/components/parameters/CMASaleConditions'
+      responses:
+        200:
+          description: Pricing strategy retrieved successfully
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/PricingStrategy'
+        300:
+          description: The address or location matches more than one property
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SubjectCandidates'
+        400:
+          description: Bad request - missing or invalid parameters
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        404:
+          description: Property not found in the listings provider
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        422:
+          description: No comparable sales were found to price the property
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: no comparable sales found to price the property
+        500:
+          description: Internal server error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        504:
+          description: Upstream data source did not respond before the request deadline
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /rent-cma:
+    get:
+      summary: Get rental comparables and a rent estimate
+      description: |
+        Finds recently leased rentals comparable to a property, ranked by the same similarity
+        measure as GET /cma and with rent per square foot outliers removed, and estimates the
+        property's monthly rent from the comparables' average rent per square foot. The range is
+        the interquartile range of the comparables' rent per square foot.
+      operationId: getRentCMA
+      parameters:
+        - $ref: '#/components/parameters/CMAPropertyID'
+        - $ref: '#/components/parameters/CMAAddress'
+        - $ref: '#/components/parameters/CMALatitude'
+        - $ref: '#/components/parameters/CMALongitude'
+        - $ref: '#/components/parameters/CMARadius'
+        - $ref: '#/components/parameters/CMAPropertyType'
+      responses:
+        200:
+          description: Rental comparables retrieved successfully
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/RentCMAResponse'
+        300:
+          description: The address or location matches more than one property
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SubjectCandidates'
+        400:
+          description: Bad request - missing or invalid parameters
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        404:
+          description: Property not found in the listings provider
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        500:
+          description: Internal server error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        501:
+          description: No configured listings provider has rental data
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: listings provider has no rental data
+        504:
+          description: Upstream data source did not respond before the request deadline
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /investment-analysis:
+    post:
+      summary: Analyze a property as a rental investment
+      description: |
+        Values a property with a CMA and evaluates buying it as a rental under the given purchase
+        and operating assumptions. Returns the cap rate, gross rent multiplier, cash-on-cash return
+        and monthly cash flow, and a 10-year projection of value, loan balance, equity and cash
+        flow. The purchase price defaults to the CMA's estimated value, the rent to the estimate
+        from rental comparables and the appreciation to the location's market trend over the last
+        3 years, limited to 10% a year either way. Rates are fractions, e.g. 0.065 for 6.5%.
+      operationId: postInvestmentAnalysis
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/InvestmentRequest'
+            example:
+              property_id: S1
+              purchase_price: 1150000
+              down_payment_rate: 0.25
+              interest_rate: 0.065
+              closing_costs: 20000
+              annual_property_tax: 13500
+              annual_insurance: 2400
+              monthly_expenses: 400
+      responses:
+        200:
+          description: Investment analysis computed successfully
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/InvestmentAnalysis'
+        300:
+          description: The address or location matches more than one property
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SubjectCandidates'
+        400:
+          description: Bad request - invalid JSON or invalid fields, or no rent given without rental data
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid investment analysis request
+                fields:
+                  - field: monthly_rent
+                    message: is required when no rental data is available
+        404:
+          description: Property not found in the listings provider
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        422:
+          description: No purchase price was given and no comparable sales were found to estimate one
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        500:
+          description: Internal server error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        504:
+          description: Upstream data source did not respond before the request deadline
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /jobs:
+    post:
+      summary: Run a long-running operation in the background
+      description: |
+        Queues a job and returns it with status queued. Poll GET /jobs/{id} for its progress and
+        fetch GET /jobs/{id}/result once it has succeeded. A cma-batch job takes a BatchCMARequest
+        and produces a BatchCMAResponse; a market-rollup job takes a MarketRollupRequest and
+        produces a MarketRollup. A bounded number of jobs run at a time, and with a job directory
+        configured, queued and running jobs resume after a restart.
+      operationId: postJob
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/JobRequest'
+            example:
+              type: market-rollup
+              params:
+                locations: ["San Francisco, CA", "Oakland, CA", "94110"]
+                time_range: 1 year
+      responses:
+        202:
+          description: Job queued
+          headers:
+            Location:
+              description: URL to poll for the job
+              schema:
+                type: string
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Job'
+              example:
+                id: 3f2a9c1e7b4d5a60
+                type: market-rollup
+                status: queued
+                progress:
+                  completed: 0
+                  total: 3
+                created_at: "2024-06-01T12:00:00Z"
+        400:
+          description: Bad request - invalid JSON, unknown type or invalid parameters
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid job request
+                fields:
+                  - field: params.locations
+                    message: must list at least one location
+        503:
+          description: The job queue is full
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: job queue is full, retry later
+
+  /jobs/{id}:
+    get:
+      summary: Get the status and progress of a job
+      description: |
+        Returns the status of a job submitted to POST /jobs and how much of its work is done.
+        Finished jobs are kept for a day.
+      operationId: getJob
+      parameters:
+        - $ref: '#/components/parameters/JobID'
+      responses:
+        200:
+          description: Job status
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Job'
+              example:
+                id: 3f2a9c1e7b4d5a60
+                type: cma-batch
+                status: running
+                progress:
+                  completed: 45
+                  total: 120
+                created_at: "2024-06-01T12:00:00Z"
+                started_at: "2024-06-01T12:00:01Z"
+        404:
+          description: Unknown or expired job
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "job not found: 3f2a9c1e7b4d5a60"
+    delete:
+      summary: Cancel a job
+      description: |
+        Cancels a queued or running job. A running job stops at its next unit of work; its partial
+        results are discarded.
+      operationId: deleteJob
+      parameters:
+        - $ref: '#/components/parameters/JobID'
+      responses:
+        200:
+          description: Job canceled
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Job'
+        404:
+          description: Unknown or expired job
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        409:
+          description: The job has already finished
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: job has already finished with status succeeded
+
+  /jobs/{id}/result:
+    get:
+      summary: Get the result of a job
+      description: |
+        Returns the result of a job that has succeeded: a BatchCMAResponse for a cma-batch job or
+        a MarketRollup for a market-rollup job. Jobs that are still queued or running, failed, or
+        were canceled have no result.
+      operationId: getJobResult
+      parameters:
+        - $ref: '#/components/parameters/JobID'
+      responses:
+        200:
+          description: Job result
+          content:
+            application/json:
+              schema:
+                oneOf:
+                  - $ref: '#/components/schemas/BatchCMAResponse'
+                  - $ref: '#/components/schemas/MarketRollup'
+        404:
+          description: Unknown or expired job
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        409:
+          description: The job has no result
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "job has no result: it is running"
+
+  /webhooks:
+    post:
+      summary: Register a webhook
+      description: |
+        Registers a URL to receive a signed POST when a background job finishes (job.finished) or
+        when the trend classification of a watched location changes (market.trend_changed). Each
+        delivery has the headers X-CMA-Event, X-CMA-Delivery, X-CMA-Timestamp and X-CMA-Signature,
+        which is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+        webhook's secret. The secret is only returned in this response. Deliveries answered with
+        anything but 2xx are retried with exponential backoff. URLs on loopback, private and
+        link-local addresses are refused unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is set. Webhooks
+        are saved to WEBHOOKS_FILE, when set, and survive a restart; the delivery log does not.
+      operationId: postWebhook
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/WebhookRequest'
+            example:
+              url: https://example.com/hooks/cma
+              events: [job.finished, market.trend_changed]
+              locations: ["San Francisco, CA", "94110"]
+      responses:
+        201:
+          description: Webhook registered
+          headers:
+            Location:
+              description: URL of the webhook
+              schema:
+                type: string
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Webhook'
+              example:
+                id: 9b1e4c2a7f3d8e60
+                url: https://example.com/hooks/cma
+                events: [job.finished, market.trend_changed]
+                locations: ["San Francisco, CA", "94110"]
+                secret: 2c1f0e3a9b8d7c6e5f4a3b2c1d0e9f8a
+                created_at: "2024-06-01T12:00:00Z"
+        400:
+          description: Bad request - invalid JSON or invalid fields
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid webhook request
+                fields:
+                  - field: url
+                    message: must be an absolute http or https URL
+        500:
+          description: The webhooks file could not be written
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+    get:
+      summary: List webhooks
+      description: Returns the registered webhooks, oldest first, without their secrets
+      operationId: getWebhooks
+      responses:
+        200:
+          description: Registered webhooks
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Webhook'
+
+  /webhooks/{id}:
+    get:
+      summary: Get a webhook
+      description: Returns a registered webhook without its secret
+      operationId: getWebhook
+      parameters:
+        - $ref: '#/components/parameters/WebhookID'
+      responses:
+        200:
+          description: Webhook
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Webhook'
+        404:
+          description: Unknown webhook
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "webhook not found: 9b1e4c2a7f3d8e60"
+    delete:
+      summary: Delete a webhook
+      description: Unregisters a webhook; pending retries of its deliveries stop
+      operationId: deleteWebhook
+      parameters:
+        - $ref: '#/components/parameters/WebhookID'
+      responses:
+        204:
+          description: Webhook deleted
+        404:
+          description: Unknown webhook
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        500:
+          description: The webhooks file could not be written
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /webhooks/{id}/deliveries:
+    get:
+      summary: Get the delivery log of a webhook
+      description: |
+        Returns the deliveries of events to a webhook, newest first, with their status, attempts,
+        last response status or error, and payload.
+      operationId: getWebhookDeliveries
+      parameters:
+        - $ref: '#/components/parameters/WebhookID'
+      responses:
+        200:
+          description: Deliveries
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/WebhookDelivery'
+              example:
+                - id: 7a3e9d1c5b2f8e40
+                  webhook_id: 9b1e4c2a7f3d8e60
+                  event_id: 5d2c8a1f9e3b7c40
+                  event: job.finished
+                  status: failed
+                  attempts: 5
+                  status_code: 503
+                  error: receiver responded with status 503
+                  created_at: "2024-06-01T12:03:20Z"
+                  last_attempt_at: "2024-06-01T12:08:41Z"
+                  payload:
+                    id: 5d2c8a1f9e3b7c40
+                    type: job.finished
+                    created_at: "2024-06-01T12:03:20Z"
+                    data:
+                      id: 3f2a9c1e7b4d5a60
+                      type: cma-batch
+                      status: succeeded
+        404:
+          description: Unknown webhook
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /webhooks/{id}/deliveries/{delivery_id}/redeliver:
+    post:
+      summary: Redeliver an event to a webhook
+      description: |
+        Sends the payload of a logged delivery to the webhook again as a new delivery, with the
+        same event id and a fresh signature.
+      operationId: postWebhookRedelivery
+      parameters:
+        - $ref: '#/components/parameters/WebhookID'
+        - name: delivery_id
+          in: path
+          required: true
+          description: Delivery identifier
+          schema:
+            type: string
+      responses:
+        202:
+          description: Redelivery started
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/WebhookDelivery'
+        404:
+          description: Unknown webhook or delivery
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "delivery not found: 7a3e9d1c5b2f8e40"
+
+  /saved-searches:
+    post:
+      summary: Save a search
+      description: |
+        Saves a market-trends or cma query with alert rules. Saved searches are re-evaluated
+        periodically with the same analysis as GET /market-trends and POST /cma; the first
+        evaluation sets the baseline and later ones raise alerts, listed by GET /alerts, when the
+        median price moves by median_price_change since the baseline or the last alert, when active
+        listings grow by inventory_change since the previous evaluation, or when a comparable sale
+        the search hasn't seen before appears.
+      operationId: postSavedSearch
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/SavedSearchRequest'
+            example:
+              name: Mission District single-family
+              type: market-trends
+              market_trends:
+                location: "94110"
+                property_type: Single-family
+              alerts:
+                median_price_change: 0.05
+                inventory_change: 0.25
+      responses:
+        201:
+          description: Search saved
+          headers:
+            Location:
+              description: URL of the saved search
+              schema:
+                type: string
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SavedSearch'
+        400:
+          description: Bad request - invalid JSON or invalid fields
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid saved search request
+                fields:
+                  - field: alerts.new_comparables
+                    message: only applies to cma searches
+        500:
+          description: The saved searches file could not be written
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+    get:
+      summary: List saved searches
+      description: Returns the saved searches, oldest first, with the time and error of their last evaluation
+      operationId: getSavedSearches
+      responses:
+        200:
+          description: Saved searches
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/SavedSearch'
+
+  /saved-searches/{id}:
+    get:
+      summary: Get a saved search
+      description: Returns a saved search with the time and error of its last evaluation
+      operationId: getSavedSearch
+      parameters:
+        - $ref: '#/components/parameters/SavedSearchID'
+      responses:
+        200:
+          description: Saved search
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/SavedSearch'
+        404:
+          description: Unknown saved search
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "saved search not found: 4e7a1c9b2d3f5e80"
+    delete:
+      summary: Delete a saved search
+      description: Stops re-evaluating a saved search; the alerts it raised stay in the feed
+      operationId: deleteSavedSearch
+      parameters:
+        - $ref: '#/components/parameters/SavedSearchID'
+      responses:
+        204:
+          description: Saved search deleted
+        404:
+          description: Unknown saved search
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        500:
+          description: The saved searches file could not be written
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /alerts:
+    get:
+      summary: Get the alerts feed
+      description: Returns the alerts raised by saved searches, newest first
+      operationId: getAlerts
+      parameters:
+        - name: search_id
+          in: query
+          description: Only alerts of this saved search
+          schema:
+            type: string
+          example: 4e7a1c9b2d3f5e80
+        - name: since
+          in: query
+          description: Only alerts raised after this time
+          schema:
+            type: string
+            format: date-time
+          example: "2024-06-01T00:00:00Z"
+        - name: limit
+          in: query
+          description: Largest number of alerts returned
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 500
+            default: 50
+      responses:
+        200:
+          description: Alerts
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Alert'
+              example:
+                - id: 6c2e8a4f1b9d3e70
+                  search_id: 4e7a1c9b2d3f5e80
+                  search_name: Mission District single-family
+                  type: median_price_change
+                  message: Median price rose 6.2% from $1150000 to $1221300
+                  previous_value: 1150000
+                  current_value: 1221300
+                  change: 0.062
+                  created_at: "2024-06-01T13:00:00Z"
+        400:
+          description: Bad request - invalid since or limit
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid alerts request
+                fields:
+                  - field: since
+                    message: must be an RFC 3339 time
+
+  /properties/{id}/valuations:
+    get:
+      summary: Get the valuation history of a property
+      description: |
+        Returns the estimated value of every CMA served for a property without comparable
+        overrides (include_ids, exclude_ids, comparables or non-standard sale_conditions), oldest
+        first, with the change from each valuation to the next and over the whole timeline. Each
+        as_of date adds a retroactive valuation recomputed with only the sales closed by that date;
+        dates with no comparable sales yet are left out.
+      operationId: getPropertyValuations
+      parameters:
+        - name: id
+          in: path
+          required: true
+          description: Unique property identifier
+          schema:
+            type: string
+          example: "12345"
+        - name: as_of
+          in: query
+          description: Dates to recompute the CMA as of; repeat the parameter for each date, up to 24
+          style: form
+          explode: true
+          schema:
+            type: array
+            maxItems: 24
+            items:
+              type: string
+              format: date
+          example: ["2023-06-01", "2024-01-01"]
+        - name: radius
+          in: query
+          description: Search radius in miles of retroactive CMAs
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+            default: 5
+      responses:
+        200:
+          description: Valuation history
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/ValuationHistory'
+              example:
+                property_id: "12345"
+                address: 100 Valencia St, San Francisco, CA 94103
+                valuations:
+                  - as_of: "2024-01-01"
+                    valued_at: "2024-06-01T12:00:00Z"
+                    estimated_value: 1100000
+                    comparables: 5
+                    retroactive: true
+                    change: 0
+                    relative_change: 0
+                  - as_of: "2024-06-01"
+                    valued_at: "2024-06-01T12:00:00Z"
+                    estimated_value: 1150000
+                    comparables: 6
+                    change: 50000
+                    relative_change: 0.045
+                total_change: 50000
+                total_relative_change: 0.045
+        400:
+          description: Bad request - invalid as_of dates or radius
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: invalid valuations request
+                fields:
+                  - field: as_of[0]
+                    message: must not be in the future
+        404:
+          description: No valuations recorded for the property and no as_of dates given, or the property was not found
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: "no valuations recorded for property: 12345"
+        500:
+          description: Internal server error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+        501:
+          description: as_of dates were given but no listings provider is configured
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+              example:
+                error: retroactive valuations need a listings provider
+        504:
+          description: A retroactive CMA timed out
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+
+  /health:
+    get:
+      summary: Health check endpoint
+      description: |
+        Returns the current health status of the API, the circuit breaker state of each upstream host
+        and hit/miss counters for the listings and aggregates caches.
+        The status is "degraded" while any upstream breaker is open or half-open.
+      operationId: healthCheck
+      responses:
+        200:
+          description: Service health
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/HealthStatus'
+              example:
+                status: degraded
+                upstreams:
+                  api.example-mls.com:
+                    state: open
+                    consecutive_failures: 5
+                    last_failure: "2024-06-01T12:00:00Z"
+                    retry_at: "2024-06-01T12:00:30Z"
+                caches:
+                  aggregates:
+                    entries: 12
+                    hits: 340
+                    stale_hits: 4
+                    misses: 12
+                    shared_loads: 3
+                    evictions: 0
+
+components:
+  parameters:
+    CMAPropertyID:
+      name: property_id
+      in: query
+      required: false
+      description: Unique property identifier
+      schema:
+        type: string
+      example: 12345
+
+    CMAAddress:
+      name: address
+      in: query
+      required: false
+      description: Street address with a city or ZIP code, unless latitude and longitude are also given
+      schema:
+        type: string
+      example: 100 Valencia St, San Francisco, CA 94103
+
+    CMALatitude:
+      name: latitude
+      in: query
+      required: false
+      description: Latitude of the property; requires longitude
+      schema:
+        type: number
+      example: 37.7706
+
+    CMALongitude:
+      name: longitude
+      in: query
+      required: false
+      description: Longitude of the property; requires latitude
+      schema:
+        type: number
+      example: -122.4222
+
+    CMARadius:
+      name: radius
+      in: query
+      required: false
+      description: Search radius in miles
+      schema:
+        type: integer
+        minimum: 1
+        maximum: 100
+        default: 5
+      example: 3
+
+    CMAPropertyType:
+      name: property_type
+      in: query
+      required: false
+      description: Filter by property type
+      schema:
+        type: string
+      example: Single-family
+
+    CMAIncludeIDs:
+      name: include_ids
+      in: query
+      required: false
+      description: Comma-separated listing IDs always used as comparables, even outside the radius
+      schema:
+        type: string
+      example: C7,C9
+
+    CMAExcludeIDs:
+      name: exclude_ids
+      in: query
+      required: false
+      description: Comma-separated listing IDs never used as comparables, e.g. non-arm's-length sales
+      schema:
+        type: string
+      example: C2
+
+    CMASaleConditions:
+      name: sale_conditions
+      in: query
+      required: false
+      description: |
+        Comma-separated sale conditions accepted for automatically selected comparables, or all.
+        Nearby sales under other conditions are reported in distressed_sales instead.
+      schema:
+        type: string
+        default: standard
+      example: standard,probate
+
+    JobID:
+      name: id
+      in: path
+      required: true
+      description: Job identifier
+      schema:
+        type: string
+      example: 3f2a9c1e7b4d5a60
+
+    WebhookID:
+      name: id
+      in: path
+      required: true
+      description: Webhook identifier
+      schema:
+        type: string
+      example: 9b1e4c2a7f3d8e60
+
+    SavedSearchID:
+      name: id
+      in: path
+      required: true
+      description: Saved search identifier
+      schema:
+        type: string
+      example: 4e7a1c9b2d3f5e80
+
+  schemas:
+    MarketTrends:
+      type: object
+      required:
+        - location
+        - median_price
+        - price_per_sqft
+        - sales_volume
+        - trend
+      properties:
+        location:
+          type: string
+          description: The location (city, state, or ZIP code)
+          example: San Francisco, CA
+        median_price:
+          type: integer
+          description: The median sale price in the area
+          example: 1200000
+        price_per_sqft:
+          type: integer
+          description: The average price per square foot
+          example: 900
+        sales_volume:
+          type: integer
+          description: The number of sales in the given time period
+          example: 120
+        trend:
+          type: string
+          description: Market trend direction (upward, downward, or stable)
+          enum:
+            - upward
+            - downward
+            - stable
+          example: upward
+        annual_appreciation:
+          type: number
+          description: |
+            Annualized appreciation of the monthly median price per square foot over the period,
+            fitted as exponential growth (0.05 is 5% a year); 0 when the sales span less than 6 months
+          example: 0.045
+        distressed_share:
+          type: number
+          description: Share of sales in the period that were distressed or non-arm's-length (0 to 1)
+          example: 0.04
+        affordability:
+          $ref: '#/components/schemas/Affordability'
+        data_freshness:
+          $ref: '#/components/schemas/DataFreshness'
+
+    MarketUpdate:
+      type: object
+      description: Data of a market-update event on the market stream
+      required:
+        - id
+        - location
+        - time_range
+        - trends
+        - updated_at
+      properties:
+        id:
+          type: integer
+          format: int64
+          description: Event id, increasing with every update; send it back as Last-Event-ID to resume
+          example: 1717243200000001
+        location:
+          type: string
+          example: San Francisco, CA
+        property_type:
+          type: string
+          example: Single-family
+        time_range:
+          type: string
+          example: 6 months
+        trends:
+          $ref: '#/components/schemas/MarketTrends'
+        updated_at:
+          type: string
+          format: date-time
+
+    Affordability:
+      type: object
+      description: Monthly mortgage payment at the median price and its share of household income
+      required:
+        - interest_rate
+        - down_payment_rate
+        - loan_term_years
+        - monthly_payment
+      properties:
+        interest_rate:
+          type: number
+          description: Configured annual interest rate for the loan term
+          example: 0.0695
+        rates_as_of:
+          type: string
+          format: date
+          description: Date the configured rates were published
+          example: "2024-06-01"
+        down_payment_rate:
+          type: number
+          description: Down payment as a share of the price
+          example: 0.2
+        loan_term_years:
+          type: integer
+          example: 30
+        monthly_payment:
+          type: integer
+          description: Monthly principal and interest on the median price
+          example: 6355
+        household_income:
+          type: integer
+          description: Annual household income the ratios are computed for, when given
+          example: 140000
+        payment_to_income:
+          type: number
+          description: Monthly payment over monthly household income
+          example: 0.545
+        affordability_index:
+          type: number
+          description: |
+            Household income as a percentage of the income needed to keep the payment at 25% of
+            income; above 100 the median home is affordable on that income
+          example: 45.9
+
+    Comparable:
+      type: object
+      required:
+        - address
+        - sale_price
+        - sqft
+        - price_per_sqft
+      properties:
+        address:
+          type: string
+          description: Property address
+          example: 123 Main St
+        sale_price:
+          type: integer
+          description: Sale price of the property
+          example: 1100000
+        sqft:
+          type: integer
+          description: Square footage of the property
+          example: 1300
+        price_per_sqft:
+          type: integer
+          description: Price per square foot
+          example: 846
+        id:
+          type: string
+          description: Provider listing identifier
+          example: "98765"
+        bedrooms:
+          type: integer
+          description: Number of bedrooms
+          example: 3
+        bathrooms:
+          type: number
+          description: Number of bathrooms
+          example: 2
+        sale_date:
+          type: string
+          format: date
+          description: Date the sale closed
+          example: 2024-03-15
+        list_price:
+          type: integer
+          description: Final asking price before the sale
+          example: 1095000
+        days_on_market:
+          type: integer
+          description: Days between listing and contract
+          example: 14
+        distance_miles:
+          type: number
+          description: Distance from the subject property in miles
+          example: 0.4
+        selection:
+          type: string
+          description: |
+            How the comparable was chosen:
+            * auto - selected by the analyzer
+            * pinned - listing requested in include_ids
+            * manual - supplied in the request's comparables
+          enum: [auto, pinned, manual]
+          example: auto
+        provenance:
+          type: object
+          description: Name of the provider each field was taken from, keyed by field; set when several providers are merged
+          additionalProperties:
+            type: string
+          example:
+            address: reso
+            sale_price: file
+            sqft: reso
+        sale_conditions:
+          type: array
+          description: Conditions of the sale when it is not a standard sale
+          items:
+            $ref: '#/components/schemas/SaleCondition'
+          example: [short-sale]
+
+    CMARequest:
+      type: object
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier
+          example: "12345"
+        address:
+          type: string
+          description: Street address of a listed property with a city or ZIP code
+          example: 100 Valencia St, San Francisco, CA 94103
+        latitude:
+          type: number
+          description: Latitude of a listed property
+          example: 37.7706
+        longitude:
+          type: number
+          description: Longitude of a listed property
+          example: -122.4222
+        subject:
+          $ref: '#/components/schemas/SubjectProperty'
+        radius:
+          type: integer
+          description: Search radius in miles (1-100)
+          default: 5
+          example: 3
+        property_type:
+          type: string
+          description: Filter by property type
+          example: Single-family
+        include_ids:
+          type: array
+          description: Listing IDs always used as comparables, even outside the radius
+          items:
+            type: string
+          example: ["C7"]
+        exclude_ids:
+          type: array
+          description: Listing IDs never used as comparables; must not overlap include_ids
+          items:
+            type: string
+          example: ["C2"]
+        comparables:
+          type: array
+          description: |
+            Comparable sales supplied by the caller, each with at least an address and sale price.
+            price_per_sqft is calculated; selection and provenance are ignored.
+          items:
+            $ref: '#/components/schemas/Comparable'
+        sale_conditions:
+          type: array
+          description: |
+            Sale conditions accepted for automatically selected comparables; only standard sales
+            when empty, or ["all"] for any condition
+          items:
+            type: string
+            enum: [all, standard, short-sale, foreclosure, reo, auction, probate, related-party]
+          example: ["standard", "probate"]
+        as_of:
+          type: string
+          format: date
+          description: |
+            Past date to value the property as of; only sales closed by then are used, and active
+            and pending listings are left out. Must not be in the future.
+          example: "2024-01-01"
+
+    SubjectProperty:
+      type: object
+      description: A property that has no listing; cannot be combined with property_id, address or coordinates
+      required:
+        - sqft
+      properties:
+        address:
+          type: string
+          description: Street address, required unless latitude and longitude are given
+          example: 100 Valencia St
+        city:
+          type: string
+          example: San Francisco
+        state:
+          type: string
+          description: Two-letter state abbreviation
+          example: CA
+        zip_code:
+          type: string
+          example: "94103"
+        latitude:
+          type: number
+          description: Geocoded from the address when omitted
+          example: 37.7706
+        longitude:
+          type: number
+          description: Geocoded from the address when omitted
+          example: -122.4222
+        property_type:
+          type: string
+          example: Single-family
+        bedrooms:
+          type: integer
+          example: 3
+        bathrooms:
+          type: number
+          example: 2
+        sqft:
+          type: integer
+          description: Square footage, greater than 0
+          example: 1400
+        year_built:
+          type: integer
+          example: 2024
+        lot_size:
+          type: integer
+          description: Lot size in square feet
+          example: 2500
+        features:
+          type: array
+          description: Notable features, compared with those of comparables
+          items:
+            type: string
+          example:
+            - garage
+            - roof deck
+
+    CMAResponse:
+      type: object
+      required:
+        - property_id
+        - comparables
+        - estimated_value
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier
+          example: "12345"
+        address:
+          type: string
+          description: Normalized address of the subject property
+          example: 100 Valencia St, San Francisco, CA 94103
+        comparables:
+          type: array
+          description: List of comparable properties
+          items:
+            $ref: '#/components/schemas/Comparable'
+        estimated_value:
+          type: integer
+          description: Estimated property value based on comparables
+          example: 1150000
+        distressed_sales:
+          type: array
+          description: Nearby sales left out of the analysis by the sale conditions policy, most similar first
+          items:
+            $ref: '#/components/schemas/Comparable'
+        active_listings:
+          type: array
+          description: Active listings near the subject, most similar first
+          items:
+            $ref: '#/components/schemas/CompetingListing'
+        pending_listings:
+          type: array
+          description: Pending listings near the subject, most similar first
+          items:
+            $ref: '#/components/schemas/CompetingListing'
+        as_of:
+          type: string
+          format: date
+          description: Date the property was valued as of, for a retroactive CMA
+          example: "2024-01-01"
+        data_freshness:
+          $ref: '#/components/schemas/DataFreshness'
+
+    PricingStrategy:
+      type: object
+      required:
+        - property_id
+        - estimated_value
+        - recommended_list_price
+        - sale_to_list_ratio
+        - price_points
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier
+          example: S1
+        address:
+          type: string
+          description: Normalized address of the subject property
+          example: 100 Valencia St, San Francisco, CA 94103
+        estimated_value:
+          type: integer
+          description: Estimated market value from the CMA
+          example: 1170400
+        recommended_list_price:
+          type: integer
+          description: Recommended list price, the market strategy's price
+          example: 1160000
+        sale_to_list_ratio:
+          type: number
+          description: Median ratio of sale price to list price of the comparables
+          example: 1.007
+        competition_price_per_sqft:
+          type: integer
+          description: Median asking price per square foot of active competing listings
+          example: 861
+        price_points:
+          type: array
+          description: List prices for the conservative, market and aggressive strategies, lowest first
+          items:
+            $ref: '#/components/schemas/PricePoint'
+        data_freshness:
+          $ref: '#/components/schemas/DataFreshness'
+
+    PricePoint:
+      type: object
+      required:
+        - strategy
+        - list_price
+        - expected_days_on_market
+      properties:
+        strategy:
+          type: string
+          description: |
+            Pricing strategy:
+            * conservative - priced below the recommendation to sell quickly
+            * market - the recommended list price
+            * aggressive - priced above the recommendation, expecting a longer time on market
+          enum: [conservative, market, aggressive]
+          example: market
+        list_price:
+          type: integer
+          description: List price, rounded to $5,000
+          example: 1160000
+        expected_days_on_market:
+          type: integer
+          description: Expected days until the listing goes under contract
+          example: 19
+
+    CompetingListing:
+      type: object
+      description: An active or pending listing competing with the subject property
+      required:
+        - id
+        - address
+        - status
+        - list_price
+        - sqft
+        - price_per_sqft
+        - days_on_market
+      properties:
+        id:
+          type: string
+          description: Provider listing identifier
+          example: "24680"
+        address:
+          type: string
+          description: Normalized property address
+          example: 77 Hayes St
+        status:
+          type: string
+          enum: [active, pending]
+          example: active
+        list_price:
+          type: integer
+          description: Asking price
+          example: 1249000
+        sqft:
+          type: integer
+          example: 1450
+        price_per_sqft:
+          type: integer
+          description: Asking price per square foot
+          example: 861
+        bedrooms:
+          type: integer
+          example: 3
+        bathrooms:
+          type: number
+          example: 2
+        list_date:
+          type: string
+          format: date
+          example: 2024-04-18
+        days_on_market:
+          type: integer
+          example: 23
+        distance_miles:
+          type: number
+          description: Distance from the subject property in miles
+          example: 0.46
+
+    RentCMAResponse:
+      type: object
+      required:
+        - property_id
+        - comparables
+        - estimated_rent
+        - rent_range_low
+        - rent_range_high
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier
+          example: S1
+        address:
+          type: string
+          description: Normalized address of the subject property
+          example: 100 Valencia St, San Francisco, CA 94103
+        comparables:
+          type: array
+          description: Comparable leased rentals, most similar first
+          items:
+            $ref: '#/components/schemas/RentalComparable'
+        estimated_rent:
+          type: integer
+          description: Estimated monthly rent
+          example: 4911
+        rent_range_low:
+          type: integer
+          description: Low end of the likely monthly rent
+          example: 4858
+        rent_range_high:
+          type: integer
+          description: High end of the likely monthly rent
+          example: 4928
+        data_freshness:
+          $ref: '#/components/schemas/DataFreshness'
+
+    RentalComparable:
+      type: object
+      description: A comparable leased rental
+      required:
+        - address
+        - monthly_rent
+        - sqft
+        - rent_per_sqft
+      properties:
+        id:
+          type: string
+          description: Provider listing identifier
+          example: R1
+        address:
+          type: string
+          description: Normalized property address
+          example: 120 Valencia St
+        monthly_rent:
+          type: integer
+          description: Monthly rent of the lease
+          example: 4700
+        sqft:
+          type: integer
+          example: 1350
+        rent_per_sqft:
+          type: number
+          description: Monthly rent per square foot
+          example: 3.48
+        bedrooms:
+          type: integer
+          example: 3
+        bathrooms:
+          type: number
+          example: 2
+        lease_date:
+          type: string
+          format: date
+          description: Date the lease was signed
+          example: 2024-03-01
+        distance_miles:
+          type: number
+          description: Distance from the subject property in miles
+          example: 0.1
+
+    InvestmentRequest:
+      type: object
+      description: |
+        The property, given by property_id, address or coordinates, and the purchase and operating
+        assumptions. Rates are fractions, e.g. 0.065 for 6.5%.
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier
+          example: S1
+        address:
+          type: string
+          description: Street address, with a city or ZIP code
+          example: 100 Valencia St, San Francisco, CA 94103
+        latitude:
+          type: number
+          example: 37.7706
+        longitude:
+          type: number
+          example: -122.4222
+        radius:
+          type: integer
+          description: Search radius for comparables in miles
+          default: 5
+          minimum: 1
+          maximum: 100
+        property_type:
+          type: string
+          description: Property type of the comparables
+          example: Single-family
+        purchase_price:
+          type: integer
+          description: Purchase price; defaults to the CMA's estimated value
+          example: 1150000
+        down_payment_rate:
+          type: number
+          description: Down payment as a share of the purchase price; 1 for a cash purchase
+          default: 0.2
+          minimum: 0
+          maximum: 1
+        interest_rate:
+          type: number
+          description: Annual mortgage interest rate; required unless down_payment_rate is 1
+          example: 0.065
+        loan_term_years:
+          type: integer
+          description: Mortgage term in years
+          default: 30
+          maximum: 50
+        closing_costs:
+          type: integer
+          description: One-time closing costs paid in cash at purchase
+          example: 20000
+        monthly_rent:
+          type: integer
+          description: Monthly rent; defaults to the rent estimated from rental comparables
+          example: 4900
+        annual_property_tax:
+          type: integer
+          example: 13500
+        annual_insurance:
+          type: integer
+          example: 2400
+        monthly_hoa:
+          type: integer
+          description: Monthly HOA dues
+          example: 0
+        monthly_expenses:
+          type: integer
+          description: Other monthly operating expenses, such as maintenance and management
+          example: 400
+        vacancy_rate:
+          type: number
+          description: Share of the year the property is expected to be vacant
+          default: 0.05
+          minimum: 0
+          maximum: 1
+        appreciation_rate:
+          type: number
+          description: Annual appreciation of the property's value; defaults to the location's market trend
+          example: 0.03
+        rent_growth_rate:
+          type: number
+          description: Annual growth of the rent in the projection
+          default: 0
+        expense_growth_rate:
+          type: number
+          description: Annual growth of the operating expenses in the projection
+          default: 0
+
+    InvestmentAnalysis:
+      type: object
+      required:
+        - property_id
+        - purchase_price
+        - monthly_rent
+        - cap_rate
+        - gross_rent_multiplier
+        - cash_on_cash_return
+        - monthly_cash_flow
+        - projection
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier
+          example: S1
+        address:
+          type: string
+          description: Normalized address of the property
+          example: 100 Valencia St, San Francisco, CA 94103
+        estimated_value:
+          type: integer
+          description: Estimated market value from the CMA
+          example: 1170400
+        purchase_price:
+          type: integer
+          example: 1150000
+        monthly_rent:
+          type: integer
+          description: Monthly rent the analysis assumes
+          example: 4911
+        down_payment:
+          type: integer
+          example: 287500
+        loan_amount:
+          type: integer
+          example: 862500
+        monthly_mortgage_payment:
+          type: integer
+          description: Monthly principal and interest
+          example: 5452
+        cash_invested:
+          type: integer
+          description: Down payment and closing costs
+          example: 307500
+        net_operating_income:
+          type: integer
+          description: A year of rent less vacancy and operating expenses
+          example: 35285
+        cap_rate:
+          type: number
+          description: Net operating income over the purchase price
+          example: 0.031
+        gross_rent_multiplier:
+          type: number
+          description: Purchase price over a year of rent
+          example: 19.51
+        cash_on_cash_return:
+          type: number
+          description: First-year cash flow over the cash invested
+          example: -0.098
+        monthly_cash_flow:
+          type: integer
+          description: Cash flow after operating expenses and mortgage payments
+          example: -2512
+        appreciation_rate:
+          type: number
+          description: Annual appreciation the projection assumes
+          example: 0.03
+        projection:
+          type: array
+          description: The first 10 years of ownership
+          items:
+            $ref: '#/components/schemas/InvestmentYear'
+        data_freshness:
+          $ref: '#/components/schemas/DataFreshness'
+
+    InvestmentYear:
+      type: object
+      description: Projected value, debt and cash flow at the end of a year of ownership
+      properties:
+        year:
+          type: integer
+          example: 1
+        property_value:
+          type: integer
+          example: 1184500
+        loan_balance:
+          type: integer
+          example: 852854
+        equity:
+          type: integer
+          example: 331646
+        cash_flow:
+          type: integer
+          description: Cash flow for the year
+          example: -30140
+        cumulative_cash_flow:
+          type: integer
+          description: Cash flow from the purchase to the end of the year
+          example: -30140
+
+    BatchCMARequest:
+      type: object
+      required:
+        - items
+      properties:
+        items:
+          type: array
+          description: CMA requests, one per property
+          minItems: 1
+          maxItems: 1000
+          items:
+            $ref: '#/components/schemas/CMARequest'
+        async:
+          type: boolean
+          description: Run the batch in the background; batches of more than 50 items always do
+          default: false
+
+    BatchCMAResponse:
+      type: object
+      required:
+        - status
+        - total
+        - completed
+        - succeeded
+        - failed
+        - portfolio_value
+      properties:
+        id:
+          type: string
+          description: Batch identifier, for batches run in the background
+          example: 3f2a9c1e7b4d5a60
+        status:
+          type: string
+          enum: [pending, running, completed, failed, canceled]
+          example: completed
+        total:
+          type: integer
+          description: Number of properties in the batch
+          example: 120
+        completed:
+          type: integer
+          description: Number of properties processed so far
+          example: 120
+        succeeded:
+          type: integer
+          description: Number of properties valued
+          example: 118
+        failed:
+          type: integer
+          description: Number of properties that could not be valued
+          example: 2
+        portfolio_value:
+          type: integer
+          description: Sum of the estimated values of the properties valued
+          example: 142350000
+        items:
+          type: array
+          description: Result of each property in request order, once the batch has completed
+          items:
+            $ref: '#/components/schemas/BatchCMAItem'
+        data_freshness:
+          $ref: '#/components/schemas/DataFreshness'
+        error:
+          type: string
+          description: Why a background batch failed
+          example: job did not finish within 30m0s
+
+    BatchCMAItem:
+      type: object
+      required:
+        - index
+        - status_code
+      properties:
+        index:
+          type: integer
+          description: Position of the item in the request
+          example: 0
+        status_code:
+          type: integer
+          description: HTTP status the CMA would have had as a single request
+          example: 200
+        result:
+          $ref: '#/components/schemas/CMAResponse'
+        error:
+          type: string
+          description: Error message, when the CMA failed
+          example: "property not found: 99999"
+        fields:
+          type: array
+          items:
+            $ref: '#/components/schemas/FieldError'
+        candidates:
+          type: array
+          description: Properties matching the item's address or location, when it matched more than one
+          items:
+            $ref: '#/components/schemas/SubjectCandidate'
+
+    JobRequest:
+      type: object
+      required:
+        - type
+        - params
+      properties:
+        type:
+          type: string
+          enum: [cma-batch, market-rollup]
+          example: market-rollup
+        params:
+          description: A BatchCMARequest for cma-batch or a MarketRollupRequest for market-rollup
+          oneOf:
+            - $ref: '#/components/schemas/BatchCMARequest'
+            - $ref: '#/components/schemas/MarketRollupRequest'
+
+    Job:
+      type: object
+      required:
+        - id
+        - type
+        - status
+        - progress
+        - created_at
+      properties:
+        id:
+          type: string
+          example: 3f2a9c1e7b4d5a60
+        type:
+          type: string
+          enum: [cma-batch, market-rollup]
+          example: cma-batch
+        status:
+          type: string
+          enum: [queued, running, succeeded, failed, canceled]
+          example: running
+        progress:
+          $ref: '#/components/schemas/JobProgress'
+        error:
+          type: string
+          description: Why the job failed
+          example: job did not finish within 30m0s
+        created_at:
+          type: string
+          format: date-time
+          example: "2024-06-01T12:00:00Z"
+        started_at:
+          type: string
+          format: date-time
+          example: "2024-06-01T12:00:01Z"
+        finished_at:
+          type: string
+          format: date-time
+          example: "2024-06-01T12:03:20Z"
+
+    JobProgress:
+      type: object
+      required:
+        - completed
+        - total
+      properties:
+        completed:
+          type: integer
+          description: Units of work done, such as properties valued or locations analyzed
+          example: 45
+        total:
+          type: integer
+          description: Units of work in the job, or 0 when unknown
+          example: 120
+
+    MarketRollupRequest:
+      type: object
+      required:
+        - locations
+      properties:
+        locations:
+          type: array
+          description: Cities, states, or ZIP codes
+          minItems: 1
+          maxItems: 500
+          items:
+            type: string
+          example: ["San Francisco, CA", "Oakland, CA"]
+        property_type:
+          type: string
+          example: Single-family
+        time_range:
+          type: string
+          default: 6 months
+          example: 1 year
+
+    MarketRollup:
+      type: object
+      required:
+        - items
+      properties:
+        items:
+          type: array
+          description: Market trends of each location, in request order
+          items:
+            $ref: '#/components/schemas/MarketRollupItem'
+
+    MarketRollupItem:
+      type: object
+      required:
+        - location
+      properties:
+        location:
+          type: string
+          example: Oakland, CA
+        trends:
+          $ref: '#/components/schemas/MarketTrends'
+        error:
+          type: string
+          description: Error message, when the location's market trends could not be computed
+          example: "failed to fetch market trends: upstream data source did not respond before the request deadline"
+
+    WebhookRequest:
+      type: object
+      required:
+        - url
+      properties:
+        url:
+          type: string
+          format: uri
+          description: Absolute http or https URL on a public address
+          example: https://example.com/hooks/cma
+        events:
+          type: array
+          description: |
+            Events to deliver; defaults to job.finished, and market.trend_changed when locations
+            are given
+          items:
+            type: string
+            enum: [job.finished, market.trend_changed]
+        locations:
+          type: array
+          description: Cities, states, or ZIP codes whose market trend is watched; required for market.trend_changed
+          maxItems: 50
+          items:
+            type: string
+          example: ["San Francisco, CA", "94110"]
+        secret:
+          type: string
+          description: Secret the payloads are signed with; generated when omitted
+          minLength: 16
+
+    Webhook:
+      type: object
+      required:
+        - id
+        - url
+        - events
+        - created_at
+      properties:
+        id:
+          type: string
+          example: 9b1e4c2a7f3d8e60
+        url:
+          type: string
+          example: https://example.com/hooks/cma
+        events:
+          type: array
+          items:
+            type: string
+            enum: [job.finished, market.trend_changed]
+        locations:
+          type: array
+          items:
+            type: string
+        secret:
+          type: string
+          description: Secret the payloads are signed with; only returned when the webhook is registered
+        created_at:
+          type: string
+          format: date-time
+
+    WebhookEvent:
+      type: object
+      description: Body POSTed to a webhook
+      required:
+        - id
+        - type
+        - created_at
+        - data
+      properties:
+        id:
+          type: string
+          description: Event identifier, the same across redeliveries
+          example: 5d2c8a1f9e3b7c40
+        type:
+          type: string
+          enum: [job.finished, market.trend_changed]
+        created_at:
+          type: string
+          format: date-time
+        data:
+          oneOf:
+            - $ref: '#/components/schemas/Job'
+            - $ref: '#/components/schemas/TrendChange'
+
+    TrendChange:
+      type: object
+      required:
+        - location
+        - previous_trend
+        - trend
+        - trends
+      properties:
+        location:
+          type: string
+          example: San Francisco, CA
+        previous_trend:
+          type: string
+          enum: [upward, downward, stable]
+          example: stable
+        trend:
+          type: string
+          enum: [upward, downward, stable]
+          example: upward
+        trends:
+          $ref: '#/components/schemas/MarketTrends'
+
+    WebhookDelivery:
+      type: object
+      required:
+        - id
+        - webhook_id
+        - event_id
+        - event
+        - status
+        - attempts
+        - created_at
+        - payload
+      properties:
+        id:
+          type: string
+          example: 7a3e9d1c5b2f8e40
+        webhook_id:
+          type: string
+          example: 9b1e4c2a7f3d8e60
+        event_id:
+          type: string
+          example: 5d2c8a1f9e3b7c40
+        event:
+          type: string
+          enum: [job.finished, market.trend_changed]
+        status:
+          type: string
+          enum: [pending, succeeded, failed]
+          example: succeeded
+        attempts:
+          type: integer
+          example: 1
+        status_code:
+          type: integer
+          description: HTTP status of the last attempt, when the receiver responded
+          example: 200
+        error:
+          type: string
+          description: Error of the last attempt, when it failed
+          example: receiver responded with status 503
+        redelivery_of:
+          type: string
+          description: Delivery this one redelivers
+        created_at:
+          type: string
+          format: date-time
+        last_attempt_at:
+          type: string
+          format: date-time
+        payload:
+          $ref: '#/components/schemas/WebhookEvent'
+
+    AlertRules:
+      type: object
+      description: Conditions that raise an alert when a saved search is re-evaluated
+      properties:
+        median_price_change:
+          type: number
+          description: |
+            Alert when the median sale price moves by at least this share, up or down, since the
+            search was saved or last alerted (market-trends searches; 0.05 is 5%)
+          exclusiveMinimum: 0
+          example: 0.05
+        inventory_change:
+          type: number
+          description: |
+            Alert when the number of active listings grows by at least this share since the
+            previous evaluation (market-trends searches; 0.25 is 25%)
+          exclusiveMinimum: 0
+          example: 0.25
+        new_comparables:
+          type: boolean
+          description: Alert when a sale within the radius of the subject closes after the previous evaluation (cma searches)
+
+    SavedSearchQuery:
+      type: object
+      description: Market trends query, in the GET /market-trends format
+      required:
+        - location
+      properties:
+        location:
+          type: string
+          example: "94110"
+        property_type:
+          type: string
+          example: Single-family
+        time_range:
+          type: string
+          default: 6 months
+
+    SavedSearchRequest:
+      type: object
+      required:
+        - name
+        - type
+        - alerts
+      properties:
+        name:
+          type: string
+          maxLength: 200
+          example: Mission District single-family
+        type:
+          type: string
+          enum: [market-trends, cma]
+        market_trends:
+          $ref: '#/components/schemas/SavedSearchQuery'
+        cma:
+          $ref: '#/components/schemas/CMARequest'
+        alerts:
+          $ref: '#/components/schemas/AlertRules'
+
+    SavedSearch:
+      type: object
+      required:
+        - id
+        - name
+        - type
+        - alerts
+        - created_at
+      properties:
+        id:
+          type: string
+          example: 4e7a1c9b2d3f5e80
+        name:
+          type: string
+          example: Mission District single-family
+        type:
+          type: string
+          enum: [market-trends, cma]
+        market_trends:
+          $ref: '#/components/schemas/SavedSearchQuery'
+        cma:
+          $ref: '#/components/schemas/CMARequest'
+        alerts:
+          $ref: '#/components/schemas/AlertRules'
+        created_at:
+          type: string
+          format: date-time
+        last_evaluated_at:
+          type: string
+          format: date-time
+        last_error:
+          type: string
+          description: Error of the last evaluation, when it failed
+
+    Alert:
+      type: object
+      required:
+        - id
+        - search_id
+        - search_name
+        - type
+        - message
+        - created_at
+      properties:
+        id:
+          type: string
+          example: 6c2e8a4f1b9d3e70
+        search_id:
+          type: string
+          example: 4e7a1c9b2d3f5e80
+        search_name:
+          type: string
+          example: Mission District single-family
+        type:
+          type: string
+          enum: [median_price_change, inventory_jump, new_comparable]
+        message:
+          type: string
+          example: Median price rose 6.2% from $1150000 to $1221300
+        previous_value:
+          type: integer
+          description: Median price or number of active listings before the change
+          example: 1150000
+        current_value:
+          type: integer
+          description: Value after the change, or the sale price of a new comparable
+          example: 1221300
+        change:
+          type: number
+          description: Relative change (0.062 is 6.2%)
+          example: 0.062
+        comparable:
+          $ref: '#/components/schemas/Comparable'
+        created_at:
+          type: string
+          format: date-time
+
+    Valuation:
+      type: object
+      required:
+        - as_of
+        - valued_at
+        - estimated_value
+        - comparables
+        - change
+        - relative_change
+      properties:
+        as_of:
+          type: string
+          format: date
+          description: Date the value is estimated as of
+          example: "2024-06-01"
+        valued_at:
+          type: string
+          format: date-time
+          description: Time the CMA was computed
+        estimated_value:
+          type: integer
+          example: 1150000
+        comparables:
+          type: integer
+          description: Number of comparables the estimate is based on
+          example: 6
+        retroactive:
+          type: boolean
+          description: Whether the CMA was recomputed as of a past date instead of recorded when it was requested
+        change:
+          type: integer
+          description: Change in estimated value since the previous valuation
+          example: 25000
+        relative_change:
+          type: number
+          description: Change relative to the previous valuation (0.022 is 2.2%)
+          example: 0.022
+
+    ValuationHistory:
+      type: object
+      required:
+        - property_id
+        - valuations
+        - total_change
+        - total_relative_change
+      properties:
+        property_id:
+          type: string
+          example: "12345"
+        address:
+          type: string
+          example: 100 Valencia St, San Francisco, CA 94103
+        valuations:
+          type: array
+          description: Valuations ordered by as-of date, then by the time they were computed
+          items:
+            $ref: '#/components/schemas/Valuation'
+        total_change:
+          type: integer
+          description: Change in estimated value from the first valuation to the last
+          example: 75000
+        total_relative_change:
+          type: number
+          description: Change from the first valuation to the last, relative to the first
+          example: 0.068
+
+    SubjectCandidates:
+      type: object
+      required:
+        - error
+        - candidates
+      properties:
+        error:
+          type: string
+          description: Error message
+        candidates:
+          type: array
+          description: Properties matching the requested address or location
+          items:
+            $ref: '#/components/schemas/SubjectCandidate'
+
+    SubjectCandidate:
+      type: object
+      required:
+        - property_id
+        - address
+      properties:
+        property_id:
+          type: string
+          description: Unique property identifier to request the CMA with
+          example: "U2"
+        address:
+          type: string
+          description: Normalized address of the property
+          example: 45 Oak Ave Apt 2, San Francisco, CA 94102
+        latitude:
+          type: number
+          example: 37.7755
+        longitude:
+          type: number
+          example: -122.421
+        property_type:
+          type: string
+          example: Condo
+        status:
+          type: string
+          description: Listing status (sold, active, or pending)
+          example: active
+
+    SaleCondition:
+      type: string
+      description: |
+        Condition of a sale. Every condition other than standard marks a distressed or non-arm's-length sale:
+        * standard - arm's-length sale at market
+        * short-sale - sold for less than the mortgage balance with lender approval
+        * foreclosure - sold during foreclosure proceedings
+        * reo - sold by a lender or agency after foreclosure
+        * auction - sold at auction
+        * probate - sold by an estate
+        * related-party - sold between related parties, e.g. a family transfer
+      enum: [standard, short-sale, foreclosure, reo, auction, probate, related-party]
+      example: short-sale
+
+    DataFreshness:
+      type: string
+      description: |
+        Freshness of the underlying data: live (fetched upstream for this request), cached (fresh cache entry)
+        or stale (expired cache entry served while refreshing or while the upstream is unavailable or out of quota)
+      enum:
+        - live
+        - cached
+        - stale
+      example: live
+
+    HealthStatus:
+      type: object
+      required:
+        - status
+      properties:
+        status:
+          type: string
+          description: Overall status
+          enum:
+            - healthy
+            - degraded
+          example: healthy
+        upstreams:
+          type: object
+          description: Circuit breaker state per upstream host
+          additionalProperties:
+            $ref: '#/components/schemas/BreakerStatus'
+        caches:
+          type: object
+          description: Counters per response cache (listings and aggregates)
+          additionalProperties:
+            $ref: '#/components/schemas/CacheStats'
+        quotas:
+          type: object
+          description: Rate limit and daily quota usage per upstream host
+          additionalProperties:
+            $ref: '#/components/schemas/QuotaStatus'
+
+    QuotaStatus:
+      type: object
+      properties:
+        requests_per_minute:
+          type: integer
+          description: Sustained requests per minute allowed (0 means unlimited)
+          example: 60
+        daily_quota:
+          type: integer
+          description: Requests allowed per UTC day (0 means unlimited)
+          example: 5000
+        requests_today:
+          type: integer
+          description: Requests made so far today
+          example: 1234
+        reset_at:
+          type: string
+          format: date-time
+          description: Time the daily quota resets
+
+    CacheStats:
+      type: object
+      properties:
+        entries:
+          type: integer
+          description: Number of cached entries
+        hits:
+          type: integer
+          description: Requests served from a fresh entry
+        stale_hits:
+          type: integer
+          description: Requests served from a stale entry while it was refreshed in the background
+        misses:
+          type: integer
+          description: Requests that had to wait for an upstream load
+        shared_loads:
+          type: integer
+          description: Loads shared with an identical request already in progress
+        evictions:
+          type: integer
+          description: Entries evicted to stay within the size limit
+
+    BreakerStatus:
+      type: object
+      required:
+        - state
+        - consecutive_failures
+      properties:
+        state:
+          type: string
+          description: Breaker state
+          enum:
+            - closed
+            - open
+            - half-open
+          example: closed
+        consecutive_failures:
+          type: integer
+          description: Number of consecutive failed calls
+          example: 0
+        last_failure:
+          type: string
+          format: date-time
+          description: Time of the most recent failure
+        retry_at:
+          type: string
+          format: date-time
+          description: Time after which a probe request will be allowed, set while open
+
+    Error:
+      type: object
+      required:
+        - error
+      properties:
+        error:
+          type: string
+          description: Error message
+          example: Internal server error
+        fields:
+          type: array
+          description: Problems with individual request fields
+          items:
+            $ref: '#/components/schemas/FieldError'
+
+    FieldError:
+      type: object
+      required:
+        - field
+        - message
+      properties:
+        field:
+          type: string
+          description: Path of the field in the request
+          example: subject.sqft
+        message:
+          type: string
+          description: What is wrong with the field
+          example: must be greater than 0
 `
@@ -1,21 +1,36 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"github.com/user/cma/models"
+	"github.com/user/cma/modules"
 )
 
+// HealthCheck handles the GET /health endpoint
 // @Summary Health check endpoint
-// @Description Returns the current health status of the API
+// @Description Returns the current health status of the API, the circuit breaker state of each upstream and cache counters
 // @ID health-check
 // @Produce json
-// @Success 200 {object} map[string]string
+// @Success 200 {object} models.HealthStatus
 // @Router /health [get]
-func HealthCheck(c echo.Context) error {
-	return c.JSON(200, map[string]string{
-		"status": "healthy",
-	})
+func (h *Handler) HealthCheck(c echo.Context) error {
+	health := models.HealthStatus{
+		Status:    "healthy",
+		Upstreams: h.dataFetcher.BreakerStatuses(),
+		Caches:    h.dataFetcher.CacheStats(),
+		Quotas:    h.dataFetcher.QuotaStatuses(),
+	}
+	for _, upstream := range health.Upstreams {
+		if upstream.State != modules.BreakerClosed {
+			health.Status = "degraded"
+		}
+	}
+
+	return c.JSON(http.StatusOK, health)
 }
 
 // SetupRoutes configures all the routes for the API
@@ -27,10 +42,33 @@ func SetupRoutes(e *echo.Echo, h *Handler) {
 
 	// Routes
 	e.GET("/market-trends", h.GetMarketTrends)
+	e.GET("/market-trends/stream", h.GetMarketStream)
 	e.GET("/cma", h.GetCMA)
+	e.POST("/cma", h.PostCMA)
+	e.POST("/cma/batch", h.PostCMABatch)
+	e.GET("/cma/batch/:id", h.GetCMABatch)
+	e.GET("/pricing", h.GetPricing)
+	e.GET("/rent-cma", h.GetRentCMA)
+	e.POST("/investment-analysis", h.PostInvestmentAnalysis)
+	e.POST("/jobs", h.PostJob)
+	e.GET("/jobs/:id", h.GetJob)
+	e.GET("/jobs/:id/result", h.GetJobResult)
+	e.DELETE("/jobs/:id", h.DeleteJob)
+	e.POST("/webhooks", h.PostWebhook)
+	e.GET("/webhooks", h.GetWebhooks)
+	e.GET("/webhooks/:id", h.GetWebhook)
+	e.DELETE("/webhooks/:id", h.DeleteWebhook)
+	e.GET("/webhooks/:id/deliveries", h.GetWebhookDeliveries)
+	e.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", h.PostWebhookRedelivery)
+	e.POST("/saved-searches", h.PostSavedSearch)
+	e.GET("/saved-searches", h.GetSavedSearches)
+	e.GET("/saved-searches/:id", h.GetSavedSearch)
+	e.DELETE("/saved-searches/:id", h.DeleteSavedSearch)
+	e.GET("/alerts", h.GetAlerts)
+	e.GET("/properties/:id/valuations", h.GetPropertyValuations)
 
 	// Health check endpoint
-	e.GET("/health", HealthCheck)
+	e.GET("/health", h.HealthCheck)
 
 	// Swagger documentation
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
@@ -0,0 +1,494 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/cma/models"
+	"github.com/user/cma/modules"
+)
+
+const (
+	// defaultRadiusMiles is the comparables search radius of a request that doesn't give one
+	defaultRadiusMiles = 5
+
+	// maxRadiusMiles is the largest comparables search radius accepted in a request
+	maxRadiusMiles = 100
+)
+
+var (
+	// zipCodePattern matches a 5-digit ZIP code, optionally with a ZIP+4 extension
+	zipCodePattern = regexp.MustCompile(`^\d{5}(?:-\d{4})?$`)
+
+	// statePattern matches a two-letter state abbreviation
+	statePattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+)
+
+// fieldErrors collects the problems found while validating a request
+type fieldErrors []models.FieldError
+
+// add records a problem with a field, formatting its message
+func (fe *fieldErrors) add(field, format string, args ...interface{}) {
+	*fe = append(*fe, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// decodeJSONBody strictly decodes a JSON request body into target. Type mismatches and unknown
+// fields are reported as field errors; a body that is not JSON at all is reported as an error.
+func decodeJSONBody(body io.Reader, target interface{}) ([]models.FieldError, error) {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(target)
+	if err == nil {
+		return nil, nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []models.FieldError{{
+			Field:   typeErr.Field,
+			Message: "must be " + jsonTypeName(typeErr.Type),
+		}}, nil
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return []models.FieldError{{
+			Field:   strings.Trim(field, `"`),
+			Message: "is not a known field",
+		}}, nil
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("request body is required")
+	}
+	return nil, errors.New("request body must be valid JSON")
+}
+
+// jsonTypeName describes a Go type as the JSON type expected in its place
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array of " + strings.TrimPrefix(strings.TrimPrefix(jsonTypeName(t.Elem()), "a "), "an ") + "s"
+	}
+	return "an object"
+}
+
+// validateCMARequest checks a CMA request body, returning a field error for every problem found
+func validateCMARequest(req models.CMARequest) []models.FieldError {
+	var errs fieldErrors
+
+	hasLocation := req.Latitude != 0 || req.Longitude != 0
+	switch {
+	case req.Subject == nil && req.PropertyID == "" && req.Address == "" && !hasLocation:
+		errs.add("subject", "is required unless property_id, address, or latitude and longitude are given")
+	case req.Subject != nil && (req.PropertyID != "" || req.Address != "" || hasLocation):
+		errs.add("subject", "cannot be combined with property_id, address, latitude or longitude")
+	}
+	validateCoordinates("", req.Latitude, req.Longitude, &errs)
+
+	// An omitted radius (0) is replaced by radiusOrDefault before the CMA runs
+	if req.Radius < 0 || req.Radius > maxRadiusMiles {
+		errs.add("radius", "must be between 1 and %d", maxRadiusMiles)
+	}
+
+	errs = append(errs, validateComparableOverrides(req)...)
+	errs = append(errs, validateSaleConditions("sale_conditions", req.SaleConditions, true)...)
+	errs = append(errs, validateAsOf("as_of", req.AsOf)...)
+
+	if s := req.Subject; s != nil {
+		if strings.TrimSpace(s.Address) == "" && s.Latitude == 0 && s.Longitude == 0 {
+			errs.add("subject.address", "is required unless subject.latitude and subject.longitude are given")
+		}
+		validateCoordinates("subject.", s.Latitude, s.Longitude, &errs)
+
+		if s.State != "" && !statePattern.MatchString(s.State) {
+			errs.add("subject.state", "must be a two-letter state abbreviation")
+		}
+		if s.ZipCode != "" && !zipCodePattern.MatchString(s.ZipCode) {
+			errs.add("subject.zip_code", "must be a 5-digit ZIP code or ZIP+4")
+		}
+		if s.Sqft <= 0 {
+			errs.add("subject.sqft", "must be greater than 0")
+		}
+		if s.Bedrooms < 0 || s.Bedrooms > 50 {
+			errs.add("subject.bedrooms", "must be between 0 and 50")
+		}
+		if s.Bathrooms < 0 || s.Bathrooms > 50 {
+			errs.add("subject.bathrooms", "must be between 0 and 50")
+		}
+		if s.LotSize < 0 {
+			errs.add("subject.lot_size", "must not be negative")
+		}
+		if maxYear := time.Now().Year() + 3; s.YearBuilt != 0 && (s.YearBuilt < 1600 || s.YearBuilt > maxYear) {
+			errs.add("subject.year_built", "must be between 1600 and %d", maxYear)
+		}
+		for i, feature := range s.Features {
+			if strings.TrimSpace(feature) == "" {
+				errs.add(fmt.Sprintf("subject.features[%d]", i), "must not be empty")
+			}
+		}
+	}
+
+	return errs
+}
+
+// parseRadius parses a radius query parameter, returning the default radius when it is empty
+func parseRadius(value string) (int, []models.FieldError) {
+	if value == "" {
+		return defaultRadiusMiles, nil
+	}
+	radius, err := strconv.Atoi(value)
+	if err != nil || radius < 1 || radius > maxRadiusMiles {
+		return 0, []models.FieldError{{Field: "radius", Message: fmt.Sprintf("must be between 1 and %d", maxRadiusMiles)}}
+	}
+	return radius, nil
+}
+
+// radiusOrDefault returns the radius of a request body, or the default radius when it is omitted
+func radiusOrDefault(radius int) int {
+	if radius == 0 {
+		return defaultRadiusMiles
+	}
+	return radius
+}
+
+// validateAsOf checks the as-of date of a retroactive CMA, if one is given
+func validateAsOf(field, asOf string) []models.FieldError {
+	if asOf == "" {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", asOf)
+	if err != nil {
+		return []models.FieldError{{Field: field, Message: "must be a date in YYYY-MM-DD format"}}
+	}
+	if date.After(time.Now()) {
+		return []models.FieldError{{Field: field, Message: "must not be in the future"}}
+	}
+	return nil
+}
+
+// validateInvestmentRequest checks an investment analysis request body, returning a field error
+// for every problem found
+func validateInvestmentRequest(req models.InvestmentRequest) []models.FieldError {
+	var errs fieldErrors
+
+	if req.PropertyID == "" && req.Address == "" && req.Latitude == 0 && req.Longitude == 0 {
+		errs.add("property_id", "is required unless address, or latitude and longitude are given")
+	}
+	validateCoordinates("", req.Latitude, req.Longitude, &errs)
+	if req.Radius < 0 || req.Radius > maxRadiusMiles {
+		errs.add("radius", "must be between 1 and %d", maxRadiusMiles)
+	}
+
+	for _, amount := range []struct {
+		field string
+		value int
+	}{
+		{"purchase_price", req.PurchasePrice},
+		{"closing_costs", req.ClosingCosts},
+		{"monthly_rent", req.MonthlyRent},
+		{"annual_property_tax", req.AnnualPropertyTax},
+		{"annual_insurance", req.AnnualInsurance},
+		{"monthly_hoa", req.MonthlyHOA},
+		{"monthly_expenses", req.MonthlyExpenses},
+	} {
+		if amount.value < 0 {
+			errs.add(amount.field, "must not be negative")
+		}
+	}
+
+	cash := req.DownPaymentRate != nil && *req.DownPaymentRate == 1
+	if rate := req.DownPaymentRate; rate != nil && (*rate < 0 || *rate > 1) {
+		errs.add("down_payment_rate", "must be between 0 and 1")
+	}
+	switch {
+	case req.InterestRate < 0 || req.InterestRate >= 1:
+		errs.add("interest_rate", "must be a fraction between 0 and 1, e.g. 0.065 for 6.5%%")
+	case req.InterestRate == 0 && !cash:
+		errs.add("interest_rate", "is required unless down_payment_rate is 1")
+	}
+	if req.LoanTermYears < 0 || req.LoanTermYears > 50 {
+		errs.add("loan_term_years", "must be between 1 and 50")
+	}
+	if rate := req.VacancyRate; rate != nil && (*rate < 0 || *rate > 1) {
+		errs.add("vacancy_rate", "must be between 0 and 1")
+	}
+	if rate := req.AppreciationRate; rate != nil && (*rate <= -1 || *rate >= 1) {
+		errs.add("appreciation_rate", "must be a fraction between -1 and 1")
+	}
+	if req.RentGrowthRate <= -1 || req.RentGrowthRate >= 1 {
+		errs.add("rent_growth_rate", "must be a fraction between -1 and 1")
+	}
+	if req.ExpenseGrowthRate <= -1 || req.ExpenseGrowthRate >= 1 {
+		errs.add("expense_growth_rate", "must be a fraction between -1 and 1")
+	}
+
+	return errs
+}
+
+// maxBatchItems is the largest number of properties in a batch CMA request
+const maxBatchItems = 1000
+
+// validateBatchCMARequest checks a batch CMA request body, returning a field error for every
+// problem found in the batch or its items
+func validateBatchCMARequest(req models.BatchCMARequest) []models.FieldError {
+	switch {
+	case len(req.Items) == 0:
+		return []models.FieldError{{Field: "items", Message: "must list at least one property"}}
+	case len(req.Items) > maxBatchItems:
+		return []models.FieldError{{Field: "items", Message: fmt.Sprintf("must not list more than %d properties", maxBatchItems)}}
+	}
+
+	var errs []models.FieldError
+	for i, item := range req.Items {
+		for _, err := range validateCMARequest(item) {
+			err.Field = fmt.Sprintf("items[%d].%s", i, err.Field)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// maxRollupLocations is the largest number of locations in a market rollup job
+const maxRollupLocations = 500
+
+// validateMarketRollupRequest checks the parameters of a market rollup job, returning a field
+// error for every problem found
+func validateMarketRollupRequest(req models.MarketRollupRequest) []models.FieldError {
+	switch {
+	case len(req.Locations) == 0:
+		return []models.FieldError{{Field: "locations", Message: "must list at least one location"}}
+	case len(req.Locations) > maxRollupLocations:
+		return []models.FieldError{{Field: "locations", Message: fmt.Sprintf("must not list more than %d locations", maxRollupLocations)}}
+	}
+
+	var errs []models.FieldError
+	for i, location := range req.Locations {
+		if strings.TrimSpace(location) == "" {
+			errs = append(errs, models.FieldError{Field: fmt.Sprintf("locations[%d]", i), Message: "must not be empty"})
+		}
+	}
+	return errs
+}
+
+const (
+	// maxWebhookLocations is the largest number of locations a webhook watches
+	maxWebhookLocations = 50
+
+	// minWebhookSecretLength is the shortest secret accepted for signing webhook payloads
+	minWebhookSecretLength = 16
+)
+
+// validateWebhookRequest checks a webhook registration, returning a field error for every problem found
+func validateWebhookRequest(req models.WebhookRequest) []models.FieldError {
+	var errs fieldErrors
+
+	if req.URL == "" {
+		errs.add("url", "is required")
+	} else if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add("url", "must be an absolute http or https URL")
+	}
+
+	watchesTrends := len(req.Events) == 0 && len(req.Locations) > 0
+	for i, event := range req.Events {
+		switch event {
+		case models.EventJobFinished:
+		case models.EventMarketTrendChange:
+			watchesTrends = true
+		default:
+			errs.add(fmt.Sprintf("events[%d]", i), "must be one of %s, %s", models.EventJobFinished, models.EventMarketTrendChange)
+		}
+	}
+
+	switch {
+	case watchesTrends && len(req.Locations) == 0:
+		errs.add("locations", "must list at least one location for %s", models.EventMarketTrendChange)
+	case len(req.Locations) > maxWebhookLocations:
+		errs.add("locations", "must not list more than %d locations", maxWebhookLocations)
+	}
+	for i, location := range req.Locations {
+		if strings.TrimSpace(location) == "" {
+			errs.add(fmt.Sprintf("locations[%d]", i), "must not be empty")
+		}
+	}
+
+	if req.Secret != "" && len(req.Secret) < minWebhookSecretLength {
+		errs.add("secret", "must be at least %d characters", minWebhookSecretLength)
+	}
+	return errs
+}
+
+// maxRequestedComparables is the largest number of pinned and supplied comparables in a request
+const maxRequestedComparables = 20
+
+// validateComparableOverrides checks the comparables a request includes, excludes or supplies
+func validateComparableOverrides(req models.CMARequest) []models.FieldError {
+	var errs fieldErrors
+
+	if len(req.IncludeIDs)+len(req.Comparables) > maxRequestedComparables {
+		errs.add("include_ids", "must not list more than %d comparables together with comparables", maxRequestedComparables)
+	}
+
+	included := make(map[string]bool)
+	for i, id := range req.IncludeIDs {
+		if strings.TrimSpace(id) == "" {
+			errs.add(fmt.Sprintf("include_ids[%d]", i), "must not be empty")
+		}
+		if id == req.PropertyID && id != "" {
+			errs.add(fmt.Sprintf("include_ids[%d]", i), "must not be the subject property")
+		}
+		included[id] = true
+	}
+	for i, id := range req.ExcludeIDs {
+		if strings.TrimSpace(id) == "" {
+			errs.add(fmt.Sprintf("exclude_ids[%d]", i), "must not be empty")
+		}
+		if included[id] {
+			errs.add(fmt.Sprintf("exclude_ids[%d]", i), "must not also be in include_ids")
+		}
+	}
+
+	for i, comp := range req.Comparables {
+		field := fmt.Sprintf("comparables[%d].", i)
+		if strings.TrimSpace(comp.Address) == "" {
+			errs.add(field+"address", "is required")
+		}
+		if comp.SalePrice <= 0 {
+			errs.add(field+"sale_price", "must be greater than 0")
+		}
+		if comp.Sqft < 0 {
+			errs.add(field+"sqft", "must not be negative")
+		}
+		if comp.Bedrooms < 0 {
+			errs.add(field+"bedrooms", "must not be negative")
+		}
+		if comp.Bathrooms < 0 {
+			errs.add(field+"bathrooms", "must not be negative")
+		}
+		if comp.DistanceMiles < 0 {
+			errs.add(field+"distance_miles", "must not be negative")
+		}
+		if comp.SaleDate != "" {
+			if _, err := time.Parse("2006-01-02", comp.SaleDate); err != nil {
+				errs.add(field+"sale_date", "must be a date in YYYY-MM-DD format")
+			}
+		}
+		errs = append(errs, validateSaleConditions(field+"sale_conditions", comp.SaleConditions, false)...)
+	}
+	return errs
+}
+
+// validateSaleConditions checks that a list names known sale conditions. A sale conditions
+// policy may instead be just "all".
+func validateSaleConditions(field string, conditions []string, policy bool) []models.FieldError {
+	var errs []models.FieldError
+	for i, condition := range conditions {
+		switch {
+		case policy && condition == models.SaleConditionsAll:
+			if len(conditions) > 1 {
+				errs = append(errs, models.FieldError{
+					Field:   fmt.Sprintf("%s[%d]", field, i),
+					Message: "all cannot be combined with other sale conditions",
+				})
+			}
+		case !slices.Contains(modules.SaleConditions, condition):
+			errs = append(errs, models.FieldError{
+				Field:   fmt.Sprintf("%s[%d]", field, i),
+				Message: "must be one of " + strings.Join(modules.SaleConditions, ", "),
+			})
+		}
+	}
+	return errs
+}
+
+// validateCoordinates checks that a latitude and longitude are given together and in range,
+// adding the problems found to errs
+func validateCoordinates(prefix string, latitude, longitude float64, errs *fieldErrors) {
+	if (latitude == 0) != (longitude == 0) {
+		errs.add(prefix+"latitude", "must be given together with %slongitude", prefix)
+	}
+	if latitude < -90 || latitude > 90 {
+		errs.add(prefix+"latitude", "must be between -90 and 90")
+	}
+	if longitude < -180 || longitude > 180 {
+		errs.add(prefix+"longitude", "must be between -180 and 180")
+	}
+}
+
+// maxSavedSearchNameLength is the longest name accepted for a saved search
+const maxSavedSearchNameLength = 200
+
+// validateSavedSearchRequest checks a saved search, returning a field error for every problem found
+func validateSavedSearchRequest(req models.SavedSearchRequest) []models.FieldError {
+	var errs fieldErrors
+
+	switch name := strings.TrimSpace(req.Name); {
+	case name == "":
+		errs.add("name", "is required")
+	case len(name) > maxSavedSearchNameLength:
+		errs.add("name", "must not be longer than %d characters", maxSavedSearchNameLength)
+	}
+
+	rules := req.Alerts
+	if rules.MedianPriceChange < 0 {
+		errs.add("alerts.median_price_change", "must be greater than 0")
+	}
+	if rules.InventoryChange < 0 {
+		errs.add("alerts.inventory_change", "must be greater than 0")
+	}
+
+	switch req.Type {
+	case models.SavedSearchTypeMarketTrends:
+		if req.MarketTrends == nil {
+			errs.add("market_trends", "is required for %s searches", req.Type)
+		} else if strings.TrimSpace(req.MarketTrends.Location) == "" {
+			errs.add("market_trends.location", "is required")
+		}
+		if req.CMA != nil {
+			errs.add("cma", "must not be set for %s searches", req.Type)
+		}
+		if rules.NewComparables {
+			errs.add("alerts.new_comparables", "only applies to %s searches", models.SavedSearchTypeCMA)
+		}
+		if rules.MedianPriceChange == 0 && rules.InventoryChange == 0 {
+			errs.add("alerts", "must set median_price_change or inventory_change")
+		}
+	case models.SavedSearchTypeCMA:
+		if req.CMA == nil {
+			errs.add("cma", "is required for %s searches", req.Type)
+		} else {
+			errs = append(errs, prefixFields("cma.", validateCMARequest(*req.CMA))...)
+		}
+		if req.MarketTrends != nil {
+			errs.add("market_trends", "must not be set for %s searches", req.Type)
+		}
+		if rules.MedianPriceChange != 0 {
+			errs.add("alerts.median_price_change", "only applies to %s searches", models.SavedSearchTypeMarketTrends)
+		}
+		if rules.InventoryChange != 0 {
+			errs.add("alerts.inventory_change", "only applies to %s searches", models.SavedSearchTypeMarketTrends)
+		}
+		if !rules.NewComparables {
+			errs.add("alerts.new_comparables", "must be true for %s searches", req.Type)
+		}
+	default:
+		errs.add("type", "must be one of %s, %s", models.SavedSearchTypeMarketTrends, models.SavedSearchTypeCMA)
+	}
+	return errs
+}
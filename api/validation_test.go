@@ -0,0 +1,264 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user/cma/models"
+)
+
+// fieldNames returns the fields of field errors, in order
+func fieldNames(errs []models.FieldError) []string {
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+func TestParseRadius(t *testing.T) {
+	testCases := []struct {
+		value          string
+		expectedRadius int
+		expectedError  bool
+	}{
+		{"", defaultRadiusMiles, false},
+		{"1", 1, false},
+		{"100", 100, false},
+		{"0", 0, true},
+		{"101", 0, true},
+		{"-1", 0, true},
+		{"five", 0, true},
+	}
+
+	for _, tc := range testCases {
+		radius, errs := parseRadius(tc.value)
+		if radius != tc.expectedRadius || (len(errs) > 0) != tc.expectedError {
+			t.Errorf("Expected radius %d (error %v) for %q but got %d (%v)", tc.expectedRadius, tc.expectedError, tc.value, radius, errs)
+		}
+	}
+}
+
+func TestValidateCMARequest(t *testing.T) {
+	testCases := []struct {
+		name           string
+		req            models.CMARequest
+		expectedFields []string
+	}{
+		{"Property ID", models.CMARequest{PropertyID: "S1", Radius: 5}, nil},
+		{"Default Radius", models.CMARequest{PropertyID: "S1"}, nil},
+		{"Largest Radius", models.CMARequest{PropertyID: "S1", Radius: 100}, nil},
+		{"Radius Too Large", models.CMARequest{PropertyID: "S1", Radius: 101}, []string{"radius"}},
+		{"Negative Radius", models.CMARequest{PropertyID: "S1", Radius: -1}, []string{"radius"}},
+		{"No Subject", models.CMARequest{Radius: 5}, []string{"subject"}},
+		{"Latitude Only", models.CMARequest{Latitude: 37.77}, []string{"latitude"}},
+		{"Latitude Out Of Range", models.CMARequest{Latitude: 90.5, Longitude: -122.4}, []string{"latitude"}},
+		{"Longitude Out Of Range", models.CMARequest{Latitude: 37.77, Longitude: -180.5}, []string{"longitude"}},
+		{
+			"Subject With Property ID",
+			models.CMARequest{PropertyID: "S1", Subject: &models.SubjectProperty{Address: "1 Main St, Oakland, CA", Sqft: 1200}},
+			[]string{"subject"},
+		},
+		{
+			"Invalid Subject",
+			models.CMARequest{Subject: &models.SubjectProperty{State: "California", ZipCode: "9410", Bedrooms: 51}},
+			[]string{"subject.address", "subject.state", "subject.zip_code", "subject.sqft", "subject.bedrooms"},
+		},
+		{
+			"Subject With ZIP+4",
+			models.CMARequest{Subject: &models.SubjectProperty{Address: "1 Main St", ZipCode: "94110-1234", Sqft: 1200}},
+			nil,
+		},
+		{"As Of Date", models.CMARequest{PropertyID: "S1", AsOf: "2024-01-31"}, nil},
+		{"As Of Format", models.CMARequest{PropertyID: "S1", AsOf: "01/31/2024"}, []string{"as_of"}},
+		{"As Of In The Future", models.CMARequest{PropertyID: "S1", AsOf: "2999-01-01"}, []string{"as_of"}},
+		{
+			"Comparable Overrides",
+			models.CMARequest{PropertyID: "S1", IncludeIDs: []string{"S1", "C1"}, ExcludeIDs: []string{"C1", " "}},
+			[]string{"include_ids[0]", "exclude_ids[0]", "exclude_ids[1]"},
+		},
+		{
+			"Supplied Comparable",
+			models.CMARequest{PropertyID: "S1", Comparables: []models.Comparable{{SaleDate: "2024-13-01"}}},
+			[]string{"comparables[0].address", "comparables[0].sale_price", "comparables[0].sale_date"},
+		},
+		{"Sale Conditions", models.CMARequest{PropertyID: "S1", SaleConditions: []string{models.SaleConditionsAll, models.SaleConditionShortSale}}, []string{"sale_conditions[0]"}},
+		{"Unknown Sale Condition", models.CMARequest{PropertyID: "S1", SaleConditions: []string{"distressed"}}, []string{"sale_conditions[0]"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if fields := fieldNames(validateCMARequest(tc.req)); !slices.Equal(fields, tc.expectedFields) {
+				t.Errorf("Expected errors in %v but got %v", tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestValidateInvestmentRequest(t *testing.T) {
+	cash, overLeveraged := 1.0, 1.5
+	testCases := []struct {
+		name           string
+		req            models.InvestmentRequest
+		expectedFields []string
+	}{
+		{"Financed", models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, LoanTermYears: 30}, nil},
+		{"Cash Purchase", models.InvestmentRequest{PropertyID: "S1", DownPaymentRate: &cash}, nil},
+		{"No Property", models.InvestmentRequest{InterestRate: 0.065}, []string{"property_id"}},
+		{"Missing Interest Rate", models.InvestmentRequest{PropertyID: "S1"}, []string{"interest_rate"}},
+		{"Interest Rate As Percentage", models.InvestmentRequest{PropertyID: "S1", InterestRate: 6.5}, []string{"interest_rate"}},
+		{"Down Payment Over 1", models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, DownPaymentRate: &overLeveraged}, []string{"down_payment_rate"}},
+		{"Largest Loan Term", models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, LoanTermYears: 50}, nil},
+		{"Loan Term Too Long", models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, LoanTermYears: 51}, []string{"loan_term_years"}},
+		{"Radius Too Large", models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, Radius: 101}, []string{"radius"}},
+		{
+			"Negative Amounts",
+			models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, PurchasePrice: -1, MonthlyRent: -1},
+			[]string{"purchase_price", "monthly_rent"},
+		},
+		{"Rent Growth", models.InvestmentRequest{PropertyID: "S1", InterestRate: 0.065, RentGrowthRate: -1}, []string{"rent_growth_rate"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if fields := fieldNames(validateInvestmentRequest(tc.req)); !slices.Equal(fields, tc.expectedFields) {
+				t.Errorf("Expected errors in %v but got %v", tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestValidateBatchCMARequest(t *testing.T) {
+	testCases := []struct {
+		name           string
+		items          int
+		invalidItem    bool
+		expectedFields []string
+	}{
+		{"Empty", 0, false, []string{"items"}},
+		{"Largest Batch", maxBatchItems, false, nil},
+		{"Too Many Items", maxBatchItems + 1, false, []string{"items"}},
+		{"Invalid Item", 2, true, []string{"items[1].radius"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := models.BatchCMARequest{Items: make([]models.CMARequest, tc.items)}
+			for i := range req.Items {
+				req.Items[i].PropertyID = "S1"
+			}
+			if tc.invalidItem {
+				req.Items[1].Radius = maxRadiusMiles + 1
+			}
+			if fields := fieldNames(validateBatchCMARequest(req)); !slices.Equal(fields, tc.expectedFields) {
+				t.Errorf("Expected errors in %v but got %v", tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestValidateSavedSearchRequest(t *testing.T) {
+	trends := &models.MarketTrendsRequest{Location: "San Francisco, CA", TimeRange: "6 months"}
+	cma := &models.CMARequest{PropertyID: "S1", Radius: 5}
+	testCases := []struct {
+		name           string
+		req            models.SavedSearchRequest
+		expectedFields []string
+	}{
+		{
+			"Market Trends",
+			models.SavedSearchRequest{Name: "SF", Type: models.SavedSearchTypeMarketTrends, MarketTrends: trends, Alerts: models.AlertRules{InventoryChange: 0.25}},
+			nil,
+		},
+		{
+			"CMA",
+			models.SavedSearchRequest{Name: "S1", Type: models.SavedSearchTypeCMA, CMA: cma, Alerts: models.AlertRules{NewComparables: true}},
+			nil,
+		},
+		{
+			"Missing Name",
+			models.SavedSearchRequest{Name: " ", Type: models.SavedSearchTypeCMA, CMA: cma, Alerts: models.AlertRules{NewComparables: true}},
+			[]string{"name"},
+		},
+		{
+			"Name Too Long",
+			models.SavedSearchRequest{Name: strings.Repeat("a", maxSavedSearchNameLength+1), Type: models.SavedSearchTypeCMA, CMA: cma, Alerts: models.AlertRules{NewComparables: true}},
+			[]string{"name"},
+		},
+		{
+			"Market Trends Without Alerts",
+			models.SavedSearchRequest{Name: "SF", Type: models.SavedSearchTypeMarketTrends, MarketTrends: trends},
+			[]string{"alerts"},
+		},
+		{
+			"Market Trends With CMA Rule",
+			models.SavedSearchRequest{Name: "SF", Type: models.SavedSearchTypeMarketTrends, MarketTrends: trends, Alerts: models.AlertRules{MedianPriceChange: 0.05, NewComparables: true}},
+			[]string{"alerts.new_comparables"},
+		},
+		{
+			"CMA Without New Comparables",
+			models.SavedSearchRequest{Name: "S1", Type: models.SavedSearchTypeCMA, CMA: cma, Alerts: models.AlertRules{InventoryChange: 0.25}},
+			[]string{"alerts.inventory_change", "alerts.new_comparables"},
+		},
+		{
+			"Invalid CMA",
+			models.SavedSearchRequest{Name: "S1", Type: models.SavedSearchTypeCMA, CMA: &models.CMARequest{PropertyID: "S1", Radius: 101}, Alerts: models.AlertRules{NewComparables: true}},
+			[]string{"cma.radius"},
+		},
+		{
+			"Unknown Type",
+			models.SavedSearchRequest{Name: "S1", Type: "listings", Alerts: models.AlertRules{NewComparables: true}},
+			[]string{"type"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if fields := fieldNames(validateSavedSearchRequest(tc.req)); !slices.Equal(fields, tc.expectedFields) {
+				t.Errorf("Expected errors in %v but got %v", tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	testCases := []struct {
+		name            string
+		body            string
+		expectedField   string
+		expectedMessage string
+		expectedError   string
+	}{
+		{name: "Valid", body: `{"property_id":"S1","radius":5}`},
+		{name: "Wrong Type", body: `{"property_id":"S1","radius":"5"}`, expectedField: "radius", expectedMessage: "must be an integer"},
+		{name: "Unknown Field", body: `{"property":"S1"}`, expectedField: "property", expectedMessage: "is not a known field"},
+		{name: "Empty Body", body: ``, expectedError: "request body is required"},
+		{name: "Not JSON", body: `property_id=S1`, expectedError: "request body must be valid JSON"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req models.CMARequest
+			fieldErrs, err := decodeJSONBody(strings.NewReader(tc.body), &req)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error %q but got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if tc.expectedField == "" {
+				if len(fieldErrs) != 0 || req.PropertyID != "S1" {
+					t.Errorf("Expected the request to decode but got %+v with %v", req, fieldErrs)
+				}
+				return
+			}
+			if len(fieldErrs) != 1 || fieldErrs[0].Field != tc.expectedField || fieldErrs[0].Message != tc.expectedMessage {
+				t.Errorf("Expected %s %s but got %v", tc.expectedField, tc.expectedMessage, fieldErrs)
+			}
+		})
+	}
+}
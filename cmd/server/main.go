@@ -1,8 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/user/cma/api"
@@ -29,12 +39,137 @@ func main() {
 	e := echo.New()
 
 	// Initialize dependencies
-	dataFetcher := modules.NewDataFetcher()
+	dataFetcher := modules.NewDataFetcherWithConfig(fetcherConfigFromEnv())
+	if mode := os.Getenv("FIXTURE_MODE"); mode != "" {
+		if err := dataFetcher.UseFixtures(mode, os.Getenv("FIXTURE_DIR")); err != nil {
+			log.Fatalf("Failed to set up fixtures: %v", err)
+		}
+		log.Printf("Upstream fixtures: %s mode in %s", mode, os.Getenv("FIXTURE_DIR"))
+	}
+	if dir := os.Getenv("HTTP_CACHE_DIR"); dir != "" {
+		store, err := modules.NewValidatorStore(dir)
+		if err != nil {
+			log.Fatalf("Failed to open HTTP cache directory: %v", err)
+		}
+		dataFetcher.SetValidatorStore(store)
+	}
+	var providers []modules.NamedProvider
+	if path := os.Getenv("LISTINGS_FILE"); path != "" {
+		columns, err := modules.ParseColumnMapping(os.Getenv("LISTINGS_COLUMNS"))
+		if err != nil {
+			log.Fatalf("Invalid LISTINGS_COLUMNS: %v", err)
+		}
+		fileProvider, err := modules.NewFileProvider(modules.FileProviderConfig{
+			Path:        path,
+			Format:      os.Getenv("LISTINGS_FORMAT"),
+			Columns:     columns,
+			RentalsPath: os.Getenv("RENTALS_FILE"),
+		})
+		if err != nil {
+			log.Fatalf("Failed to load listings file: %v", err)
+		}
+		log.Printf("Loaded %d listings from %s", fileProvider.Len(), path)
+		providers = append(providers, modules.NamedProvider{Name: "file", Provider: fileProvider})
+	}
+	if baseURL := os.Getenv("RESO_BASE_URL"); baseURL != "" {
+		resoProvider := modules.NewRESOProvider(dataFetcher, modules.RESOConfig{
+			BaseURL:      baseURL,
+			TokenURL:     os.Getenv("RESO_TOKEN_URL"),
+			ClientID:     os.Getenv("RESO_CLIENT_ID"),
+			ClientSecret: os.Getenv("RESO_CLIENT_SECRET"),
+			Scope:        os.Getenv("RESO_SCOPE"),
+		})
+		log.Printf("Using RESO Web API provider at %s", baseURL)
+		providers = append(providers, modules.NamedProvider{Name: "reso", Provider: resoProvider})
+	}
+	switch {
+	case len(providers) == 1:
+		dataFetcher.SetProvider(providers[0].Provider)
+	case len(providers) > 1:
+		providers = prioritizeProviders(providers, os.Getenv("PROVIDER_PRIORITY"))
+		dataFetcher.SetProvider(modules.NewMergedProvider(modules.DefaultMergeConfig(), providers...))
+		log.Printf("Merging listings from %d providers", len(providers))
+	}
+	if os.Getenv("CACHE_ENABLED") != "false" {
+		dataFetcher.EnableCache(cacheSettingsFromEnv())
+	}
 	marketAnalyzer := modules.NewMarketAnalyzer(dataFetcher)
+	if path := os.Getenv("MORTGAGE_RATES_FILE"); path != "" {
+		rates, err := modules.LoadMortgageRates(path)
+		if err != nil {
+			log.Fatalf("Failed to load mortgage rates: %v", err)
+		}
+		marketAnalyzer.SetMortgageRates(rates)
+		log.Printf("Mortgage rates as of %s loaded from %s", rates.AsOf, path)
+	}
 	cmaAnalyzer := modules.NewCMAAnalyzer(dataFetcher)
+	cmaAnalyzer.SetSaleWindow(envInt("CMA_SALE_WINDOW_MONTHS", modules.DefaultSaleWindowMonths))
+	if path := os.Getenv("GEOCODER_FILE"); path != "" {
+		geocoder, err := modules.NewFileGeocoder(path)
+		if err != nil {
+			log.Fatalf("Failed to load geocoder file: %v", err)
+		}
+		cmaAnalyzer.SetGeocoder(geocoder)
+	}
 
 	// Create handler
-	handler := api.NewHandler(marketAnalyzer, cmaAnalyzer)
+	handler := api.NewHandler(dataFetcher, marketAnalyzer, cmaAnalyzer)
+	handler.SetRequestTimeout(envDuration("REQUEST_TIMEOUT", 30*time.Second))
+	batchConfig := modules.DefaultBatchConfig()
+	batchConfig.Workers = envInt("BATCH_WORKERS", batchConfig.Workers)
+	handler.SetBatchConfig(batchConfig)
+	jobConfig := modules.DefaultJobConfig()
+	jobConfig.Workers = envInt("JOB_WORKERS", jobConfig.Workers)
+	jobConfig.Timeout = envDuration("JOB_TIMEOUT", jobConfig.Timeout)
+	jobConfig.Retention = envDuration("JOB_RETENTION", jobConfig.Retention)
+	jobConfig.MaxQueued = envInt("JOB_MAX_QUEUED", jobConfig.MaxQueued)
+	jobConfig.Dir = os.Getenv("JOBS_DIR")
+	if err := handler.SetJobConfig(jobConfig); err != nil {
+		log.Fatalf("Failed to open job directory: %v", err)
+	}
+	if jobConfig.Dir != "" {
+		log.Printf("Persisting background jobs in %s", jobConfig.Dir)
+	}
+	webhookConfig := modules.DefaultWebhookConfig()
+	webhookConfig.MaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", webhookConfig.MaxAttempts)
+	webhookConfig.Timeout = envDuration("WEBHOOK_TIMEOUT", webhookConfig.Timeout)
+	webhookConfig.AllowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+	webhookConfig.Path = os.Getenv("WEBHOOKS_FILE")
+	webhooks, err := modules.NewWebhookDispatcher(webhookConfig)
+	if err != nil {
+		log.Fatalf("Failed to open webhooks file: %v", err)
+	}
+	if webhookConfig.Path != "" {
+		log.Printf("Persisting webhooks in %s", webhookConfig.Path)
+	}
+	handler.SetWebhookDispatcher(webhooks)
+	savedSearchesFile := os.Getenv("SAVED_SEARCHES_FILE")
+	savedSearches, err := modules.NewSavedSearchStore(savedSearchesFile)
+	if err != nil {
+		log.Fatalf("Failed to open saved searches file: %v", err)
+	}
+	if savedSearchesFile != "" {
+		log.Printf("Persisting saved searches and alerts in %s", savedSearchesFile)
+	}
+	handler.SetSavedSearchStore(savedSearches)
+	valuationsFile := os.Getenv("VALUATIONS_FILE")
+	valuations, err := modules.NewValuationStore(valuationsFile)
+	if err != nil {
+		log.Fatalf("Failed to open valuations file: %v", err)
+	}
+	if valuationsFile != "" {
+		log.Printf("Recording valuation history in %s", valuationsFile)
+	}
+	handler.SetValuationStore(valuations)
+	streamConfig := modules.DefaultStreamConfig()
+	streamConfig.Interval = envDuration("MARKET_STREAM_INTERVAL", streamConfig.Interval)
+	streamConfig.Heartbeat = envDuration("MARKET_STREAM_HEARTBEAT", streamConfig.Heartbeat)
+	streamConfig.WriteTimeout = envDuration("MARKET_STREAM_WRITE_TIMEOUT", streamConfig.WriteTimeout)
+	streamConfig.MaxSubscribers = envInt("MARKET_STREAM_MAX_CLIENTS", streamConfig.MaxSubscribers)
+	handler.SetStreamConfig(streamConfig)
+
+	// Resumed jobs only run now, once the webhooks they notify are loaded
+	handler.Start()
 
 	// Setup routes
 	api.SetupRoutes(e, handler)
@@ -45,10 +180,120 @@ func main() {
 		port = "8080"
 	}
 
+	// Request contexts derive from baseCtx so in-flight upstream calls can be canceled on shutdown
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	e.Server.BaseContext = func(net.Listener) context.Context { return baseCtx }
+	// Market streams never finish on their own, so end them as soon as shutdown starts
+	e.Server.RegisterOnShutdown(handler.CloseStreams)
+
+	// Watch the trend of the locations webhooks are subscribed to
+	go modules.NewTrendWatcher(marketAnalyzer, webhooks).Run(baseCtx, envDuration("TREND_WATCH_INTERVAL", time.Hour))
+
+	// Re-evaluate saved searches and raise their alerts
+	go modules.NewSearchMonitor(savedSearches, marketAnalyzer, cmaAnalyzer).Run(baseCtx, envDuration("SAVED_SEARCH_INTERVAL", time.Hour))
+
 	// Start server
 	log.Printf("Starting server on port %s...", port)
 	log.Printf("Swagger UI available at http://localhost:%s/swagger/index.html", port)
-	if err := e.Start(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		if err := e.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt, then give in-flight requests a grace period before canceling them
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+	<-stop.Done()
+
+	log.Printf("Shutting down server...")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_GRACE_PERIOD", 10*time.Second))
+	defer cancelShutdown()
+	go func() {
+		<-shutdownCtx.Done()
+		cancelRequests()
+	}()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown did not complete cleanly: %v", err)
+	}
+
+	// Running jobs are canceled and persisted to resume on the next start
+	handler.Close()
+}
+
+// fetcherConfigFromEnv builds the DataFetcher configuration, overriding defaults from the environment
+func fetcherConfigFromEnv() modules.FetcherConfig {
+	cfg := modules.DefaultFetcherConfig()
+	cfg.Timeout = envDuration("FETCH_TIMEOUT", cfg.Timeout)
+	cfg.MaxRetries = envInt("FETCH_MAX_RETRIES", cfg.MaxRetries)
+	cfg.BaseBackoff = envDuration("FETCH_BASE_BACKOFF", cfg.BaseBackoff)
+	cfg.MaxBackoff = envDuration("FETCH_MAX_BACKOFF", cfg.MaxBackoff)
+	cfg.BreakerThreshold = envInt("BREAKER_THRESHOLD", cfg.BreakerThreshold)
+	cfg.BreakerCooldown = envDuration("BREAKER_COOLDOWN", cfg.BreakerCooldown)
+	cfg.MaxBodyBytes = int64(envInt("FETCH_MAX_BODY_BYTES", int(cfg.MaxBodyBytes)))
+
+	var err error
+	if spec := os.Getenv("RATE_LIMIT_DEFAULT"); spec != "" {
+		if cfg.DefaultRateLimit, err = modules.ParseRateLimit(spec); err != nil {
+			log.Fatalf("Invalid RATE_LIMIT_DEFAULT: %v", err)
+		}
 	}
+	if cfg.RateLimits, err = modules.ParseRateLimits(os.Getenv("RATE_LIMITS")); err != nil {
+		log.Fatalf("Invalid RATE_LIMITS: %v", err)
+	}
+	return cfg
+}
+
+// cacheSettingsFromEnv builds the response cache configuration, overriding defaults from the environment
+func cacheSettingsFromEnv() modules.CacheSettings {
+	settings := modules.DefaultCacheSettings()
+	settings.ListingsTTL = envDuration("CACHE_LISTINGS_TTL", settings.ListingsTTL)
+	settings.AggregatesTTL = envDuration("CACHE_AGGREGATES_TTL", settings.AggregatesTTL)
+	settings.StaleTTL = envDuration("CACHE_STALE_TTL", settings.StaleTTL)
+	settings.MaxEntries = envInt("CACHE_MAX_ENTRIES", settings.MaxEntries)
+	return settings
+}
+
+// envInt returns an integer environment variable, or the fallback when unset
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return n
+}
+
+// envDuration returns a duration environment variable (e.g. "10s"), or the fallback when unset
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return d
+}
+
+// prioritizeProviders orders providers by a comma-separated list of provider names, e.g. "reso,file";
+// providers not in the list keep their order after the listed ones
+func prioritizeProviders(providers []modules.NamedProvider, priority string) []modules.NamedProvider {
+	names := strings.Split(priority, ",")
+	rank := make(map[string]int)
+	for i, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			rank[name] = i - len(names)
+		}
+	}
+
+	sort.SliceStable(providers, func(i, j int) bool {
+		return rank[providers[i].Name] < rank[providers[j].Name]
+	})
+	return providers
 }
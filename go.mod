@@ -2,7 +2,12 @@ module github.com/user/cma
 
 go 1.23.4
 
-require github.com/swaggo/echo-swagger v1.4.1
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/labstack/echo/v4 v4.13.3
+	github.com/swaggo/echo-swagger v1.4.1
+	golang.org/x/time v0.8.0
+)
 
 require (
 	github.com/KyleBanks/depth v1.2.1 // indirect
@@ -14,7 +19,6 @@ require (
 	github.com/go-openapi/spec v0.20.4 // indirect
 	github.com/go-openapi/swag v0.19.15 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
-	github.com/labstack/echo/v4 v4.13.3 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -27,7 +31,6 @@ require (
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
-	golang.org/x/time v0.8.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,90 @@
+package models
+
+// Batch statuses
+const (
+	BatchStatusPending   = "pending"
+	BatchStatusRunning   = "running"
+	BatchStatusCompleted = "completed"
+	BatchStatusFailed    = "failed"
+	BatchStatusCanceled  = "canceled"
+)
+
+// BatchCMARequest represents a request for the CMAs of many properties
+// @Description CMA requests for a portfolio of properties
+type BatchCMARequest struct {
+	// CMA requests, one per property, each with property_id, address, latitude and longitude, or subject
+	Items []CMARequest `json:"items"`
+
+	// Run the batch in the background and poll for the result; batches above the synchronous
+	// limit always run in the background
+	// @Example false
+	Async bool `json:"async"`
+}
+
+// BatchCMAItem represents the outcome of one CMA in a batch
+// @Description The CMA or error for one property of a batch
+type BatchCMAItem struct {
+	// Position of the item in the request
+	// @Example 0
+	Index int `json:"index"`
+
+	// HTTP status the CMA would have had as a single request
+	// @Example 200
+	StatusCode int `json:"status_code"`
+
+	// CMA of the property, when it succeeded
+	Result *CMAResponse `json:"result,omitempty"`
+
+	// Error message, when it failed
+	// @Example property not found: 12345
+	Error string `json:"error,omitempty"`
+
+	// Problems with individual fields of the item
+	Fields []FieldError `json:"fields,omitempty"`
+
+	// Properties matching the item's address or location, when it matched more than one
+	Candidates []SubjectCandidate `json:"candidates,omitempty"`
+}
+
+// BatchCMAResponse represents the progress and results of a batch of CMAs
+// @Description Progress, per-property results and portfolio value of a batch of CMAs
+type BatchCMAResponse struct {
+	// Batch identifier to poll, for batches run in the background
+	// @Example 3f2a9c1e7b4d5a60
+	ID string `json:"id,omitempty"`
+
+	// Batch status (pending, running, completed, failed, or canceled)
+	// @Example completed
+	Status string `json:"status"`
+
+	// Number of properties in the batch
+	// @Example 120
+	Total int `json:"total"`
+
+	// Number of properties processed so far
+	// @Example 120
+	Completed int `json:"completed"`
+
+	// Number of properties valued
+	// @Example 118
+	Succeeded int `json:"succeeded"`
+
+	// Number of properties that could not be valued
+	// @Example 2
+	Failed int `json:"failed"`
+
+	// Sum of the estimated values of the properties valued
+	// @Example 142350000
+	PortfolioValue int `json:"portfolio_value"`
+
+	// Result of each property, in request order, once the batch has completed
+	Items []BatchCMAItem `json:"items,omitempty"`
+
+	// Least fresh data behind the results (live, cached, or stale)
+	// @Example live
+	DataFreshness string `json:"data_freshness,omitempty"`
+
+	// Why a background batch failed
+	// @Example job did not finish within 30m0s
+	Error string `json:"error,omitempty"`
+}
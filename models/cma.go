@@ -1,8 +1,19 @@
 package models
 
+// Comparable selection sources
+const (
+	ComparableSelectionAuto   = "auto"
+	ComparableSelectionPinned = "pinned"
+	ComparableSelectionManual = "manual"
+)
+
 // Comparable represents a comparable property for CMA
 // @Description A comparable property for CMA
 type Comparable struct {
+	// Provider listing identifier
+	// @Example 98765
+	ID string `json:"id,omitempty"`
+
 	// Property address
 	// @Example 123 Main St
 	Address string `json:"address"`
@@ -18,6 +29,92 @@ type Comparable struct {
 	// Price per square foot
 	// @Example 846
 	PricePerSqft int `json:"price_per_sqft"`
+
+	// Number of bedrooms
+	// @Example 3
+	Bedrooms int `json:"bedrooms,omitempty"`
+
+	// Number of bathrooms
+	// @Example 2
+	Bathrooms float64 `json:"bathrooms,omitempty"`
+
+	// Date the sale closed (YYYY-MM-DD)
+	// @Example 2024-03-15
+	SaleDate string `json:"sale_date,omitempty"`
+
+	// Final asking price before the sale
+	// @Example 1095000
+	ListPrice int `json:"list_price,omitempty"`
+
+	// Days between listing and contract
+	// @Example 14
+	DaysOnMarket int `json:"days_on_market,omitempty"`
+
+	// Distance from the subject property in miles
+	// @Example 0.4
+	DistanceMiles float64 `json:"distance_miles,omitempty"`
+
+	// Name of the provider each field was taken from, keyed by field; set when several providers are merged
+	// @Example {"address":"mls","sale_price":"county","sqft":"mls"}
+	Provenance map[string]string `json:"provenance,omitempty"`
+
+	// How the comparable was chosen: auto (selected by the analyzer), pinned (listing requested
+	// in include_ids) or manual (supplied in the request)
+	// @Example auto
+	Selection string `json:"selection,omitempty"`
+
+	// Conditions of the sale when it is not a standard sale
+	// @Example ["short-sale"]
+	SaleConditions []string `json:"sale_conditions,omitempty"`
+}
+
+// CompetingListing is an active or pending listing near the subject property, competing with
+// it for buyers
+// @Description An active or pending listing competing with the subject property
+type CompetingListing struct {
+	// Provider listing identifier
+	// @Example 24680
+	ID string `json:"id"`
+
+	// Property address
+	// @Example 22 Guerrero St
+	Address string `json:"address"`
+
+	// Listing status (active or pending)
+	// @Example active
+	Status string `json:"status"`
+
+	// Asking price
+	// @Example 1195000
+	ListPrice int `json:"list_price"`
+
+	// Square footage of the property
+	// @Example 1400
+	Sqft int `json:"sqft"`
+
+	// Asking price per square foot
+	// @Example 853
+	PricePerSqft int `json:"price_per_sqft"`
+
+	// Number of bedrooms
+	// @Example 3
+	Bedrooms int `json:"bedrooms,omitempty"`
+
+	// Number of bathrooms
+	// @Example 2
+	Bathrooms float64 `json:"bathrooms,omitempty"`
+
+	// Date the property was listed (YYYY-MM-DD)
+	// @Example 2024-05-01
+	ListDate string `json:"list_date,omitempty"`
+
+	// Days on market
+	// @Example 10
+	DaysOnMarket int `json:"days_on_market"`
+
+	// Distance from the subject property in miles
+	// @Example 0.3
+	DistanceMiles float64 `json:"distance_miles,omitempty"`
 }
 
 // CMAResponse represents the comparative market analysis response
@@ -27,17 +124,155 @@ type CMAResponse struct {
 	// @Example 12345
 	PropertyID string `json:"property_id"`
 
+	// Normalized address of the subject property
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address,omitempty"`
+
 	// List of comparable properties
 	Comparables []Comparable `json:"comparables"`
 
 	// Estimated property value based on comparables
 	// @Example 1150000
 	EstimatedValue int `json:"estimated_value"`
+
+	// Nearby sales left out of the analysis by the sale conditions policy, most similar first
+	DistressedSales []Comparable `json:"distressed_sales,omitempty"`
+
+	// Active listings near the subject, most similar first
+	ActiveListings []CompetingListing `json:"active_listings,omitempty"`
+
+	// Pending listings near the subject, most similar first
+	PendingListings []CompetingListing `json:"pending_listings,omitempty"`
+
+	// Freshness of the underlying data (live, cached, or stale)
+	// @Example live
+	DataFreshness string `json:"data_freshness,omitempty"`
+
+	// Date the CMA was computed as of, for a retroactive CMA
+	// @Example 2024-01-01
+	AsOf string `json:"as_of,omitempty"`
+}
+
+// SubjectCandidate is a property that matches the address or location given for a CMA
+// @Description A property matching the requested address or location
+type SubjectCandidate struct {
+	// Unique property identifier to request the CMA with
+	// @Example 12345
+	PropertyID string `json:"property_id"`
+
+	// Normalized address of the property
+	// @Example 45 Oak Ave #2, San Francisco, CA 94110
+	Address string `json:"address"`
+
+	// Latitude of the property
+	// @Example 37.7599
+	Latitude float64 `json:"latitude,omitempty"`
+
+	// Longitude of the property
+	// @Example -122.4148
+	Longitude float64 `json:"longitude,omitempty"`
+
+	// Type of property
+	// @Example Condo
+	PropertyType string `json:"property_type,omitempty"`
+
+	// Listing status (sold, active, or pending)
+	// @Example active
+	Status string `json:"status,omitempty"`
+}
+
+// SubjectCandidatesResponse is returned when an address or location matches more than one property
+// @Description Candidate properties for an ambiguous address or location
+type SubjectCandidatesResponse struct {
+	// Error message
+	// @Example address matches more than one property
+	Error string `json:"error"`
+
+	// Properties matching the request
+	Candidates []SubjectCandidate `json:"candidates"`
+}
+
+// SubjectProperty describes a property that is not in the listings provider, such as an
+// off-market home or new construction
+// @Description Attributes of a subject property that has no listing
+type SubjectProperty struct {
+	// Street address, optionally with city, state and ZIP code
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address"`
+
+	// City of the property
+	// @Example San Francisco
+	City string `json:"city"`
+
+	// State of the property
+	// @Example CA
+	State string `json:"state"`
+
+	// ZIP code of the property
+	// @Example 94103
+	ZipCode string `json:"zip_code"`
+
+	// Latitude of the property; geocoded from the address when omitted
+	// @Example 37.7706
+	Latitude float64 `json:"latitude"`
+
+	// Longitude of the property; geocoded from the address when omitted
+	// @Example -122.4222
+	Longitude float64 `json:"longitude"`
+
+	// Type of property (Single-family, condo, etc.)
+	// @Example Single-family
+	PropertyType string `json:"property_type"`
+
+	// Number of bedrooms
+	// @Example 3
+	Bedrooms int `json:"bedrooms"`
+
+	// Number of bathrooms
+	// @Example 2
+	Bathrooms float64 `json:"bathrooms"`
+
+	// Square footage of the property
+	// @Example 1400
+	Sqft int `json:"sqft"`
+
+	// Year the property was built
+	// @Example 2024
+	YearBuilt int `json:"year_built"`
+
+	// Lot size in square feet
+	// @Example 2500
+	LotSize int `json:"lot_size"`
+
+	// Notable features of the property
+	// @Example ["garage", "view"]
+	Features []string `json:"features"`
 }
 
 // CMARequest represents the request parameters for CMA
 type CMARequest struct {
-	PropertyID   string `json:"property_id"`
-	Radius       int    `json:"radius"`
-	PropertyType string `json:"property_type"`
+	PropertyID   string           `json:"property_id"`
+	Address      string           `json:"address"`
+	Latitude     float64          `json:"latitude"`
+	Longitude    float64          `json:"longitude"`
+	Subject      *SubjectProperty `json:"subject"`
+	Radius       int              `json:"radius"`
+	PropertyType string           `json:"property_type"`
+
+	// Listing IDs always used as comparables, wherever they are
+	IncludeIDs []string `json:"include_ids"`
+
+	// Listing IDs never used as comparables
+	ExcludeIDs []string `json:"exclude_ids"`
+
+	// Comparable sales supplied by the caller (POST /cma only)
+	Comparables []Comparable `json:"comparables"`
+
+	// Sale conditions accepted for automatically selected comparables; standard only when empty,
+	// or "all" for any condition
+	SaleConditions []string `json:"sale_conditions"`
+
+	// Date to compute the CMA as of (YYYY-MM-DD): only sales closed by then are comparables, and
+	// active and pending listings are left out. Empty for a current CMA.
+	AsOf string `json:"as_of,omitempty"`
 }
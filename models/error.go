@@ -6,4 +6,19 @@ type ErrorResponse struct {
 	// Error message
 	// @Example location is required
 	Error string `json:"error"`
+
+	// Problems with individual request fields
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes a problem with a single request field
+// @Description A problem with a single request field
+type FieldError struct {
+	// Path of the field in the request
+	// @Example subject.sqft
+	Field string `json:"field"`
+
+	// What is wrong with the field
+	// @Example must be greater than 0
+	Message string `json:"message"`
 }
@@ -0,0 +1,14 @@
+package models
+
+// Data freshness values reported in responses
+const (
+	// DataFreshnessLive means the data was fetched from the upstream provider for this request
+	DataFreshnessLive = "live"
+
+	// DataFreshnessCached means the data was served from a cache entry within its TTL
+	DataFreshnessCached = "cached"
+
+	// DataFreshnessStale means the data was served from an expired cache entry, either while it is
+	// refreshed or because the upstream is unavailable or its quota is exhausted
+	DataFreshnessStale = "stale"
+)
@@ -0,0 +1,86 @@
+package models
+
+// HealthStatus represents the health of the API and its upstream data sources
+// @Description Health of the API and its upstream data sources
+type HealthStatus struct {
+	// Overall status (healthy or degraded)
+	// @Example healthy
+	Status string `json:"status"`
+
+	// Circuit breaker state per upstream host
+	Upstreams map[string]BreakerStatus `json:"upstreams,omitempty"`
+
+	// Hit and miss counters per response cache (listings and aggregates)
+	Caches map[string]CacheStats `json:"caches,omitempty"`
+
+	// Rate limit and daily quota usage per upstream host
+	Quotas map[string]QuotaStatus `json:"quotas,omitempty"`
+}
+
+// BreakerStatus represents the circuit breaker state for an upstream host
+// @Description Circuit breaker state for an upstream host
+type BreakerStatus struct {
+	// Breaker state (closed, open, or half-open)
+	// @Example closed
+	State string `json:"state"`
+
+	// Number of consecutive failed calls
+	// @Example 0
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// Time of the most recent failure (RFC 3339)
+	// @Example 2024-06-01T12:00:00Z
+	LastFailure string `json:"last_failure,omitempty"`
+
+	// Time after which a probe request will be allowed (RFC 3339), set while open
+	// @Example 2024-06-01T12:00:30Z
+	RetryAt string `json:"retry_at,omitempty"`
+}
+
+// CacheStats represents the counters of a response cache
+// @Description Counters of a response cache
+type CacheStats struct {
+	// Number of cached entries
+	// @Example 42
+	Entries int `json:"entries"`
+
+	// Requests served from a fresh entry
+	// @Example 1200
+	Hits uint64 `json:"hits"`
+
+	// Requests served from a stale entry while it was refreshed in the background
+	// @Example 15
+	StaleHits uint64 `json:"stale_hits"`
+
+	// Requests that had to wait for an upstream load
+	// @Example 80
+	Misses uint64 `json:"misses"`
+
+	// Loads that were shared with an identical request already in progress
+	// @Example 12
+	SharedLoads uint64 `json:"shared_loads"`
+
+	// Entries evicted to stay within the size limit
+	// @Example 3
+	Evictions uint64 `json:"evictions"`
+}
+
+// QuotaStatus represents the rate limit and daily quota usage for an upstream host
+// @Description Rate limit and daily quota usage for an upstream host
+type QuotaStatus struct {
+	// Sustained requests per minute allowed (0 means unlimited)
+	// @Example 60
+	RequestsPerMinute int `json:"requests_per_minute"`
+
+	// Requests allowed per UTC day (0 means unlimited)
+	// @Example 5000
+	DailyQuota int `json:"daily_quota"`
+
+	// Requests made so far today
+	// @Example 1234
+	RequestsToday int `json:"requests_today"`
+
+	// Time the daily quota resets (RFC 3339)
+	// @Example 2024-06-02T00:00:00Z
+	ResetAt string `json:"reset_at"`
+}
@@ -0,0 +1,185 @@
+package models
+
+// InvestmentRequest represents the request body for an investment analysis: the property, given
+// as for a CMA, and the purchase and operating assumptions. Rates are fractions, e.g. 0.065 for 6.5%.
+// @Description Property and purchase assumptions for an investment analysis
+type InvestmentRequest struct {
+	// Unique property identifier
+	// @Example 12345
+	PropertyID string `json:"property_id"`
+
+	// Street address, with a city or ZIP code
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address"`
+
+	// Latitude of the property
+	// @Example 37.7706
+	Latitude float64 `json:"latitude"`
+
+	// Longitude of the property
+	// @Example -122.4222
+	Longitude float64 `json:"longitude"`
+
+	// Search radius for comparables in miles
+	// @Example 5
+	Radius int `json:"radius"`
+
+	// Property type of the comparables
+	// @Example Single-family
+	PropertyType string `json:"property_type"`
+
+	// Purchase price; defaults to the CMA's estimated value
+	// @Example 1150000
+	PurchasePrice int `json:"purchase_price"`
+
+	// Down payment as a share of the purchase price (default 0.2; 1 for a cash purchase)
+	// @Example 0.25
+	DownPaymentRate *float64 `json:"down_payment_rate"`
+
+	// Annual mortgage interest rate; required unless the purchase is paid in cash
+	// @Example 0.065
+	InterestRate float64 `json:"interest_rate"`
+
+	// Mortgage term in years (default 30)
+	// @Example 30
+	LoanTermYears int `json:"loan_term_years"`
+
+	// One-time closing costs paid in cash at purchase
+	// @Example 20000
+	ClosingCosts int `json:"closing_costs"`
+
+	// Monthly rent; defaults to the rent estimated from rental comparables
+	// @Example 4900
+	MonthlyRent int `json:"monthly_rent"`
+
+	// Annual property taxes
+	// @Example 13500
+	AnnualPropertyTax int `json:"annual_property_tax"`
+
+	// Annual insurance premium
+	// @Example 2400
+	AnnualInsurance int `json:"annual_insurance"`
+
+	// Monthly HOA dues
+	// @Example 0
+	MonthlyHOA int `json:"monthly_hoa"`
+
+	// Other monthly operating expenses, such as maintenance and management
+	// @Example 400
+	MonthlyExpenses int `json:"monthly_expenses"`
+
+	// Share of the year the property is expected to be vacant (default 0.05)
+	// @Example 0.05
+	VacancyRate *float64 `json:"vacancy_rate"`
+
+	// Annual appreciation of the property's value; defaults to the location's market trend
+	// @Example 0.03
+	AppreciationRate *float64 `json:"appreciation_rate"`
+
+	// Annual growth of the rent in the projection (default 0)
+	// @Example 0.03
+	RentGrowthRate float64 `json:"rent_growth_rate"`
+
+	// Annual growth of the operating expenses in the projection (default 0)
+	// @Example 0.03
+	ExpenseGrowthRate float64 `json:"expense_growth_rate"`
+}
+
+// InvestmentYear is one year of an investment projection
+// @Description Projected value, debt and cash flow at the end of a year of ownership
+type InvestmentYear struct {
+	// Year of ownership, starting at 1
+	// @Example 1
+	Year int `json:"year"`
+
+	// Projected value of the property at the end of the year
+	// @Example 1185000
+	PropertyValue int `json:"property_value"`
+
+	// Mortgage balance at the end of the year
+	// @Example 851000
+	LoanBalance int `json:"loan_balance"`
+
+	// Property value less the mortgage balance
+	// @Example 334000
+	Equity int `json:"equity"`
+
+	// Cash flow for the year after operating expenses and mortgage payments
+	// @Example -21000
+	CashFlow int `json:"cash_flow"`
+
+	// Cash flow from the purchase to the end of the year
+	// @Example -21000
+	CumulativeCashFlow int `json:"cumulative_cash_flow"`
+}
+
+// InvestmentAnalysis represents the returns of buying a property as a rental
+// @Description Rental investment metrics and a 10-year projection for a property
+type InvestmentAnalysis struct {
+	// Unique property identifier
+	// @Example 12345
+	PropertyID string `json:"property_id"`
+
+	// Normalized address of the property
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address,omitempty"`
+
+	// Estimated market value from the CMA
+	// @Example 1170400
+	EstimatedValue int `json:"estimated_value"`
+
+	// Purchase price the analysis assumes
+	// @Example 1150000
+	PurchasePrice int `json:"purchase_price"`
+
+	// Monthly rent the analysis assumes
+	// @Example 4900
+	MonthlyRent int `json:"monthly_rent"`
+
+	// Down payment
+	// @Example 287500
+	DownPayment int `json:"down_payment"`
+
+	// Mortgage amount
+	// @Example 862500
+	LoanAmount int `json:"loan_amount"`
+
+	// Monthly mortgage payment of principal and interest
+	// @Example 5452
+	MonthlyMortgagePayment int `json:"monthly_mortgage_payment"`
+
+	// Cash invested at purchase: the down payment and closing costs
+	// @Example 307500
+	CashInvested int `json:"cash_invested"`
+
+	// Net operating income: rent less vacancy and operating expenses, for a year
+	// @Example 35760
+	NetOperatingIncome int `json:"net_operating_income"`
+
+	// Capitalization rate: net operating income over the purchase price
+	// @Example 0.031
+	CapRate float64 `json:"cap_rate"`
+
+	// Gross rent multiplier: the purchase price over a year of rent
+	// @Example 19.56
+	GrossRentMultiplier float64 `json:"gross_rent_multiplier"`
+
+	// Cash-on-cash return: the first year's cash flow over the cash invested
+	// @Example -0.096
+	CashOnCashReturn float64 `json:"cash_on_cash_return"`
+
+	// Monthly cash flow after operating expenses and mortgage payments
+	// @Example -2472
+	MonthlyCashFlow int `json:"monthly_cash_flow"`
+
+	// Annual appreciation the projection assumes
+	// @Example 0.03
+	AppreciationRate float64 `json:"appreciation_rate"`
+
+	// Projection for each of the first 10 years of ownership
+	Projection []InvestmentYear `json:"projection"`
+
+	// Freshness of the underlying data (live, cached, or stale)
+	// @Example live
+	DataFreshness string `json:"data_freshness,omitempty"`
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCanceled  = "canceled"
+)
+
+// Job types
+const (
+	JobTypeCMABatch     = "cma-batch"
+	JobTypeMarketRollup = "market-rollup"
+)
+
+// JobRequest represents a request to run a long-running operation in the background
+// @Description A long-running operation to run in the background
+type JobRequest struct {
+	// Job type (cma-batch or market-rollup)
+	// @Example market-rollup
+	Type string `json:"type"`
+
+	// Parameters of the job: a BatchCMARequest for cma-batch, a MarketRollupRequest for market-rollup
+	Params json.RawMessage `json:"params" swaggertype:"object"`
+}
+
+// JobProgress represents how much of a job is done
+// @Description Progress of a job
+type JobProgress struct {
+	// Number of units of work done, such as properties valued
+	// @Example 45
+	Completed int `json:"completed"`
+
+	// Number of units of work in the job, or 0 when unknown
+	// @Example 120
+	Total int `json:"total"`
+}
+
+// Job represents the state of a background job
+// @Description State and progress of a background job
+type Job struct {
+	// Job identifier
+	// @Example 3f2a9c1e7b4d5a60
+	ID string `json:"id"`
+
+	// Job type (cma-batch or market-rollup)
+	// @Example cma-batch
+	Type string `json:"type"`
+
+	// Job status (queued, running, succeeded, failed, or canceled)
+	// @Example running
+	Status string `json:"status"`
+
+	// Progress of the job
+	Progress JobProgress `json:"progress"`
+
+	// Why the job failed
+	// @Example job did not finish within 30m0s
+	Error string `json:"error,omitempty"`
+
+	// Time the job was submitted
+	// @Example 2024-06-01T12:00:00Z
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time the job started running
+	// @Example 2024-06-01T12:00:01Z
+	StartedAt *time.Time `json:"started_at,omitempty"`
+
+	// Time the job finished
+	// @Example 2024-06-01T12:03:20Z
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// MarketRollupRequest represents the parameters of a market rollup job: market trends for many
+// locations over the same property type and time range
+// @Description Locations to compute market trends for
+type MarketRollupRequest struct {
+	// Cities, states, or ZIP codes
+	// @Example ["San Francisco, CA", "Oakland, CA"]
+	Locations []string `json:"locations"`
+
+	// Type of property (Single-family, condo, etc.)
+	// @Example Single-family
+	PropertyType string `json:"property_type"`
+
+	// Time range for analysis (e.g., Last 6 months, 1 year, etc.)
+	// @Example 1 year
+	TimeRange string `json:"time_range"`
+}
+
+// MarketRollupItem represents the market trends of one location of a rollup
+// @Description Market trends or error for one location of a rollup
+type MarketRollupItem struct {
+	// Location (city, state, or ZIP code)
+	// @Example Oakland, CA
+	Location string `json:"location"`
+
+	// Market trends for the location, when they could be computed
+	Trends *MarketTrends `json:"trends,omitempty"`
+
+	// Error message, when they could not
+	// @Example failed to fetch market trends: upstream data source did not respond before the request deadline
+	Error string `json:"error,omitempty"`
+}
+
+// MarketRollup represents the result of a market rollup job
+// @Description Market trends for many locations
+type MarketRollup struct {
+	// Market trends of each location, in request order
+	Items []MarketRollupItem `json:"items"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import "time"
+
+// Listing status values
+const (
+	ListingStatusSold    = "sold"
+	ListingStatusActive  = "active"
+	ListingStatusPending = "pending"
+)
+
+// Sale condition values. Every condition other than standard marks a distressed or non-arm's-length
+// sale whose price may not reflect market value.
+const (
+	SaleConditionStandard     = "standard"
+	SaleConditionShortSale    = "short-sale"
+	SaleConditionForeclosure  = "foreclosure"
+	SaleConditionREO          = "reo"
+	SaleConditionAuction      = "auction"
+	SaleConditionProbate      = "probate"
+	SaleConditionRelatedParty = "related-party"
+)
+
+// SaleConditionsAll is the sale conditions policy that accepts sales under any condition
+const SaleConditionsAll = "all"
+
+// Listing represents a single sold or active property listing from a data provider
+// @Description A property listing from a data provider
+type Listing struct {
+	// Provider-specific listing identifier
+	// @Example 12345
+	ID string `json:"id"`
+
+	// Street address of the property
+	// @Example 123 Main St
+	Address string `json:"address"`
+
+	// City of the property
+	// @Example San Francisco
+	City string `json:"city"`
+
+	// State of the property
+	// @Example CA
+	State string `json:"state"`
+
+	// ZIP code of the property
+	// @Example 94110
+	ZipCode string `json:"zip_code"`
+
+	// Latitude of the property
+	// @Example 37.7599
+	Latitude float64 `json:"latitude"`
+
+	// Longitude of the property
+	// @Example -122.4148
+	Longitude float64 `json:"longitude"`
+
+	// Type of property (Single-family, condo, etc.)
+	// @Example Single-family
+	PropertyType string `json:"property_type"`
+
+	// Listing status (sold, active, or pending)
+	// @Example sold
+	Status string `json:"status"`
+
+	// Number of bedrooms
+	// @Example 3
+	Bedrooms int `json:"bedrooms"`
+
+	// Number of bathrooms
+	// @Example 2
+	Bathrooms float64 `json:"bathrooms"`
+
+	// Square footage of the property
+	// @Example 1300
+	Sqft int `json:"sqft"`
+
+	// Lot size in square feet
+	// @Example 2500
+	LotSize int `json:"lot_size"`
+
+	// Year the property was built
+	// @Example 1925
+	YearBuilt int `json:"year_built"`
+
+	// Asking price
+	// @Example 1095000
+	ListPrice int `json:"list_price"`
+
+	// Closed sale price (sold listings only)
+	// @Example 1100000
+	SalePrice int `json:"sale_price"`
+
+	// Date the property was listed
+	ListDate time.Time `json:"list_date"`
+
+	// Date the sale closed (sold listings only)
+	SaleDate time.Time `json:"sale_date"`
+
+	// Days between listing and contract
+	// @Example 21
+	DaysOnMarket int `json:"days_on_market"`
+
+	// Notable features of the property
+	// @Example ["garage", "view"]
+	Features []string `json:"features,omitempty"`
+
+	// Conditions of the sale; empty when the provider doesn't report them
+	// @Example ["short-sale"]
+	SaleConditions []string `json:"sale_conditions,omitempty"`
+
+	// Name of the provider each field was taken from, keyed by field (merged listings only)
+	Provenance map[string]string `json:"provenance,omitempty"`
+}
+
+// ListingQuery represents the search criteria for listings from a data provider
+type ListingQuery struct {
+	Location     string    `json:"location"`
+	PropertyType string    `json:"property_type"`
+	Statuses     []string  `json:"statuses"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	RadiusMiles  float64   `json:"radius_miles"`
+	SoldAfter    time.Time `json:"sold_after"`
+	SoldBefore   time.Time `json:"sold_before"`
+	Limit        int       `json:"limit"`
+}
@@ -22,6 +22,58 @@ type MarketTrends struct {
 	// Market trend direction (upward, downward, or stable)
 	// @Example upward
 	Trend string `json:"trend"`
+
+	// Annualized appreciation of the monthly median price per square foot (0.05 is 5% a year)
+	// @Example 0.045
+	AnnualAppreciation float64 `json:"annual_appreciation"`
+
+	// Share of sales in the period that were distressed or non-arm's-length (0 to 1)
+	// @Example 0.04
+	DistressedShare float64 `json:"distressed_share"`
+
+	// Cost of buying at the median price with a mortgage
+	Affordability Affordability `json:"affordability"`
+
+	// Freshness of the underlying data (live, cached, or stale)
+	// @Example live
+	DataFreshness string `json:"data_freshness,omitempty"`
+}
+
+// Affordability represents the cost of buying at the median price with a mortgage
+// @Description Mortgage payment at the median price and its share of household income
+type Affordability struct {
+	// Annual mortgage interest rate (0.07 is 7%)
+	// @Example 0.0695
+	InterestRate float64 `json:"interest_rate"`
+
+	// Date the interest rate was published
+	// @Example 2024-06-01
+	RatesAsOf string `json:"rates_as_of,omitempty"`
+
+	// Down payment as a share of the price
+	// @Example 0.2
+	DownPaymentRate float64 `json:"down_payment_rate"`
+
+	// Mortgage term in years
+	// @Example 30
+	LoanTermYears int `json:"loan_term_years"`
+
+	// Monthly principal and interest on the median price
+	// @Example 6355
+	MonthlyPayment int `json:"monthly_payment"`
+
+	// Annual median household income the ratios are computed for
+	// @Example 140000
+	HouseholdIncome int `json:"household_income,omitempty"`
+
+	// Monthly payment over monthly household income
+	// @Example 0.545
+	PaymentToIncome float64 `json:"payment_to_income,omitempty"`
+
+	// Household income over the income needed to keep the payment at 25% of income, times 100;
+	// above 100 the median home is affordable on the median income
+	// @Example 45.9
+	AffordabilityIndex float64 `json:"affordability_index,omitempty"`
 }
 
 // MarketTrendsRequest represents the request parameters for market trends
@@ -29,4 +81,9 @@ type MarketTrendsRequest struct {
 	Location     string `json:"location"`
 	PropertyType string `json:"property_type"`
 	TimeRange    string `json:"time_range"`
+
+	// Mortgage assumptions for affordability; zero values use the configured defaults
+	DownPaymentRate *float64 `json:"down_payment_rate"`
+	LoanTermYears   int      `json:"loan_term_years"`
+	HouseholdIncome int      `json:"household_income"`
 }
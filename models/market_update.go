@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// MarketUpdate represents new market trends for a location subscribed to on the market stream
+// @Description Market trends of a subscribed location, sent when its underlying data changes
+type MarketUpdate struct {
+	// Event identifier, increasing with every update; send it back as Last-Event-ID to resume
+	// @Example 1717243200000001
+	ID uint64 `json:"id"`
+
+	// Location (city, state, or ZIP code)
+	// @Example San Francisco, CA
+	Location string `json:"location"`
+
+	// Property type the trends are filtered to, if any
+	// @Example Single-family
+	PropertyType string `json:"property_type,omitempty"`
+
+	// Time range of the trends
+	// @Example 6 months
+	TimeRange string `json:"time_range"`
+
+	// Updated market trends
+	Trends *MarketTrends `json:"trends"`
+
+	// Time the update was found
+	// @Example 2024-06-01T12:00:00Z
+	UpdatedAt time.Time `json:"updated_at"`
+}
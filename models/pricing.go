@@ -0,0 +1,60 @@
+package models
+
+// Pricing strategies, from the lowest to the highest list price
+const (
+	PricingStrategyConservative = "conservative"
+	PricingStrategyMarket       = "market"
+	PricingStrategyAggressive   = "aggressive"
+)
+
+// PricePoint is a list price for a pricing strategy and how long a listing at that price is
+// expected to take to go under contract
+// @Description A list price and its expected days on market
+type PricePoint struct {
+	// Pricing strategy (conservative, market, or aggressive)
+	// @Example market
+	Strategy string `json:"strategy"`
+
+	// Suggested list price
+	// @Example 1195000
+	ListPrice int `json:"list_price"`
+
+	// Expected days until the listing goes under contract
+	// @Example 18
+	ExpectedDaysOnMarket int `json:"expected_days_on_market"`
+}
+
+// PricingStrategy is the recommended list price for a property and the range of prices around it
+// @Description Recommended list price and pricing strategy for a property
+type PricingStrategy struct {
+	// Unique property identifier
+	// @Example 12345
+	PropertyID string `json:"property_id"`
+
+	// Normalized address of the subject property
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address,omitempty"`
+
+	// Estimated market value from the CMA
+	// @Example 1170400
+	EstimatedValue int `json:"estimated_value"`
+
+	// Recommended list price
+	// @Example 1195000
+	RecommendedListPrice int `json:"recommended_list_price"`
+
+	// Median ratio of sale price to list price of the comparables
+	// @Example 0.985
+	SaleToListRatio float64 `json:"sale_to_list_ratio"`
+
+	// Median asking price per square foot of active competing listings
+	// @Example 861
+	CompetitionPricePerSqft int `json:"competition_price_per_sqft,omitempty"`
+
+	// List prices for the conservative, market and aggressive strategies
+	PricePoints []PricePoint `json:"price_points"`
+
+	// Freshness of the underlying data (live, cached, or stale)
+	// @Example live
+	DataFreshness string `json:"data_freshness,omitempty"`
+}
@@ -0,0 +1,144 @@
+package models
+
+import "time"
+
+// Rental represents a leased rental listing from a data provider
+// @Description A leased rental listing from a data provider
+type Rental struct {
+	// Provider-specific listing identifier
+	// @Example R12345
+	ID string `json:"id"`
+
+	// Street address of the property
+	// @Example 123 Main St
+	Address string `json:"address"`
+
+	// City of the property
+	// @Example San Francisco
+	City string `json:"city"`
+
+	// State of the property
+	// @Example CA
+	State string `json:"state"`
+
+	// ZIP code of the property
+	// @Example 94110
+	ZipCode string `json:"zip_code"`
+
+	// Latitude of the property
+	// @Example 37.7599
+	Latitude float64 `json:"latitude"`
+
+	// Longitude of the property
+	// @Example -122.4148
+	Longitude float64 `json:"longitude"`
+
+	// Type of property (Single-family, condo, etc.)
+	// @Example Single-family
+	PropertyType string `json:"property_type"`
+
+	// Number of bedrooms
+	// @Example 3
+	Bedrooms int `json:"bedrooms"`
+
+	// Number of bathrooms
+	// @Example 2
+	Bathrooms float64 `json:"bathrooms"`
+
+	// Square footage of the property
+	// @Example 1300
+	Sqft int `json:"sqft"`
+
+	// Monthly rent of the lease
+	// @Example 4800
+	MonthlyRent int `json:"monthly_rent"`
+
+	// Date the lease was signed
+	LeaseDate time.Time `json:"lease_date"`
+
+	// Days between listing and lease
+	// @Example 12
+	DaysOnMarket int `json:"days_on_market"`
+}
+
+// RentalQuery represents the search criteria for leased rentals from a data provider
+type RentalQuery struct {
+	Location     string    `json:"location"`
+	PropertyType string    `json:"property_type"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	RadiusMiles  float64   `json:"radius_miles"`
+	LeasedAfter  time.Time `json:"leased_after"`
+	Limit        int       `json:"limit"`
+}
+
+// RentalComparable represents a comparable leased rental for a rent CMA
+// @Description A comparable leased rental
+type RentalComparable struct {
+	// Provider listing identifier
+	// @Example R98765
+	ID string `json:"id,omitempty"`
+
+	// Property address
+	// @Example 123 Main St
+	Address string `json:"address"`
+
+	// Monthly rent of the lease
+	// @Example 4800
+	MonthlyRent int `json:"monthly_rent"`
+
+	// Square footage of the property
+	// @Example 1300
+	Sqft int `json:"sqft"`
+
+	// Monthly rent per square foot
+	// @Example 3.69
+	RentPerSqft float64 `json:"rent_per_sqft"`
+
+	// Number of bedrooms
+	// @Example 3
+	Bedrooms int `json:"bedrooms,omitempty"`
+
+	// Number of bathrooms
+	// @Example 2
+	Bathrooms float64 `json:"bathrooms,omitempty"`
+
+	// Date the lease was signed (YYYY-MM-DD)
+	// @Example 2024-03-01
+	LeaseDate string `json:"lease_date,omitempty"`
+
+	// Distance from the subject property in miles
+	// @Example 0.4
+	DistanceMiles float64 `json:"distance_miles,omitempty"`
+}
+
+// RentCMAResponse represents the rental comparative market analysis response
+// @Description Rental comparables and estimated monthly rent
+type RentCMAResponse struct {
+	// Unique property identifier
+	// @Example 12345
+	PropertyID string `json:"property_id"`
+
+	// Normalized address of the subject property
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address,omitempty"`
+
+	// List of comparable leased rentals
+	Comparables []RentalComparable `json:"comparables"`
+
+	// Estimated monthly rent based on comparables
+	// @Example 4900
+	EstimatedRent int `json:"estimated_rent"`
+
+	// Low end of the likely monthly rent
+	// @Example 4650
+	RentRangeLow int `json:"rent_range_low"`
+
+	// High end of the likely monthly rent
+	// @Example 5150
+	RentRangeHigh int `json:"rent_range_high"`
+
+	// Freshness of the underlying data (live, cached, or stale)
+	// @Example live
+	DataFreshness string `json:"data_freshness,omitempty"`
+}
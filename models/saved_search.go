@@ -0,0 +1,135 @@
+package models
+
+import "time"
+
+// Saved search types
+const (
+	SavedSearchTypeMarketTrends = "market-trends"
+	SavedSearchTypeCMA          = "cma"
+)
+
+// Alert types
+const (
+	AlertMedianPriceChange = "median_price_change"
+	AlertInventoryJump     = "inventory_jump"
+	AlertNewComparable     = "new_comparable"
+)
+
+// AlertRules represents the changes a saved search alerts on
+// @Description Conditions that raise an alert when a saved search is re-evaluated
+type AlertRules struct {
+	// Alert when the median sale price moves by at least this share, up or down, since the
+	// search was saved or last alerted (market-trends searches; 0.05 is 5%)
+	// @Example 0.05
+	MedianPriceChange float64 `json:"median_price_change,omitempty"`
+
+	// Alert when the number of active listings grows by at least this share since the previous
+	// evaluation (market-trends searches; 0.25 is 25%)
+	// @Example 0.25
+	InventoryChange float64 `json:"inventory_change,omitempty"`
+
+	// Alert when a sale within the radius of the subject closes after the previous evaluation (cma searches)
+	// @Example true
+	NewComparables bool `json:"new_comparables,omitempty"`
+}
+
+// SavedSearchRequest represents a request to save a query and re-evaluate it periodically
+// @Description A /market-trends or /cma query to re-evaluate periodically, with its alert rules
+type SavedSearchRequest struct {
+	// Name of the search
+	// @Example Mission District single-family
+	Name string `json:"name"`
+
+	// Search type (market-trends or cma)
+	// @Example market-trends
+	Type string `json:"type"`
+
+	// Market trends query, for market-trends searches
+	MarketTrends *MarketTrendsRequest `json:"market_trends,omitempty"`
+
+	// CMA query in the POST /cma format, for cma searches
+	CMA *CMARequest `json:"cma,omitempty"`
+
+	// Changes to alert on
+	Alerts AlertRules `json:"alerts"`
+}
+
+// SavedSearch represents a saved query and the state of its periodic evaluation
+// @Description A saved /market-trends or /cma query with its alert rules
+type SavedSearch struct {
+	// Saved search identifier
+	// @Example 4e7a1c9b2d3f5e80
+	ID string `json:"id"`
+
+	// Name of the search
+	// @Example Mission District single-family
+	Name string `json:"name"`
+
+	// Search type (market-trends or cma)
+	// @Example market-trends
+	Type string `json:"type"`
+
+	// Market trends query, for market-trends searches
+	MarketTrends *MarketTrendsRequest `json:"market_trends,omitempty"`
+
+	// CMA query, for cma searches
+	CMA *CMARequest `json:"cma,omitempty"`
+
+	// Changes to alert on
+	Alerts AlertRules `json:"alerts"`
+
+	// Time the search was saved
+	// @Example 2024-06-01T12:00:00Z
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time the search was last evaluated
+	// @Example 2024-06-01T13:00:00Z
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+
+	// Error of the last evaluation, when it failed
+	// @Example failed to fetch market trends: upstream data source did not respond before the request deadline
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Alert represents a change found when re-evaluating a saved search
+// @Description A change found in a saved search
+type Alert struct {
+	// Alert identifier
+	// @Example 6c2e8a4f1b9d3e70
+	ID string `json:"id"`
+
+	// Saved search that raised the alert
+	// @Example 4e7a1c9b2d3f5e80
+	SearchID string `json:"search_id"`
+
+	// Name of the saved search
+	// @Example Mission District single-family
+	SearchName string `json:"search_name"`
+
+	// Alert type (median_price_change, inventory_jump, or new_comparable)
+	// @Example median_price_change
+	Type string `json:"type"`
+
+	// Description of the change
+	// @Example Median price rose 6.2% from $1150000 to $1221300
+	Message string `json:"message"`
+
+	// Value before the change: the median price or the number of active listings
+	// @Example 1150000
+	PreviousValue int `json:"previous_value,omitempty"`
+
+	// Value after the change
+	// @Example 1221300
+	CurrentValue int `json:"current_value,omitempty"`
+
+	// Relative change (0.062 is 6.2%)
+	// @Example 0.062
+	Change float64 `json:"change,omitempty"`
+
+	// The new comparable sale, for new_comparable alerts
+	Comparable *Comparable `json:"comparable,omitempty"`
+
+	// Time the alert was raised
+	// @Example 2024-06-01T13:00:00Z
+	CreatedAt time.Time `json:"created_at"`
+}
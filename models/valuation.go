@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Valuation represents the estimated value of a property from one CMA
+// @Description Estimated value of a property from a recorded or retroactive CMA
+type Valuation struct {
+	// Date the value is estimated as of
+	// @Example 2024-06-01
+	AsOf string `json:"as_of"`
+
+	// Time the CMA was computed
+	// @Example 2024-06-01T12:00:00Z
+	ValuedAt time.Time `json:"valued_at"`
+
+	// Estimated property value
+	// @Example 1150000
+	EstimatedValue int `json:"estimated_value"`
+
+	// Number of comparables the estimate is based on
+	// @Example 6
+	Comparables int `json:"comparables"`
+
+	// Whether the CMA was recomputed as of a past date instead of recorded when it was requested
+	// @Example false
+	Retroactive bool `json:"retroactive,omitempty"`
+
+	// Change in estimated value since the previous valuation in the timeline
+	// @Example 25000
+	Change int `json:"change"`
+
+	// Change in estimated value relative to the previous valuation (0.022 is 2.2%)
+	// @Example 0.022
+	RelativeChange float64 `json:"relative_change"`
+}
+
+// ValuationHistory represents how the estimated value of a property changed over time
+// @Description Timeline of a property's estimated values, oldest first
+type ValuationHistory struct {
+	// Unique property identifier
+	// @Example 12345
+	PropertyID string `json:"property_id"`
+
+	// Normalized address of the property
+	// @Example 100 Valencia St, San Francisco, CA 94103
+	Address string `json:"address,omitempty"`
+
+	// Valuations ordered by as-of date, then by the time they were computed
+	Valuations []Valuation `json:"valuations"`
+
+	// Change in estimated value from the first valuation to the last
+	// @Example 75000
+	TotalChange int `json:"total_change"`
+
+	// Change in estimated value from the first valuation to the last, relative to the first
+	// @Example 0.068
+	TotalRelativeChange float64 `json:"total_relative_change"`
+}
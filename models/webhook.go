@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types
+const (
+	EventJobFinished       = "job.finished"
+	EventMarketTrendChange = "market.trend_changed"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookRequest represents a request to register a webhook
+// @Description A URL to notify of events, with the events and locations it is interested in
+type WebhookRequest struct {
+	// URL events are POSTed to
+	// @Example https://example.com/hooks/cma
+	URL string `json:"url"`
+
+	// Events to deliver (job.finished, market.trend_changed); defaults to job.finished, and
+	// market.trend_changed when locations are given
+	// @Example ["job.finished", "market.trend_changed"]
+	Events []string `json:"events"`
+
+	// Locations (cities, states, or ZIP codes) whose market trend is watched for market.trend_changed
+	// @Example ["San Francisco, CA", "94110"]
+	Locations []string `json:"locations"`
+
+	// Secret the payloads are signed with; one is generated when omitted
+	// @Example 2c1f0e3a9b8d7c6e5f4a3b2c1d0e9f8a
+	Secret string `json:"secret"`
+}
+
+// Webhook represents a registered webhook
+// @Description A URL notified of events
+type Webhook struct {
+	// Webhook identifier
+	// @Example 9b1e4c2a7f3d8e60
+	ID string `json:"id"`
+
+	// URL events are POSTed to
+	// @Example https://example.com/hooks/cma
+	URL string `json:"url"`
+
+	// Events delivered to the URL
+	// @Example ["job.finished", "market.trend_changed"]
+	Events []string `json:"events"`
+
+	// Locations whose market trend is watched
+	// @Example ["San Francisco, CA", "94110"]
+	Locations []string `json:"locations,omitempty"`
+
+	// Secret the payloads are signed with; only returned when the webhook is registered
+	// @Example 2c1f0e3a9b8d7c6e5f4a3b2c1d0e9f8a
+	Secret string `json:"secret,omitempty"`
+
+	// Time the webhook was registered
+	// @Example 2024-06-01T12:00:00Z
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvent represents the payload POSTed to a webhook
+// @Description An event delivered to a webhook
+type WebhookEvent struct {
+	// Event identifier, the same across redeliveries
+	// @Example 5d2c8a1f9e3b7c40
+	ID string `json:"id"`
+
+	// Event type (job.finished or market.trend_changed)
+	// @Example job.finished
+	Type string `json:"type"`
+
+	// Time the event happened
+	// @Example 2024-06-01T12:03:20Z
+	CreatedAt time.Time `json:"created_at"`
+
+	// The finished Job for job.finished, or a TrendChange for market.trend_changed
+	Data interface{} `json:"data"`
+}
+
+// TrendChange represents a change of the trend classification of a watched location
+// @Description A watched location's market trend changed direction
+type TrendChange struct {
+	// Location (city, state, or ZIP code)
+	// @Example San Francisco, CA
+	Location string `json:"location"`
+
+	// Trend direction before the change (upward, downward, or stable)
+	// @Example stable
+	PreviousTrend string `json:"previous_trend"`
+
+	// Trend direction now
+	// @Example upward
+	Trend string `json:"trend"`
+
+	// Current market trends of the location
+	Trends *MarketTrends `json:"trends"`
+}
+
+// WebhookDelivery represents an attempt to deliver an event to a webhook, with its retries
+// @Description Delivery log entry of an event sent to a webhook
+type WebhookDelivery struct {
+	// Delivery identifier
+	// @Example 7a3e9d1c5b2f8e40
+	ID string `json:"id"`
+
+	// Webhook the event was sent to
+	// @Example 9b1e4c2a7f3d8e60
+	WebhookID string `json:"webhook_id"`
+
+	// Event identifier
+	// @Example 5d2c8a1f9e3b7c40
+	EventID string `json:"event_id"`
+
+	// Event type
+	// @Example job.finished
+	Event string `json:"event"`
+
+	// Delivery status (pending, succeeded, or failed)
+	// @Example succeeded
+	Status string `json:"status"`
+
+	// Number of attempts made
+	// @Example 1
+	Attempts int `json:"attempts"`
+
+	// HTTP status of the last attempt, when the receiver responded
+	// @Example 200
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Error of the last attempt, when it failed
+	// @Example receiver responded with status 503
+	Error string `json:"error,omitempty"`
+
+	// Delivery this one redelivers
+	// @Example 1f8c3e7a2d9b5c60
+	RedeliveryOf string `json:"redelivery_of,omitempty"`
+
+	// Time the delivery was created
+	// @Example 2024-06-01T12:03:20Z
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time of the last attempt
+	// @Example 2024-06-01T12:03:21Z
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+
+	// Payload sent to the webhook
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+}
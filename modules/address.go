@@ -0,0 +1,290 @@
+package modules
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Address is a US street address split into its components and normalized to USPS abbreviations
+type Address struct {
+	Number          string `json:"number,omitempty"`
+	PreDirectional  string `json:"pre_directional,omitempty"`
+	StreetName      string `json:"street_name,omitempty"`
+	Suffix          string `json:"suffix,omitempty"`
+	PostDirectional string `json:"post_directional,omitempty"`
+	UnitType        string `json:"unit_type,omitempty"`
+	Unit            string `json:"unit,omitempty"`
+	City            string `json:"city,omitempty"`
+	State           string `json:"state,omitempty"`
+	ZipCode         string `json:"zip_code,omitempty"`
+}
+
+// directionals maps directional words and abbreviations to their USPS abbreviation
+var directionals = map[string]string{
+	"n": "N", "north": "N", "s": "S", "south": "S", "e": "E", "east": "E", "w": "W", "west": "W",
+	"ne": "NE", "northeast": "NE", "nw": "NW", "northwest": "NW",
+	"se": "SE", "southeast": "SE", "sw": "SW", "southwest": "SW",
+}
+
+// streetSuffixes maps common street suffixes and their variants to the USPS abbreviation
+var streetSuffixes = map[string]string{
+	"alley": "Aly", "aly": "Aly", "ally": "Aly",
+	"avenue": "Ave", "ave": "Ave", "av": "Ave", "aven": "Ave", "avenu": "Ave", "avn": "Ave", "avnue": "Ave",
+	"boulevard": "Blvd", "blvd": "Blvd", "boul": "Blvd", "boulv": "Blvd",
+	"bridge": "Brg", "brg": "Brg", "bypass": "Byp", "byp": "Byp",
+	"center": "Ctr", "centre": "Ctr", "ctr": "Ctr", "cntr": "Ctr",
+	"circle": "Cir", "cir": "Cir", "circ": "Cir", "circl": "Cir", "crcl": "Cir",
+	"court": "Ct", "ct": "Ct", "courts": "Cts", "cts": "Cts", "cove": "Cv", "cv": "Cv",
+	"crescent": "Cres", "cres": "Cres", "crossing": "Xing", "xing": "Xing",
+	"drive": "Dr", "dr": "Dr", "driv": "Dr", "drv": "Dr",
+	"expressway": "Expy", "expy": "Expy", "freeway": "Fwy", "fwy": "Fwy",
+	"heights": "Hts", "hts": "Hts", "hill": "Hl", "hl": "Hl", "hollow": "Holw", "holw": "Holw",
+	"highway": "Hwy", "hwy": "Hwy", "highwy": "Hwy", "hiway": "Hwy", "hiwy": "Hwy", "hway": "Hwy",
+	"junction": "Jct", "jct": "Jct", "lane": "Ln", "ln": "Ln", "loop": "Loop", "manor": "Mnr", "mnr": "Mnr",
+	"parkway": "Pkwy", "pkwy": "Pkwy", "parkwy": "Pkwy", "pkway": "Pkwy", "pky": "Pkwy",
+	"park": "Park", "pass": "Pass", "path": "Path", "pike": "Pike",
+	"place": "Pl", "pl": "Pl", "plaza": "Plz", "plz": "Plz", "point": "Pt", "pt": "Pt",
+	"ridge": "Rdg", "rdg": "Rdg", "road": "Rd", "rd": "Rd", "route": "Rte", "rte": "Rte", "row": "Row", "run": "Run",
+	"square": "Sq", "sq": "Sq", "sqr": "Sq",
+	"street": "St", "st": "St", "str": "St", "strt": "St",
+	"terrace": "Ter", "ter": "Ter", "terr": "Ter",
+	"trail": "Trl", "trl": "Trl", "trails": "Trl", "turnpike": "Tpke", "tpke": "Tpke",
+	"view": "Vw", "vw": "Vw", "village": "Vlg", "vlg": "Vlg", "walk": "Walk", "way": "Way", "wy": "Way",
+}
+
+// unitTypes maps secondary unit designators to the USPS abbreviation
+var unitTypes = map[string]string{
+	"apartment": "Apt", "apt": "Apt", "basement": "Bsmt", "bsmt": "Bsmt", "building": "Bldg", "bldg": "Bldg",
+	"department": "Dept", "dept": "Dept", "floor": "Fl", "fl": "Fl", "lot": "Lot", "penthouse": "Ph", "ph": "Ph",
+	"room": "Rm", "rm": "Rm", "space": "Spc", "spc": "Spc", "suite": "Ste", "ste": "Ste",
+	"trailer": "Trlr", "trlr": "Trlr", "unit": "Unit", "#": "#",
+}
+
+// states maps US state and territory names to their USPS abbreviation
+var states = map[string]string{
+	"alabama": "AL", "alaska": "AK", "arizona": "AZ", "arkansas": "AR", "california": "CA", "colorado": "CO",
+	"connecticut": "CT", "delaware": "DE", "district of columbia": "DC", "florida": "FL", "georgia": "GA",
+	"hawaii": "HI", "idaho": "ID", "illinois": "IL", "indiana": "IN", "iowa": "IA", "kansas": "KS",
+	"kentucky": "KY", "louisiana": "LA", "maine": "ME", "maryland": "MD", "massachusetts": "MA",
+	"michigan": "MI", "minnesota": "MN", "mississippi": "MS", "missouri": "MO", "montana": "MT",
+	"nebraska": "NE", "nevada": "NV", "new hampshire": "NH", "new jersey": "NJ", "new mexico": "NM",
+	"new york": "NY", "north carolina": "NC", "north dakota": "ND", "ohio": "OH", "oklahoma": "OK",
+	"oregon": "OR", "pennsylvania": "PA", "puerto rico": "PR", "rhode island": "RI", "south carolina": "SC",
+	"south dakota": "SD", "tennessee": "TN", "texas": "TX", "utah": "UT", "vermont": "VT", "virginia": "VA",
+	"washington": "WA", "west virginia": "WV", "wisconsin": "WI", "wyoming": "WY",
+}
+
+// stateZipPattern matches a trailing ZIP or ZIP+4 code in the last part of an address
+var stateZipPattern = regexp.MustCompile(`^(.*?)\s*(\d{5}(?:-\d{4})?)$`)
+
+// ParseAddress splits a free-form US address such as "123 N Main Street Apt 4, San Francisco, CA 94110"
+// into its components. The street line may be given on its own; city, state and ZIP code are read
+// from the comma-separated parts after it.
+func ParseAddress(s string) Address {
+	var a Address
+
+	parts := strings.Split(s, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	street := parts[0]
+	rest := parts[1:]
+
+	// A unit may follow the street line as its own part, as in "123 Main St, Apt 4, ..."
+	if len(rest) > 0 && isUnitPart(rest[0]) {
+		street += " " + rest[0]
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 {
+		last := rest[len(rest)-1]
+		if m := stateZipPattern.FindStringSubmatch(last); m != nil {
+			a.ZipCode = m[2]
+			last = m[1]
+		}
+		// A ZIP code may be its own part, as in "..., CA, 94110"; the state is then the part before it
+		if a.ZipCode != "" && last == "" && len(rest) > 1 {
+			rest = rest[:len(rest)-1]
+			last = rest[len(rest)-1]
+		}
+		// A full state name on its own could also be a city, as in "123 Main St, Washington"
+		if state, ok := parseState(last); ok && (len(last) == 2 || len(rest) > 1 || a.ZipCode != "") {
+			a.State = state
+			rest = rest[:len(rest)-1]
+		} else if city, abbreviation, ok := cutState(last); ok {
+			a.State = abbreviation
+			rest[len(rest)-1] = city
+		} else if a.ZipCode != "" {
+			rest[len(rest)-1] = last
+		}
+		if len(rest) > 0 && rest[0] != "" {
+			a.City = titleCase(rest[0])
+		}
+	}
+
+	a.parseStreet(street)
+	return a
+}
+
+// NormalizeAddress returns the normalized street line of an address, e.g. "123 N Main St Apt 4"
+func NormalizeAddress(s string) string {
+	return ParseAddress(s).Street()
+}
+
+// parseStreet fills in the street and unit components from a street line
+func (a *Address) parseStreet(street string) {
+	tokens := strings.Fields(strings.NewReplacer(".", "", ",", " ", "#", " # ").Replace(street))
+
+	// Everything from the first unit designator on is the unit. A trailing designator without a
+	// unit, as in "123 Main St Apt", is dropped so the suffix before it is still found.
+	for i := 1; i < len(tokens); i++ {
+		unitType, ok := unitTypes[strings.ToLower(tokens[i])]
+		if ok && i+1 == len(tokens) && !startsWithDigit(tokens[i-1]) {
+			tokens = tokens[:i]
+			break
+		}
+		if !ok || i+1 == len(tokens) || (i+2 == len(tokens) && isSuffix(tokens[i+1])) {
+			continue
+		}
+		a.UnitType = unitType
+		a.Unit = strings.ToUpper(strings.Join(tokens[i+1:], " "))
+		tokens = tokens[:i]
+		break
+	}
+
+	if len(tokens) > 0 && startsWithDigit(tokens[0]) {
+		a.Number = strings.ToUpper(tokens[0])
+		tokens = tokens[1:]
+	}
+
+	// A directional before the name, unless it is the name itself as in "North St"
+	if len(tokens) > 1 {
+		if dir, ok := directionals[strings.ToLower(tokens[0])]; ok && !(len(tokens) == 2 && isSuffix(tokens[1])) {
+			a.PreDirectional = dir
+			tokens = tokens[1:]
+		}
+	}
+
+	if len(tokens) > 1 {
+		if dir, ok := directionals[strings.ToLower(tokens[len(tokens)-1])]; ok {
+			a.PostDirectional = dir
+			tokens = tokens[:len(tokens)-1]
+		}
+	}
+
+	if len(tokens) > 1 {
+		if suffix, ok := streetSuffixes[strings.ToLower(tokens[len(tokens)-1])]; ok {
+			a.Suffix = suffix
+			tokens = tokens[:len(tokens)-1]
+		}
+	}
+
+	a.StreetName = titleCase(strings.Join(tokens, " "))
+}
+
+// Street returns the normalized street line, including the unit
+func (a Address) Street() string {
+	var words []string
+	for _, word := range []string{a.Number, a.PreDirectional, a.StreetName, a.Suffix, a.PostDirectional} {
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+
+	if a.Unit != "" {
+		if a.UnitType == "#" || a.UnitType == "" {
+			words = append(words, "#"+a.Unit)
+		} else {
+			words = append(words, a.UnitType, a.Unit)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// String returns the normalized full address, e.g. "123 N Main St Apt 4, San Francisco, CA 94110"
+func (a Address) String() string {
+	parts := []string{a.Street()}
+	if a.City != "" {
+		parts = append(parts, a.City)
+	}
+
+	stateZip := strings.TrimSpace(a.State + " " + a.ZipCode)
+	if stateZip != "" {
+		parts = append(parts, stateZip)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StreetKey returns a lowercase key identifying the street address without its unit, for matching
+// differently written addresses of the same building
+func (a Address) StreetKey() string {
+	var words []string
+	for _, word := range []string{a.Number, a.PreDirectional, a.StreetName, a.Suffix, a.PostDirectional} {
+		if word != "" {
+			words = append(words, strings.ToLower(word))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// isUnitPart reports whether an address part is a unit, such as "Apt 4" or "#12"
+func isUnitPart(part string) bool {
+	if strings.HasPrefix(part, "#") {
+		return true
+	}
+	designator, _, ok := strings.Cut(part, " ")
+	_, isUnit := unitTypes[strings.ToLower(strings.TrimSuffix(designator, "."))]
+	return ok && isUnit
+}
+
+// parseState returns the USPS abbreviation for a state name or abbreviation
+func parseState(s string) (string, bool) {
+	s = strings.TrimSpace(strings.TrimSuffix(s, "."))
+	if len(s) == 2 {
+		upper := strings.ToUpper(s)
+		for _, abbreviation := range states {
+			if abbreviation == upper {
+				return upper, true
+			}
+		}
+		return "", false
+	}
+
+	abbreviation, ok := states[strings.ToLower(strings.Join(strings.Fields(s), " "))]
+	return abbreviation, ok
+}
+
+// cutState splits a trailing state abbreviation from a city, as in "San Francisco CA"
+func cutState(s string) (city, state string, ok bool) {
+	i := strings.LastIndex(s, " ")
+	if i < 0 || len(s)-i-1 != 2 {
+		return "", "", false
+	}
+	state, ok = parseState(s[i+1:])
+	return strings.TrimSpace(s[:i]), state, ok
+}
+
+// isSuffix reports whether a token is a street suffix
+func isSuffix(token string) bool {
+	_, ok := streetSuffixes[strings.ToLower(token)]
+	return ok
+}
+
+// startsWithDigit reports whether a token starts with a digit
+func startsWithDigit(token string) bool {
+	return token != "" && unicode.IsDigit(rune(token[0]))
+}
+
+// titleCase capitalizes the first letter of each word; words starting with a digit, such as "1st",
+// are lowercased
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
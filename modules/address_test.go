@@ -0,0 +1,118 @@
+package modules
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Address
+	}{
+		{
+			name:     "Street only",
+			input:    "123 Main St",
+			expected: Address{Number: "123", StreetName: "Main", Suffix: "St"},
+		},
+		{
+			name:     "Full suffix and unit",
+			input:    "123 Main Street Apt 4",
+			expected: Address{Number: "123", StreetName: "Main", Suffix: "St", UnitType: "Apt", Unit: "4"},
+		},
+		{
+			name:  "Directionals, city, state and ZIP",
+			input: "456 north Oak avenue sw, san francisco, CA 94110",
+			expected: Address{
+				Number: "456", PreDirectional: "N", StreetName: "Oak", Suffix: "Ave", PostDirectional: "SW",
+				City: "San Francisco", State: "CA", ZipCode: "94110",
+			},
+		},
+		{
+			name:  "Hash unit, state name and ZIP+4",
+			input: "789 Elm Blvd. #12b, Austin, Texas 78701-1234",
+			expected: Address{
+				Number: "789", StreetName: "Elm", Suffix: "Blvd", UnitType: "#", Unit: "12B",
+				City: "Austin", State: "TX", ZipCode: "78701-1234",
+			},
+		},
+		{
+			name:  "Unit as its own part and state without comma",
+			input: "10 Market St, Suite 300, Oakland CA 94607",
+			expected: Address{
+				Number: "10", StreetName: "Market", Suffix: "St", UnitType: "Ste", Unit: "300",
+				City: "Oakland", State: "CA", ZipCode: "94607",
+			},
+		},
+		{
+			name:     "Directional as street name",
+			input:    "55 North St",
+			expected: Address{Number: "55", StreetName: "North", Suffix: "St"},
+		},
+		{
+			name:     "Suffix as street name",
+			input:    "1200 Park Ave",
+			expected: Address{Number: "1200", StreetName: "Park", Suffix: "Ave"},
+		},
+		{
+			name:     "Ordinal street",
+			input:    "300 W 22ND STREET",
+			expected: Address{Number: "300", PreDirectional: "W", StreetName: "22nd", Suffix: "St"},
+		},
+		{
+			name:  "ZIP as its own part",
+			input: "123 Main St, San Francisco, CA, 94110",
+			expected: Address{
+				Number: "123", StreetName: "Main", Suffix: "St", City: "San Francisco", State: "CA", ZipCode: "94110",
+			},
+		},
+		{
+			name:     "Unit designator without a unit",
+			input:    "123 Main St Apt",
+			expected: Address{Number: "123", StreetName: "Main", Suffix: "St"},
+		},
+		{
+			name:     "Trailing hash without a unit",
+			input:    "123 Main Street #",
+			expected: Address{Number: "123", StreetName: "Main", Suffix: "St"},
+		},
+		{
+			name:     "City that is also a state name",
+			input:    "1 Main St, Washington",
+			expected: Address{Number: "1", StreetName: "Main", Suffix: "St", City: "Washington"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ParseAddress(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected %+v but got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestAddressFormatting(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedStreet string
+		expectedString string
+	}{
+		{"123 main street apt 4", "123 Main St Apt 4", "123 Main St Apt 4"},
+		{"45 Oak Avenue #2, San Francisco, California 94110", "45 Oak Ave #2", "45 Oak Ave #2, San Francisco, CA 94110"},
+		{"9 S Van Ness Ave", "9 S Van Ness Ave", "9 S Van Ness Ave"},
+	}
+
+	for _, tt := range tests {
+		address := ParseAddress(tt.input)
+		if address.Street() != tt.expectedStreet {
+			t.Errorf("Expected street %q but got %q", tt.expectedStreet, address.Street())
+		}
+		if address.String() != tt.expectedString {
+			t.Errorf("Expected address %q but got %q", tt.expectedString, address.String())
+		}
+	}
+
+	if ParseAddress("123 Main St").StreetKey() != ParseAddress("123 MAIN STREET Apt 4").StreetKey() {
+		t.Error("Expected addresses of the same building to share a street key")
+	}
+}
@@ -0,0 +1,73 @@
+package modules
+
+import (
+	"context"
+	"sync"
+
+	"github.com/user/cma/models"
+)
+
+// BatchConfig configures a BatchProcessor
+type BatchConfig struct {
+	// Number of CMAs of a batch computed concurrently
+	Workers int
+}
+
+// DefaultBatchConfig returns the default batch configuration
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		Workers: 8,
+	}
+}
+
+// BatchResult is the outcome of one CMA of a batch
+type BatchResult struct {
+	CMA *models.CMAResponse
+	Err error
+}
+
+// BatchProcessor computes CMAs for many properties with a bounded pool of workers
+type BatchProcessor struct {
+	cmaAnalyzer *CMAAnalyzer
+	config      BatchConfig
+}
+
+// NewBatchProcessor creates a new BatchProcessor instance
+func NewBatchProcessor(ca *CMAAnalyzer, cfg BatchConfig) *BatchProcessor {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	return &BatchProcessor{
+		cmaAnalyzer: ca,
+		config:      cfg,
+	}
+}
+
+// Run computes the CMA of every request, at most config.Workers at a time, and returns the
+// outcomes in request order. progress, if not nil, is called after each CMA completes.
+func (bp *BatchProcessor) Run(ctx context.Context, reqs []models.CMARequest, progress func()) []BatchResult {
+	results := make([]BatchResult, len(reqs))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(bp.config.Workers, len(reqs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				cma, err := bp.cmaAnalyzer.GetComparableProperties(ctx, reqs[i])
+				results[i] = BatchResult{CMA: cma, Err: err}
+				if progress != nil {
+					progress()
+				}
+			}
+		}()
+	}
+
+	for i := range reqs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,84 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// concurrencyProvider records the largest number of listing lookups in flight at once
+type concurrencyProvider struct {
+	staticProvider
+	mu       sync.Mutex
+	inFlight int
+	maxSeen  int
+}
+
+func (cp *concurrencyProvider) GetListing(ctx context.Context, id string) (*models.Listing, error) {
+	cp.mu.Lock()
+	cp.inFlight++
+	cp.maxSeen = max(cp.maxSeen, cp.inFlight)
+	cp.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	cp.mu.Lock()
+	cp.inFlight--
+	cp.mu.Unlock()
+	return cp.staticProvider.GetListing(ctx, id)
+}
+
+func TestBatchProcessorRun(t *testing.T) {
+	provider := &concurrencyProvider{staticProvider: staticProvider{listings: []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", Latitude: 37.7706, Longitude: -122.4222, Sqft: 1400, PropertyType: "Single-family"},
+		{ID: "S2", Address: "200 Valencia St", Latitude: 37.7690, Longitude: -122.4220, Sqft: 1200, PropertyType: "Single-family"},
+		{ID: "C1", Address: "123 Main St", Latitude: 37.7712, Longitude: -122.4210, Sqft: 1300, PropertyType: "Single-family",
+			Status: models.ListingStatusSold, SalePrice: 1300000, SaleDate: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+	}}}
+	df := NewDataFetcher()
+	df.SetProvider(provider)
+	processor := NewBatchProcessor(newTestCMAAnalyzer(df), BatchConfig{Workers: 2})
+
+	var reqs []models.CMARequest
+	for i := 0; i < 10; i++ {
+		id := "S1"
+		if i%2 == 1 {
+			id = "S2"
+		}
+		reqs = append(reqs, models.CMARequest{PropertyID: id, Radius: 5})
+	}
+	reqs = append(reqs, models.CMARequest{PropertyID: "missing", Radius: 5})
+
+	var progress int
+	var mu sync.Mutex
+	results := processor.Run(context.Background(), reqs, func() {
+		mu.Lock()
+		progress++
+		mu.Unlock()
+	})
+
+	if len(results) != len(reqs) {
+		t.Fatalf("Expected %d results but got %d", len(reqs), len(results))
+	}
+	for i, result := range results[:10] {
+		if result.Err != nil {
+			t.Fatalf("Item %d: expected no error but got: %v", i, result.Err)
+		}
+		if result.CMA.PropertyID != reqs[i].PropertyID {
+			t.Errorf("Item %d: expected the CMA of %s but got %s", i, reqs[i].PropertyID, result.CMA.PropertyID)
+		}
+	}
+	if !errors.Is(results[10].Err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound for the last item but got %v", results[10].Err)
+	}
+	if progress != len(reqs) {
+		t.Errorf("Expected %d progress calls but got %d", len(reqs), progress)
+	}
+	if provider.maxSeen > 2 {
+		t.Errorf("Expected at most 2 CMAs at a time but got %d", provider.maxSeen)
+	}
+}
@@ -0,0 +1,188 @@
+package modules
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// CacheConfig configures a Cache
+type CacheConfig struct {
+	// Maximum number of entries before the least recently used is evicted; 0 means unlimited
+	MaxEntries int
+
+	// Time an entry is served as fresh
+	TTL time.Duration
+
+	// Time after TTL during which a stale entry is still served while it is refreshed in the background
+	StaleTTL time.Duration
+
+	// Deadline for loads shared between callers and for background refreshes
+	LoadTimeout time.Duration
+}
+
+// CacheLoader loads the value for a cache key
+type CacheLoader func(ctx context.Context) (interface{}, error)
+
+// Cache is an LRU cache with per-entry TTLs, stale-while-revalidate and deduplication of
+// concurrent loads for the same key
+type Cache struct {
+	config CacheConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	inflight map[string]*cacheCall
+	stats    models.CacheStats
+}
+
+// cacheEntry is a cached value and the time it was stored
+type cacheEntry struct {
+	key      string
+	value    interface{}
+	storedAt time.Time
+}
+
+// cacheCall is a load in progress that concurrent callers for the same key wait on
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// NewCache creates a new Cache instance
+func NewCache(cfg CacheConfig) *Cache {
+	if cfg.LoadTimeout <= 0 {
+		cfg.LoadTimeout = 30 * time.Second
+	}
+	return &Cache{
+		config:   cfg,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inflight: make(map[string]*cacheCall),
+	}
+}
+
+// GetOrLoad returns the cached value for key, loading it on a miss. Expired entries still within
+// the stale window are returned immediately and refreshed in the background. When a load fails
+// because the upstream is unavailable (open circuit breaker or exhausted quota), any expired entry
+// is served instead. The freshness of the returned value is recorded on the context's tracker.
+func (c *Cache) GetOrLoad(ctx context.Context, key string, load CacheLoader) (interface{}, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		value := entry.value
+		age := c.now().Sub(entry.storedAt)
+		if age < c.config.TTL {
+			c.order.MoveToFront(elem)
+			c.stats.Hits++
+			c.mu.Unlock()
+			recordFreshness(ctx, models.DataFreshnessCached)
+			return value, nil
+		}
+		if age < c.config.TTL+c.config.StaleTTL {
+			c.order.MoveToFront(elem)
+			c.stats.StaleHits++
+			c.startLoad(withoutFreshness(ctx), key, load)
+			c.mu.Unlock()
+			recordFreshness(ctx, models.DataFreshnessStale)
+			return value, nil
+		}
+	}
+	c.stats.Misses++
+	call := c.startLoad(ctx, key, load)
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if call.err != nil && (errors.Is(call.err, ErrQuotaExhausted) || errors.Is(call.err, ErrCircuitOpen)) {
+		c.mu.Lock()
+		elem, ok := c.entries[key]
+		var value interface{}
+		if ok {
+			value = elem.Value.(*cacheEntry).value
+			c.stats.StaleHits++
+		}
+		c.mu.Unlock()
+
+		if ok {
+			recordFreshness(ctx, models.DataFreshnessStale)
+			return value, nil
+		}
+	}
+	if call.err == nil {
+		recordFreshness(ctx, models.DataFreshnessLive)
+	}
+	return call.value, call.err
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *Cache) Stats() models.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// startLoad starts a load for key unless one is already in progress; c.mu must be held.
+// The load runs detached from the caller's cancellation so that other waiters and the cache
+// still get its result if the first caller goes away.
+func (c *Cache) startLoad(ctx context.Context, key string, load CacheLoader) *cacheCall {
+	if call, ok := c.inflight[key]; ok {
+		c.stats.SharedLoads++
+		return call
+	}
+
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+
+	go func() {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.config.LoadTimeout)
+		defer cancel()
+
+		call.value, call.err = load(loadCtx)
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if call.err == nil {
+			c.store(key, call.value)
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	return call
+}
+
+// store adds or replaces an entry and evicts the least recently used entries over the limit;
+// c.mu must be held
+func (c *Cache) store(key string, value interface{}) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value = value
+		entry.storedAt = c.now()
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, storedAt: c.now()})
+
+	for c.config.MaxEntries > 0 && c.order.Len() > c.config.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
@@ -0,0 +1,191 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCache creates a Cache whose clock is controlled by the returned pointer
+func newTestCache(cfg CacheConfig) (*Cache, *time.Time) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCache(cfg)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCacheHitsAndExpiry(t *testing.T) {
+	c, now := newTestCache(CacheConfig{TTL: time.Minute})
+
+	loads := 0
+	load := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		value, err := c.GetOrLoad(context.Background(), "key", load)
+		if err != nil || value.(int) != 1 {
+			t.Fatalf("Expected cached value 1 but got %v (%v)", value, err)
+		}
+	}
+
+	*now = now.Add(2 * time.Minute)
+	value, _ := c.GetOrLoad(context.Background(), "key", load)
+	if value.(int) != 2 {
+		t.Errorf("Expected expired entry to be reloaded but got %v", value)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheErrorsNotCached(t *testing.T) {
+	c, _ := newTestCache(CacheConfig{TTL: time.Minute})
+
+	loadErr := errors.New("upstream down")
+	if _, err := c.GetOrLoad(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return nil, loadErr
+	}); !errors.Is(err, loadErr) {
+		t.Fatalf("Expected load error but got %v", err)
+	}
+
+	value, err := c.GetOrLoad(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return "ok", nil
+	})
+	if err != nil || value != "ok" {
+		t.Errorf("Expected failed load not to be cached but got %v (%v)", value, err)
+	}
+}
+
+func TestCacheLRUEviction(t *testing.T) {
+	c, _ := newTestCache(CacheConfig{TTL: time.Minute, MaxEntries: 2})
+	ctx := context.Background()
+
+	loads := map[string]int{}
+	loader := func(key string) CacheLoader {
+		return func(ctx context.Context) (interface{}, error) {
+			loads[key]++
+			return key, nil
+		}
+	}
+
+	c.GetOrLoad(ctx, "a", loader("a"))
+	c.GetOrLoad(ctx, "b", loader("b"))
+	c.GetOrLoad(ctx, "a", loader("a")) // a is now most recently used
+	c.GetOrLoad(ctx, "c", loader("c")) // evicts b
+	c.GetOrLoad(ctx, "a", loader("a"))
+	c.GetOrLoad(ctx, "b", loader("b"))
+
+	if loads["a"] != 1 || loads["b"] != 2 {
+		t.Errorf("Expected b to be evicted and reloaded but got loads %v", loads)
+	}
+	if stats := c.Stats(); stats.Evictions != 2 || stats.Entries != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	c, _ := newTestCache(CacheConfig{TTL: time.Minute})
+
+	var loads int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := c.GetOrLoad(context.Background(), "key", load); err != nil || value != "value" {
+				t.Errorf("Expected value but got %v (%v)", value, err)
+			}
+		}()
+	}
+
+	// Wait until every caller has joined the in-flight load
+	for c.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("Expected 1 load for concurrent identical requests but got %d", loads)
+	}
+	if stats := c.Stats(); stats.SharedLoads != 9 {
+		t.Errorf("Expected 9 shared loads but got %d", stats.SharedLoads)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	c, now := newTestCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Minute})
+	ctx := context.Background()
+
+	refreshed := make(chan struct{})
+	c.GetOrLoad(ctx, "key", func(ctx context.Context) (interface{}, error) { return "old", nil })
+
+	*now = now.Add(90 * time.Second)
+	value, err := c.GetOrLoad(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		defer close(refreshed)
+		return "new", nil
+	})
+	if err != nil || value != "old" {
+		t.Fatalf("Expected stale value to be served but got %v (%v)", value, err)
+	}
+
+	<-refreshed
+	// The refresh stores its result after the loader returns
+	for c.Stats().Entries == 0 || c.inflightCount() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	value, _ = c.GetOrLoad(ctx, "key", func(ctx context.Context) (interface{}, error) { return "unused", nil })
+	if value != "new" {
+		t.Errorf("Expected refreshed value but got %v", value)
+	}
+	if stats := c.Stats(); stats.StaleHits != 1 || stats.Hits != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Entries past the stale window are treated as misses
+	*now = now.Add(3 * time.Minute)
+	value, _ = c.GetOrLoad(ctx, "key", func(ctx context.Context) (interface{}, error) { return "newest", nil })
+	if value != "newest" {
+		t.Errorf("Expected reload past the stale window but got %v", value)
+	}
+}
+
+func TestCacheWaiterCanceled(t *testing.T) {
+	c, _ := newTestCache(CacheConfig{TTL: time.Minute})
+
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.GetOrLoad(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		<-release
+		return "value", nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
+
+// inflightCount returns the number of loads in progress
+func (c *Cache) inflightCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.inflight)
+}
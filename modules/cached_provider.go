@@ -0,0 +1,70 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/user/cma/models"
+)
+
+// CachedProvider serves listing lookups and searches from a cache in front of another provider
+type CachedProvider struct {
+	provider ListingProvider
+	cache    *Cache
+}
+
+// NewCachedProvider creates a new CachedProvider instance
+func NewCachedProvider(provider ListingProvider, cache *Cache) *CachedProvider {
+	return &CachedProvider{
+		provider: provider,
+		cache:    cache,
+	}
+}
+
+// GetListing returns the listing with the given ID from the cache or the underlying provider
+func (cp *CachedProvider) GetListing(ctx context.Context, id string) (*models.Listing, error) {
+	value, err := cp.cache.GetOrLoad(ctx, "listing:"+id, func(ctx context.Context) (interface{}, error) {
+		return cp.provider.GetListing(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listing := *value.(*models.Listing)
+	return &listing, nil
+}
+
+// SearchListings returns listings matching the query from the cache or the underlying provider
+func (cp *CachedProvider) SearchListings(ctx context.Context, query models.ListingQuery) ([]models.Listing, error) {
+	key, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := cp.cache.GetOrLoad(ctx, "search:"+string(key), func(ctx context.Context) (interface{}, error) {
+		return cp.provider.SearchListings(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Callers own the returned slice, so never hand out the cached one
+	return append([]models.Listing(nil), value.([]models.Listing)...), nil
+}
+
+// SearchRentals returns leased rentals matching the query from the cache or the underlying provider
+func (cp *CachedProvider) SearchRentals(ctx context.Context, query models.RentalQuery) ([]models.Rental, error) {
+	key, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := cp.cache.GetOrLoad(ctx, "rentals:"+string(key), func(ctx context.Context) (interface{}, error) {
+		return cp.provider.SearchRentals(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.Rental(nil), value.([]models.Rental)...), nil
+}
@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen is returned when a request is rejected because the upstream's circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker stops calls to a failing upstream after consecutive failures and lets a single
+// probe request through once the cooldown has elapsed
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	failures    int
+	openedAt    time.Time
+	lastFailure time.Time
+	probing     bool
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker that opens after threshold consecutive failures
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// Allow reports whether a request may be sent, returning ErrCircuitOpen if not
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return ErrCircuitOpen
+		}
+		cb.state = BreakerHalfOpen
+		cb.probing = true
+		return nil
+	case BreakerHalfOpen:
+		// Only one probe request at a time while half-open
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	}
+	return nil
+}
+
+// RecordSuccess closes the breaker and resets the failure count
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = BreakerClosed
+	cb.failures = 0
+	cb.probing = false
+}
+
+// RecordCancel releases a probe slot without changing the breaker state, for calls abandoned by the caller
+func (cb *CircuitBreaker) RecordCancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+}
+
+// RecordFailure counts a failure, opening the breaker when the threshold is reached or a probe fails
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.lastFailure = cb.now()
+	cb.probing = false
+
+	if cb.state == BreakerHalfOpen || (cb.threshold > 0 && cb.failures >= cb.threshold) {
+		cb.state = BreakerOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// Status returns a snapshot of the breaker state
+func (cb *CircuitBreaker) Status() models.BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := models.BreakerStatus{
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+	}
+	if !cb.lastFailure.IsZero() {
+		status.LastFailure = cb.lastFailure.UTC().Format(time.RFC3339)
+	}
+	if cb.state == BreakerOpen {
+		status.RetryAt = cb.openedAt.Add(cb.cooldown).UTC().Format(time.RFC3339)
+	}
+	return status
+}
@@ -1,31 +1,453 @@
 package modules
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
 	"github.com/user/cma/models"
 )
 
+// maxComparables is the maximum number of comparables returned in a CMA, unless more are pinned
+// or supplied in the request
+const maxComparables = 6
+
+var (
+	// ErrNotSold is returned when a listing requested as a comparable has no sale price
+	ErrNotSold = errors.New("listing has no sale price")
+
+	// ErrSoldAfterAsOf is returned when a listing requested as a comparable for a retroactive
+	// CMA sold after the date the CMA is computed as of
+	ErrSoldAfterAsOf = errors.New("listing sold after the as-of date")
+)
+
+// asOfLayout is the date format of the as-of date of a retroactive CMA
+const asOfLayout = "2006-01-02"
+
+// DefaultSaleWindowMonths is how many months before the date of a CMA a sale may have closed to
+// be selected as a comparable
+const DefaultSaleWindowMonths = 12
+
+// ComparableError is returned when a listing requested as a comparable can't be used
+type ComparableError struct {
+	ID  string
+	Err error
+}
+
+func (e *ComparableError) Error() string {
+	return "comparable " + e.ID + ": " + e.Err.Error()
+}
+
+func (e *ComparableError) Unwrap() error {
+	return e.Err
+}
+
 // CMAAnalyzer handles the Comparative Market Analysis
 type CMAAnalyzer struct {
-	dataFetcher *DataFetcher
+	dataFetcher      *DataFetcher
+	geocoder         Geocoder
+	saleWindowMonths int
+	now              func() time.Time
 }
 
 // NewCMAAnalyzer creates a new CMAAnalyzer instance
 func NewCMAAnalyzer(df *DataFetcher) *CMAAnalyzer {
 	return &CMAAnalyzer{
-		dataFetcher: df,
+		dataFetcher:      df,
+		saleWindowMonths: DefaultSaleWindowMonths,
+		now:              time.Now,
+	}
+}
+
+// SetGeocoder sets the geocoder used to locate subject properties given by address
+func (ca *CMAAnalyzer) SetGeocoder(geocoder Geocoder) {
+	ca.geocoder = geocoder
+}
+
+// SetSaleWindow sets how many months before the date of a CMA a sale may have closed to be
+// selected as a comparable; 0 selects sales of any age
+func (ca *CMAAnalyzer) SetSaleWindow(months int) {
+	ca.saleWindowMonths = months
+}
+
+// GetComparableProperties fetches comparable properties for a property given by ID, address
+// or coordinates
+func (ca *CMAAnalyzer) GetComparableProperties(ctx context.Context, req models.CMARequest) (*models.CMAResponse, error) {
+	provider := ca.dataFetcher.Provider()
+	if provider == nil {
+		return ca.mockComparableProperties(req), nil
+	}
+	ctx, freshness := WithFreshness(ctx)
+
+	// A retroactive CMA only sees the sales closed by its as-of date
+	var asOf time.Time
+	if req.AsOf != "" {
+		var err error
+		if asOf, err = time.Parse(asOfLayout, req.AsOf); err != nil {
+			return nil, fmt.Errorf("invalid as-of date %q: %w", req.AsOf, err)
+		}
+	}
+
+	// Fetch details of the target property
+	subject, err := ca.resolveSubject(ctx, provider, req)
+	if err != nil {
+		return nil, err
+	}
+
+	propertyType := req.PropertyType
+	if propertyType == "" {
+		propertyType = subject.PropertyType
+	}
+
+	// Search for recently sold properties with similar characteristics in the given radius. The
+	// sale window ends today, or on the as-of date of a retroactive CMA.
+	var soldAfter time.Time
+	if ca.saleWindowMonths > 0 {
+		end := asOf
+		if end.IsZero() {
+			end = ca.now().UTC().Truncate(24 * time.Hour)
+		}
+		soldAfter = end.AddDate(0, -ca.saleWindowMonths, 0)
+	}
+	candidates, err := provider.SearchListings(ctx, models.ListingQuery{
+		PropertyType: propertyType,
+		Statuses:     []string{models.ListingStatusSold},
+		Latitude:     subject.Latitude,
+		Longitude:    subject.Longitude,
+		RadiusMiles:  float64(req.Radius),
+		SoldAfter:    soldAfter,
+		SoldBefore:   asOf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Pinned and manual comparables always count; the best automatic matches fill the remaining slots
+	pinned, err := ca.pinnedComparables(ctx, provider, *subject, req.IncludeIDs, asOf)
+	if err != nil {
+		return nil, err
+	}
+	comparables := append(pinned, ca.manualComparables(req.Comparables)...)
+
+	excluded := make(map[string]bool)
+	for _, id := range req.ExcludeIDs {
+		excluded[id] = true
+	}
+	for _, id := range req.IncludeIDs {
+		excluded[id] = true
+	}
+
+	// Sales the sale conditions policy doesn't accept are reported separately instead of being used
+	var accepted, distressed []models.Listing
+	for _, c := range withoutIDs(candidates, excluded) {
+		if saleConditionsAllowed(c, req.SaleConditions) {
+			accepted = append(accepted, c)
+		} else {
+			distressed = append(distressed, c)
+		}
+	}
+
+	auto := ca.selectComparables(*subject, accepted, float64(req.Radius))
+	if slots := maxComparables - len(comparables); slots > 0 {
+		comparables = append(comparables, auto[:min(slots, len(auto))]...)
+	}
+
+	distressedSales := ca.rankComparables(*subject, distressed, float64(req.Radius), "")
+	if len(distressedSales) > maxComparables {
+		distressedSales = distressedSales[:maxComparables]
+	}
+
+	// Active and pending listings nearby are the competition the subject would be listed against.
+	// Listings only reflect the market today, so a retroactive CMA has none.
+	var active, pending []models.CompetingListing
+	if asOf.IsZero() {
+		listed, err := provider.SearchListings(ctx, models.ListingQuery{
+			PropertyType: propertyType,
+			Statuses:     []string{models.ListingStatusActive, models.ListingStatusPending},
+			Latitude:     subject.Latitude,
+			Longitude:    subject.Longitude,
+			RadiusMiles:  float64(req.Radius),
+		})
+		if err != nil {
+			return nil, err
+		}
+		active, pending = ca.selectCompetition(*subject, withoutIDs(listed, excluded), float64(req.Radius))
+	}
+
+	// Calculate the estimated value based on comparables
+	return &models.CMAResponse{
+		PropertyID:      subject.ID,
+		Address:         ListingAddress(*subject).String(),
+		Comparables:     comparables,
+		EstimatedValue:  ca.estimateValue(*subject, comparables),
+		DistressedSales: distressedSales,
+		ActiveListings:  active,
+		PendingListings: pending,
+		DataFreshness:   freshness.Freshness(),
+		AsOf:            req.AsOf,
+	}, nil
+}
+
+// salesNear returns a CMA request's subject and the sales within its radius that closed on or
+// after soldAfter and pass its sale conditions, most similar first. Unlike the comparables of a
+// CMA, every such sale is returned. Without a listings provider there are none.
+func (ca *CMAAnalyzer) salesNear(ctx context.Context, req models.CMARequest, soldAfter time.Time) (*models.Listing, []models.Comparable, error) {
+	provider := ca.dataFetcher.Provider()
+	if provider == nil {
+		return nil, nil, nil
+	}
+
+	subject, err := ca.resolveSubject(ctx, provider, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	propertyType := req.PropertyType
+	if propertyType == "" {
+		propertyType = subject.PropertyType
+	}
+	sales, err := provider.SearchListings(ctx, models.ListingQuery{
+		PropertyType: propertyType,
+		Statuses:     []string{models.ListingStatusSold},
+		Latitude:     subject.Latitude,
+		Longitude:    subject.Longitude,
+		RadiusMiles:  float64(req.Radius),
+		SoldAfter:    soldAfter,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	excluded := make(map[string]bool)
+	for _, id := range req.ExcludeIDs {
+		excluded[id] = true
+	}
+	var accepted []models.Listing
+	for _, s := range withoutIDs(sales, excluded) {
+		if saleConditionsAllowed(s, req.SaleConditions) {
+			accepted = append(accepted, s)
+		}
+	}
+	return subject, ca.rankComparables(*subject, accepted, float64(req.Radius), models.ComparableSelectionAuto), nil
+}
+
+// selectComparables ranks sold candidates by similarity to the subject, drops price outliers
+// and returns the closest matches
+func (ca *CMAAnalyzer) selectComparables(subject models.Listing, candidates []models.Listing, radius float64) []models.Comparable {
+	comparables := removePriceOutliers(ca.rankComparables(subject, candidates, radius, models.ComparableSelectionAuto))
+	if len(comparables) > maxComparables {
+		comparables = comparables[:maxComparables]
+	}
+	return comparables
+}
+
+// rankComparables converts sold candidates into comparables, most similar to the subject first
+func (ca *CMAAnalyzer) rankComparables(subject models.Listing, candidates []models.Listing, radius float64, selection string) []models.Comparable {
+	comparables := make([]models.Comparable, 0, len(candidates))
+	for _, r := range rankListings(subject, candidates, radius) {
+		if r.listing.SalePrice > 0 {
+			comparables = append(comparables, ca.toComparable(r.listing, r.distance, selection))
+		}
+	}
+	return comparables
+}
+
+// selectCompetition returns the active and pending listings most similar to the subject
+func (ca *CMAAnalyzer) selectCompetition(subject models.Listing, candidates []models.Listing, radius float64) (active, pending []models.CompetingListing) {
+	for _, r := range rankListings(subject, candidates, radius) {
+		switch r.listing.Status {
+		case models.ListingStatusActive:
+			if len(active) < maxComparables {
+				active = append(active, ca.toCompetingListing(r.listing, r.distance))
+			}
+		case models.ListingStatusPending:
+			if len(pending) < maxComparables {
+				pending = append(pending, ca.toCompetingListing(r.listing, r.distance))
+			}
+		}
+	}
+	return active, pending
+}
+
+// rankedListing is a candidate listing with its distance from the subject and similarity score
+type rankedListing struct {
+	listing  models.Listing
+	distance float64
+	score    float64
+}
+
+// rankListings orders candidates by similarity to the subject, most similar first, leaving out
+// the subject's own listing
+func rankListings(subject models.Listing, candidates []models.Listing, radius float64) []rankedListing {
+	var ranked []rankedListing
+	for _, c := range candidates {
+		if subject.ID != "" && c.ID == subject.ID {
+			continue
+		}
+		distance := DistanceMiles(subject.Latitude, subject.Longitude, c.Latitude, c.Longitude)
+		ranked = append(ranked, rankedListing{
+			listing:  c,
+			distance: distance,
+			score:    similarityScore(subject, c, distance, radius),
+		})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score < ranked[j].score
+	})
+	return ranked
+}
+
+// pinnedComparables fetches the listings requested as comparables, in the order given. With an
+// as-of date, they must have sold by then.
+func (ca *CMAAnalyzer) pinnedComparables(ctx context.Context, provider ListingProvider, subject models.Listing, ids []string, asOf time.Time) ([]models.Comparable, error) {
+	var comparables []models.Comparable
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		listing, err := provider.GetListing(ctx, id)
+		if errors.Is(err, ErrListingNotFound) {
+			return nil, &ComparableError{ID: id, Err: err}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if listing.SalePrice <= 0 {
+			return nil, &ComparableError{ID: id, Err: ErrNotSold}
+		}
+		if !asOf.IsZero() && listing.SaleDate.After(asOf) {
+			return nil, &ComparableError{ID: id, Err: ErrSoldAfterAsOf}
+		}
+
+		distance := DistanceMiles(subject.Latitude, subject.Longitude, listing.Latitude, listing.Longitude)
+		if !hasCoordinates(subject) || !hasCoordinates(*listing) {
+			distance = 0
+		}
+		comparables = append(comparables, ca.toComparable(*listing, distance, models.ComparableSelectionPinned))
+	}
+	return comparables, nil
+}
+
+// manualComparables completes the comparables supplied in a request
+func (ca *CMAAnalyzer) manualComparables(supplied []models.Comparable) []models.Comparable {
+	comparables := make([]models.Comparable, 0, len(supplied))
+	for _, comp := range supplied {
+		comp.Address = NormalizeAddress(comp.Address)
+		comp.PricePerSqft = ca.CalculatePricePerSqft(comp.SalePrice, comp.Sqft)
+		comp.Provenance = nil
+		comp.Selection = models.ComparableSelectionManual
+		comparables = append(comparables, comp)
+	}
+	return comparables
+}
+
+// toComparable converts a sold listing into a Comparable
+func (ca *CMAAnalyzer) toComparable(l models.Listing, distance float64, selection string) models.Comparable {
+	var saleConditions []string
+	if !IsStandardSale(l) {
+		saleConditions = l.SaleConditions
+	}
+
+	return models.Comparable{
+		ID:             l.ID,
+		Address:        NormalizeAddress(l.Address),
+		SalePrice:      l.SalePrice,
+		Sqft:           l.Sqft,
+		PricePerSqft:   ca.CalculatePricePerSqft(l.SalePrice, l.Sqft),
+		Bedrooms:       l.Bedrooms,
+		Bathrooms:      l.Bathrooms,
+		SaleDate:       formatDate(l.SaleDate),
+		ListPrice:      l.ListPrice,
+		DaysOnMarket:   l.DaysOnMarket,
+		DistanceMiles:  math.Round(distance*100) / 100,
+		Provenance:     comparableProvenance(l),
+		Selection:      selection,
+		SaleConditions: saleConditions,
 	}
 }
 
-// GetComparableProperties fetches comparable properties for a given property ID
-func (ca *CMAAnalyzer) GetComparableProperties(req models.CMARequest) (*models.CMAResponse, error) {
-	// In a real implementation, we would:
-	// 1. Fetch details of the target property
-	// 2. Search for recently sold properties with similar characteristics in the given radius
-	// 3. Calculate the estimated value based on comparables
+// toCompetingListing converts an active or pending listing into a CompetingListing
+func (ca *CMAAnalyzer) toCompetingListing(l models.Listing, distance float64) models.CompetingListing {
+	return models.CompetingListing{
+		ID:            l.ID,
+		Address:       NormalizeAddress(l.Address),
+		Status:        l.Status,
+		ListPrice:     l.ListPrice,
+		Sqft:          l.Sqft,
+		PricePerSqft:  ca.CalculatePricePerSqft(l.ListPrice, l.Sqft),
+		Bedrooms:      l.Bedrooms,
+		Bathrooms:     l.Bathrooms,
+		ListDate:      formatDate(l.ListDate),
+		DaysOnMarket:  l.DaysOnMarket,
+		DistanceMiles: math.Round(distance*100) / 100,
+	}
+}
+
+// withoutIDs returns the listings whose IDs are not in the excluded set
+func withoutIDs(listings []models.Listing, excluded map[string]bool) []models.Listing {
+	if len(excluded) == 0 {
+		return listings
+	}
+
+	filtered := make([]models.Listing, 0, len(listings))
+	for _, l := range listings {
+		if !excluded[l.ID] {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
+
+// comparableFields are the listing fields reported on a Comparable, keyed by their JSON name
+var comparableFields = []string{
+	"id", "address", "sale_price", "sqft", "bedrooms", "bathrooms", "sale_date", "list_price", "days_on_market",
+}
+
+// comparableProvenance returns the provenance of a merged listing's fields shown on a Comparable
+func comparableProvenance(l models.Listing) map[string]string {
+	if len(l.Provenance) == 0 {
+		return nil
+	}
+
+	provenance := make(map[string]string)
+	for _, field := range comparableFields {
+		if source, ok := l.Provenance[field]; ok {
+			provenance[field] = source
+		}
+	}
+	return provenance
+}
+
+// estimateValue applies the comparables' average price per square foot to the subject's size,
+// falling back to the average sale price when the subject's size is unknown
+func (ca *CMAAnalyzer) estimateValue(subject models.Listing, comparables []models.Comparable) int {
+	if len(comparables) == 0 {
+		return 0
+	}
+
+	var totalPrice, totalPricePerSqft, sized int
+	for _, comp := range comparables {
+		totalPrice += comp.SalePrice
+		if comp.PricePerSqft > 0 {
+			totalPricePerSqft += comp.PricePerSqft
+			sized++
+		}
+	}
 
-	// For now, we're returning mock data
-	// This can be extended to use real data sources
+	if subject.Sqft > 0 && sized > 0 {
+		return totalPricePerSqft / sized * subject.Sqft
+	}
+	return totalPrice / len(comparables)
+}
 
+// mockComparableProperties returns mock data when no listing provider is configured
+func (ca *CMAAnalyzer) mockComparableProperties(req models.CMARequest) *models.CMAResponse {
 	// Mocked comparables for demonstration
 	comparables := []models.Comparable{
 		{
@@ -63,7 +485,7 @@ func (ca *CMAAnalyzer) GetComparableProperties(req models.CMARequest) (*models.C
 		PropertyID:     req.PropertyID,
 		Comparables:    comparables,
 		EstimatedValue: estimatedValue,
-	}, nil
+	}
 }
 
 // CalculatePricePerSqft calculates the price per square foot for a property
@@ -73,3 +495,78 @@ func (ca *CMAAnalyzer) CalculatePricePerSqft(price, sqft int) int {
 	}
 	return price / sqft
 }
+
+// similarityScore scores how closely a candidate matches the subject; lower is more similar
+func similarityScore(subject, candidate models.Listing, distance, radius float64) float64 {
+	score := 0.0
+
+	if subject.Sqft > 0 && candidate.Sqft > 0 {
+		score += math.Abs(float64(candidate.Sqft-subject.Sqft)) / float64(subject.Sqft)
+	}
+	score += 0.1 * math.Abs(float64(candidate.Bedrooms-subject.Bedrooms))
+	score += 0.1 * math.Abs(candidate.Bathrooms-subject.Bathrooms)
+	if radius > 0 {
+		score += 0.5 * distance / radius
+	}
+	if len(subject.Features) > 0 && len(candidate.Features) > 0 {
+		score += 0.2 * (1 - featureOverlap(subject.Features, candidate.Features))
+	}
+
+	return score
+}
+
+// removePriceOutliers drops comparables whose price per square foot falls outside 1.5 IQR
+// of the others; small sets are returned unchanged. Comparables of unknown size have no price
+// per square foot, so they neither count toward the range nor are dropped.
+func removePriceOutliers(comparables []models.Comparable) []models.Comparable {
+	var values []float64
+	for _, comp := range comparables {
+		if comp.PricePerSqft > 0 {
+			values = append(values, float64(comp.PricePerSqft))
+		}
+	}
+	if len(values) < 4 {
+		return comparables
+	}
+	low, high := outlierBounds(values)
+
+	filtered := comparables[:0:0]
+	for _, comp := range comparables {
+		ppsf := float64(comp.PricePerSqft)
+		if ppsf == 0 || (ppsf >= low && ppsf <= high) {
+			filtered = append(filtered, comp)
+		}
+	}
+	return filtered
+}
+
+// outlierBounds returns the range within 1.5 IQR of the quartiles of the values
+func outlierBounds(values []float64) (low, high float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	q1 := percentile(sorted, 25)
+	q3 := percentile(sorted, 75)
+	iqr := q3 - q1
+	return q1 - 1.5*iqr, q3 + 1.5*iqr
+}
+
+// featureOverlap returns the share of the distinct features in either list that both lists have
+func featureOverlap(a, b []string) float64 {
+	setA := make(map[string]bool)
+	for _, feature := range a {
+		setA[feature] = true
+	}
+	setB := make(map[string]bool)
+	for _, feature := range b {
+		setB[feature] = true
+	}
+
+	shared := 0
+	for feature := range setB {
+		if setA[feature] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
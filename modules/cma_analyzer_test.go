@@ -0,0 +1,503 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func newFileDataFetcher(t *testing.T) *DataFetcher {
+	t.Helper()
+
+	fp, err := NewFileProvider(FileProviderConfig{Path: "testdata/listings.csv", RentalsPath: "testdata/rentals.csv"})
+	if err != nil {
+		t.Fatalf("Expected no error loading listings but got: %v", err)
+	}
+
+	df := NewDataFetcher()
+	df.SetProvider(fp)
+	return df
+}
+
+// newTestCMAAnalyzer creates a CMAAnalyzer whose sale window ends on June 1, 2024, after the last
+// sale in the test data
+func newTestCMAAnalyzer(df *DataFetcher) *CMAAnalyzer {
+	analyzer := NewCMAAnalyzer(df)
+	analyzer.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	return analyzer
+}
+
+func TestGetComparablePropertiesFromFile(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID: "S1",
+		Radius:     5,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// C6 is a non-arm's-length sale, D1 is a condo and F1 is outside the radius
+	if len(result.Comparables) != 5 {
+		t.Fatalf("Expected 5 comparables but got %d", len(result.Comparables))
+	}
+	for _, comp := range result.Comparables {
+		switch comp.ID {
+		case "S1", "C6", "D1", "F1":
+			t.Errorf("Unexpected comparable %s", comp.ID)
+		}
+	}
+
+	// Most similar comparable comes first
+	if result.Comparables[0].ID != "C2" {
+		t.Errorf("Expected C2 to be the closest match but got %s", result.Comparables[0].ID)
+	}
+
+	if result.EstimatedValue != 836*1400 {
+		t.Errorf("Expected estimated value %d but got %d", 836*1400, result.EstimatedValue)
+	}
+}
+
+func TestGetComparablePropertiesNotFound(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	_, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{PropertyID: "missing", Radius: 5})
+	if !errors.Is(err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound but got %v", err)
+	}
+}
+
+func TestGetComparablePropertiesByAddress(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	tests := []struct {
+		name string
+		req  models.CMARequest
+	}{
+		{"Address with ZIP code", models.CMARequest{Address: "100 Valencia Street, San Francisco, CA 94103", Radius: 5}},
+		{"Address with city", models.CMARequest{Address: "100 valencia st, San Francisco", Radius: 5}},
+		{"Address with coordinates", models.CMARequest{Address: "100 Valencia St", Latitude: 37.7707, Longitude: -122.4221, Radius: 5}},
+		{"Coordinates only", models.CMARequest{Latitude: 37.7706, Longitude: -122.4222, Radius: 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := analyzer.GetComparableProperties(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if result.PropertyID != "S1" {
+				t.Errorf("Expected subject S1 but got %s", result.PropertyID)
+			}
+			if result.Address != "100 Valencia St, San Francisco, CA 94103" {
+				t.Errorf("Expected normalized subject address but got %q", result.Address)
+			}
+			if len(result.Comparables) != 5 {
+				t.Errorf("Expected 5 comparables but got %d", len(result.Comparables))
+			}
+		})
+	}
+
+	_, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{Address: "100 Valencia St", Radius: 5})
+	if !errors.Is(err, ErrIncompleteAddress) {
+		t.Errorf("Expected ErrIncompleteAddress but got %v", err)
+	}
+
+	_, err = analyzer.GetComparableProperties(context.Background(), models.CMARequest{Address: "1 Nowhere Ln, San Francisco, CA", Radius: 5})
+	if !errors.Is(err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound but got %v", err)
+	}
+}
+
+func TestGetComparablePropertiesAmbiguousAddress(t *testing.T) {
+	listDate := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: []models.Listing{
+		{ID: "U2", Address: "45 Oak Ave Apt 2", City: "San Francisco", State: "CA", ZipCode: "94102", Status: models.ListingStatusActive, ListDate: listDate},
+		// An earlier record of the same unit with a ZIP+4 code
+		{ID: "U2-2019", Address: "45 Oak Avenue #2", City: "San Francisco", State: "CA", ZipCode: "94102-3318", Status: models.ListingStatusSold, SaleDate: listDate.AddDate(-5, 0, 0)},
+		{ID: "U3", Address: "45 Oak Ave Apt 3", City: "San Francisco", State: "CA", ZipCode: "94102", Status: models.ListingStatusSold, SaleDate: listDate.AddDate(-1, 0, 0)},
+	}})
+	analyzer := newTestCMAAnalyzer(df)
+	geocoder, err := NewFileGeocoder("testdata/geocoder.csv")
+	if err != nil {
+		t.Fatalf("Expected no error loading geocoder but got: %v", err)
+	}
+	analyzer.SetGeocoder(geocoder)
+
+	_, err = analyzer.GetComparableProperties(context.Background(), models.CMARequest{Address: "45 Oak Ave, San Francisco, CA 94102", Radius: 1})
+	var ambiguous *AmbiguousSubjectError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("Expected AmbiguousSubjectError but got %v", err)
+	}
+	if len(ambiguous.Candidates) != 2 || ambiguous.Candidates[0].ID != "U2" || ambiguous.Candidates[1].ID != "U3" {
+		t.Errorf("Expected candidates U2 and U3 but got %+v", ambiguous.Candidates)
+	}
+
+	// The unit disambiguates, and the current listing wins over the earlier sale of the same unit
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{Address: "45 Oak Avenue #2, San Francisco, CA 94102-3318", Radius: 1})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if result.PropertyID != "U2" {
+		t.Errorf("Expected subject U2 but got %s", result.PropertyID)
+	}
+}
+
+func TestFileGeocoder(t *testing.T) {
+	geocoder, err := NewFileGeocoder("testdata/geocoder.csv")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	tests := []struct {
+		address           string
+		expectedPrecision string
+		expectedLatitude  float64
+	}{
+		{"100 Valencia St, San Francisco, CA", GeocodePrecisionAddress, 37.7706},
+		{"100 Valencia Street Apt 1, 94103", GeocodePrecisionAddress, 37.7706},
+		{"100 Valencia St, San Francisco, CA 94103-1234", GeocodePrecisionAddress, 37.7706},
+		{"200 Valencia St, San Francisco, CA 94103", GeocodePrecisionZip, 37.7725},
+		{"200 Valencia St, 94103-1234", GeocodePrecisionZip, 37.7725},
+		{"1 Market St, San Francisco, CA", GeocodePrecisionCity, 37.7749},
+	}
+
+	for _, tt := range tests {
+		result, err := geocoder.Geocode(context.Background(), ParseAddress(tt.address))
+		if err != nil {
+			t.Errorf("Expected no error for %q but got: %v", tt.address, err)
+			continue
+		}
+		if result.Precision != tt.expectedPrecision || result.Latitude != tt.expectedLatitude {
+			t.Errorf("Expected %s precision at %v for %q but got %+v", tt.expectedPrecision, tt.expectedLatitude, tt.address, result)
+		}
+	}
+
+	if _, err := geocoder.Geocode(context.Background(), ParseAddress("1 Main St, Oakland, CA")); !errors.Is(err, ErrAddressNotGeocoded) {
+		t.Errorf("Expected ErrAddressNotGeocoded but got %v", err)
+	}
+}
+
+func TestGetComparablePropertiesAdHocSubject(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+	subject := &models.SubjectProperty{
+		Address:      "100 Valencia Street",
+		City:         "San Francisco",
+		State:        "CA",
+		ZipCode:      "94103",
+		PropertyType: "Single-family",
+		Bedrooms:     3,
+		Bathrooms:    2,
+		Sqft:         1400,
+		YearBuilt:    2024,
+		Features:     []string{"Garage", " roof deck "},
+	}
+
+	_, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{Subject: subject, Radius: 5})
+	if !errors.Is(err, ErrSubjectNotLocated) {
+		t.Errorf("Expected ErrSubjectNotLocated without coordinates or geocoder but got %v", err)
+	}
+
+	geocoder, err := NewFileGeocoder("testdata/geocoder.csv")
+	if err != nil {
+		t.Fatalf("Expected no error loading geocoder but got: %v", err)
+	}
+	analyzer.SetGeocoder(geocoder)
+
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{Subject: subject, Radius: 5})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if result.PropertyID != "" || result.Address != "100 Valencia St, San Francisco, CA 94103" {
+		t.Errorf("Expected an ad-hoc subject at the normalized address but got %q, %q", result.PropertyID, result.Address)
+	}
+	if len(result.Comparables) != 5 || result.Comparables[0].ID != "C2" {
+		t.Errorf("Expected 5 comparables led by C2 but got %+v", result.Comparables)
+	}
+	if result.EstimatedValue != 836*1400 {
+		t.Errorf("Expected estimated value %d but got %d", 836*1400, result.EstimatedValue)
+	}
+}
+
+func TestFeatureOverlap(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected float64
+	}{
+		{[]string{"garage", "view"}, []string{"garage", "view"}, 1},
+		{[]string{"garage", "view"}, []string{"garage", "pool"}, 1.0 / 3},
+		{[]string{"garage"}, []string{"pool"}, 0},
+		{[]string{"garage", "garage"}, []string{"garage"}, 1},
+	}
+
+	for _, tt := range tests {
+		if result := featureOverlap(tt.a, tt.b); result != tt.expected {
+			t.Errorf("Expected overlap %v for %v and %v but got %v", tt.expected, tt.a, tt.b, result)
+		}
+	}
+}
+
+func TestRemovePriceOutliers(t *testing.T) {
+	comparables := []models.Comparable{
+		{ID: "A", PricePerSqft: 900},
+		{ID: "B", PricePerSqft: 950},
+		{ID: "U1"},
+		{ID: "C", PricePerSqft: 1000},
+		{ID: "D", PricePerSqft: 1050},
+		{ID: "U2"},
+		{ID: "HIGH", PricePerSqft: 3000},
+	}
+
+	// Comparables of unknown size are kept and don't widen the range that drops HIGH
+	var ids []string
+	for _, comp := range removePriceOutliers(comparables) {
+		ids = append(ids, comp.ID)
+	}
+	if expected := []string{"A", "B", "U1", "C", "D", "U2"}; !slices.Equal(ids, expected) {
+		t.Errorf("Expected %v but got %v", expected, ids)
+	}
+
+	// Too few sized comparables to judge outliers leaves the set unchanged
+	if result := removePriceOutliers(comparables[:5]); len(result) != 5 {
+		t.Errorf("Expected 5 comparables but got %d", len(result))
+	}
+}
+
+func TestGetComparablePropertiesOverrides(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID:  "S1",
+		Radius:      5,
+		IncludeIDs:  []string{"F1", "C6"},
+		ExcludeIDs:  []string{"C2"},
+		Comparables: []models.Comparable{{Address: "5 Test Court", SalePrice: 1000000, Sqft: 1250}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// F1 is outside the radius and C6 is a price outlier, but pinned comparables are always kept
+	if len(result.Comparables) != maxComparables {
+		t.Fatalf("Expected %d comparables but got %d", maxComparables, len(result.Comparables))
+	}
+	expected := []struct{ id, selection string }{
+		{"F1", models.ComparableSelectionPinned},
+		{"C6", models.ComparableSelectionPinned},
+		{"", models.ComparableSelectionManual},
+	}
+	for i, e := range expected {
+		comp := result.Comparables[i]
+		if comp.ID != e.id || comp.Selection != e.selection {
+			t.Errorf("Expected comparable %d to be %q (%s) but got %q (%s)", i, e.id, e.selection, comp.ID, comp.Selection)
+		}
+	}
+	if manual := result.Comparables[2]; manual.Address != "5 Test Ct" || manual.PricePerSqft != 800 {
+		t.Errorf("Expected the manual comparable at 5 Test Ct with 800 per sqft but got %+v", manual)
+	}
+	for _, comp := range result.Comparables[3:] {
+		if comp.Selection != models.ComparableSelectionAuto {
+			t.Errorf("Expected %s to be selected automatically but got %s", comp.ID, comp.Selection)
+		}
+		if comp.ID == "C2" {
+			t.Error("Expected excluded comparable C2 to be left out")
+		}
+	}
+
+	tests := []struct {
+		id       string
+		expected error
+	}{
+		{"missing", ErrListingNotFound},
+		{"S1", ErrNotSold},
+	}
+	for _, tt := range tests {
+		_, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{PropertyID: "C1", Radius: 5, IncludeIDs: []string{tt.id}})
+		var comparableErr *ComparableError
+		if !errors.As(err, &comparableErr) || comparableErr.ID != tt.id || !errors.Is(err, tt.expected) {
+			t.Errorf("Expected a ComparableError for %s wrapping %v but got %v", tt.id, tt.expected, err)
+		}
+	}
+}
+
+func TestGetComparablePropertiesSaleConditions(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	// By default only standard sales are used; C6 is reported separately
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(result.DistressedSales) != 1 || result.DistressedSales[0].ID != "C6" {
+		t.Fatalf("Expected C6 as the only distressed sale but got %+v", result.DistressedSales)
+	}
+	conditions := result.DistressedSales[0].SaleConditions
+	if len(conditions) != 1 || conditions[0] != models.SaleConditionRelatedParty {
+		t.Errorf("Expected sale conditions [%s] but got %v", models.SaleConditionRelatedParty, conditions)
+	}
+	if result.DistressedSales[0].Selection != "" {
+		t.Errorf("Expected no selection for a distressed sale but got %s", result.DistressedSales[0].Selection)
+	}
+
+	// Accepting every condition leaves nothing to report separately
+	result, err = analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID:     "S1",
+		Radius:         5,
+		SaleConditions: []string{models.SaleConditionsAll},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(result.DistressedSales) != 0 {
+		t.Errorf("Expected no distressed sales but got %d", len(result.DistressedSales))
+	}
+
+	// Accepting related-party sales only reports the standard sales separately
+	result, err = analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID:     "S1",
+		Radius:         5,
+		SaleConditions: []string{models.SaleConditionRelatedParty},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(result.Comparables) != 1 || result.Comparables[0].ID != "C6" {
+		t.Errorf("Expected C6 as the only comparable but got %+v", result.Comparables)
+	}
+	if len(result.DistressedSales) != 5 {
+		t.Errorf("Expected 5 sales reported separately but got %d", len(result.DistressedSales))
+	}
+}
+
+func TestGetComparablePropertiesCompetition(t *testing.T) {
+	listDate := time.Date(2024, 4, 18, 0, 0, 0, 0, time.UTC)
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", Latitude: 37.7706, Longitude: -122.4222, Status: models.ListingStatusActive, Bedrooms: 3, Bathrooms: 2, Sqft: 1400, ListPrice: 1195000},
+		{ID: "C1", Address: "123 Main St", Latitude: 37.7712, Longitude: -122.4210, Status: models.ListingStatusSold, Bedrooms: 3, Bathrooms: 2, Sqft: 1300, SalePrice: 1100000, SaleDate: listDate},
+		{ID: "A1", Address: "310 Noe St", Latitude: 37.7645, Longitude: -122.4330, Status: models.ListingStatusActive, Bedrooms: 4, Bathrooms: 3, Sqft: 1900, ListPrice: 1595000},
+		{ID: "A2", Address: "77 Hayes Street", Latitude: 37.7772, Longitude: -122.4205, Status: models.ListingStatusActive, Bedrooms: 3, Bathrooms: 2, Sqft: 1450, ListPrice: 1249000, ListDate: listDate, DaysOnMarket: 23},
+		{ID: "A3", Address: "10 Far Away Rd", Latitude: 37.8044, Longitude: -122.2712, Status: models.ListingStatusActive, Sqft: 1400, ListPrice: 850000},
+		{ID: "A4", Address: "9 Dolores St", Latitude: 37.7660, Longitude: -122.4260, Status: models.ListingStatusActive, Sqft: 1400, ListPrice: 1100000},
+		{ID: "P1", Address: "15 Fell St", Latitude: 37.7760, Longitude: -122.4190, Status: models.ListingStatusPending, Bedrooms: 3, Bathrooms: 2, Sqft: 1380, ListPrice: 1150000},
+	}})
+	analyzer := newTestCMAAnalyzer(df)
+
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID: "S1",
+		Radius:     5,
+		ExcludeIDs: []string{"A4"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// The subject's own listing, excluded listings and listings outside the radius are left out
+	expectedActive := []string{"A2", "A1"}
+	if len(result.ActiveListings) != len(expectedActive) {
+		t.Fatalf("Expected %d active listings but got %+v", len(expectedActive), result.ActiveListings)
+	}
+	for i, id := range expectedActive {
+		if result.ActiveListings[i].ID != id {
+			t.Errorf("Expected active listing %d to be %s but got %s", i, id, result.ActiveListings[i].ID)
+		}
+	}
+
+	closest := result.ActiveListings[0]
+	if closest.Address != "77 Hayes St" {
+		t.Errorf("Expected address 77 Hayes St but got %s", closest.Address)
+	}
+	if closest.PricePerSqft != 861 {
+		t.Errorf("Expected price per sqft 861 but got %d", closest.PricePerSqft)
+	}
+	if closest.ListDate != "2024-04-18" || closest.DaysOnMarket != 23 {
+		t.Errorf("Expected listing date 2024-04-18 and 23 days on market but got %s and %d", closest.ListDate, closest.DaysOnMarket)
+	}
+
+	if len(result.PendingListings) != 1 || result.PendingListings[0].ID != "P1" {
+		t.Errorf("Expected P1 as the only pending listing but got %+v", result.PendingListings)
+	}
+	if len(result.Comparables) != 1 || result.Comparables[0].ID != "C1" {
+		t.Errorf("Expected C1 as the only comparable but got %+v", result.Comparables)
+	}
+}
+
+func TestGetComparablePropertiesAsOf(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	// Only C1, C2 and C5 had sold nearby by March 10, 2024
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID: "S1",
+		Radius:     5,
+		AsOf:       "2024-03-10",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if result.AsOf != "2024-03-10" {
+		t.Errorf("Expected as-of date 2024-03-10 but got %q", result.AsOf)
+	}
+	if len(result.Comparables) != 3 {
+		t.Fatalf("Expected 3 comparables but got %+v", result.Comparables)
+	}
+	for _, comp := range result.Comparables {
+		if comp.SaleDate > "2024-03-10" {
+			t.Errorf("Expected no sales after the as-of date but got %s on %s", comp.ID, comp.SaleDate)
+		}
+	}
+	if len(result.ActiveListings) != 0 || len(result.PendingListings) != 0 {
+		t.Errorf("Expected no competing listings in a retroactive CMA but got %+v", result.ActiveListings)
+	}
+
+	_, err = analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID: "S1",
+		Radius:     5,
+		AsOf:       "2024-03-10",
+		IncludeIDs: []string{"C3"},
+	})
+	if !errors.Is(err, ErrSoldAfterAsOf) {
+		t.Errorf("Expected ErrSoldAfterAsOf but got %v", err)
+	}
+}
+
+func TestGetComparablePropertiesSaleWindow(t *testing.T) {
+	subject := models.Listing{ID: "S1", Address: "100 Valencia St", Latitude: 37.7706, Longitude: -122.4222,
+		Status: models.ListingStatusActive, Sqft: 1300, PropertyType: "Single-family"}
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: []models.Listing{
+		subject,
+		soldListing("OLD", 700000, time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)),
+		soldListing("NEW", 1100000, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)),
+	}})
+	analyzer := newTestCMAAnalyzer(df)
+
+	// A sale from years before the CMA date is not averaged into the estimate
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(result.Comparables) != 1 || result.Comparables[0].ID != "NEW" {
+		t.Fatalf("Expected NEW as the only comparable but got %+v", result.Comparables)
+	}
+
+	// A retroactive CMA looks back from its as-of date
+	result, err = analyzer.GetComparableProperties(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5, AsOf: "2022-01-01"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(result.Comparables) != 1 || result.Comparables[0].ID != "OLD" {
+		t.Errorf("Expected OLD as the only comparable as of 2022-01-01 but got %+v", result.Comparables)
+	}
+
+	analyzer.SetSaleWindow(0)
+	result, _ = analyzer.GetComparableProperties(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5})
+	if len(result.Comparables) != 2 {
+		t.Errorf("Expected sales of any age without a sale window but got %+v", result.Comparables)
+	}
+}
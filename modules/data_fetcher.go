@@ -1,51 +1,474 @@
 package modules
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/user/cma/models"
 )
 
+// FetcherConfig configures timeouts, retries and circuit breaking for a DataFetcher
+type FetcherConfig struct {
+	// Timeout for a single HTTP attempt
+	Timeout time.Duration
+
+	// Number of retries after the first attempt for 429, 5xx and network errors
+	MaxRetries int
+
+	// Initial and maximum backoff between retries; each retry waits a random duration up to
+	// BaseBackoff * 2^attempt, capped at MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Consecutive failed calls to a host before its circuit breaker opens
+	BreakerThreshold int
+
+	// Time an open breaker rejects calls before letting a probe through
+	BreakerCooldown time.Duration
+
+	// Maximum decompressed size of a response body
+	MaxBodyBytes int64
+
+	// Request rate and daily quota per upstream host; hosts without an entry use DefaultRateLimit
+	RateLimits       map[string]RateLimit
+	DefaultRateLimit RateLimit
+}
+
+// DefaultFetcherConfig returns the default DataFetcher configuration
+func DefaultFetcherConfig() FetcherConfig {
+	return FetcherConfig{
+		Timeout:          time.Second * 10,
+		MaxRetries:       3,
+		BaseBackoff:      time.Millisecond * 200,
+		MaxBackoff:       time.Second * 5,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Second * 30,
+		MaxBodyBytes:     50 << 20,
+	}
+}
+
+// CacheSettings configures the response caches of a DataFetcher
+type CacheSettings struct {
+	// TTL for individual listings and listing searches
+	ListingsTTL time.Duration
+
+	// TTL for computed aggregates such as market trends
+	AggregatesTTL time.Duration
+
+	// Time after expiry during which stale entries are served while being refreshed
+	StaleTTL time.Duration
+
+	// Maximum entries per cache
+	MaxEntries int
+}
+
+// DefaultCacheSettings returns the default cache configuration
+func DefaultCacheSettings() CacheSettings {
+	return CacheSettings{
+		ListingsTTL:   time.Minute * 15,
+		AggregatesTTL: time.Hour,
+		StaleTTL:      time.Minute * 5,
+		MaxEntries:    1000,
+	}
+}
+
+// Cache names used by DataFetcher
+const (
+	CacheListings   = "listings"
+	CacheAggregates = "aggregates"
+)
+
+// StatusError is returned when an upstream responds with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
 // DataFetcher handles fetching data from external API sources
 type DataFetcher struct {
-	client *http.Client
+	client   *http.Client
+	provider ListingProvider
+	config   FetcherConfig
+	sleep    func(context.Context, time.Duration) error
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+	limiters map[string]*hostLimiter
+
+	caches         map[string]*Cache
+	cachedProvider ListingProvider
+
+	validators *ValidatorStore
 }
 
-// NewDataFetcher creates a new DataFetcher instance
+// NewDataFetcher creates a new DataFetcher instance with the default configuration
 func NewDataFetcher() *DataFetcher {
+	return NewDataFetcherWithConfig(DefaultFetcherConfig())
+}
+
+// NewDataFetcherWithConfig creates a new DataFetcher instance with the given configuration
+func NewDataFetcherWithConfig(cfg FetcherConfig) *DataFetcher {
 	return &DataFetcher{
 		client: &http.Client{
-			Timeout: time.Second * 10,
+			Timeout: cfg.Timeout,
 		},
+		config:   cfg,
+		sleep:    sleepContext,
+		breakers: make(map[string]*CircuitBreaker),
+		limiters: make(map[string]*hostLimiter),
+	}
+}
+
+// SetProvider sets the listing provider used to serve property data
+func (df *DataFetcher) SetProvider(p ListingProvider) {
+	df.provider = p
+	df.wrapProvider()
+}
+
+// Provider returns the configured listing provider, or nil when only mock data is available.
+// When caching is enabled the provider is wrapped by the listings cache.
+func (df *DataFetcher) Provider() ListingProvider {
+	if df.cachedProvider != nil {
+		return df.cachedProvider
 	}
+	return df.provider
+}
+
+// EnableCache puts listings and aggregates caches in front of the provider
+func (df *DataFetcher) EnableCache(settings CacheSettings) {
+	df.caches = map[string]*Cache{
+		CacheListings: NewCache(CacheConfig{
+			MaxEntries:  settings.MaxEntries,
+			TTL:         settings.ListingsTTL,
+			StaleTTL:    settings.StaleTTL,
+			LoadTimeout: df.config.Timeout * time.Duration(df.config.MaxRetries+1),
+		}),
+		CacheAggregates: NewCache(CacheConfig{
+			MaxEntries:  settings.MaxEntries,
+			TTL:         settings.AggregatesTTL,
+			StaleTTL:    settings.StaleTTL,
+			LoadTimeout: df.config.Timeout * time.Duration(df.config.MaxRetries+1),
+		}),
+	}
+	df.wrapProvider()
+}
+
+// Cached returns the value for key from the named cache, calling load on a miss.
+// Without caching enabled load is always called.
+func (df *DataFetcher) Cached(ctx context.Context, cache, key string, load CacheLoader) (interface{}, error) {
+	c, ok := df.caches[cache]
+	if !ok {
+		return load(ctx)
+	}
+	return c.GetOrLoad(ctx, key, load)
+}
+
+// CacheStats returns the counters of every enabled cache
+func (df *DataFetcher) CacheStats() map[string]models.CacheStats {
+	stats := make(map[string]models.CacheStats, len(df.caches))
+	for name, cache := range df.caches {
+		stats[name] = cache.Stats()
+	}
+	return stats
+}
+
+// wrapProvider puts the listings cache in front of the provider when both are configured
+func (df *DataFetcher) wrapProvider() {
+	df.cachedProvider = nil
+	if cache, ok := df.caches[CacheListings]; ok && df.provider != nil {
+		df.cachedProvider = NewCachedProvider(df.provider, cache)
+	}
+}
+
+// BreakerStatuses returns the circuit breaker state of every upstream host contacted so far
+func (df *DataFetcher) BreakerStatuses() map[string]models.BreakerStatus {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	statuses := make(map[string]models.BreakerStatus, len(df.breakers))
+	for host, breaker := range df.breakers {
+		statuses[host] = breaker.Status()
+	}
+	return statuses
+}
+
+// QuotaStatuses returns the rate limit and daily quota usage of every upstream host contacted so far
+func (df *DataFetcher) QuotaStatuses() map[string]models.QuotaStatus {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	statuses := make(map[string]models.QuotaStatus, len(df.limiters))
+	for host, limiter := range df.limiters {
+		statuses[host] = limiter.Status()
+	}
+	return statuses
 }
 
 // FetchJSON fetches JSON data from a URL and unmarshals it into the provided interface
-func (df *DataFetcher) FetchJSON(url string, target interface{}) error {
-	resp, err := df.client.Get(url)
+func (df *DataFetcher) FetchJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	return df.FetchRequestJSON(req, target)
+}
+
+// FetchRequestJSON sends a prepared request (e.g. with auth headers) and decodes the JSON response
+// into target. Requests failing with 429, 5xx or network errors are retried with backoff, and calls
+// to a host are rejected with ErrCircuitOpen while its circuit breaker is open. Every attempt waits
+// for the host's rate limiter and fails with ErrQuotaExhausted once its daily quota is used up.
+// The request's context bounds every attempt, rate limit wait and backoff wait. GET responses
+// carrying an ETag or Last-Modified header are kept in the validator store, when one is set, and
+// revalidated on later requests.
+func (df *DataFetcher) FetchRequestJSON(req *http.Request, target interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	breaker := df.breaker(req.URL.Host)
+	if err := breaker.Allow(); err != nil {
+		return fmt.Errorf("error fetching data from %s: %w", req.URL.Host, err)
+	}
+
+	err := df.doWithRetry(req, target)
+	switch {
+	case err == nil:
+		breaker.RecordSuccess()
+	case req.Context().Err() != nil, errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrQuotaExhausted):
+		// The caller gave up or the request was never sent; this says nothing about the upstream's health
+		breaker.RecordCancel()
+	case isRetryable(err):
+		breaker.RecordFailure()
+	default:
+		breaker.RecordSuccess()
+	}
+	return err
+}
+
+// UseFixtures records every upstream exchange to dir (mode "record") or serves them from dir
+// without network access (mode "replay")
+func (df *DataFetcher) UseFixtures(mode, dir string) error {
+	transport, err := NewFixtureTransport(mode, dir, df.client.Transport)
+	if err != nil {
+		return err
+	}
+	df.client.Transport = transport
+	return nil
+}
+
+// SetValidatorStore sets the store used for ETag and Last-Modified revalidation of GET requests
+func (df *DataFetcher) SetValidatorStore(store *ValidatorStore) {
+	df.validators = store
+}
+
+// doWithRetry sends the request, retrying retryable failures, and decodes the response into target
+func (df *DataFetcher) doWithRetry(req *http.Request, target interface{}) error {
+	limiter := df.limiter(req.URL.Host)
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(req.Context()); err != nil {
+			return fmt.Errorf("error fetching data from %s: %w", req.URL.Host, err)
+		}
+
+		err := df.do(req, target)
+		if err == nil {
+			return nil
+		}
+
+		if !isRetryable(err) || attempt >= df.config.MaxRetries {
+			return err
+		}
+
+		wait := df.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			// Give up rather than stall the caller when the upstream asks for a long pause
+			if statusErr.RetryAfter > df.config.MaxBackoff {
+				return err
+			}
+			wait = statusErr.RetryAfter
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return fmt.Errorf("%w (retry abandoned: %w)", context.DeadlineExceeded, err)
+		}
+		if err := df.sleep(req.Context(), wait); err != nil {
+			return err
+		}
+	}
+}
+
+// do sends a single attempt of the request and streams the decoded response body into target
+func (df *DataFetcher) do(req *http.Request, target interface{}) error {
+	attempt := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("error creating request body: %w", err)
+		}
+		attempt.Body = body
+	}
+
+	var stored *StoredResponse
+	if df.validators != nil && req.Method == http.MethodGet {
+		if s, ok := df.validators.Get(req.URL.String()); ok {
+			stored = s
+			if s.ETag != "" {
+				attempt.Header.Set("If-None-Match", s.ETag)
+			}
+			if s.LastModified != "" {
+				attempt.Header.Set("If-Modified-Since", s.LastModified)
+			}
+		}
+	}
+
+	resp, err := df.client.Do(attempt)
 	if err != nil {
 		return fmt.Errorf("error fetching data: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && stored != nil {
+		return decodeJSON(bytes.NewReader(stored.Body), target)
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := decodedBody(resp, df.config.MaxBodyBytes)
 	if err != nil {
-		return fmt.Errorf("error reading response body: %w", err)
+		return err
+	}
+	defer body.Close()
+
+	// Keep a copy of revalidatable responses while decoding
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	var reader io.Reader = body
+	var copied *bytes.Buffer
+	if df.validators != nil && req.Method == http.MethodGet && (etag != "" || lastModified != "") {
+		copied = new(bytes.Buffer)
+		reader = io.TeeReader(body, copied)
 	}
 
-	if err := json.Unmarshal(body, target); err != nil {
-		return fmt.Errorf("error unmarshaling JSON: %w", err)
+	if err := decodeJSON(reader, target); err != nil {
+		return err
 	}
 
+	if copied != nil {
+		// A failure to persist validators only costs a full download next time
+		df.validators.Put(StoredResponse{
+			URL:          req.URL.String(),
+			ETag:         etag,
+			LastModified: lastModified,
+			Body:         copied.Bytes(),
+		})
+	}
 	return nil
 }
 
+// backoff returns a random wait of up to BaseBackoff * 2^attempt, capped at MaxBackoff
+func (df *DataFetcher) backoff(attempt int) time.Duration {
+	return jitteredBackoff(df.config.BaseBackoff, df.config.MaxBackoff, attempt)
+}
+
+// jitteredBackoff returns a random wait of up to base * 2^attempt, capped at maxWait
+func jitteredBackoff(base, maxWait time.Duration, attempt int) time.Duration {
+	ceiling := base << attempt
+	if ceiling <= 0 || ceiling > maxWait {
+		ceiling = maxWait
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// breaker returns the circuit breaker for a host, creating it on first use
+func (df *DataFetcher) breaker(host string) *CircuitBreaker {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	breaker, ok := df.breakers[host]
+	if !ok {
+		breaker = NewCircuitBreaker(df.config.BreakerThreshold, df.config.BreakerCooldown)
+		df.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// limiter returns the rate limiter for a host, creating it on first use
+func (df *DataFetcher) limiter(host string) *hostLimiter {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	limiter, ok := df.limiters[host]
+	if !ok {
+		limit, ok := df.config.RateLimits[host]
+		if !ok {
+			limit = df.config.DefaultRateLimit
+		}
+		limiter = newHostLimiter(limit, time.Now)
+		df.limiters[host] = limiter
+	}
+	return limiter
+}
+
+// sleepContext waits for the duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isRetryable reports whether an error is a network error or a 429/5xx response
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) || errors.Is(err, ErrQuotaExhausted) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
 // FetchMockData returns mock data for testing purposes
 func (df *DataFetcher) FetchMockData() ([]byte, error) {
 	// This function will return mock data for development and testing
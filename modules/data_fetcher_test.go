@@ -0,0 +1,353 @@
+package modules
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// newTestFetcher creates a DataFetcher that records backoff waits instead of sleeping
+func newTestFetcher(cfg FetcherConfig) (*DataFetcher, *[]time.Duration) {
+	var waits []time.Duration
+	df := NewDataFetcherWithConfig(cfg)
+	df.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return df, &waits
+}
+
+func TestFetchJSONRetries(t *testing.T) {
+	testCases := []struct {
+		name             string
+		statuses         []int
+		retryAfter       string
+		expectedRequests int
+		expectError      bool
+	}{
+		{
+			name:             "Success After 5xx",
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			expectedRequests: 3,
+		},
+		{
+			name:             "Too Many Requests With Retry-After",
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "1",
+			expectedRequests: 2,
+		},
+		{
+			name:             "Retry-After Beyond Max Backoff",
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "120",
+			expectedRequests: 1,
+			expectError:      true,
+		},
+		{
+			name:             "Client Error Not Retried",
+			statuses:         []int{http.StatusNotFound, http.StatusOK},
+			expectedRequests: 1,
+			expectError:      true,
+		},
+		{
+			name:             "Retries Exhausted",
+			statuses:         []int{500, 500, 500, 500, 500},
+			expectedRequests: 4,
+			expectError:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[requests]
+				requests++
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(status)
+				w.Write([]byte(`{"status":"success"}`))
+			}))
+			defer server.Close()
+
+			df, waits := newTestFetcher(DefaultFetcherConfig())
+
+			var result map[string]string
+			err := df.FetchJSON(context.Background(), server.URL, &result)
+			if tc.expectError && err == nil {
+				t.Error("Expected an error but got nil")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Expected no error but got: %v", err)
+			}
+			if requests != tc.expectedRequests {
+				t.Errorf("Expected %d requests but got %d", tc.expectedRequests, requests)
+			}
+			if tc.retryAfter == "1" && (len(*waits) != 1 || (*waits)[0] != time.Second) {
+				t.Errorf("Expected a single 1s Retry-After wait but got %v", *waits)
+			}
+		})
+	}
+}
+
+func TestFetchJSONCircuitBreaker(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := DefaultFetcherConfig()
+	cfg.MaxRetries = 0
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = time.Minute
+	df, _ := newTestFetcher(cfg)
+
+	var result map[string]interface{}
+	for i := 0; i < 2; i++ {
+		if err := df.FetchJSON(context.Background(), server.URL, &result); err == nil {
+			t.Fatal("Expected an error but got nil")
+		}
+	}
+
+	err := df.FetchJSON(context.Background(), server.URL, &result)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen but got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected the open breaker to block the third request but got %d requests", requests)
+	}
+
+	statuses := df.BreakerStatuses()
+	if len(statuses) != 1 {
+		t.Fatalf("Expected 1 upstream but got %d", len(statuses))
+	}
+	for _, status := range statuses {
+		if status.State != BreakerOpen || status.ConsecutiveFailures != 2 || status.RetryAt == "" {
+			t.Errorf("Unexpected breaker status: %+v", status)
+		}
+	}
+}
+
+func TestFetchJSONDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := DefaultFetcherConfig()
+	cfg.BreakerThreshold = 1
+	df := NewDataFetcherWithConfig(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var result map[string]interface{}
+	err := df.FetchJSON(ctx, server.URL, &result)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded but got %v", err)
+	}
+
+	// A caller's deadline must not trip the upstream's breaker
+	for _, status := range df.BreakerStatuses() {
+		if status.State != BreakerClosed {
+			t.Errorf("Expected breaker to stay closed but got %s", status.State)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cb := NewCircuitBreaker(1, 30*time.Second)
+	cb.now = func() time.Time { return now }
+
+	cb.RecordFailure()
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen but got %v", err)
+	}
+
+	// After the cooldown a single probe is allowed
+	now = now.Add(31 * time.Second)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed but got %v", err)
+	}
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected concurrent probe to be rejected but got %v", err)
+	}
+
+	// A failed probe reopens the breaker; a successful one closes it
+	cb.RecordFailure()
+	if cb.Status().State != BreakerOpen {
+		t.Errorf("Expected breaker to reopen but got %s", cb.Status().State)
+	}
+	now = now.Add(31 * time.Second)
+	cb.Allow()
+	cb.RecordSuccess()
+	if status := cb.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("Expected breaker to close but got %+v", status)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"Sat, 01 Jun 2024 12:00:10 GMT", 10 * time.Second},
+		{"Sat, 01 Jun 2024 11:59:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			if result := parseRetryAfter(tc.value, now); result != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestFetchJSONContentEncoding(t *testing.T) {
+	payload := `{"status":"success","count":3}`
+
+	testCases := []struct {
+		encoding string
+		encode   func(w io.Writer) io.WriteCloser
+	}{
+		{"", nil},
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}},
+		{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+	}
+
+	for _, tc := range testCases {
+		t.Run("encoding "+tc.encoding, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.encode == nil {
+					w.Write([]byte(payload))
+					return
+				}
+				if !strings.Contains(r.Header.Get("Accept-Encoding"), tc.encoding) {
+					t.Errorf("Expected Accept-Encoding to include %s but got %q", tc.encoding, r.Header.Get("Accept-Encoding"))
+				}
+				w.Header().Set("Content-Encoding", tc.encoding)
+				enc := tc.encode(w)
+				enc.Write([]byte(payload))
+				enc.Close()
+			}))
+			defer server.Close()
+
+			var result struct {
+				Status string `json:"status"`
+				Count  int    `json:"count"`
+			}
+			if err := NewDataFetcher().FetchJSON(context.Background(), server.URL, &result); err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if result.Status != "success" || result.Count != 3 {
+				t.Errorf("Unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestFetchJSONMaxBodySize(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"data":"` + strings.Repeat("x", 1024) + `"}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultFetcherConfig()
+	cfg.MaxBodyBytes = 512
+	df, _ := newTestFetcher(cfg)
+
+	var result map[string]string
+	err := df.FetchJSON(context.Background(), server.URL, &result)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge but got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected oversized response not to be retried but got %d requests", requests)
+	}
+	if result != nil {
+		t.Errorf("Expected target to be left untouched but got %v", result)
+	}
+}
+
+func TestFetchJSONConditionalRequests(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Sat, 01 Jun 2024 12:00:00 GMT")
+		w.Write([]byte(`{"median_price":1150000}`))
+	}))
+	defer server.Close()
+
+	store, err := NewValidatorStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	df := NewDataFetcher()
+	df.SetValidatorStore(store)
+
+	for i := 0; i < 2; i++ {
+		var result struct {
+			MedianPrice int `json:"median_price"`
+		}
+		if err := df.FetchJSON(context.Background(), server.URL, &result); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if result.MedianPrice != 1150000 {
+			t.Errorf("Expected median price 1150000 on request %d but got %d", i+1, result.MedianPrice)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 requests but got %d", requests)
+	}
+	if stored, ok := store.Get(server.URL); !ok || stored.ETag != `"v1"` {
+		t.Errorf("Expected stored validators but got %+v", stored)
+	}
+}
+
+func TestFetchJSONUnsupportedEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	var result map[string]interface{}
+	err := NewDataFetcher().FetchJSON(context.Background(), server.URL, &result)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Expected DecodeError but got %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// Supported file formats for FileProvider
+const (
+	FileFormatCSV    = "csv"
+	FileFormatNDJSON = "ndjson"
+)
+
+// listingFields are the Listing fields that can be loaded from a file, keyed by their JSON name
+var listingFields = []string{
+	"id", "address", "city", "state", "zip_code", "latitude", "longitude",
+	"property_type", "status", "bedrooms", "bathrooms", "sqft", "lot_size",
+	"year_built", "list_price", "sale_price", "list_date", "sale_date", "days_on_market", "features",
+	"sale_conditions",
+}
+
+// dateLayouts are the date formats accepted in listing files
+var dateLayouts = []string{time.RFC3339, "2006-01-02", "01/02/2006", "1/2/2006"}
+
+// FileProviderConfig configures a FileProvider
+type FileProviderConfig struct {
+	// Path to the CSV or newline-delimited JSON file
+	Path string
+
+	// Format of the file (csv or ndjson); inferred from the file extension when empty
+	Format string
+
+	// Columns maps a listing field (e.g. sale_price) to the CSV header or JSON key holding it.
+	// Fields without a mapping are read from a column with the field's own name.
+	Columns map[string]string
+
+	// Path to an optional CSV or newline-delimited JSON file of leased rentals, in the format of
+	// the listings file with monthly_rent and lease_date columns instead of the sale price and date.
+	// Format applies to it too.
+	RentalsPath string
+}
+
+// FileProvider serves listings loaded from a local CSV or newline-delimited JSON export
+type FileProvider struct {
+	listings []models.Listing
+	byID     map[string]int
+
+	// Leases in the form built by rentalListing; nil when no rentals file is configured
+	rentals []models.Listing
+}
+
+// NewFileProvider creates a new FileProvider and loads all listings from the configured file
+func NewFileProvider(cfg FileProviderConfig) (*FileProvider, error) {
+	records, err := readListingsFile(cfg.Path, cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &FileProvider{
+		listings: make([]models.Listing, 0, len(records)),
+		byID:     make(map[string]int, len(records)),
+	}
+	for i, record := range records {
+		listing, err := listingFromRecord(record, cfg.Columns)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing listing %d: %w", i+1, err)
+		}
+		if first, ok := fp.byID[listing.ID]; ok {
+			return nil, fmt.Errorf("error parsing listing %d: duplicate id %q of listing %d", i+1, listing.ID, first+1)
+		}
+		fp.byID[listing.ID] = len(fp.listings)
+		fp.listings = append(fp.listings, listing)
+	}
+
+	if cfg.RentalsPath != "" {
+		records, err := readListingsFile(cfg.RentalsPath, cfg.Format)
+		if err != nil {
+			return nil, fmt.Errorf("error loading rentals file: %w", err)
+		}
+
+		columns := rentalColumns(cfg.Columns)
+		fp.rentals = make([]models.Listing, 0, len(records))
+		leaseIDs := make(map[string]int, len(records))
+		for i, record := range records {
+			lease, err := listingFromRecord(record, columns)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing rental %d: %w", i+1, err)
+			}
+			if first, ok := leaseIDs[lease.ID]; ok {
+				return nil, fmt.Errorf("error parsing rental %d: duplicate id %q of rental %d", i+1, lease.ID, first+1)
+			}
+			leaseIDs[lease.ID] = i
+			lease.Status = models.ListingStatusSold
+			fp.rentals = append(fp.rentals, lease)
+		}
+	}
+
+	return fp, nil
+}
+
+// readListingsFile reads the records of a CSV or newline-delimited JSON file, inferring the
+// format from the file extension when it is empty
+func readListingsFile(path, format string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening listings file: %w", err)
+	}
+	defer f.Close()
+
+	format = strings.ToLower(format)
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = FileFormatCSV
+		case ".ndjson", ".jsonl", ".json":
+			format = FileFormatNDJSON
+		default:
+			return nil, fmt.Errorf("cannot infer listings file format from %q", path)
+		}
+	}
+
+	switch format {
+	case FileFormatCSV:
+		return readCSVRecords(f)
+	case FileFormatNDJSON:
+		return readNDJSONRecords(f)
+	}
+	return nil, fmt.Errorf("unsupported listings file format: %s", format)
+}
+
+// rentalColumns returns the column mapping for a rentals file, which reads the monthly rent and
+// lease date into the sale price and sale date of a lease's listing form
+func rentalColumns(columns map[string]string) map[string]string {
+	mapped := make(map[string]string, len(columns)+2)
+	for field, column := range columns {
+		mapped[field] = column
+	}
+
+	mapped["sale_price"] = "monthly_rent"
+	if column, ok := columns["monthly_rent"]; ok {
+		mapped["sale_price"] = column
+	}
+	mapped["sale_date"] = "lease_date"
+	if column, ok := columns["lease_date"]; ok {
+		mapped["sale_date"] = column
+	}
+	return mapped
+}
+
+// GetListing returns the listing with the given ID
+func (fp *FileProvider) GetListing(ctx context.Context, id string) (*models.Listing, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	idx, ok := fp.byID[id]
+	if !ok {
+		return nil, ErrListingNotFound
+	}
+	listing := fp.listings[idx]
+	return &listing, nil
+}
+
+// SearchListings returns all loaded listings matching the query
+func (fp *FileProvider) SearchListings(ctx context.Context, query models.ListingQuery) ([]models.Listing, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []models.Listing
+	for _, listing := range fp.listings {
+		if !MatchesQuery(listing, query) {
+			continue
+		}
+		results = append(results, listing)
+		if query.Limit > 0 && len(results) >= query.Limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// SearchRentals returns all loaded leased rentals matching the query
+func (fp *FileProvider) SearchRentals(ctx context.Context, query models.RentalQuery) ([]models.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if fp.rentals == nil {
+		return nil, ErrRentalsUnavailable
+	}
+
+	listingQuery := rentalListingQuery(query)
+	var results []models.Rental
+	for _, lease := range fp.rentals {
+		if !MatchesQuery(lease, listingQuery) {
+			continue
+		}
+		results = append(results, rentalFromListing(lease))
+		if query.Limit > 0 && len(results) >= query.Limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// Len returns the number of loaded listings
+func (fp *FileProvider) Len() int {
+	return len(fp.listings)
+}
+
+// ParseColumnMapping parses a column mapping of the form "sale_price=ClosePrice,sqft=LivingArea"
+func ParseColumnMapping(s string) (map[string]string, error) {
+	columns := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return columns, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		column = strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid column mapping %q", pair)
+		}
+		columns[field] = column
+	}
+	return columns, nil
+}
+
+// readCSVRecords reads a CSV file with a header row into a list of column/value maps
+func readCSVRecords(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	var records []map[string]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV row: %w", err)
+		}
+
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(row) {
+				record[strings.TrimSpace(column)] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readNDJSONRecords reads one flat JSON object per line into a list of key/value maps
+func readNDJSONRecords(r io.Reader) ([]map[string]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var records []map[string]string
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("error unmarshaling JSON on line %d: %w", line, err)
+		}
+
+		record := make(map[string]string, len(raw))
+		for key, value := range raw {
+			switch v := value.(type) {
+			case nil:
+			case []interface{}:
+				// Lists such as features and sale conditions are stored the way they are written in CSV files
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				record[key] = strings.Join(items, ";")
+			default:
+				record[key] = fmt.Sprint(v)
+			}
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading listings file: %w", err)
+	}
+	return records, nil
+}
+
+// listingFromRecord converts a raw column/value record into a Listing using the column mapping
+func listingFromRecord(record map[string]string, columns map[string]string) (models.Listing, error) {
+	var l models.Listing
+	for _, field := range listingFields {
+		column := field
+		if mapped, ok := columns[field]; ok {
+			column = mapped
+		}
+		value := strings.TrimSpace(record[column])
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch field {
+		case "id":
+			l.ID = value
+		case "address":
+			l.Address = value
+		case "city":
+			l.City = value
+		case "state":
+			l.State = value
+		case "zip_code":
+			l.ZipCode = value
+		case "latitude":
+			l.Latitude, err = strconv.ParseFloat(value, 64)
+		case "longitude":
+			l.Longitude, err = strconv.ParseFloat(value, 64)
+		case "property_type":
+			l.PropertyType = value
+		case "status":
+			l.Status = strings.ToLower(value)
+		case "bedrooms":
+			l.Bedrooms, err = parseInt(value)
+		case "bathrooms":
+			l.Bathrooms, err = strconv.ParseFloat(value, 64)
+		case "sqft":
+			l.Sqft, err = parseInt(value)
+		case "lot_size":
+			l.LotSize, err = parseInt(value)
+		case "year_built":
+			l.YearBuilt, err = parseInt(value)
+		case "list_price":
+			l.ListPrice, err = parseInt(value)
+		case "sale_price":
+			l.SalePrice, err = parseInt(value)
+		case "list_date":
+			l.ListDate, err = parseDate(value)
+		case "sale_date":
+			l.SaleDate, err = parseDate(value)
+		case "days_on_market":
+			l.DaysOnMarket, err = parseInt(value)
+		case "features":
+			l.Features = parseFeatures(value)
+		case "sale_conditions":
+			l.SaleConditions = parseSaleConditions(value)
+		}
+		if err != nil {
+			return l, fmt.Errorf("invalid %s %q: %w", field, value, err)
+		}
+	}
+
+	if l.ID == "" {
+		return l, fmt.Errorf("missing id")
+	}
+	if l.Status == "" && !l.SaleDate.IsZero() {
+		l.Status = models.ListingStatusSold
+	}
+
+	return l, nil
+}
+
+// parseFeatures parses a list of features separated by semicolons or pipes, e.g. "Garage;View"
+func parseFeatures(s string) []string {
+	var features []string
+	for _, feature := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '|' }) {
+		if feature = NormalizeFeature(feature); feature != "" {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// NormalizeFeature returns a feature name in the lowercase form used for comparison
+func NormalizeFeature(feature string) string {
+	return strings.ToLower(strings.Join(strings.Fields(feature), " "))
+}
+
+// parseInt parses an integer that may be formatted as currency (e.g. "$1,100,000")
+func parseInt(s string) (int, error) {
+	s = strings.NewReplacer("$", "", ",", "").Replace(s)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(f), nil
+}
+
+// parseDate parses a date in any of the accepted layouts
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date format")
+}
@@ -0,0 +1,241 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func TestNewFileProviderCSV(t *testing.T) {
+	fp, err := NewFileProvider(FileProviderConfig{Path: "testdata/listings.csv"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	if fp.Len() != 9 {
+		t.Errorf("Expected 9 listings but got %d", fp.Len())
+	}
+
+	listing, err := fp.GetListing(context.Background(), "S1")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if listing.ListPrice != 1195000 {
+		t.Errorf("Expected list price 1195000 but got %d", listing.ListPrice)
+	}
+	if listing.Status != models.ListingStatusActive {
+		t.Errorf("Expected status %s but got %s", models.ListingStatusActive, listing.Status)
+	}
+
+	sold, _ := fp.GetListing(context.Background(), "C3")
+	if sold.Bathrooms != 2.5 {
+		t.Errorf("Expected 2.5 bathrooms but got %v", sold.Bathrooms)
+	}
+	if !sold.SaleDate.Equal(time.Date(2024, 4, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected sale date 2024-04-12 but got %v", sold.SaleDate)
+	}
+
+	if _, err := fp.GetListing(context.Background(), "missing"); !errors.Is(err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound but got %v", err)
+	}
+}
+
+func TestNewFileProviderNDJSONColumnMapping(t *testing.T) {
+	columns, err := ParseColumnMapping("id=ListingId, address=UnparsedAddress, city=City, state=StateOrProvince," +
+		"zip_code=PostalCode,latitude=Latitude,longitude=Longitude,property_type=PropertyType,status=Status," +
+		"sqft=LivingArea,sale_price=ClosePrice,sale_date=CloseDate,features=Features")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	fp, err := NewFileProvider(FileProviderConfig{Path: "testdata/listings.ndjson", Columns: columns})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	if fp.Len() != 2 {
+		t.Fatalf("Expected 2 listings but got %d", fp.Len())
+	}
+
+	listing, _ := fp.GetListing(context.Background(), "N2")
+	if listing.SalePrice != 1150000 {
+		t.Errorf("Expected sale price 1150000 but got %d", listing.SalePrice)
+	}
+	if listing.Status != models.ListingStatusSold {
+		t.Errorf("Expected status inferred as sold but got %q", listing.Status)
+	}
+	if listing.Address != "456 Elm St" {
+		t.Errorf("Expected address 456 Elm St but got %s", listing.Address)
+	}
+	if len(listing.Features) != 2 || listing.Features[0] != "garage" || listing.Features[1] != "roof deck" {
+		t.Errorf("Expected normalized features [garage roof deck] but got %v", listing.Features)
+	}
+}
+
+func TestNewFileProviderErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  FileProviderConfig
+	}{
+		{
+			name: "Missing File",
+			cfg:  FileProviderConfig{Path: "testdata/does-not-exist.csv"},
+		},
+		{
+			name: "Unknown Format",
+			cfg:  FileProviderConfig{Path: "testdata/listings.csv", Format: "xml"},
+		},
+		{
+			name: "Missing ID Column",
+			cfg:  FileProviderConfig{Path: "testdata/listings.ndjson"},
+		},
+		{
+			name: "Duplicate ID",
+			cfg:  FileProviderConfig{Path: "testdata/duplicate_ids.csv"},
+		},
+		{
+			name: "Duplicate Rental ID",
+			cfg:  FileProviderConfig{Path: "testdata/listings.csv", RentalsPath: "testdata/duplicate_ids.csv"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewFileProvider(tc.cfg); err == nil {
+				t.Error("Expected an error but got nil")
+			}
+		})
+	}
+
+	// A duplicate is reported with its row, like other malformed rows
+	_, err := NewFileProvider(FileProviderConfig{Path: "testdata/duplicate_ids.csv"})
+	if err == nil || !strings.Contains(err.Error(), `listing 3: duplicate id "S1" of listing 1`) {
+		t.Errorf("Expected the duplicate of listing 1 in listing 3 but got %v", err)
+	}
+}
+
+func TestFileProviderSearchListings(t *testing.T) {
+	fp, err := NewFileProvider(FileProviderConfig{Path: "testdata/listings.csv"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		query    models.ListingQuery
+		expected int
+	}{
+		{
+			name:     "By City And State",
+			query:    models.ListingQuery{Location: "San Francisco, CA"},
+			expected: 8,
+		},
+		{
+			name:     "By ZIP Code",
+			query:    models.ListingQuery{Location: "94110"},
+			expected: 3,
+		},
+		{
+			name:     "Sold Condos",
+			query:    models.ListingQuery{PropertyType: "condo", Statuses: []string{models.ListingStatusSold}},
+			expected: 1,
+		},
+		{
+			name: "Within Radius",
+			query: models.ListingQuery{
+				Latitude:    37.7706,
+				Longitude:   -122.4222,
+				RadiusMiles: 1,
+			},
+			expected: 7,
+		},
+		{
+			name:     "Sold After",
+			query:    models.ListingQuery{SoldAfter: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+			expected: 2,
+		},
+		{
+			name:     "Sold Before",
+			query:    models.ListingQuery{SoldBefore: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+			expected: 5,
+		},
+		{
+			name:     "Limit",
+			query:    models.ListingQuery{Limit: 3},
+			expected: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := fp.SearchListings(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if len(results) != tc.expected {
+				t.Errorf("Expected %d listings but got %d", tc.expected, len(results))
+			}
+		})
+	}
+}
+
+func TestFileProviderSearchRentals(t *testing.T) {
+	fp, err := NewFileProvider(FileProviderConfig{Path: "testdata/listings.csv", RentalsPath: "testdata/rentals.csv"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	rentals, err := fp.SearchRentals(context.Background(), models.RentalQuery{
+		PropertyType: "Single-family",
+		Latitude:     37.7706,
+		Longitude:    -122.4222,
+		RadiusMiles:  5,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(rentals) != 6 {
+		t.Fatalf("Expected 6 rentals but got %d", len(rentals))
+	}
+
+	r2 := rentals[1]
+	if r2.ID != "R2" || r2.MonthlyRent != 5100 {
+		t.Errorf("Expected R2 with monthly rent 5100 but got %s with %d", r2.ID, r2.MonthlyRent)
+	}
+	if !r2.LeaseDate.Equal(time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected lease date 2024-02-15 but got %v", r2.LeaseDate)
+	}
+
+	// Rentals are not listings
+	if _, err := fp.GetListing(context.Background(), "R1"); !errors.Is(err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound but got %v", err)
+	}
+
+	// The configured format applies to the rentals file too, whatever its extension
+	data, err := os.ReadFile("testdata/rentals.csv")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	rentalsPath := filepath.Join(t.TempDir(), "rentals.txt")
+	if err := os.WriteFile(rentalsPath, data, 0o644); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if _, err := NewFileProvider(FileProviderConfig{Path: "testdata/listings.csv", Format: FileFormatCSV, RentalsPath: rentalsPath}); err != nil {
+		t.Errorf("Expected the rentals file to be read as CSV but got: %v", err)
+	}
+
+	// Without a rentals file there is no rental data
+	fp, err = NewFileProvider(FileProviderConfig{Path: "testdata/listings.csv"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if _, err := fp.SearchRentals(context.Background(), models.RentalQuery{}); !errors.Is(err, ErrRentalsUnavailable) {
+		t.Errorf("Expected ErrRentalsUnavailable but got %v", err)
+	}
+}
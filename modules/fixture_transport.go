@@ -0,0 +1,172 @@
+package modules
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Fixture modes for FixtureTransport
+const (
+	FixtureModeRecord = "record"
+	FixtureModeReplay = "replay"
+)
+
+// redactedFields are JSON fields whose values are never written to fixtures
+var redactedFields = regexp.MustCompile(`"(access_token|refresh_token|id_token)"\s*:\s*"[^"]*"`)
+
+// unsafeFilenameChars matches characters not allowed in fixture file names
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// Fixture is a recorded upstream HTTP exchange
+type Fixture struct {
+	Method      string              `json:"method"`
+	URL         string              `json:"url"`
+	RequestBody string              `json:"request_body,omitempty"`
+	StatusCode  int                 `json:"status_code"`
+	Header      map[string][]string `json:"header"`
+	Body        string              `json:"body"`
+}
+
+// FixtureTransport records every upstream exchange to a fixture directory, or replays them from it
+// without touching the network. Exchanges are keyed by method, URL and request body.
+type FixtureTransport struct {
+	mode string
+	dir  string
+	next http.RoundTripper
+}
+
+// NewFixtureTransport creates a new FixtureTransport; next is used to reach the upstream in record mode
+func NewFixtureTransport(mode, dir string, next http.RoundTripper) (*FixtureTransport, error) {
+	switch mode {
+	case FixtureModeRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating fixture directory: %w", err)
+		}
+	case FixtureModeReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("error opening fixture directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture mode: %s", mode)
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &FixtureTransport{mode: mode, dir: dir, next: next}, nil
+}
+
+// RoundTrip records or replays a single HTTP exchange
+func (ft *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		if requestBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+	path := ft.fixturePath(req, requestBody)
+
+	if ft.mode == FixtureModeReplay {
+		return ft.replay(req, path)
+	}
+	return ft.record(req, path, requestBody)
+}
+
+// record forwards the request upstream and writes the exchange to path
+func (ft *FixtureTransport) record(req *http.Request, path string, requestBody []byte) (*http.Response, error) {
+	resp, err := ft.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Store bodies uncompressed so fixtures stay readable and editable
+	body, err := decodedBody(resp, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	header := resp.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	header.Del("Set-Cookie")
+
+	fixture := Fixture{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		RequestBody: string(requestBody),
+		StatusCode:  resp.StatusCode,
+		Header:      header,
+		Body:        redactedFields.ReplaceAllString(string(data), `"$1":"redacted"`),
+	}
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(fixture); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, encoded.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("error writing fixture: %w", err)
+	}
+
+	return fixture.response(req), nil
+}
+
+// replay serves the exchange stored at path
+func (ft *FixtureTransport) replay(req *http.Request, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s (%s): %w", req.Method, req.URL, filepath.Base(path), err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("error unmarshaling fixture %s: %w", filepath.Base(path), err)
+	}
+	return fixture.response(req), nil
+}
+
+// fixturePath returns the fixture file for a request, named after its method and host with a
+// hash of the method, URL and body
+func (ft *FixtureTransport) fixturePath(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.String() + "\n"))
+	hash.Write(body)
+	sum := hex.EncodeToString(hash.Sum(nil))[:16]
+
+	host := unsafeFilenameChars.ReplaceAllString(req.URL.Host, "_")
+	return filepath.Join(ft.dir, fmt.Sprintf("%s_%s_%s.json", strings.ToLower(req.Method), host, sum))
+}
+
+// response builds an http.Response for the fixture
+func (f Fixture) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(f.Header).Clone(),
+		Body:          io.NopCloser(strings.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,156 @@
+package modules
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// newReplayDataFetcher creates a DataFetcher backed by the RESO provider replaying recorded fixtures
+func newReplayDataFetcher(t *testing.T) *DataFetcher {
+	t.Helper()
+
+	df := NewDataFetcher()
+	if err := df.UseFixtures(FixtureModeReplay, "testdata/fixtures/reso"); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	df.SetProvider(NewRESOProvider(df, RESOConfig{
+		BaseURL:      "https://api.example-mls.com/reso/odata",
+		TokenURL:     "https://api.example-mls.com/oauth2/token",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}))
+	return df
+}
+
+func TestFixtureTransportRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"access_token":"secret-token","median_price":1150000}`))
+		gz.Close()
+	}))
+	dir := t.TempDir()
+
+	recorder := NewDataFetcher()
+	if err := recorder.UseFixtures(FixtureModeRecord, dir); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	var recorded map[string]interface{}
+	if err := recorder.FetchJSON(context.Background(), server.URL+"/trends?city=sf", &recorded); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	server.Close()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 fixture but got %d", len(entries))
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	if strings.Contains(string(data), "secret-token") {
+		t.Error("Expected access token to be redacted from the fixture")
+	}
+
+	// Replay works with the upstream gone
+	replayer := NewDataFetcher()
+	if err := replayer.UseFixtures(FixtureModeReplay, dir); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	var replayed map[string]interface{}
+	if err := replayer.FetchJSON(context.Background(), server.URL+"/trends?city=sf", &replayed); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if replayed["median_price"] != float64(1150000) {
+		t.Errorf("Expected replayed median price 1150000 but got %v", replayed["median_price"])
+	}
+
+	if err := replayer.FetchJSON(context.Background(), server.URL+"/trends?city=la", &replayed); err == nil {
+		t.Error("Expected an error for a request without a fixture but got nil")
+	}
+}
+
+func TestNewFixtureTransportErrors(t *testing.T) {
+	if _, err := NewFixtureTransport("rewind", t.TempDir(), nil); err == nil {
+		t.Error("Expected an error for an unknown mode but got nil")
+	}
+	if _, err := NewFixtureTransport(FixtureModeReplay, "testdata/fixtures/missing", nil); err == nil {
+		t.Error("Expected an error for a missing replay directory but got nil")
+	}
+}
+
+func TestCMAAnalyzerReplay(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newReplayDataFetcher(t))
+
+	result, err := analyzer.GetComparableProperties(context.Background(), models.CMARequest{
+		PropertyID: "S1",
+		Radius:     5,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	expectedIDs := []string{"C2", "C1", "C3", "C4", "C5"}
+	if len(result.Comparables) != len(expectedIDs) {
+		t.Fatalf("Expected %d comparables but got %d", len(expectedIDs), len(result.Comparables))
+	}
+	for i, id := range expectedIDs {
+		if result.Comparables[i].ID != id {
+			t.Errorf("Expected comparable %d to be %s but got %s", i, id, result.Comparables[i].ID)
+		}
+	}
+	if result.EstimatedValue != 1170400 {
+		t.Errorf("Expected estimated value 1170400 but got %d", result.EstimatedValue)
+	}
+
+	expectedActive := []string{"A1", "A2"}
+	if len(result.ActiveListings) != len(expectedActive) {
+		t.Fatalf("Expected %d active listings but got %d", len(expectedActive), len(result.ActiveListings))
+	}
+	for i, id := range expectedActive {
+		if result.ActiveListings[i].ID != id {
+			t.Errorf("Expected active listing %d to be %s but got %s", i, id, result.ActiveListings[i].ID)
+		}
+	}
+	if len(result.PendingListings) != 1 || result.PendingListings[0].ID != "P1" {
+		t.Errorf("Expected P1 as the only pending listing but got %+v", result.PendingListings)
+	}
+}
+
+func TestMarketAnalyzerReplay(t *testing.T) {
+	analyzer := NewMarketAnalyzer(newReplayDataFetcher(t))
+	analyzer.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	result, err := analyzer.GetMarketTrends(context.Background(), models.MarketTrendsRequest{
+		Location:     "San Francisco, CA",
+		PropertyType: "Single-family",
+		TimeRange:    "6 months",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	expected := models.MarketTrends{
+		Location:     "San Francisco, CA",
+		MedianPrice:  1175000,
+		PricePerSqft: 1185,
+		SalesVolume:  6,
+		Trend:        "stable",
+		Affordability: models.Affordability{
+			InterestRate:    0.07,
+			DownPaymentRate: 0.2,
+			LoanTermYears:   30,
+			MonthlyPayment:  6254,
+		},
+		DataFreshness: models.DataFreshnessLive,
+	}
+	if *result != expected {
+		t.Errorf("Expected %+v but got %+v", expected, *result)
+	}
+}
@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"context"
+	"sync"
+
+	"github.com/user/cma/models"
+)
+
+// freshnessKey is the context key for a FreshnessTracker
+type freshnessKey struct{}
+
+// FreshnessTracker records whether the data behind a response came live from upstream,
+// from a fresh cache entry or from a stale one
+type FreshnessTracker struct {
+	mu        sync.Mutex
+	freshness string
+}
+
+// WithFreshness returns a context that records the freshness of the data loaded with it
+func WithFreshness(ctx context.Context) (context.Context, *FreshnessTracker) {
+	tracker := &FreshnessTracker{}
+	return context.WithValue(ctx, freshnessKey{}, tracker), tracker
+}
+
+// Freshness returns the least fresh level recorded, or live if nothing was recorded
+func (ft *FreshnessTracker) Freshness() string {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	if ft.freshness == "" {
+		return models.DataFreshnessLive
+	}
+	return ft.freshness
+}
+
+// record notes that part of the response was served at the given freshness
+func (ft *FreshnessTracker) record(freshness string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	if freshnessRank(freshness) > freshnessRank(ft.freshness) {
+		ft.freshness = freshness
+	}
+}
+
+// recordFreshness records freshness on the context's tracker, if any
+func recordFreshness(ctx context.Context, freshness string) {
+	if tracker, ok := ctx.Value(freshnessKey{}).(*FreshnessTracker); ok && tracker != nil {
+		tracker.record(freshness)
+	}
+}
+
+// withoutFreshness detaches a context from its tracker, for work that outlives the response
+func withoutFreshness(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshnessKey{}, (*FreshnessTracker)(nil))
+}
+
+// LeastFresh returns the least fresh of several data freshness levels
+func LeastFresh(levels ...string) string {
+	least := models.DataFreshnessLive
+	for _, level := range levels {
+		if freshnessRank(level) > freshnessRank(least) {
+			least = level
+		}
+	}
+	return least
+}
+
+// freshnessRank orders freshness levels from most to least fresh
+func freshnessRank(freshness string) int {
+	switch freshness {
+	case models.DataFreshnessLive:
+		return 1
+	case models.DataFreshnessCached:
+		return 2
+	case models.DataFreshnessStale:
+		return 3
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+package modules
+
+import "math"
+
+// earthRadiusMiles is the mean radius of the earth in miles
+const earthRadiusMiles = 3958.8
+
+// DistanceMiles calculates the great-circle distance between two coordinates using the haversine formula
+func DistanceMiles(lat1, lng1, lat2, lng2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return earthRadiusMiles * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
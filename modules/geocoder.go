@@ -0,0 +1,137 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Geocode precision values, from most to least precise
+const (
+	GeocodePrecisionAddress = "address"
+	GeocodePrecisionZip     = "zip"
+	GeocodePrecisionCity    = "city"
+)
+
+// ErrAddressNotGeocoded is returned by a Geocoder when it has no location for an address
+var ErrAddressNotGeocoded = errors.New("address could not be geocoded")
+
+// GeocodeResult is the location found for an address
+type GeocodeResult struct {
+	Latitude  float64
+	Longitude float64
+
+	// How closely the location matches the address (address, zip or city)
+	Precision string
+}
+
+// Geocoder resolves addresses to coordinates
+type Geocoder interface {
+	// Geocode returns the location of an address
+	Geocode(ctx context.Context, address Address) (*GeocodeResult, error)
+}
+
+// FileGeocoder is an offline Geocoder backed by a local CSV gazetteer of address points and
+// ZIP code and city centroids
+type FileGeocoder struct {
+	points map[string]GeocodeResult
+	zips   map[string]GeocodeResult
+	cities map[string]GeocodeResult
+}
+
+// NewFileGeocoder creates a new FileGeocoder from a CSV file with the columns address, city,
+// state, zip_code, latitude and longitude. Rows with an address are address points; rows
+// without one are the centroid of their ZIP code, or of their city when the ZIP code is empty.
+func NewFileGeocoder(path string) (*FileGeocoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geocoder file: %w", err)
+	}
+	defer f.Close()
+
+	records, err := readCSVRecords(f)
+	if err != nil {
+		return nil, err
+	}
+
+	fg := &FileGeocoder{
+		points: make(map[string]GeocodeResult),
+		zips:   make(map[string]GeocodeResult),
+		cities: make(map[string]GeocodeResult),
+	}
+	for i, record := range records {
+		latitude, err := strconv.ParseFloat(strings.TrimSpace(record["latitude"]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing geocoder row %d: invalid latitude: %w", i+1, err)
+		}
+		longitude, err := strconv.ParseFloat(strings.TrimSpace(record["longitude"]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing geocoder row %d: invalid longitude: %w", i+1, err)
+		}
+
+		address := ParseAddress(record["address"])
+		address.City = titleCase(record["city"])
+		address.State = strings.ToUpper(strings.TrimSpace(record["state"]))
+		address.ZipCode = strings.TrimSpace(record["zip_code"])
+
+		result := GeocodeResult{Latitude: latitude, Longitude: longitude}
+		switch {
+		case address.StreetKey() != "":
+			result.Precision = GeocodePrecisionAddress
+			for _, key := range pointKeys(address) {
+				fg.points[key] = result
+			}
+		case address.ZipCode != "":
+			result.Precision = GeocodePrecisionZip
+			fg.zips[zip5(address.ZipCode)] = result
+		case address.City != "":
+			result.Precision = GeocodePrecisionCity
+			fg.cities[cityKey(address)] = result
+		}
+	}
+
+	return fg, nil
+}
+
+// Geocode returns the address point for an address, falling back to the centroid of its ZIP
+// code and then of its city. ZIP+4 codes are matched by their first five digits.
+func (fg *FileGeocoder) Geocode(ctx context.Context, address Address) (*GeocodeResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if address.StreetKey() != "" {
+		for _, key := range pointKeys(address) {
+			if result, ok := fg.points[key]; ok {
+				return &result, nil
+			}
+		}
+	}
+	if result, ok := fg.zips[zip5(address.ZipCode)]; ok {
+		return &result, nil
+	}
+	if result, ok := fg.cities[cityKey(address)]; ok {
+		return &result, nil
+	}
+	return nil, ErrAddressNotGeocoded
+}
+
+// pointKeys returns the keys an address point is indexed under: by five-digit ZIP code and by city
+func pointKeys(address Address) []string {
+	var keys []string
+	if address.ZipCode != "" {
+		keys = append(keys, address.StreetKey()+"|"+zip5(address.ZipCode))
+	}
+	if address.City != "" {
+		keys = append(keys, address.StreetKey()+"|"+cityKey(address))
+	}
+	return keys
+}
+
+// cityKey returns the lowercase "city|state" key of an address
+func cityKey(address Address) string {
+	return strings.ToLower(address.City + "|" + address.State)
+}
@@ -0,0 +1,200 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/user/cma/models"
+)
+
+const (
+	// defaultDownPaymentRate is the down payment assumed when a request doesn't give one
+	defaultDownPaymentRate = 0.2
+
+	// defaultLoanTermYears is the mortgage term assumed when a request doesn't give one
+	defaultLoanTermYears = 30
+
+	// defaultVacancyRate is the share of the year a rental is assumed to be vacant
+	defaultVacancyRate = 0.05
+
+	// maxTrendAppreciation bounds the market trend's appreciation used in a projection, since a
+	// short or thin sales history can annualize to rates no market sustains for a decade
+	maxTrendAppreciation = 0.1
+
+	// appreciationTimeRange is the sales history the market trend's appreciation is measured over
+	appreciationTimeRange = "3 years"
+
+	// projectionYears is the number of years an investment is projected over
+	projectionYears = 10
+)
+
+// ErrRentUnknown is returned when an investment analysis has no monthly rent and none can be estimated
+var ErrRentUnknown = errors.New("monthly rent is required when no rental data is available")
+
+// InvestmentAnalyzer evaluates properties as rental investments
+type InvestmentAnalyzer struct {
+	cmaAnalyzer    *CMAAnalyzer
+	marketAnalyzer *MarketAnalyzer
+}
+
+// NewInvestmentAnalyzer creates a new InvestmentAnalyzer instance
+func NewInvestmentAnalyzer(ca *CMAAnalyzer, ma *MarketAnalyzer) *InvestmentAnalyzer {
+	return &InvestmentAnalyzer{
+		cmaAnalyzer:    ca,
+		marketAnalyzer: ma,
+	}
+}
+
+// GetInvestmentAnalysis values a property with a CMA and evaluates buying it as a rental. The
+// purchase price, rent and appreciation default to the CMA's estimate, the rent estimated from
+// rental comparables and the location's market trend.
+func (ia *InvestmentAnalyzer) GetInvestmentAnalysis(ctx context.Context, req models.InvestmentRequest) (*models.InvestmentAnalysis, error) {
+	cmaReq := models.CMARequest{
+		PropertyID:   req.PropertyID,
+		Address:      req.Address,
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Radius:       req.Radius,
+		PropertyType: req.PropertyType,
+	}
+	cma, err := ia.cmaAnalyzer.GetComparableProperties(ctx, cmaReq)
+	if err != nil {
+		return nil, err
+	}
+	freshness := []string{cma.DataFreshness}
+
+	if req.PurchasePrice == 0 {
+		if cma.EstimatedValue <= 0 {
+			return nil, ErrNoComparables
+		}
+		req.PurchasePrice = cma.EstimatedValue
+	}
+
+	if req.MonthlyRent == 0 {
+		rent, err := ia.cmaAnalyzer.GetRentalComparables(ctx, cmaReq)
+		if errors.Is(err, ErrRentalsUnavailable) {
+			return nil, ErrRentUnknown
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rent.EstimatedRent <= 0 {
+			return nil, ErrRentUnknown
+		}
+		req.MonthlyRent = rent.EstimatedRent
+		freshness = append(freshness, rent.DataFreshness)
+	}
+
+	if req.AppreciationRate == nil {
+		appreciation, dataFreshness, err := ia.trendAppreciation(ctx, cma.Address, req.PropertyType)
+		if err != nil {
+			return nil, err
+		}
+		req.AppreciationRate = &appreciation
+		freshness = append(freshness, dataFreshness)
+	}
+
+	analysis := analyzeInvestment(req)
+	analysis.PropertyID = cma.PropertyID
+	analysis.Address = cma.Address
+	analysis.EstimatedValue = cma.EstimatedValue
+	analysis.DataFreshness = LeastFresh(freshness...)
+	return analysis, nil
+}
+
+// trendAppreciation returns the annual appreciation of the market around an address, within
+// bounds, and the freshness of the data it was measured from
+func (ia *InvestmentAnalyzer) trendAppreciation(ctx context.Context, address, propertyType string) (float64, string, error) {
+	parsed := ParseAddress(address)
+	location := zip5(parsed.ZipCode)
+	if parsed.City != "" && parsed.State != "" {
+		location = parsed.City + ", " + parsed.State
+	}
+	if location == "" {
+		return 0, "", nil
+	}
+
+	trends, err := ia.marketAnalyzer.GetMarketTrends(ctx, models.MarketTrendsRequest{
+		Location:     location,
+		PropertyType: propertyType,
+		TimeRange:    appreciationTimeRange,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	appreciation := math.Min(math.Max(trends.AnnualAppreciation, -maxTrendAppreciation), maxTrendAppreciation)
+	return appreciation, trends.DataFreshness, nil
+}
+
+// analyzeInvestment computes the investment metrics and projection for a request whose purchase
+// price, monthly rent and appreciation rate are known
+func analyzeInvestment(req models.InvestmentRequest) *models.InvestmentAnalysis {
+	downPaymentRate := defaultDownPaymentRate
+	if req.DownPaymentRate != nil {
+		downPaymentRate = *req.DownPaymentRate
+	}
+	vacancyRate := defaultVacancyRate
+	if req.VacancyRate != nil {
+		vacancyRate = *req.VacancyRate
+	}
+	var appreciation float64
+	if req.AppreciationRate != nil {
+		appreciation = *req.AppreciationRate
+	}
+	term := req.LoanTermYears
+	if term == 0 {
+		term = defaultLoanTermYears
+	}
+
+	price := float64(req.PurchasePrice)
+	downPayment := math.Round(price * downPaymentRate)
+	loan := price - downPayment
+	payment := MonthlyPayment(loan, req.InterestRate, term)
+	cashInvested := downPayment + float64(req.ClosingCosts)
+
+	grossRent := float64(req.MonthlyRent) * 12
+	expenses := float64(req.AnnualPropertyTax+req.AnnualInsurance) + float64(req.MonthlyHOA+req.MonthlyExpenses)*12
+	noi := grossRent*(1-vacancyRate) - expenses
+	cashFlow := noi - payment*12
+
+	analysis := &models.InvestmentAnalysis{
+		PurchasePrice:          req.PurchasePrice,
+		MonthlyRent:            req.MonthlyRent,
+		DownPayment:            int(downPayment),
+		LoanAmount:             int(loan),
+		MonthlyMortgagePayment: int(math.Round(payment)),
+		CashInvested:           int(cashInvested),
+		NetOperatingIncome:     int(math.Round(noi)),
+		CapRate:                math.Round(noi/price*1000) / 1000,
+		MonthlyCashFlow:        int(math.Round(cashFlow / 12)),
+		AppreciationRate:       appreciation,
+	}
+	if grossRent > 0 {
+		analysis.GrossRentMultiplier = math.Round(price/grossRent*100) / 100
+	}
+	if cashInvested > 0 {
+		analysis.CashOnCashReturn = math.Round(cashFlow/cashInvested*1000) / 1000
+	}
+
+	var cumulative float64
+	for year := 1; year <= projectionYears; year++ {
+		yearRent := grossRent * math.Pow(1+req.RentGrowthRate, float64(year-1))
+		yearExpenses := expenses * math.Pow(1+req.ExpenseGrowthRate, float64(year-1))
+		payments := min(12, max(0, term*12-(year-1)*12))
+		yearCashFlow := yearRent*(1-vacancyRate) - yearExpenses - payment*float64(payments)
+		cumulative += yearCashFlow
+
+		value := price * math.Pow(1+appreciation, float64(year))
+		balance := LoanBalance(loan, req.InterestRate, term, year*12)
+		analysis.Projection = append(analysis.Projection, models.InvestmentYear{
+			Year:               year,
+			PropertyValue:      int(math.Round(value)),
+			LoanBalance:        int(math.Round(balance)),
+			Equity:             int(math.Round(value - balance)),
+			CashFlow:           int(math.Round(yearCashFlow)),
+			CumulativeCashFlow: int(math.Round(cumulative)),
+		})
+	}
+	return analysis
+}
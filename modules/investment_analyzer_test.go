@@ -0,0 +1,192 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func TestAnalyzeInvestment(t *testing.T) {
+	appreciation := 0.03
+	result := analyzeInvestment(models.InvestmentRequest{
+		PurchasePrice:     500000,
+		InterestRate:      0.06,
+		ClosingCosts:      10000,
+		MonthlyRent:       3000,
+		AnnualPropertyTax: 6000,
+		AnnualInsurance:   1200,
+		MonthlyExpenses:   200,
+		AppreciationRate:  &appreciation,
+	})
+
+	// 20% down, 30 years at 6% and 5% vacancy by default
+	checks := []struct {
+		name     string
+		expected interface{}
+		actual   interface{}
+	}{
+		{"down payment", 100000, result.DownPayment},
+		{"loan amount", 400000, result.LoanAmount},
+		{"monthly mortgage payment", 2398, result.MonthlyMortgagePayment},
+		{"cash invested", 110000, result.CashInvested},
+		{"net operating income", 24600, result.NetOperatingIncome},
+		{"cap rate", 0.049, result.CapRate},
+		{"gross rent multiplier", 13.89, result.GrossRentMultiplier},
+		{"cash-on-cash return", -0.038, result.CashOnCashReturn},
+		{"monthly cash flow", -348, result.MonthlyCashFlow},
+		{"projection years", 10, len(result.Projection)},
+	}
+	for _, c := range checks {
+		if c.expected != c.actual {
+			t.Errorf("Expected %s %v but got %v", c.name, c.expected, c.actual)
+		}
+	}
+
+	year10 := result.Projection[9]
+	if year10.PropertyValue != 671958 {
+		t.Errorf("Expected year 10 property value 671958 but got %d", year10.PropertyValue)
+	}
+	if year10.LoanBalance != 334743 {
+		t.Errorf("Expected year 10 loan balance 334743 but got %d", year10.LoanBalance)
+	}
+	if year10.Equity != 337215 {
+		t.Errorf("Expected year 10 equity 337215 but got %d", year10.Equity)
+	}
+	if year10.CumulativeCashFlow != -41784 {
+		t.Errorf("Expected year 10 cumulative cash flow -41784 but got %d", year10.CumulativeCashFlow)
+	}
+}
+
+func TestAnalyzeInvestmentCashPurchase(t *testing.T) {
+	downPayment, vacancy := 1.0, 0.0
+	result := analyzeInvestment(models.InvestmentRequest{
+		PurchasePrice:   400000,
+		MonthlyRent:     2500,
+		MonthlyHOA:      300,
+		DownPaymentRate: &downPayment,
+		VacancyRate:     &vacancy,
+		RentGrowthRate:  0.1,
+	})
+
+	if result.LoanAmount != 0 || result.MonthlyMortgagePayment != 0 {
+		t.Errorf("Expected no mortgage but got %d at %d a month", result.LoanAmount, result.MonthlyMortgagePayment)
+	}
+	// Without a mortgage the cap rate and the cash-on-cash return are the same
+	if result.CapRate != 0.066 || result.CashOnCashReturn != 0.066 {
+		t.Errorf("Expected cap rate and cash-on-cash return 0.066 but got %v and %v", result.CapRate, result.CashOnCashReturn)
+	}
+	if result.MonthlyCashFlow != 2200 {
+		t.Errorf("Expected monthly cash flow 2200 but got %d", result.MonthlyCashFlow)
+	}
+	if result.Projection[0].CashFlow != 26400 || result.Projection[1].CashFlow != 29400 {
+		t.Errorf("Expected cash flows 26400 and 29400 but got %d and %d", result.Projection[0].CashFlow, result.Projection[1].CashFlow)
+	}
+	if result.Projection[9].PropertyValue != 400000 {
+		t.Errorf("Expected no appreciation but got year 10 value %d", result.Projection[9].PropertyValue)
+	}
+}
+
+func TestAnalyzeInvestmentShortLoan(t *testing.T) {
+	appreciation := 0.0
+	result := analyzeInvestment(models.InvestmentRequest{
+		PurchasePrice:    300000,
+		InterestRate:     0.05,
+		LoanTermYears:    5,
+		MonthlyRent:      2000,
+		AppreciationRate: &appreciation,
+	})
+
+	// Mortgage payments end with the loan term
+	if result.Projection[4].LoanBalance != 0 || result.Projection[4].Equity != 300000 {
+		t.Errorf("Expected the loan repaid after 5 years but got balance %d", result.Projection[4].LoanBalance)
+	}
+	if result.Projection[5].CashFlow != 22800 {
+		t.Errorf("Expected year 6 cash flow 22800 but got %d", result.Projection[5].CashFlow)
+	}
+}
+
+func TestGetInvestmentAnalysisFromFile(t *testing.T) {
+	df := newFileDataFetcher(t)
+	marketAnalyzer := NewMarketAnalyzer(df)
+	marketAnalyzer.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	analyzer := NewInvestmentAnalyzer(newTestCMAAnalyzer(df), marketAnalyzer)
+
+	result, err := analyzer.GetInvestmentAnalysis(context.Background(), models.InvestmentRequest{
+		PropertyID:   "S1",
+		Radius:       5,
+		InterestRate: 0.065,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// Purchase price and rent default to the CMA's estimate and the rent estimate
+	if result.PurchasePrice != result.EstimatedValue || result.PurchasePrice == 0 {
+		t.Errorf("Expected purchase price %d but got %d", result.EstimatedValue, result.PurchasePrice)
+	}
+	if result.MonthlyRent != 4911 {
+		t.Errorf("Expected monthly rent 4911 but got %d", result.MonthlyRent)
+	}
+	// Four months of sales are too short a history to show appreciation
+	if result.AppreciationRate != 0 {
+		t.Errorf("Expected no appreciation but got %v", result.AppreciationRate)
+	}
+	if result.DataFreshness != models.DataFreshnessLive {
+		t.Errorf("Expected data freshness live but got %s", result.DataFreshness)
+	}
+}
+
+func TestGetInvestmentAnalysisWithoutRent(t *testing.T) {
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", City: "San Francisco", State: "CA", Latitude: 37.7706, Longitude: -122.4222, Sqft: 1400},
+	}})
+	analyzer := NewInvestmentAnalyzer(newTestCMAAnalyzer(df), NewMarketAnalyzer(df))
+
+	_, err := analyzer.GetInvestmentAnalysis(context.Background(), models.InvestmentRequest{
+		PropertyID:    "S1",
+		PurchasePrice: 1000000,
+		InterestRate:  0.065,
+	})
+	if !errors.Is(err, ErrRentUnknown) {
+		t.Errorf("Expected ErrRentUnknown but got %v", err)
+	}
+}
+
+func TestTrendAppreciationBounded(t *testing.T) {
+	// Prices per square foot doubling over a year
+	listings := []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", City: "San Francisco", State: "CA", ZipCode: "94103", Latitude: 37.7706, Longitude: -122.4222, Sqft: 1000},
+	}
+	for i, month := range []time.Month{time.January, time.July, time.December} {
+		listings = append(listings, models.Listing{
+			ID:        fmt.Sprintf("C%d", i+1),
+			City:      "San Francisco",
+			State:     "CA",
+			Status:    models.ListingStatusSold,
+			Sqft:      1000,
+			SalePrice: 1000000 + i*500000,
+			SaleDate:  time.Date(2023, month, 15, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: listings})
+	marketAnalyzer := NewMarketAnalyzer(df)
+	marketAnalyzer.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	analyzer := NewInvestmentAnalyzer(newTestCMAAnalyzer(df), marketAnalyzer)
+
+	appreciation, freshness, err := analyzer.trendAppreciation(context.Background(), "100 Valencia St, San Francisco, CA 94103", "")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if appreciation != maxTrendAppreciation {
+		t.Errorf("Expected appreciation %v but got %v", maxTrendAppreciation, appreciation)
+	}
+	if freshness != models.DataFreshnessLive {
+		t.Errorf("Expected data freshness live but got %s", freshness)
+	}
+}
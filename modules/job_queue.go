@@ -0,0 +1,420 @@
+package modules
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+var (
+	// ErrJobNotFound is returned when a job is unknown or has expired
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrUnknownJobType is returned when a job is submitted with a type no function is registered for
+	ErrUnknownJobType = errors.New("unknown job type")
+
+	// ErrJobQueueFull is returned when a job is submitted while the queue holds its limit of jobs
+	ErrJobQueueFull = errors.New("job queue is full")
+
+	// ErrJobFinished is returned when canceling a job that has already finished
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+// JobFunc runs a job of one type: it decodes the job's parameters, reports the number of units
+// of work done through progress, and returns a result that is stored as JSON. It must stop when
+// ctx is canceled.
+type JobFunc func(ctx context.Context, params json.RawMessage, progress func(completed int)) (interface{}, error)
+
+// JobConfig configures a JobQueue
+type JobConfig struct {
+	// Number of jobs run concurrently
+	Workers int
+
+	// Deadline for a job, from when it starts running
+	Timeout time.Duration
+
+	// How long a finished job and its result are kept
+	Retention time.Duration
+
+	// Largest number of jobs waiting to run
+	MaxQueued int
+
+	// Directory jobs are persisted to so they survive a restart; empty keeps them in memory only
+	Dir string
+}
+
+// DefaultJobConfig returns the default job queue configuration
+func DefaultJobConfig() JobConfig {
+	return JobConfig{
+		Workers:   2,
+		Timeout:   30 * time.Minute,
+		Retention: 24 * time.Hour,
+		MaxQueued: 100,
+	}
+}
+
+// storedJob is a job as persisted: its state with the parameters to rerun it and its result
+type storedJob struct {
+	models.Job
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// jobEntry tracks a job in the queue
+type jobEntry struct {
+	storedJob
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// JobQueue runs long-running jobs in the background, a bounded number at a time, and keeps their
+// state and results for polling. With a directory configured, jobs are persisted as they change
+// state; jobs that were queued or running when the process stopped run again after a restart.
+type JobQueue struct {
+	config JobConfig
+	funcs  map[string]JobFunc
+	now    func() time.Time
+
+	mu       sync.Mutex
+	jobs     map[string]*jobEntry
+	onFinish func(models.Job)
+	queue    chan string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewJobQueue creates a new JobQueue, loading the jobs persisted in cfg.Dir if it is set. Job
+// functions are registered with Register, then Start runs the queue.
+func NewJobQueue(cfg JobConfig) (*JobQueue, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &JobQueue{
+		config: cfg,
+		funcs:  make(map[string]JobFunc),
+		now:    time.Now,
+		jobs:   make(map[string]*jobEntry),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	var pending []*jobEntry
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			cancel()
+			return nil, fmt.Errorf("error creating job directory: %w", err)
+		}
+		loaded, err := q.load()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		for _, entry := range loaded {
+			q.jobs[entry.ID] = entry
+			if entry.Status == models.JobStatusQueued {
+				pending = append(pending, entry)
+			}
+		}
+	}
+
+	// Jobs waiting from before a restart run first, in the order they were submitted
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	q.queue = make(chan string, max(cfg.MaxQueued, 0)+len(pending))
+	for _, entry := range pending {
+		q.queue <- entry.ID
+	}
+	return q, nil
+}
+
+// Register sets the function that runs jobs of a type
+func (q *JobQueue) Register(jobType string, fn JobFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.funcs[jobType] = fn
+}
+
+// OnFinish sets a function called in the background with each job that succeeds, fails or is
+// canceled
+func (q *JobQueue) OnFinish(fn func(models.Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onFinish = fn
+}
+
+// Start starts the workers that run queued jobs
+func (q *JobQueue) Start() {
+	for w := 0; w < q.config.Workers; w++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop stops the workers, canceling running jobs. Jobs that finish as they are canceled keep their
+// results; the others are persisted as queued so they run again after a restart.
+func (q *JobQueue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Submit queues a job with its parameters and the number of units of work in it, if known
+func (q *JobQueue) Submit(jobType string, params json.RawMessage, total int) (models.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.funcs[jobType]; !ok {
+		return models.Job{}, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+	q.evictExpired()
+
+	entry := &jobEntry{storedJob: storedJob{
+		Job: models.Job{
+			ID:        newID(),
+			Type:      jobType,
+			Status:    models.JobStatusQueued,
+			Progress:  models.JobProgress{Total: total},
+			CreatedAt: q.now().UTC(),
+		},
+		Params: params,
+	}}
+	if err := q.save(entry); err != nil {
+		return models.Job{}, err
+	}
+
+	select {
+	case q.queue <- entry.ID:
+	default:
+		q.remove(entry.ID)
+		return models.Job{}, ErrJobQueueFull
+	}
+	q.jobs[entry.ID] = entry
+	return entry.Job, nil
+}
+
+// Get returns the state of a job
+func (q *JobQueue) Get(id string) (models.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.evictExpired()
+	entry, ok := q.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	return entry.Job, nil
+}
+
+// Result returns the state of a job and, once it has succeeded, its result as JSON
+func (q *JobQueue) Result(id string) (models.Job, json.RawMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.evictExpired()
+	entry, ok := q.jobs[id]
+	if !ok {
+		return models.Job{}, nil, ErrJobNotFound
+	}
+	return entry.Job, entry.Result, nil
+}
+
+// Cancel cancels a queued or running job. A running job's function is canceled through its
+// context; the job is reported as canceled right away.
+func (q *JobQueue) Cancel(id string) (models.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	if entry.Status != models.JobStatusQueued && entry.Status != models.JobStatusRunning {
+		return entry.Job, ErrJobFinished
+	}
+
+	entry.canceled = true
+	if entry.cancel != nil {
+		entry.cancel()
+	}
+	q.finish(entry, models.JobStatusCanceled, "")
+	return entry.Job, nil
+}
+
+// work runs queued jobs until the queue is stopped
+func (q *JobQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case id := <-q.queue:
+			if q.ctx.Err() != nil {
+				return
+			}
+			q.run(id)
+		}
+	}
+}
+
+// run runs a queued job and records its outcome
+func (q *JobQueue) run(id string) {
+	q.mu.Lock()
+	entry, ok := q.jobs[id]
+	if !ok || entry.Status != models.JobStatusQueued {
+		// Canceled or evicted while waiting
+		q.mu.Unlock()
+		return
+	}
+	fn, ok := q.funcs[entry.Type]
+	if !ok {
+		q.finish(entry, models.JobStatusFailed, fmt.Sprintf("%s: %s", ErrUnknownJobType, entry.Type))
+		q.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, q.config.Timeout)
+	defer cancel()
+	started := q.now().UTC()
+	entry.Status = models.JobStatusRunning
+	entry.StartedAt = &started
+	entry.cancel = cancel
+	_ = q.save(entry)
+	q.mu.Unlock()
+
+	result, err := fn(ctx, entry.Params, func(completed int) {
+		q.mu.Lock()
+		entry.Progress.Completed = completed
+		q.mu.Unlock()
+	})
+	var data json.RawMessage
+	if err == nil {
+		data, err = json.Marshal(result)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry.cancel = nil
+	switch {
+	case entry.canceled:
+		// Already reported as canceled
+	case err == nil:
+		// Keep the result even when the queue stopped as the job finished
+		entry.Result = data
+		q.finish(entry, models.JobStatusSucceeded, "")
+	case q.ctx.Err() != nil && errors.Is(ctx.Err(), context.Canceled):
+		// The queue stopped the job: run it again after a restart
+		entry.Status = models.JobStatusQueued
+		entry.StartedAt = nil
+		entry.Progress.Completed = 0
+		_ = q.save(entry)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		q.finish(entry, models.JobStatusFailed, fmt.Sprintf("job did not finish within %s", q.config.Timeout))
+	default:
+		q.finish(entry, models.JobStatusFailed, err.Error())
+	}
+}
+
+// finish records the final status of a job; the caller must hold q.mu
+func (q *JobQueue) finish(entry *jobEntry, status, message string) {
+	finished := q.now().UTC()
+	entry.Status = status
+	entry.Error = message
+	entry.FinishedAt = &finished
+	// A job whose state could not be persisted is still tracked in memory until a restart
+	_ = q.save(entry)
+
+	if q.onFinish != nil {
+		go q.onFinish(entry.Job)
+	}
+}
+
+// evictExpired drops finished jobs kept longer than the retention period; the caller must hold q.mu
+func (q *JobQueue) evictExpired() {
+	for id, entry := range q.jobs {
+		if entry.FinishedAt != nil && q.now().Sub(*entry.FinishedAt) > q.config.Retention {
+			delete(q.jobs, id)
+			q.remove(id)
+		}
+	}
+}
+
+// save persists a job, if the queue has a directory; the caller must hold q.mu
+func (q *JobQueue) save(entry *jobEntry) error {
+	if q.config.Dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry.storedJob)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated job behind
+	path := q.path(entry.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing job: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// remove deletes a persisted job, if the queue has a directory
+func (q *JobQueue) remove(id string) {
+	if q.config.Dir != "" {
+		_ = os.Remove(q.path(id))
+	}
+}
+
+// load reads the persisted jobs. Jobs that were running are queued to run again.
+func (q *JobQueue) load() ([]*jobEntry, error) {
+	files, err := os.ReadDir(q.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading job directory: %w", err)
+	}
+
+	var entries []*jobEntry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.config.Dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading job: %w", err)
+		}
+		var stored storedJob
+		if err := json.Unmarshal(data, &stored); err != nil || stored.ID == "" {
+			return nil, fmt.Errorf("error parsing job file %s", file.Name())
+		}
+		if stored.Status == models.JobStatusRunning {
+			stored.Status = models.JobStatusQueued
+			stored.StartedAt = nil
+			stored.Progress.Completed = 0
+		}
+		entries = append(entries, &jobEntry{storedJob: stored})
+	}
+	return entries, nil
+}
+
+// path returns the file holding a persisted job
+func (q *JobQueue) path(id string) string {
+	return filepath.Join(q.config.Dir, id+".json")
+}
+
+// newID returns a random identifier for a job, webhook or delivery
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
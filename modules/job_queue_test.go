@@ -0,0 +1,333 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// waitForJob polls a job until it has a status, failing the test if it doesn't within a few seconds
+func waitForJob(t *testing.T, q *JobQueue, id, status string) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected job status %s but got %s", status, job.Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingJob runs until its context is canceled or release is closed, then returns "done"
+func blockingJob(started chan<- string, release <-chan struct{}) JobFunc {
+	return func(ctx context.Context, params json.RawMessage, progress func(completed int)) (interface{}, error) {
+		var name string
+		_ = json.Unmarshal(params, &name)
+		if started != nil {
+			started <- name
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-release:
+			return "done", nil
+		}
+	}
+}
+
+// countingJob reports progress over the number of units in its parameters and returns their sum
+func countingJob(ctx context.Context, params json.RawMessage, progress func(completed int)) (interface{}, error) {
+	var units []int
+	if err := json.Unmarshal(params, &units); err != nil {
+		return nil, err
+	}
+	var sum int
+	for i, unit := range units {
+		if unit < 0 {
+			return nil, errors.New("negative unit")
+		}
+		sum += unit
+		progress(i + 1)
+	}
+	return map[string]int{"sum": sum}, nil
+}
+
+func newTestJobQueue(t *testing.T, cfg JobConfig) *JobQueue {
+	t.Helper()
+	q, err := NewJobQueue(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	q.Register("count", countingJob)
+	t.Cleanup(q.Stop)
+	return q
+}
+
+func TestJobQueueRun(t *testing.T) {
+	q := newTestJobQueue(t, DefaultJobConfig())
+	finished := make(chan models.Job, 2)
+	q.OnFinish(func(job models.Job) { finished <- job })
+	q.Start()
+
+	job, err := q.Submit("count", json.RawMessage(`[1, 2, 3]`), 3)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if job.ID == "" || job.Type != "count" || job.Progress.Total != 3 {
+		t.Errorf("Expected a queued count job with 3 units but got %+v", job)
+	}
+
+	job = waitForJob(t, q, job.ID, models.JobStatusSucceeded)
+	if job.Progress.Completed != 3 {
+		t.Errorf("Expected 3 completed units but got %d", job.Progress.Completed)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		t.Errorf("Expected start and finish times but got %+v", job)
+	}
+	_, result, err := q.Result(job.ID)
+	if err != nil || string(result) != `{"sum":6}` {
+		t.Errorf("Expected result {\"sum\":6} but got %s (%v)", result, err)
+	}
+
+	failed, err := q.Submit("count", json.RawMessage(`[1, -1]`), 2)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	failed = waitForJob(t, q, failed.ID, models.JobStatusFailed)
+	if failed.Error != "negative unit" {
+		t.Errorf("Expected error negative unit but got %q", failed.Error)
+	}
+	if _, result, _ := q.Result(failed.ID); result != nil {
+		t.Errorf("Expected no result for a failed job but got %s", result)
+	}
+
+	statuses := map[string]string{}
+	for i := 0; i < 2; i++ {
+		job := <-finished
+		statuses[job.ID] = job.Status
+	}
+	if statuses[job.ID] != models.JobStatusSucceeded || statuses[failed.ID] != models.JobStatusFailed {
+		t.Errorf("Expected OnFinish with the succeeded and failed jobs but got %v", statuses)
+	}
+
+	if _, err := q.Submit("unknown", nil, 0); !errors.Is(err, ErrUnknownJobType) {
+		t.Errorf("Expected ErrUnknownJobType but got %v", err)
+	}
+	if _, err := q.Get("unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound but got %v", err)
+	}
+}
+
+func TestJobQueueConcurrency(t *testing.T) {
+	cfg := DefaultJobConfig()
+	cfg.Workers = 1
+	cfg.MaxQueued = 1
+	q := newTestJobQueue(t, cfg)
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	q.Register("block", blockingJob(started, release))
+	q.Start()
+
+	first, _ := q.Submit("block", json.RawMessage(`"first"`), 0)
+	<-started
+	second, err := q.Submit("block", json.RawMessage(`"second"`), 0)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// One worker is busy and the one queue slot is taken
+	if _, err := q.Submit("block", json.RawMessage(`"third"`), 0); !errors.Is(err, ErrJobQueueFull) {
+		t.Errorf("Expected ErrJobQueueFull but got %v", err)
+	}
+	if job, _ := q.Get(second.ID); job.Status != models.JobStatusQueued {
+		t.Errorf("Expected the second job to wait but got status %s", job.Status)
+	}
+
+	close(release)
+	waitForJob(t, q, first.ID, models.JobStatusSucceeded)
+	waitForJob(t, q, second.ID, models.JobStatusSucceeded)
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	cfg := DefaultJobConfig()
+	cfg.Workers = 1
+	q := newTestJobQueue(t, cfg)
+	started := make(chan string, 1)
+	q.Register("block", blockingJob(started, nil))
+	q.Start()
+
+	running, _ := q.Submit("block", json.RawMessage(`"running"`), 0)
+	<-started
+	queued, _ := q.Submit("block", json.RawMessage(`"queued"`), 0)
+
+	for _, id := range []string{queued.ID, running.ID} {
+		job, err := q.Cancel(id)
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if job.Status != models.JobStatusCanceled || job.FinishedAt == nil {
+			t.Errorf("Expected job %s to be canceled but got %+v", id, job)
+		}
+	}
+
+	// The canceled job's function stops, and the queued one never runs
+	done, _ := q.Submit("count", json.RawMessage(`[1]`), 1)
+	waitForJob(t, q, done.ID, models.JobStatusSucceeded)
+	select {
+	case name := <-started:
+		t.Errorf("Expected the canceled queued job not to run but %s started", name)
+	default:
+	}
+	if job, _ := q.Get(running.ID); job.Status != models.JobStatusCanceled {
+		t.Errorf("Expected the running job to stay canceled but got %s", job.Status)
+	}
+
+	if _, err := q.Cancel(done.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished but got %v", err)
+	}
+	if _, err := q.Cancel("unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound but got %v", err)
+	}
+}
+
+func TestJobQueueTimeout(t *testing.T) {
+	cfg := DefaultJobConfig()
+	cfg.Timeout = 10 * time.Millisecond
+	q := newTestJobQueue(t, cfg)
+	q.Register("block", blockingJob(nil, nil))
+	q.Start()
+
+	job, _ := q.Submit("block", json.RawMessage(`"slow"`), 0)
+	job = waitForJob(t, q, job.ID, models.JobStatusFailed)
+	if job.Error != "job did not finish within 10ms" {
+		t.Errorf("Expected a timeout error but got %q", job.Error)
+	}
+}
+
+func TestJobQueueRetention(t *testing.T) {
+	q := newTestJobQueue(t, DefaultJobConfig())
+	q.Start()
+
+	job, _ := q.Submit("count", json.RawMessage(`[1]`), 1)
+	waitForJob(t, q, job.ID, models.JobStatusSucceeded)
+
+	q.mu.Lock()
+	q.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	q.mu.Unlock()
+	if _, err := q.Get(job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected the job to have expired but got %v", err)
+	}
+}
+
+func TestJobQueuePersistence(t *testing.T) {
+	cfg := DefaultJobConfig()
+	cfg.Workers = 1
+	cfg.Dir = t.TempDir()
+
+	q, err := NewJobQueue(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	started := make(chan string, 1)
+	q.Register("count", countingJob)
+	q.Register("block", blockingJob(started, nil))
+	q.Start()
+
+	finished, _ := q.Submit("count", json.RawMessage(`[4, 5]`), 2)
+	waitForJob(t, q, finished.ID, models.JobStatusSucceeded)
+	running, _ := q.Submit("block", json.RawMessage(`"running"`), 0)
+	<-started
+	queued, _ := q.Submit("count", json.RawMessage(`[1, 2]`), 2)
+	canceled, _ := q.Submit("count", json.RawMessage(`[3]`), 1)
+	if _, err := q.Cancel(canceled.ID); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	q.Stop()
+
+	// After a restart, finished jobs keep their results and unfinished ones run again
+	restarted, err := NewJobQueue(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	defer restarted.Stop()
+
+	for id, status := range map[string]string{
+		finished.ID: models.JobStatusSucceeded,
+		running.ID:  models.JobStatusQueued,
+		queued.ID:   models.JobStatusQueued,
+		canceled.ID: models.JobStatusCanceled,
+	} {
+		job, err := restarted.Get(id)
+		if err != nil {
+			t.Fatalf("Expected job %s to be restored but got: %v", id, err)
+		}
+		if job.Status != status {
+			t.Errorf("Expected restored job %s to be %s but got %s", id, status, job.Status)
+		}
+	}
+	if _, result, _ := restarted.Result(finished.ID); string(result) != `{"sum":9}` {
+		t.Errorf("Expected the restored result {\"sum\":9} but got %s", result)
+	}
+
+	release := make(chan struct{})
+	close(release)
+	restarted.Register("count", countingJob)
+	restarted.Register("block", blockingJob(nil, release))
+	restarted.Start()
+	waitForJob(t, restarted, running.ID, models.JobStatusSucceeded)
+	job := waitForJob(t, restarted, queued.ID, models.JobStatusSucceeded)
+	if job.Progress.Completed != 2 {
+		t.Errorf("Expected 2 completed units but got %d", job.Progress.Completed)
+	}
+}
+
+func TestJobQueueStopKeepsResult(t *testing.T) {
+	cfg := DefaultJobConfig()
+	cfg.Workers = 1
+	cfg.Dir = t.TempDir()
+
+	q, err := NewJobQueue(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	started := make(chan struct{})
+	q.Register("finish", func(ctx context.Context, params json.RawMessage, progress func(completed int)) (interface{}, error) {
+		close(started)
+		// The job completes its work even though the queue is stopping
+		<-ctx.Done()
+		return "done", nil
+	})
+	q.Start()
+
+	job, _ := q.Submit("finish", nil, 0)
+	<-started
+	q.Stop()
+
+	restarted, err := NewJobQueue(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	defer restarted.Stop()
+
+	job, result, err := restarted.Result(job.ID)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if job.Status != models.JobStatusSucceeded {
+		t.Errorf("Expected status %s but got %s", models.JobStatusSucceeded, job.Status)
+	}
+	if string(result) != `"done"` {
+		t.Errorf("Expected the result \"done\" but got %s", result)
+	}
+}
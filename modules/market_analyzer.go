@@ -1,23 +1,146 @@
 package modules
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/user/cma/models"
 )
 
+// timeRangePattern matches time ranges such as "6 months", "Last 1 year" or "90 days"
+var timeRangePattern = regexp.MustCompile(`(\d+)\s*(day|week|month|year)s?`)
+
+// affordablePaymentShare is the share of income a mortgage payment may take for the median home
+// to count as affordable in the affordability index
+const affordablePaymentShare = 0.25
+
+// ErrNoMortgageRate is returned when affordability is requested for a loan term with no configured rate
+var ErrNoMortgageRate = errors.New("no mortgage rate configured")
+
+// ErrInventoryUnavailable is returned when active listings are counted without a listings provider
+var ErrInventoryUnavailable = errors.New("no listings provider to count active listings")
+
 // MarketAnalyzer analyzes real estate market data
 type MarketAnalyzer struct {
-	dataFetcher *DataFetcher
+	dataFetcher   *DataFetcher
+	mortgageRates MortgageRates
+	now           func() time.Time
 }
 
 // NewMarketAnalyzer creates a new MarketAnalyzer instance
 func NewMarketAnalyzer(df *DataFetcher) *MarketAnalyzer {
 	return &MarketAnalyzer{
-		dataFetcher: df,
+		dataFetcher:   df,
+		mortgageRates: DefaultMortgageRates(),
+		now:           time.Now,
 	}
 }
 
+// SetMortgageRates sets the mortgage rates and loan assumptions used for affordability
+func (ma *MarketAnalyzer) SetMortgageRates(rates MortgageRates) {
+	ma.mortgageRates = rates
+}
+
+// MortgageRates returns the mortgage rates and loan assumptions used for affordability
+func (ma *MarketAnalyzer) MortgageRates() MortgageRates {
+	return ma.mortgageRates
+}
+
 // GetMarketTrends fetches and analyzes market trends for a specific location
-func (ma *MarketAnalyzer) GetMarketTrends(req models.MarketTrendsRequest) (*models.MarketTrends, error) {
+func (ma *MarketAnalyzer) GetMarketTrends(ctx context.Context, req models.MarketTrendsRequest) (*models.MarketTrends, error) {
+	ctx, freshness := WithFreshness(ctx)
+
+	key := strings.ToLower(strings.Join([]string{req.Location, req.PropertyType, req.TimeRange}, "|"))
+	value, err := ma.dataFetcher.Cached(ctx, CacheAggregates, "market-trends:"+key, func(ctx context.Context) (interface{}, error) {
+		return ma.computeMarketTrends(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hand out a copy so callers can't modify the cached result
+	trends := *value.(*models.MarketTrends)
+	trends.Affordability, err = ma.affordability(trends.MedianPrice, req)
+	if err != nil {
+		return nil, err
+	}
+	trends.DataFreshness = freshness.Freshness()
+	return &trends, nil
+}
+
+// ActiveInventory returns the number of active listings in a location
+func (ma *MarketAnalyzer) ActiveInventory(ctx context.Context, location, propertyType string) (int, error) {
+	provider := ma.dataFetcher.Provider()
+	if provider == nil {
+		return 0, ErrInventoryUnavailable
+	}
+
+	listings, err := provider.SearchListings(ctx, models.ListingQuery{
+		Location:     location,
+		PropertyType: propertyType,
+		Statuses:     []string{models.ListingStatusActive},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(listings), nil
+}
+
+// affordability computes the monthly mortgage payment at a median price with the request's
+// down payment and loan term, or the configured ones, and its share of household income
+func (ma *MarketAnalyzer) affordability(medianPrice int, req models.MarketTrendsRequest) (models.Affordability, error) {
+	a := models.Affordability{
+		RatesAsOf:       ma.mortgageRates.AsOf,
+		DownPaymentRate: ma.mortgageRates.DownPaymentRate,
+		LoanTermYears:   ma.mortgageRates.LoanTermYears,
+		HouseholdIncome: req.HouseholdIncome,
+	}
+	if req.DownPaymentRate != nil {
+		a.DownPaymentRate = *req.DownPaymentRate
+	}
+	if req.LoanTermYears != 0 {
+		a.LoanTermYears = req.LoanTermYears
+	}
+
+	rate, ok := ma.mortgageRates.Rate(a.LoanTermYears)
+	if !ok {
+		return models.Affordability{}, fmt.Errorf("%w for a %d-year term", ErrNoMortgageRate, a.LoanTermYears)
+	}
+	a.InterestRate = rate
+
+	payment := MonthlyPayment(float64(medianPrice)*(1-a.DownPaymentRate), rate, a.LoanTermYears)
+	a.MonthlyPayment = int(math.Round(payment))
+	if req.HouseholdIncome > 0 && payment > 0 {
+		income := float64(req.HouseholdIncome)
+		a.PaymentToIncome = math.Round(payment/(income/12)*1000) / 1000
+		a.AffordabilityIndex = math.Round(income/(payment*12/affordablePaymentShare)*1000) / 10
+	}
+	return a, nil
+}
+
+// computeMarketTrends fetches sales for the location and computes its market trends
+func (ma *MarketAnalyzer) computeMarketTrends(ctx context.Context, req models.MarketTrendsRequest) (*models.MarketTrends, error) {
+	if provider := ma.dataFetcher.Provider(); provider != nil {
+		// Start the range at midnight so repeated searches during a day share a cache key
+		sales, err := provider.SearchListings(ctx, models.ListingQuery{
+			Location:     req.Location,
+			PropertyType: req.PropertyType,
+			Statuses:     []string{models.ListingStatusSold},
+			SoldAfter:    TimeRangeStart(ma.now().Truncate(24*time.Hour), req.TimeRange),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ma.summarizeSales(req.Location, sales), nil
+	}
+
 	// In a real implementation, we would fetch data from external APIs
 	// and perform analysis on the data
 
@@ -29,7 +152,7 @@ func (ma *MarketAnalyzer) GetMarketTrends(req models.MarketTrendsRequest) (*mode
 	//     req.Location, req.PropertyType, req.TimeRange)
 
 	// var responseData SomeExternalAPIResponse
-	// if err := ma.dataFetcher.FetchJSON(url, &responseData); err != nil {
+	// if err := ma.dataFetcher.FetchJSON(ctx, url, &responseData); err != nil {
 	//     return nil, err
 	// }
 
@@ -42,9 +165,125 @@ func (ma *MarketAnalyzer) GetMarketTrends(req models.MarketTrendsRequest) (*mode
 		PricePerSqft: 650,
 		SalesVolume:  89,
 		Trend:        "upward",
+
+		AnnualAppreciation: 0.045,
 	}, nil
 }
 
+// summarizeSales computes market trends from a set of sold listings
+func (ma *MarketAnalyzer) summarizeSales(location string, sales []models.Listing) *models.MarketTrends {
+	trends := &models.MarketTrends{
+		Location:    location,
+		SalesVolume: len(sales),
+		Trend:       "stable",
+	}
+	if len(sales) == 0 {
+		return trends
+	}
+
+	prices := make([]float64, 0, len(sales))
+	monthly := make(map[string][]float64)
+	var totalPricePerSqft float64
+	var sized, distressed int
+	for _, sale := range sales {
+		prices = append(prices, float64(sale.SalePrice))
+		if !IsStandardSale(sale) {
+			distressed++
+		}
+		if sale.Sqft > 0 {
+			ppsf := float64(sale.SalePrice) / float64(sale.Sqft)
+			totalPricePerSqft += ppsf
+			sized++
+			month := sale.SaleDate.Format("2006-01")
+			monthly[month] = append(monthly[month], ppsf)
+		}
+	}
+
+	trends.MedianPrice = int(median(prices))
+	trends.DistressedShare = math.Round(float64(distressed)/float64(len(sales))*1000) / 1000
+	if sized > 0 {
+		trends.PricePerSqft = int(totalPricePerSqft / float64(sized))
+	}
+
+	// Use the median price per square foot of each month as the historical series
+	months := make([]string, 0, len(monthly))
+	for month := range monthly {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	historicalData := make([]float64, len(months))
+	elapsed := make([]float64, len(months))
+	for i, month := range months {
+		historicalData[i] = median(monthly[month])
+		elapsed[i] = monthsBetween(months[0], month)
+	}
+	trends.Trend = ma.AnalyzeTrend(historicalData)
+	trends.AnnualAppreciation = math.Round(annualAppreciation(elapsed, historicalData)*1000) / 1000
+
+	return trends
+}
+
+// minAppreciationMonths is the shortest price history annualized into an appreciation rate;
+// a few months of noisy medians would compound into meaningless yearly rates
+const minAppreciationMonths = 6
+
+// annualAppreciation fits an exponential growth rate to a price series sampled at the given
+// number of months from its start and returns it as an annual rate. Fewer than three samples
+// or a history shorter than minAppreciationMonths show no appreciation.
+func annualAppreciation(months, prices []float64) float64 {
+	if len(prices) < 3 || months[len(months)-1]-months[0] < minAppreciationMonths {
+		return 0
+	}
+
+	var meanX, meanY float64
+	logs := make([]float64, len(prices))
+	for i, price := range prices {
+		if price <= 0 {
+			return 0
+		}
+		logs[i] = math.Log(price)
+		meanX += months[i]
+		meanY += logs[i]
+	}
+	meanX /= float64(len(prices))
+	meanY /= float64(len(prices))
+
+	var covariance, variance float64
+	for i := range prices {
+		covariance += (months[i] - meanX) * (logs[i] - meanY)
+		variance += (months[i] - meanX) * (months[i] - meanX)
+	}
+	return math.Exp(12*covariance/variance) - 1
+}
+
+// monthsBetween returns the number of months from one YYYY-MM month to another
+func monthsBetween(from, to string) float64 {
+	start, _ := time.Parse("2006-01", from)
+	end, _ := time.Parse("2006-01", to)
+	return float64((end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month()))
+}
+
+// TimeRangeStart returns the start of a time range such as "6 months" or "Last 1 year" ending at now.
+// Unrecognized ranges default to 6 months.
+func TimeRangeStart(now time.Time, timeRange string) time.Time {
+	match := timeRangePattern.FindStringSubmatch(strings.ToLower(timeRange))
+	if match == nil {
+		return now.AddDate(0, -6, 0)
+	}
+
+	n, _ := strconv.Atoi(match[1])
+	switch match[2] {
+	case "day":
+		return now.AddDate(0, 0, -n)
+	case "week":
+		return now.AddDate(0, 0, -7*n)
+	case "year":
+		return now.AddDate(-n, 0, 0)
+	default:
+		return now.AddDate(0, -n, 0)
+	}
+}
+
 // AnalyzeTrend determines the trend direction based on historical data
 func (ma *MarketAnalyzer) AnalyzeTrend(historicalData []float64) string {
 	// Simple analysis algorithm to determine trend
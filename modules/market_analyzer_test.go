@@ -1,7 +1,11 @@
 package modules
 
 import (
+	"context"
+	"errors"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/user/cma/models"
 )
@@ -68,7 +72,7 @@ func TestGetMarketTrends(t *testing.T) {
 	}
 
 	// Call the function
-	result, err := analyzer.GetMarketTrends(req)
+	result, err := analyzer.GetMarketTrends(context.Background(), req)
 
 	// Check for errors
 	if err != nil {
@@ -103,3 +107,142 @@ func TestGetMarketTrends(t *testing.T) {
 		t.Error("Expected non-empty trend but got empty string")
 	}
 }
+
+func TestGetMarketTrendsFromFile(t *testing.T) {
+	analyzer := NewMarketAnalyzer(newFileDataFetcher(t))
+	analyzer.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	result, err := analyzer.GetMarketTrends(context.Background(), models.MarketTrendsRequest{
+		Location:  "San Francisco, CA",
+		TimeRange: "6 months",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	if result.SalesVolume != 7 {
+		t.Errorf("Expected sales volume 7 but got %d", result.SalesVolume)
+	}
+	if result.MedianPrice != 1150000 {
+		t.Errorf("Expected median price 1150000 but got %d", result.MedianPrice)
+	}
+	if result.DistressedShare != 0.143 {
+		t.Errorf("Expected distressed share 0.143 but got %v", result.DistressedShare)
+	}
+	if result.Trend == "" {
+		t.Error("Expected non-empty trend but got empty string")
+	}
+}
+
+func TestTimeRangeStart(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		timeRange string
+		expected  time.Time
+	}{
+		{"6 months", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"Last 1 year", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"90 days", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"2 weeks", time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC)},
+		{"whenever", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.timeRange, func(t *testing.T) {
+			if result := TimeRangeStart(now, tc.timeRange); !result.Equal(tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestAnnualAppreciation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		months   []float64
+		prices   []float64
+		expected float64
+	}{
+		{"one percent a month", []float64{0, 2, 4, 6}, []float64{100, 102.01, 104.0604, 106.152}, 0.1268},
+		{"gaps between months", []float64{0, 6, 12}, []float64{100, 102.4695, 105}, 0.05},
+		{"falling prices", []float64{0, 12, 24}, []float64{100, 90, 81}, -0.1},
+		{"flat prices", []float64{0, 6, 12}, []float64{100, 100, 100}, 0},
+		{"too few months", []float64{0, 12}, []float64{100, 110}, 0},
+		{"too short a history", []float64{0, 1, 2, 3}, []float64{100, 101, 102.01, 103.0301}, 0},
+		{"no prices", nil, nil, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := annualAppreciation(tc.months, tc.prices)
+			if math.Abs(result-tc.expected) > 0.0001 {
+				t.Errorf("Expected %v but got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetMarketTrendsAffordability(t *testing.T) {
+	rates, err := LoadMortgageRates("testdata/mortgage_rates.json")
+	if err != nil {
+		t.Fatalf("Expected no error loading rates but got: %v", err)
+	}
+	analyzer := NewMarketAnalyzer(newFileDataFetcher(t))
+	analyzer.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	analyzer.SetMortgageRates(rates)
+
+	downPayment := 0.25
+	testCases := []struct {
+		name     string
+		req      models.MarketTrendsRequest
+		expected models.Affordability
+	}{
+		{
+			name: "configured defaults",
+			req:  models.MarketTrendsRequest{},
+			expected: models.Affordability{
+				InterestRate: 0.0695, RatesAsOf: "2024-06-01", DownPaymentRate: 0.1, LoanTermYears: 30,
+				MonthlyPayment: 6851,
+			},
+		},
+		{
+			name: "with household income",
+			req:  models.MarketTrendsRequest{HouseholdIncome: 150000},
+			expected: models.Affordability{
+				InterestRate: 0.0695, RatesAsOf: "2024-06-01", DownPaymentRate: 0.1, LoanTermYears: 30,
+				MonthlyPayment: 6851, HouseholdIncome: 150000, PaymentToIncome: 0.548, AffordabilityIndex: 45.6,
+			},
+		},
+		{
+			name: "requested down payment and term",
+			req:  models.MarketTrendsRequest{DownPaymentRate: &downPayment, LoanTermYears: 15, HouseholdIncome: 150000},
+			expected: models.Affordability{
+				InterestRate: 0.0625, RatesAsOf: "2024-06-01", DownPaymentRate: 0.25, LoanTermYears: 15,
+				MonthlyPayment: 7395, HouseholdIncome: 150000, PaymentToIncome: 0.592, AffordabilityIndex: 42.3,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.Location = "San Francisco, CA"
+			tc.req.TimeRange = "6 months"
+			result, err := analyzer.GetMarketTrends(context.Background(), tc.req)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if result.Affordability != tc.expected {
+				t.Errorf("Expected %+v but got %+v", tc.expected, result.Affordability)
+			}
+		})
+	}
+
+	_, err = analyzer.GetMarketTrends(context.Background(), models.MarketTrendsRequest{
+		Location:      "San Francisco, CA",
+		LoanTermYears: 20,
+	})
+	if !errors.Is(err, ErrNoMortgageRate) {
+		t.Errorf("Expected ErrNoMortgageRate but got %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+var (
+	// ErrTooManySubscribers is returned when the market stream already has its largest number of subscribers
+	ErrTooManySubscribers = errors.New("too many market stream subscribers")
+
+	// ErrStreamStopped is returned when subscribing to a market stream that has been stopped
+	ErrStreamStopped = errors.New("market stream stopped")
+)
+
+// StreamConfig holds the settings of the market stream
+type StreamConfig struct {
+	// How often the market trends of subscribed locations are fetched again. Trends are served
+	// from the aggregates cache, so updates follow its refreshes.
+	Interval time.Duration
+
+	// How often an idle connection is sent a heartbeat comment
+	Heartbeat time.Duration
+
+	// Time a write to a connection may block before the connection is dropped
+	WriteTimeout time.Duration
+
+	// Largest number of open subscriptions
+	MaxSubscribers int
+}
+
+// DefaultStreamConfig returns the default market stream configuration
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		Interval:       time.Minute,
+		Heartbeat:      15 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxSubscribers: 100,
+	}
+}
+
+// streamTopic is a market trends query watched for at least one subscription
+type streamTopic struct {
+	query       models.MarketTrendsRequest
+	latest      *models.MarketUpdate
+	subscribers map[*Subscription]struct{}
+}
+
+// MarketStream fetches the market trends of subscribed locations periodically and sends every
+// change to their subscriptions
+type MarketStream struct {
+	marketAnalyzer *MarketAnalyzer
+	config         StreamConfig
+	now            func() time.Time
+
+	mu     sync.Mutex
+	nextID uint64
+	topics map[string]*streamTopic
+	subs   map[*Subscription]struct{}
+	wake   chan struct{}
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewMarketStream creates a new MarketStream; Start runs it
+func NewMarketStream(ma *MarketAnalyzer, cfg StreamConfig) *MarketStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MarketStream{
+		marketAnalyzer: ma,
+		config:         cfg,
+		now:            time.Now,
+		// Event IDs start from the startup time so IDs handed out before a restart are never
+		// ahead of the ones after it
+		nextID: uint64(time.Now().UnixMicro()),
+		topics: make(map[string]*streamTopic),
+		subs:   make(map[*Subscription]struct{}),
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Config returns the stream's configuration
+func (ms *MarketStream) Config() StreamConfig {
+	return ms.config
+}
+
+// Start fetches the subscribed locations in the background until Stop is called
+func (ms *MarketStream) Start() {
+	ms.wg.Add(1)
+	go func() {
+		defer ms.wg.Done()
+		ms.run(ms.ctx)
+	}()
+}
+
+// Stop stops fetching and closes every subscription
+func (ms *MarketStream) Stop() {
+	ms.stopOnce.Do(func() {
+		ms.cancel()
+		ms.wg.Wait()
+
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		for sub := range ms.subs {
+			close(sub.done)
+		}
+		ms.subs = make(map[*Subscription]struct{})
+		ms.topics = make(map[string]*streamTopic)
+	})
+}
+
+// Subscribe subscribes to the market trends of queries. The subscription first receives the
+// latest trends of each query newer than lastEventID, or all of them when lastEventID is 0;
+// queries nobody subscribed to before are fetched right away.
+func (ms *MarketStream) Subscribe(queries []models.MarketTrendsRequest, lastEventID uint64) (*Subscription, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.ctx.Err() != nil {
+		return nil, ErrStreamStopped
+	}
+	if len(ms.subs) >= ms.config.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	sub := &Subscription{
+		stream:  ms,
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		pending: make(map[string]models.MarketUpdate),
+	}
+	fetch := false
+	for _, query := range queries {
+		key := streamKey(query)
+		topic, ok := ms.topics[key]
+		if !ok {
+			topic = &streamTopic{query: query, subscribers: make(map[*Subscription]struct{})}
+			ms.topics[key] = topic
+		}
+		if _, ok := topic.subscribers[sub]; ok {
+			continue
+		}
+		topic.subscribers[sub] = struct{}{}
+		sub.keys = append(sub.keys, key)
+
+		switch {
+		case topic.latest == nil:
+			fetch = true
+		case topic.latest.ID > lastEventID:
+			sub.push(key, *topic.latest)
+		}
+	}
+	ms.subs[sub] = struct{}{}
+
+	if fetch {
+		select {
+		case ms.wake <- struct{}{}:
+		default:
+		}
+	}
+	return sub, nil
+}
+
+// Subscribers returns the number of open subscriptions
+func (ms *MarketStream) Subscribers() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.subs)
+}
+
+// run fetches every subscribed query each interval, and queries not fetched yet as soon as they
+// are subscribed to, until ctx is canceled
+func (ms *MarketStream) run(ctx context.Context) {
+	ticker := time.NewTicker(ms.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ms.Refresh(ctx, false)
+		case <-ms.wake:
+			ms.Refresh(ctx, true)
+		}
+	}
+}
+
+// Refresh fetches the market trends of the subscribed queries, or only of those not fetched yet
+// when onlyNew is set, and sends the ones that changed to their subscriptions. Queries that fail
+// keep their last trends and are fetched again next time.
+func (ms *MarketStream) Refresh(ctx context.Context, onlyNew bool) {
+	ms.mu.Lock()
+	queries := make(map[string]models.MarketTrendsRequest, len(ms.topics))
+	for key, topic := range ms.topics {
+		if !onlyNew || topic.latest == nil {
+			queries[key] = topic.query
+		}
+	}
+	ms.mu.Unlock()
+
+	for key, query := range queries {
+		trends, err := ms.marketAnalyzer.GetMarketTrends(ctx, query)
+		if err != nil {
+			continue
+		}
+		ms.publish(key, trends)
+	}
+}
+
+// publish records the trends of a query and, if they differ from the last ones, sends them to
+// the query's subscriptions
+func (ms *MarketStream) publish(key string, trends *models.MarketTrends) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	topic, ok := ms.topics[key]
+	if !ok {
+		// Every subscription to the query closed while it was fetched
+		return
+	}
+	if topic.latest != nil && sameTrends(*topic.latest.Trends, *trends) {
+		return
+	}
+
+	ms.nextID++
+	update := models.MarketUpdate{
+		ID:           ms.nextID,
+		Location:     topic.query.Location,
+		PropertyType: topic.query.PropertyType,
+		TimeRange:    topic.query.TimeRange,
+		Trends:       trends,
+		UpdatedAt:    ms.now().UTC(),
+	}
+	topic.latest = &update
+	for sub := range topic.subscribers {
+		sub.push(key, update)
+	}
+}
+
+// unsubscribe removes a subscription, dropping queries nobody else subscribes to
+func (ms *MarketStream) unsubscribe(sub *Subscription) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.subs[sub]; !ok {
+		return
+	}
+	delete(ms.subs, sub)
+	for _, key := range sub.keys {
+		topic := ms.topics[key]
+		delete(topic.subscribers, sub)
+		if len(topic.subscribers) == 0 {
+			delete(ms.topics, key)
+		}
+	}
+}
+
+// sameTrends reports whether two market trends have the same metrics, ignoring their freshness
+func sameTrends(a, b models.MarketTrends) bool {
+	a.DataFreshness, b.DataFreshness = "", ""
+	return a == b
+}
+
+// streamKey identifies a market trends query regardless of case
+func streamKey(query models.MarketTrendsRequest) string {
+	return strings.ToLower(strings.Join([]string{query.Location, query.PropertyType, query.TimeRange}, "|"))
+}
+
+// Subscription receives the market updates of the queries it subscribed to. Updates a slow
+// reader hasn't taken yet are replaced by newer ones for the same query, so a subscription
+// never holds more than one pending update per query.
+type Subscription struct {
+	stream *MarketStream
+	keys   []string
+	ready  chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]models.MarketUpdate
+	skipped int
+}
+
+// Ready returns a channel that receives a value when updates are pending
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done returns a channel that is closed when the stream stops
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Next takes the pending updates, oldest first, and the number of updates that were replaced
+// by newer ones before they were taken
+func (s *Subscription) Next() ([]models.MarketUpdate, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updates := make([]models.MarketUpdate, 0, len(s.pending))
+	for _, update := range s.pending {
+		updates = append(updates, update)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].ID < updates[j].ID })
+	skipped := s.skipped
+	s.pending = make(map[string]models.MarketUpdate)
+	s.skipped = 0
+	return updates, skipped
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.stream.unsubscribe(s)
+}
+
+// push queues an update for the subscription, replacing any pending update of the same query
+func (s *Subscription) push(key string, update models.MarketUpdate) {
+	s.mu.Lock()
+	if _, ok := s.pending[key]; ok {
+		s.skipped++
+	}
+	s.pending[key] = update
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
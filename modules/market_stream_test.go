@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func newTestMarketStream(t *testing.T, provider ListingProvider, cfg StreamConfig) *MarketStream {
+	t.Helper()
+	df := NewDataFetcher()
+	df.SetProvider(provider)
+	ma := NewMarketAnalyzer(df)
+	ma.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	ms := NewMarketStream(ma, cfg)
+	t.Cleanup(ms.Stop)
+	return ms
+}
+
+// waitForUpdates waits until a subscription has pending updates and takes them
+func waitForUpdates(t *testing.T, sub *Subscription) []models.MarketUpdate {
+	t.Helper()
+	select {
+	case <-sub.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected market updates but got none")
+	}
+	updates, _ := sub.Next()
+	return updates
+}
+
+func TestMarketStreamUpdates(t *testing.T) {
+	provider := &staticProvider{listings: []models.Listing{
+		soldListing("A", 1000000, time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)),
+	}}
+	ms := newTestMarketStream(t, provider, DefaultStreamConfig())
+	ms.Start()
+
+	sf := models.MarketTrendsRequest{Location: "San Francisco, CA", TimeRange: "6 months"}
+	sub, err := ms.Subscribe([]models.MarketTrendsRequest{sf, {Location: "san francisco, ca", TimeRange: "6 Months"}}, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	defer sub.Close()
+
+	// A new subscription is fetched right away
+	updates := waitForUpdates(t, sub)
+	if len(updates) != 1 || updates[0].Location != "San Francisco, CA" || updates[0].Trends.MedianPrice != 1000000 {
+		t.Fatalf("Expected the current San Francisco trends but got %+v", updates)
+	}
+	first := updates[0]
+
+	// Unchanged trends are not sent again
+	ms.Refresh(context.Background(), false)
+	if updates, _ := sub.Next(); len(updates) != 0 {
+		t.Errorf("Expected no updates while the trends are unchanged but got %+v", updates)
+	}
+
+	provider.listings = append(provider.listings, soldListing("B", 1200000, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)))
+	ms.Refresh(context.Background(), false)
+	updates, _ = sub.Next()
+	if len(updates) != 1 || updates[0].ID <= first.ID || updates[0].Trends.SalesVolume != 2 {
+		t.Fatalf("Expected an update with 2 sales but got %+v", updates)
+	}
+	latest := updates[0]
+
+	// Resuming after the first event sends only the newer trends
+	resumed, _ := ms.Subscribe([]models.MarketTrendsRequest{sf}, first.ID)
+	defer resumed.Close()
+	if updates, _ := resumed.Next(); len(updates) != 1 || updates[0].ID != latest.ID {
+		t.Errorf("Expected update %d on resume but got %+v", latest.ID, updates)
+	}
+	upToDate, _ := ms.Subscribe([]models.MarketTrendsRequest{sf}, latest.ID)
+	defer upToDate.Close()
+	if updates, _ := upToDate.Next(); len(updates) != 0 {
+		t.Errorf("Expected no updates for an up to date client but got %+v", updates)
+	}
+}
+
+func TestMarketStreamBackpressure(t *testing.T) {
+	provider := &staticProvider{}
+	ms := newTestMarketStream(t, provider, DefaultStreamConfig())
+
+	sf := models.MarketTrendsRequest{Location: "San Francisco, CA", TimeRange: "6 months"}
+	sub, _ := ms.Subscribe([]models.MarketTrendsRequest{sf}, 0)
+	defer sub.Close()
+
+	// A reader that falls behind gets only the latest trends of each query
+	for i := 1; i <= 3; i++ {
+		provider.listings = append(provider.listings, soldListing(string(rune('A'+i)), 1000000+i*1000, time.Date(2024, 3, i, 0, 0, 0, 0, time.UTC)))
+		ms.Refresh(context.Background(), false)
+	}
+	updates, skipped := sub.Next()
+	if len(updates) != 1 || updates[0].Trends.SalesVolume != 3 {
+		t.Fatalf("Expected only the latest update but got %+v", updates)
+	}
+	if skipped != 2 {
+		t.Errorf("Expected 2 skipped updates but got %d", skipped)
+	}
+}
+
+func TestMarketStreamSubscriptions(t *testing.T) {
+	cfg := DefaultStreamConfig()
+	cfg.MaxSubscribers = 1
+	ms := newTestMarketStream(t, &staticProvider{}, cfg)
+
+	query := []models.MarketTrendsRequest{{Location: "94110", TimeRange: "6 months"}}
+	sub, err := ms.Subscribe(query, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if _, err := ms.Subscribe(query, 0); !errors.Is(err, ErrTooManySubscribers) {
+		t.Errorf("Expected ErrTooManySubscribers but got %v", err)
+	}
+
+	sub.Close()
+	if ms.Subscribers() != 0 {
+		t.Errorf("Expected no subscribers after closing but got %d", ms.Subscribers())
+	}
+	sub, _ = ms.Subscribe(query, 0)
+
+	// Stopping the stream ends its subscriptions
+	ms.Stop()
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("Expected the subscription to end when the stream stops")
+	}
+	if _, err := ms.Subscribe(query, 0); !errors.Is(err, ErrStreamStopped) {
+		t.Errorf("Expected ErrStreamStopped but got %v", err)
+	}
+}
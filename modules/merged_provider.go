@@ -0,0 +1,268 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// MergeConfig configures how a MergedProvider recognizes the same listing across providers
+type MergeConfig struct {
+	// Maximum distance in miles between two records with the same street number and unit for
+	// them to be treated as the same property when their addresses are written differently
+	MatchRadiusMiles float64
+
+	// Maximum difference between the sale dates of two records of the same sale
+	SaleDateWindow time.Duration
+}
+
+// DefaultMergeConfig returns the default MergeConfig
+func DefaultMergeConfig() MergeConfig {
+	return MergeConfig{
+		MatchRadiusMiles: 0.05,
+		SaleDateWindow:   7 * 24 * time.Hour,
+	}
+}
+
+// NamedProvider is a ListingProvider identified by the name recorded in field provenance
+type NamedProvider struct {
+	Name     string
+	Provider ListingProvider
+}
+
+// MergedProvider queries several providers and merges records of the same listing into one.
+// Providers are given in priority order: each field of a merged listing is taken from the
+// highest-priority provider that has a value for it.
+type MergedProvider struct {
+	providers []NamedProvider
+	config    MergeConfig
+}
+
+// NewMergedProvider creates a new MergedProvider over providers in priority order
+func NewMergedProvider(cfg MergeConfig, providers ...NamedProvider) *MergedProvider {
+	return &MergedProvider{
+		providers: providers,
+		config:    cfg,
+	}
+}
+
+// GetListing returns the listing from the highest-priority provider that has it
+func (mp *MergedProvider) GetListing(ctx context.Context, id string) (*models.Listing, error) {
+	var firstErr error
+	for _, p := range mp.providers {
+		listing, err := p.Provider.GetListing(ctx, id)
+		if err == nil {
+			return listing, nil
+		}
+		if firstErr == nil && !errors.Is(err, ErrListingNotFound) {
+			firstErr = err
+		}
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrListingNotFound
+}
+
+// SearchListings queries every provider concurrently and returns the merged, de-duplicated
+// results. Providers that fail are left out as long as at least one succeeds.
+func (mp *MergedProvider) SearchListings(ctx context.Context, query models.ListingQuery) ([]models.Listing, error) {
+	results := make([][]models.Listing, len(mp.providers))
+	errs := make([]error, len(mp.providers))
+
+	var wg sync.WaitGroup
+	for i, p := range mp.providers {
+		wg.Add(1)
+		go func(i int, p NamedProvider) {
+			defer wg.Done()
+			results[i], errs[i] = p.Provider.SearchListings(ctx, query)
+		}(i, p)
+	}
+	wg.Wait()
+
+	var firstErr error
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if succeeded == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	return mp.merge(results, errs), nil
+}
+
+// SearchRentals queries every provider concurrently and returns the merged, de-duplicated leases.
+// Providers without rental data or that fail are left out as long as at least one succeeds.
+func (mp *MergedProvider) SearchRentals(ctx context.Context, query models.RentalQuery) ([]models.Rental, error) {
+	results := make([][]models.Listing, len(mp.providers))
+	errs := make([]error, len(mp.providers))
+
+	var wg sync.WaitGroup
+	for i, p := range mp.providers {
+		wg.Add(1)
+		go func(i int, p NamedProvider) {
+			defer wg.Done()
+			rentals, err := p.Provider.SearchRentals(ctx, query)
+			for _, r := range rentals {
+				results[i] = append(results[i], rentalListing(r))
+			}
+			errs[i] = err
+		}(i, p)
+	}
+	wg.Wait()
+
+	// Providers without rental data only make the search fail when none has any
+	var firstErr error
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case firstErr == nil || errors.Is(firstErr, ErrRentalsUnavailable):
+			firstErr = err
+		}
+	}
+	if succeeded == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	var rentals []models.Rental
+	for _, lease := range mp.merge(results, errs) {
+		rentals = append(rentals, rentalFromListing(lease))
+	}
+	return rentals, nil
+}
+
+// mergeGroup is the set of records, one per provider, that describe the same listing
+type mergeGroup struct {
+	records []models.Listing
+	sources []string
+	// address is the parsed address of the first record, which the group is matched on
+	address Address
+}
+
+// merge groups duplicate records across provider results and combines each group into one listing
+func (mp *MergedProvider) merge(results [][]models.Listing, errs []error) []models.Listing {
+	var groups []*mergeGroup
+	for i, listings := range results {
+		if errs[i] != nil {
+			continue
+		}
+		name := mp.providers[i].Name
+
+		// Records are only matched against groups built from other providers, so two
+		// distinct listings from the same provider are never collapsed
+		existing := len(groups)
+		for _, l := range listings {
+			address := ParseAddress(l.Address)
+			var match *mergeGroup
+			for _, g := range groups[:existing] {
+				if !g.hasSource(name) && mp.sameListing(g.records[0], g.address, l, address) {
+					match = g
+					break
+				}
+			}
+
+			if match == nil {
+				groups = append(groups, &mergeGroup{records: []models.Listing{l}, sources: []string{name}, address: address})
+			} else {
+				match.records = append(match.records, l)
+				match.sources = append(match.sources, name)
+			}
+		}
+	}
+
+	merged := make([]models.Listing, 0, len(groups))
+	for _, g := range groups {
+		merged = append(merged, g.combine())
+	}
+	return merged
+}
+
+// hasSource reports whether the group already holds a record from the named provider
+func (g *mergeGroup) hasSource(name string) bool {
+	for _, source := range g.sources {
+		if source == name {
+			return true
+		}
+	}
+	return false
+}
+
+// combine builds one listing from the group, taking each field from the first record that has
+// a value for it and recording which provider supplied it
+func (g *mergeGroup) combine() models.Listing {
+	var merged models.Listing
+	provenance := make(map[string]string)
+
+	mergedValue := reflect.ValueOf(&merged).Elem()
+	listingType := mergedValue.Type()
+	for i := 0; i < listingType.NumField(); i++ {
+		field := listingType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "provenance" {
+			continue
+		}
+
+		for j, record := range g.records {
+			value := reflect.ValueOf(record).Field(i)
+			if value.IsZero() {
+				continue
+			}
+			mergedValue.Field(i).Set(value)
+			provenance[name] = g.sources[j]
+			break
+		}
+	}
+
+	merged.Provenance = provenance
+	return merged
+}
+
+// sameListing reports whether two records from different providers describe the same listing:
+// the same sale (or both unsold) of the same property, identified either by address or by
+// street number, unit and location. The addresses are parsed once per record by the caller.
+func (mp *MergedProvider) sameListing(a models.Listing, addressA Address, b models.Listing, addressB Address) bool {
+	if a.SaleDate.IsZero() != b.SaleDate.IsZero() {
+		return false
+	}
+	if !a.SaleDate.IsZero() {
+		diff := a.SaleDate.Sub(b.SaleDate)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > mp.config.SaleDateWindow {
+			return false
+		}
+	}
+
+	if addressA.Unit != addressB.Unit {
+		return false
+	}
+
+	streetKey := addressA.StreetKey()
+	if streetKey != "" && streetKey == addressB.StreetKey() && (a.ZipCode == "" || b.ZipCode == "" || a.ZipCode == b.ZipCode) {
+		return true
+	}
+
+	if addressA.Number == "" || addressA.Number != addressB.Number || !hasCoordinates(a) || !hasCoordinates(b) {
+		return false
+	}
+	return DistanceMiles(a.Latitude, a.Longitude, b.Latitude, b.Longitude) <= mp.config.MatchRadiusMiles
+}
+
+// hasCoordinates reports whether a listing has a location
+func hasCoordinates(l models.Listing) bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
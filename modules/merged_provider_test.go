@@ -0,0 +1,133 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// staticProvider is a ListingProvider serving a fixed set of listings and rentals, or failing with err
+type staticProvider struct {
+	listings []models.Listing
+	rentals  []models.Rental
+	err      error
+}
+
+func (sp *staticProvider) GetListing(ctx context.Context, id string) (*models.Listing, error) {
+	if sp.err != nil {
+		return nil, sp.err
+	}
+	for _, l := range sp.listings {
+		if l.ID == id {
+			return &l, nil
+		}
+	}
+	return nil, ErrListingNotFound
+}
+
+func (sp *staticProvider) SearchListings(ctx context.Context, query models.ListingQuery) ([]models.Listing, error) {
+	if sp.err != nil {
+		return nil, sp.err
+	}
+	var matches []models.Listing
+	for _, l := range sp.listings {
+		if MatchesQuery(l, query) {
+			matches = append(matches, l)
+		}
+	}
+	return matches, nil
+}
+
+func (sp *staticProvider) SearchRentals(ctx context.Context, query models.RentalQuery) ([]models.Rental, error) {
+	if sp.err != nil {
+		return nil, sp.err
+	}
+	if sp.rentals == nil {
+		return nil, ErrRentalsUnavailable
+	}
+	var matches []models.Rental
+	for _, r := range sp.rentals {
+		if MatchesQuery(rentalListing(r), rentalListingQuery(query)) {
+			matches = append(matches, r)
+		}
+	}
+	return matches, nil
+}
+
+func TestMergedProviderSearchListings(t *testing.T) {
+	saleDate := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	mls := &staticProvider{listings: []models.Listing{
+		{ID: "M1", Address: "123 Main St", ZipCode: "94110", Latitude: 37.7599, Longitude: -122.4148, SalePrice: 1100000, Sqft: 1300, SaleDate: saleDate},
+		{ID: "M2", Address: "45 Oak Ave Apt 2", ZipCode: "94110", Latitude: 37.7601, Longitude: -122.4150, SalePrice: 900000, Sqft: 1000, SaleDate: saleDate},
+		{ID: "M3", Address: "45 Oak Ave Apt 3", ZipCode: "94110", Latitude: 37.7601, Longitude: -122.4150, SalePrice: 950000, Sqft: 1050, SaleDate: saleDate},
+	}}
+	county := &staticProvider{listings: []models.Listing{
+		// Same sale as M1, with a different spelling, a corrected price and the bedroom count
+		{ID: "R1", Address: "123 Main Street", ZipCode: "94110", Latitude: 37.7599, Longitude: -122.4148, SalePrice: 1105000, Bedrooms: 3, SaleDate: saleDate.AddDate(0, 0, 2)},
+		// Same sale as M2, matched by street number, unit and location
+		{ID: "R2", Address: "45 Oak Avenue #2", Latitude: 37.7602, Longitude: -122.4150, SalePrice: 900000, SaleDate: saleDate},
+		// An earlier sale of the same property as M1
+		{ID: "R3", Address: "123 Main St", ZipCode: "94110", SalePrice: 800000, SaleDate: saleDate.AddDate(-5, 0, 0)},
+	}}
+
+	provider := NewMergedProvider(DefaultMergeConfig(),
+		NamedProvider{Name: "mls", Provider: mls},
+		NamedProvider{Name: "county", Provider: county},
+	)
+	listings, err := provider.SearchListings(context.Background(), models.ListingQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	if len(listings) != 4 {
+		t.Fatalf("Expected 4 merged listings but got %d", len(listings))
+	}
+
+	merged := listings[0]
+	if merged.ID != "M1" || merged.SalePrice != 1100000 || merged.Bedrooms != 3 {
+		t.Errorf("Expected M1 with the mls price and county bedrooms but got %+v", merged)
+	}
+	expectedProvenance := map[string]string{"id": "mls", "sale_price": "mls", "sqft": "mls", "bedrooms": "county"}
+	for field, source := range expectedProvenance {
+		if merged.Provenance[field] != source {
+			t.Errorf("Expected %s from %s but got %s", field, source, merged.Provenance[field])
+		}
+	}
+
+	expectedIDs := []string{"M1", "M2", "M3", "R3"}
+	for i, id := range expectedIDs {
+		if listings[i].ID != id {
+			t.Errorf("Expected listing %d to be %s but got %s", i, id, listings[i].ID)
+		}
+	}
+}
+
+func TestMergedProviderPartialFailure(t *testing.T) {
+	failing := &staticProvider{err: errors.New("upstream unavailable")}
+	working := &staticProvider{listings: []models.Listing{{ID: "A1", Address: "1 Elm St"}}}
+
+	provider := NewMergedProvider(DefaultMergeConfig(),
+		NamedProvider{Name: "mls", Provider: failing},
+		NamedProvider{Name: "file", Provider: working},
+	)
+	listings, err := provider.SearchListings(context.Background(), models.ListingQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if len(listings) != 1 || listings[0].Provenance["id"] != "file" {
+		t.Errorf("Expected the listing from file but got %+v", listings)
+	}
+
+	listing, err := provider.GetListing(context.Background(), "A1")
+	if err != nil || listing.ID != "A1" {
+		t.Errorf("Expected listing A1 but got %+v, %v", listing, err)
+	}
+
+	allFailing := NewMergedProvider(DefaultMergeConfig(), NamedProvider{Name: "mls", Provider: failing})
+	if _, err := allFailing.SearchListings(context.Background(), models.ListingQuery{}); err == nil {
+		t.Error("Expected an error when every provider fails but got nil")
+	}
+}
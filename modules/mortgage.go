@@ -0,0 +1,163 @@
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+)
+
+// MonthlyPayment returns the monthly principal and interest payment that repays a fully
+// amortizing loan over a term in years at an annual interest rate (0.065 for 6.5%)
+func MonthlyPayment(principal, annualRate float64, years int) float64 {
+	months := float64(years * 12)
+	if principal <= 0 || months <= 0 {
+		return 0
+	}
+	if annualRate == 0 {
+		return principal / months
+	}
+
+	rate := annualRate / 12
+	return principal * rate / (1 - math.Pow(1+rate, -months))
+}
+
+// LoanBalance returns the balance left on a fully amortizing loan after a number of monthly payments
+func LoanBalance(principal, annualRate float64, years, payments int) float64 {
+	if principal <= 0 || payments >= years*12 {
+		return 0
+	}
+	if payments <= 0 {
+		return principal
+	}
+
+	payment := MonthlyPayment(principal, annualRate, years)
+	if annualRate == 0 {
+		return principal - payment*float64(payments)
+	}
+
+	rate := annualRate / 12
+	growth := math.Pow(1+rate, float64(payments))
+	return math.Max(0, principal*growth-payment*(growth-1)/rate)
+}
+
+// AmortizationPayment is one monthly payment of an amortization schedule
+type AmortizationPayment struct {
+	Month     int
+	Payment   float64
+	Principal float64
+	Interest  float64
+	Balance   float64
+}
+
+// Amortize returns the amortization schedule of a loan: for every monthly payment, how much of it
+// goes to interest and to principal and the balance left after it. The last payment repays the
+// remaining balance, so the principal paid adds up to the loan.
+func Amortize(principal, annualRate float64, years int) []AmortizationPayment {
+	payment := MonthlyPayment(principal, annualRate, years)
+	if payment == 0 {
+		return nil
+	}
+
+	months := years * 12
+	schedule := make([]AmortizationPayment, 0, months)
+	balance := principal
+	for month := 1; month <= months; month++ {
+		interest := balance * annualRate / 12
+		paid := payment - interest
+		if month == months {
+			paid = balance
+		}
+		balance -= paid
+		schedule = append(schedule, AmortizationPayment{
+			Month:     month,
+			Payment:   paid + interest,
+			Principal: paid,
+			Interest:  interest,
+			Balance:   math.Max(0, balance),
+		})
+	}
+	return schedule
+}
+
+// MortgageRates holds the mortgage rates and loan assumptions used for affordability
+type MortgageRates struct {
+	// Date the rates were published, e.g. 2024-06-01
+	AsOf string `json:"as_of"`
+
+	// Down payment assumed when a request doesn't give one, as a share of the price
+	DownPaymentRate float64 `json:"down_payment_rate"`
+
+	// Loan term assumed when a request doesn't give one
+	LoanTermYears int `json:"loan_term_years"`
+
+	// Annual interest rate by loan term in years
+	Rates map[int]float64 `json:"rates"`
+}
+
+// DefaultMortgageRates returns the rates used when no rates file is configured
+func DefaultMortgageRates() MortgageRates {
+	return MortgageRates{
+		DownPaymentRate: 0.2,
+		LoanTermYears:   30,
+		Rates: map[int]float64{
+			15: 0.06,
+			30: 0.07,
+		},
+	}
+}
+
+// LoadMortgageRates reads mortgage rates from a JSON file such as
+//
+//	{"as_of": "2024-06-01", "down_payment_rate": 0.2, "loan_term_years": 30, "rates": {"15": 0.0625, "30": 0.0695}}
+//
+// Omitted down payment and loan term fall back to DefaultMortgageRates.
+func LoadMortgageRates(path string) (MortgageRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MortgageRates{}, fmt.Errorf("error reading mortgage rates file: %w", err)
+	}
+
+	defaults := DefaultMortgageRates()
+	rates := MortgageRates{
+		DownPaymentRate: defaults.DownPaymentRate,
+		LoanTermYears:   defaults.LoanTermYears,
+	}
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return MortgageRates{}, fmt.Errorf("error parsing mortgage rates file: %w", err)
+	}
+
+	if rates.DownPaymentRate < 0 || rates.DownPaymentRate > 1 {
+		return MortgageRates{}, errors.New("invalid mortgage rates: down_payment_rate must be between 0 and 1")
+	}
+	if len(rates.Rates) == 0 {
+		return MortgageRates{}, errors.New("invalid mortgage rates: no rates given")
+	}
+	for term, rate := range rates.Rates {
+		if term <= 0 || rate < 0 || rate >= 1 {
+			return MortgageRates{}, fmt.Errorf("invalid mortgage rates: rate %v for a %d-year term", rate, term)
+		}
+	}
+	if _, ok := rates.Rates[rates.LoanTermYears]; !ok {
+		return MortgageRates{}, fmt.Errorf("invalid mortgage rates: no rate for the %d-year default term", rates.LoanTermYears)
+	}
+	return rates, nil
+}
+
+// Rate returns the interest rate for a loan term
+func (mr MortgageRates) Rate(years int) (float64, bool) {
+	rate, ok := mr.Rates[years]
+	return rate, ok
+}
+
+// Terms returns the loan terms there are rates for, shortest first
+func (mr MortgageRates) Terms() []int {
+	terms := make([]int, 0, len(mr.Rates))
+	for term := range mr.Rates {
+		terms = append(terms, term)
+	}
+	slices.Sort(terms)
+	return terms
+}
@@ -0,0 +1,200 @@
+package modules
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMonthlyPayment(t *testing.T) {
+	testCases := []struct {
+		name      string
+		principal float64
+		rate      float64
+		years     int
+		expected  float64
+	}{
+		{"30 years at 6%", 100000, 0.06, 30, 599.55},
+		{"30 years at 7%", 300000, 0.07, 30, 1995.91},
+		{"15 years at 4.5%", 200000, 0.045, 15, 1529.99},
+		{"10 years at 5%", 250000, 0.05, 10, 2651.64},
+		{"1 year at 12%", 1000, 0.12, 1, 88.85},
+		{"high rate", 100000, 0.18, 30, 1507.09},
+		{"tiny rate", 120000, 0.0001, 10, 1000.5},
+		{"no interest", 120000, 0, 10, 1000},
+		{"no principal", 0, 0.06, 30, 0},
+		{"negative principal", -1000, 0.06, 30, 0},
+		{"no term", 100000, 0.06, 0, 0},
+		{"negative term", 100000, 0.06, -5, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := MonthlyPayment(tc.principal, tc.rate, tc.years)
+			if math.Abs(result-tc.expected) > 0.005 {
+				t.Errorf("Expected %.2f but got %.4f", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestLoanBalance(t *testing.T) {
+	testCases := []struct {
+		name      string
+		principal float64
+		rate      float64
+		years     int
+		payments  int
+		expected  float64
+	}{
+		{"before the first payment", 400000, 0.06, 30, 0, 400000},
+		{"after one payment", 400000, 0.06, 30, 1, 399601.80},
+		{"after 10 years", 400000, 0.06, 30, 120, 334742.90},
+		{"one payment left", 100000, 0.06, 30, 359, 596.57},
+		{"repaid", 400000, 0.06, 30, 360, 0},
+		{"past the term", 400000, 0.06, 30, 400, 0},
+		{"negative payments", 400000, 0.06, 30, -1, 400000},
+		{"no interest halfway", 120000, 0, 10, 60, 60000},
+		{"no principal", 0, 0.06, 30, 12, 0},
+		{"no term", 100000, 0.06, 0, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := LoanBalance(tc.principal, tc.rate, tc.years, tc.payments)
+			if math.Abs(result-tc.expected) > 0.005 {
+				t.Errorf("Expected %.2f but got %.4f", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestAmortize(t *testing.T) {
+	testCases := []struct {
+		name          string
+		principal     float64
+		rate          float64
+		years         int
+		totalInterest float64
+	}{
+		{"30 years at 6%", 100000, 0.06, 30, 115838.19},
+		{"15 years at 4.5%", 200000, 0.045, 15, 75397.58},
+		{"1 year at 12%", 1000, 0.12, 1, 66.19},
+		{"no interest", 120000, 0, 10, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule := Amortize(tc.principal, tc.rate, tc.years)
+			if len(schedule) != tc.years*12 {
+				t.Fatalf("Expected %d payments but got %d", tc.years*12, len(schedule))
+			}
+
+			payment := MonthlyPayment(tc.principal, tc.rate, tc.years)
+			var principal, interest float64
+			for i, p := range schedule {
+				if p.Month != i+1 {
+					t.Fatalf("Expected month %d but got %d", i+1, p.Month)
+				}
+				if math.Abs(p.Payment-payment) > 0.000001 {
+					t.Errorf("Month %d: expected payment %.2f but got %.4f", p.Month, payment, p.Payment)
+				}
+				if math.Abs(p.Principal+p.Interest-p.Payment) > 0.000001 {
+					t.Errorf("Month %d: principal %.2f and interest %.2f don't add up to %.2f", p.Month, p.Principal, p.Interest, p.Payment)
+				}
+				if expected := LoanBalance(tc.principal, tc.rate, tc.years, p.Month); math.Abs(p.Balance-expected) > 0.0001 {
+					t.Errorf("Month %d: expected balance %.2f but got %.4f", p.Month, expected, p.Balance)
+				}
+				if i > 0 && p.Interest > schedule[i-1].Interest {
+					t.Errorf("Month %d: expected interest to fall but got %.2f after %.2f", p.Month, p.Interest, schedule[i-1].Interest)
+				}
+				principal += p.Principal
+				interest += p.Interest
+			}
+
+			if first := schedule[0]; math.Abs(first.Interest-tc.principal*tc.rate/12) > 0.000001 {
+				t.Errorf("Expected first interest %.2f but got %.4f", tc.principal*tc.rate/12, first.Interest)
+			}
+			if last := schedule[len(schedule)-1]; last.Balance != 0 {
+				t.Errorf("Expected the loan repaid but got balance %.4f", last.Balance)
+			}
+			if math.Abs(principal-tc.principal) > 0.000001 {
+				t.Errorf("Expected principal paid %.2f but got %.4f", tc.principal, principal)
+			}
+			if math.Abs(interest-tc.totalInterest) > 0.01 {
+				t.Errorf("Expected total interest %.2f but got %.4f", tc.totalInterest, interest)
+			}
+		})
+	}
+
+	if schedule := Amortize(0, 0.06, 30); schedule != nil {
+		t.Errorf("Expected no schedule without principal but got %d payments", len(schedule))
+	}
+	if schedule := Amortize(100000, 0.06, 0); schedule != nil {
+		t.Errorf("Expected no schedule without a term but got %d payments", len(schedule))
+	}
+}
+
+func TestLoadMortgageRates(t *testing.T) {
+	rates, err := LoadMortgageRates("testdata/mortgage_rates.json")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if rates.AsOf != "2024-06-01" || rates.DownPaymentRate != 0.1 || rates.LoanTermYears != 30 {
+		t.Errorf("Unexpected rates %+v", rates)
+	}
+	if rate, ok := rates.Rate(15); !ok || rate != 0.0625 {
+		t.Errorf("Expected a 15-year rate of 0.0625 but got %v", rate)
+	}
+	if _, ok := rates.Rate(20); ok {
+		t.Error("Expected no 20-year rate")
+	}
+	if terms := rates.Terms(); !slices.Equal(terms, []int{15, 30}) {
+		t.Errorf("Expected terms [15 30] but got %v", terms)
+	}
+
+	testCases := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{"defaults", `{"rates": {"30": 0.07}}`, false},
+		{"invalid JSON", `{"rates": `, true},
+		{"no rates", `{"loan_term_years": 30}`, true},
+		{"no rate for the default term", `{"loan_term_years": 20, "rates": {"30": 0.07}}`, true},
+		{"rate out of range", `{"rates": {"30": 7}}`, true},
+		{"negative rate", `{"rates": {"30": -0.01}}`, true},
+		{"invalid term", `{"rates": {"30": 0.07, "0": 0.05}}`, true},
+		{"down payment out of range", `{"down_payment_rate": 20, "rates": {"30": 0.07}}`, true},
+	}
+
+	dir := t.TempDir()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "rates.json")
+			if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			rates, err := LoadMortgageRates(path)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error but got %+v", rates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if rates.DownPaymentRate != 0.2 || rates.LoanTermYears != 30 {
+				t.Errorf("Expected the default down payment and term but got %+v", rates)
+			}
+		})
+	}
+
+	if _, err := LoadMortgageRates(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
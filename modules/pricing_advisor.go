@@ -0,0 +1,202 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/user/cma/models"
+)
+
+const (
+	// competitionWeight is the weight of the asking prices of active competition in the recommended
+	// list price; the rest comes from the estimate and the sale-to-list ratio
+	competitionWeight = 0.25
+
+	// defaultDaysOnMarket is the expected days on market of a listing priced at market value when
+	// the comparables don't report days on market
+	defaultDaysOnMarket = 30
+
+	// defaultDaysPerPremium is the number of days on market added by listing above market value,
+	// per unit of premium, when the comparables don't show a trend: three days for each 1%
+	defaultDaysPerPremium = 300.0
+
+	// minPricingBand and maxPricingBand bound how far the conservative and aggressive list prices
+	// are from the recommended one
+	minPricingBand = 0.02
+	maxPricingBand = 0.06
+
+	// listPriceIncrement is the amount list prices are rounded to
+	listPriceIncrement = 5000
+)
+
+// ErrNoComparables is returned when a property can't be priced because no comparable sales were found
+var ErrNoComparables = errors.New("no comparable sales found to price the property")
+
+// PricingAdvisor recommends list prices on top of a CMA
+type PricingAdvisor struct {
+	cmaAnalyzer *CMAAnalyzer
+}
+
+// NewPricingAdvisor creates a new PricingAdvisor instance
+func NewPricingAdvisor(ca *CMAAnalyzer) *PricingAdvisor {
+	return &PricingAdvisor{
+		cmaAnalyzer: ca,
+	}
+}
+
+// GetPricingStrategy runs a CMA for a property and recommends a list price, with conservative
+// and aggressive alternatives and the expected days on market at each
+func (pa *PricingAdvisor) GetPricingStrategy(ctx context.Context, req models.CMARequest) (*models.PricingStrategy, error) {
+	cma, err := pa.cmaAnalyzer.GetComparableProperties(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if cma.EstimatedValue <= 0 {
+		return nil, ErrNoComparables
+	}
+	return priceListing(cma), nil
+}
+
+// priceListing derives the pricing strategy from a CMA. The estimate is grossed up by the
+// comparables' sale-to-list ratio, so that a typical negotiation ends at market value, and blended
+// with the asking prices of active competition relative to recent sales.
+func priceListing(cma *models.CMAResponse) *models.PricingStrategy {
+	value := float64(cma.EstimatedValue)
+	strategy := &models.PricingStrategy{
+		PropertyID:      cma.PropertyID,
+		Address:         cma.Address,
+		EstimatedValue:  cma.EstimatedValue,
+		SaleToListRatio: 1,
+		DataFreshness:   cma.DataFreshness,
+	}
+
+	var ratios, soldPricesPerSqft []float64
+	for _, comp := range cma.Comparables {
+		if comp.ListPrice > 0 && comp.SalePrice > 0 {
+			ratios = append(ratios, float64(comp.SalePrice)/float64(comp.ListPrice))
+		}
+		if comp.PricePerSqft > 0 {
+			soldPricesPerSqft = append(soldPricesPerSqft, float64(comp.PricePerSqft))
+		}
+	}
+	if len(ratios) > 0 {
+		strategy.SaleToListRatio = math.Round(median(ratios)*1000) / 1000
+	}
+	recommended := value / strategy.SaleToListRatio
+
+	var askingPricesPerSqft []float64
+	for _, listing := range cma.ActiveListings {
+		if listing.PricePerSqft > 0 {
+			askingPricesPerSqft = append(askingPricesPerSqft, float64(listing.PricePerSqft))
+		}
+	}
+	if len(askingPricesPerSqft) > 0 && len(soldPricesPerSqft) > 0 {
+		asking := median(askingPricesPerSqft)
+		strategy.CompetitionPricePerSqft = int(math.Round(asking))
+		competitionPrice := value * asking / median(soldPricesPerSqft)
+		recommended = (1-competitionWeight)*recommended + competitionWeight*competitionPrice
+	}
+
+	band := pricingBand(soldPricesPerSqft)
+	curve := fitDaysOnMarketCurve(cma.Comparables)
+	for _, point := range []struct {
+		strategy string
+		factor   float64
+	}{
+		{models.PricingStrategyConservative, 1 - band},
+		{models.PricingStrategyMarket, 1},
+		{models.PricingStrategyAggressive, 1 + band},
+	} {
+		listPrice := roundToIncrement(recommended*point.factor, listPriceIncrement)
+		strategy.PricePoints = append(strategy.PricePoints, models.PricePoint{
+			Strategy:             point.strategy,
+			ListPrice:            listPrice,
+			ExpectedDaysOnMarket: curve.daysOnMarket(float64(listPrice)/value - 1),
+		})
+		if point.strategy == models.PricingStrategyMarket {
+			strategy.RecommendedListPrice = listPrice
+		}
+	}
+	return strategy
+}
+
+// pricingBand returns the relative distance of the conservative and aggressive list prices from
+// the recommended one: the coefficient of variation of the comparables' price per square foot,
+// within bounds
+func pricingBand(pricesPerSqft []float64) float64 {
+	if len(pricesPerSqft) < 2 {
+		return minPricingBand
+	}
+
+	var sum float64
+	for _, v := range pricesPerSqft {
+		sum += v
+	}
+	mean := sum / float64(len(pricesPerSqft))
+
+	var squares float64
+	for _, v := range pricesPerSqft {
+		squares += (v - mean) * (v - mean)
+	}
+	cv := math.Sqrt(squares/float64(len(pricesPerSqft)-1)) / mean
+	return math.Min(math.Max(cv, minPricingBand), maxPricingBand)
+}
+
+// daysOnMarketCurve models days on market as a linear function of a listing's premium over market
+// value (list price / value - 1)
+type daysOnMarketCurve struct {
+	intercept float64
+	slope     float64
+}
+
+// fitDaysOnMarketCurve fits the days on market of the comparables against their list price
+// premium over their sale price. With fewer than three comparables, or when the fit doesn't show
+// days on market rising with the premium, a default slope is drawn through their median.
+func fitDaysOnMarketCurve(comparables []models.Comparable) daysOnMarketCurve {
+	var premiums, days []float64
+	for _, comp := range comparables {
+		if comp.ListPrice > 0 && comp.SalePrice > 0 && comp.DaysOnMarket > 0 {
+			premiums = append(premiums, float64(comp.ListPrice)/float64(comp.SalePrice)-1)
+			days = append(days, float64(comp.DaysOnMarket))
+		}
+	}
+	if len(days) == 0 {
+		return daysOnMarketCurve{intercept: defaultDaysOnMarket, slope: defaultDaysPerPremium}
+	}
+
+	if len(days) >= 3 {
+		var meanX, meanY float64
+		for i := range days {
+			meanX += premiums[i]
+			meanY += days[i]
+		}
+		meanX /= float64(len(days))
+		meanY /= float64(len(days))
+
+		var covariance, variance float64
+		for i := range days {
+			covariance += (premiums[i] - meanX) * (days[i] - meanY)
+			variance += (premiums[i] - meanX) * (premiums[i] - meanX)
+		}
+		if variance > 0 && covariance > 0 {
+			slope := covariance / variance
+			return daysOnMarketCurve{intercept: meanY - slope*meanX, slope: slope}
+		}
+	}
+
+	return daysOnMarketCurve{
+		intercept: median(days) - defaultDaysPerPremium*median(premiums),
+		slope:     defaultDaysPerPremium,
+	}
+}
+
+// daysOnMarket returns the expected days on market at a premium over market value, at least one day
+func (c daysOnMarketCurve) daysOnMarket(premium float64) int {
+	return max(1, int(math.Round(c.intercept+c.slope*premium)))
+}
+
+// roundToIncrement rounds a price to the nearest multiple of increment
+func roundToIncrement(price float64, increment int) int {
+	return int(math.Round(price/float64(increment))) * increment
+}
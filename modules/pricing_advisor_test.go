@@ -0,0 +1,145 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/user/cma/models"
+)
+
+func TestPriceListing(t *testing.T) {
+	cma := &models.CMAResponse{
+		PropertyID:     "S1",
+		EstimatedValue: 1000000,
+		Comparables: []models.Comparable{
+			{SalePrice: 1000000, ListPrice: 1000000, PricePerSqft: 1000, DaysOnMarket: 10},
+			{SalePrice: 1000000, ListPrice: 1020000, PricePerSqft: 1000, DaysOnMarket: 20},
+			{SalePrice: 1000000, ListPrice: 1040000, PricePerSqft: 1000, DaysOnMarket: 30},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		active         []models.CompetingListing
+		expectedPrices []int
+		expectedDays   []int
+	}{
+		{
+			name:           "without competition",
+			expectedPrices: []int{1000000, 1020000, 1040000},
+			expectedDays:   []int{10, 20, 30},
+		},
+		{
+			name:           "with competition asking more",
+			active:         []models.CompetingListing{{PricePerSqft: 1100}, {PricePerSqft: 1050}, {PricePerSqft: 1150}},
+			expectedPrices: []int{1020000, 1040000, 1060000},
+			expectedDays:   []int{20, 30, 40},
+		},
+	}
+
+	for _, tc := range testCases {
+		cma.ActiveListings = tc.active
+		result := priceListing(cma)
+
+		if result.SaleToListRatio != 0.98 {
+			t.Errorf("%s: expected sale-to-list ratio 0.98 but got %v", tc.name, result.SaleToListRatio)
+		}
+		if result.RecommendedListPrice != tc.expectedPrices[1] {
+			t.Errorf("%s: expected recommended list price %d but got %d", tc.name, tc.expectedPrices[1], result.RecommendedListPrice)
+		}
+		if len(result.PricePoints) != 3 {
+			t.Fatalf("%s: expected 3 price points but got %d", tc.name, len(result.PricePoints))
+		}
+		strategies := []string{models.PricingStrategyConservative, models.PricingStrategyMarket, models.PricingStrategyAggressive}
+		for i, point := range result.PricePoints {
+			if point.Strategy != strategies[i] {
+				t.Errorf("%s: expected strategy %s but got %s", tc.name, strategies[i], point.Strategy)
+			}
+			if point.ListPrice != tc.expectedPrices[i] {
+				t.Errorf("%s: expected %s list price %d but got %d", tc.name, point.Strategy, tc.expectedPrices[i], point.ListPrice)
+			}
+			if point.ExpectedDaysOnMarket != tc.expectedDays[i] {
+				t.Errorf("%s: expected %s days on market %d but got %d", tc.name, point.Strategy, tc.expectedDays[i], point.ExpectedDaysOnMarket)
+			}
+		}
+	}
+}
+
+func TestFitDaysOnMarketCurve(t *testing.T) {
+	testCases := []struct {
+		name        string
+		comparables []models.Comparable
+		premium     float64
+		expected    int
+	}{
+		{"no data", nil, 0, defaultDaysOnMarket},
+		{"no data above value", nil, 0.05, defaultDaysOnMarket + 15},
+		{
+			name: "fitted",
+			comparables: []models.Comparable{
+				{SalePrice: 1000000, ListPrice: 1000000, DaysOnMarket: 10},
+				{SalePrice: 1000000, ListPrice: 1020000, DaysOnMarket: 20},
+				{SalePrice: 1000000, ListPrice: 1040000, DaysOnMarket: 30},
+			},
+			premium:  0.1,
+			expected: 60,
+		},
+		{
+			// Days on market falling with the premium is noise; the default slope is used instead
+			name: "falling",
+			comparables: []models.Comparable{
+				{SalePrice: 1000000, ListPrice: 1000000, DaysOnMarket: 30},
+				{SalePrice: 1000000, ListPrice: 1020000, DaysOnMarket: 20},
+				{SalePrice: 1000000, ListPrice: 1040000, DaysOnMarket: 10},
+			},
+			premium:  0.03,
+			expected: 23,
+		},
+		{"never below one day", nil, -0.5, 1},
+	}
+
+	for _, tc := range testCases {
+		result := fitDaysOnMarketCurve(tc.comparables).daysOnMarket(tc.premium)
+		if result != tc.expected {
+			t.Errorf("%s: expected %d days on market but got %d", tc.name, tc.expected, result)
+		}
+	}
+}
+
+func TestGetPricingStrategyFromFile(t *testing.T) {
+	advisor := NewPricingAdvisor(newTestCMAAnalyzer(newFileDataFetcher(t)))
+
+	result, err := advisor.GetPricingStrategy(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if result.EstimatedValue != 836*1400 {
+		t.Errorf("Expected estimated value %d but got %d", 836*1400, result.EstimatedValue)
+	}
+	if len(result.PricePoints) != 3 {
+		t.Fatalf("Expected 3 price points but got %d", len(result.PricePoints))
+	}
+	for i := 1; i < len(result.PricePoints); i++ {
+		lower, higher := result.PricePoints[i-1], result.PricePoints[i]
+		if higher.ListPrice <= lower.ListPrice {
+			t.Errorf("Expected %s list price above %s but got %d and %d", higher.Strategy, lower.Strategy, higher.ListPrice, lower.ListPrice)
+		}
+		if higher.ExpectedDaysOnMarket < lower.ExpectedDaysOnMarket {
+			t.Errorf("Expected %s to take at least as long as %s but got %d and %d days", higher.Strategy, lower.Strategy, higher.ExpectedDaysOnMarket, lower.ExpectedDaysOnMarket)
+		}
+	}
+}
+
+func TestGetPricingStrategyNoComparables(t *testing.T) {
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", Latitude: 37.7706, Longitude: -122.4222, Status: models.ListingStatusActive, Sqft: 1400},
+	}})
+	advisor := NewPricingAdvisor(newTestCMAAnalyzer(df))
+
+	_, err := advisor.GetPricingStrategy(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5})
+	if !errors.Is(err, ErrNoComparables) {
+		t.Errorf("Expected ErrNoComparables but got %v", err)
+	}
+}
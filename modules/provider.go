@@ -0,0 +1,153 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/user/cma/models"
+)
+
+// ErrListingNotFound is returned by a ListingProvider when no listing matches the requested ID
+var ErrListingNotFound = errors.New("listing not found")
+
+// ErrRentalsUnavailable is returned by a ListingProvider that has no leased rental data
+var ErrRentalsUnavailable = errors.New("listings provider has no rental data")
+
+// ListingProvider is a source of sold and active property listings and leased rentals
+type ListingProvider interface {
+	// GetListing returns the listing with the given provider ID
+	GetListing(ctx context.Context, id string) (*models.Listing, error)
+
+	// SearchListings returns all listings matching the query
+	SearchListings(ctx context.Context, query models.ListingQuery) ([]models.Listing, error)
+
+	// SearchRentals returns all leased rentals matching the query
+	SearchRentals(ctx context.Context, query models.RentalQuery) ([]models.Rental, error)
+}
+
+// MatchesQuery reports whether a listing satisfies every criterion set on the query
+func MatchesQuery(l models.Listing, q models.ListingQuery) bool {
+	if q.Location != "" && !matchesLocation(l, q.Location) {
+		return false
+	}
+
+	if q.PropertyType != "" && !strings.EqualFold(l.PropertyType, q.PropertyType) {
+		return false
+	}
+
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, status := range q.Statuses {
+			if strings.EqualFold(l.Status, status) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.RadiusMiles > 0 {
+		if l.Latitude == 0 && l.Longitude == 0 {
+			return false
+		}
+		if DistanceMiles(q.Latitude, q.Longitude, l.Latitude, l.Longitude) > q.RadiusMiles {
+			return false
+		}
+	}
+
+	if !q.SoldAfter.IsZero() && l.SaleDate.Before(q.SoldAfter) {
+		return false
+	}
+	if !q.SoldBefore.IsZero() && (l.SaleDate.IsZero() || l.SaleDate.After(q.SoldBefore)) {
+		return false
+	}
+
+	return true
+}
+
+// matchesLocation matches a location string against a listing's city, state, ZIP code, "city, state"
+// or "city, state ZIP"
+func matchesLocation(l models.Listing, location string) bool {
+	location = strings.ToLower(strings.TrimSpace(location))
+	city := strings.ToLower(l.City)
+	state := strings.ToLower(l.State)
+
+	if before, zip := splitLocationZip(location); zip != "" && strings.Contains(before, ",") {
+		return zip5(l.ZipCode) == zip5(zip) && matchesLocation(l, before)
+	}
+
+	switch location {
+	case strings.ToLower(l.ZipCode), city, state, city + ", " + state:
+		return true
+	}
+	return false
+}
+
+// splitLocationZip splits a trailing ZIP code off a "city, state ZIP" location, returning the
+// location unchanged and an empty ZIP code when it has none
+func splitLocationZip(location string) (string, string) {
+	if m := stateZipPattern.FindStringSubmatch(location); m != nil {
+		return strings.TrimRight(m[1], ", "), m[2]
+	}
+	return location, ""
+}
+
+// rentalListingQuery returns the listing query matching the leases a rental query asks for, with
+// leases represented as sold listings by rentalListing
+func rentalListingQuery(q models.RentalQuery) models.ListingQuery {
+	return models.ListingQuery{
+		Location:     q.Location,
+		PropertyType: q.PropertyType,
+		Statuses:     []string{models.ListingStatusSold},
+		Latitude:     q.Latitude,
+		Longitude:    q.Longitude,
+		RadiusMiles:  q.RadiusMiles,
+		SoldAfter:    q.LeasedAfter,
+		Limit:        q.Limit,
+	}
+}
+
+// rentalListing represents a lease as a sold listing: the monthly rent is its sale price and the
+// lease date its sale date. Providers store and match leases in this form.
+func rentalListing(r models.Rental) models.Listing {
+	return models.Listing{
+		ID:           r.ID,
+		Address:      r.Address,
+		City:         r.City,
+		State:        r.State,
+		ZipCode:      r.ZipCode,
+		Latitude:     r.Latitude,
+		Longitude:    r.Longitude,
+		PropertyType: r.PropertyType,
+		Status:       models.ListingStatusSold,
+		Bedrooms:     r.Bedrooms,
+		Bathrooms:    r.Bathrooms,
+		Sqft:         r.Sqft,
+		SalePrice:    r.MonthlyRent,
+		SaleDate:     r.LeaseDate,
+		DaysOnMarket: r.DaysOnMarket,
+	}
+}
+
+// rentalFromListing converts a lease in the form built by rentalListing back into a Rental
+func rentalFromListing(l models.Listing) models.Rental {
+	return models.Rental{
+		ID:           l.ID,
+		Address:      l.Address,
+		City:         l.City,
+		State:        l.State,
+		ZipCode:      l.ZipCode,
+		Latitude:     l.Latitude,
+		Longitude:    l.Longitude,
+		PropertyType: l.PropertyType,
+		Bedrooms:     l.Bedrooms,
+		Bathrooms:    l.Bathrooms,
+		Sqft:         l.Sqft,
+		MonthlyRent:  l.SalePrice,
+		LeaseDate:    l.SaleDate,
+		DaysOnMarket: l.DaysOnMarket,
+	}
+}
@@ -0,0 +1,166 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+	"golang.org/x/time/rate"
+)
+
+// ErrQuotaExhausted is returned when an upstream host's daily request quota has been used up
+var ErrQuotaExhausted = errors.New("daily request quota exhausted")
+
+// RateLimit configures the request limits for an upstream host
+type RateLimit struct {
+	// Sustained requests per minute; 0 means unlimited
+	RequestsPerMinute int
+
+	// Requests allowed in a burst above the sustained rate; defaults to 1
+	Burst int
+
+	// Requests per UTC day; 0 means unlimited
+	DailyQuota int
+}
+
+// hostLimiter applies a token bucket and a daily quota to one upstream host
+type hostLimiter struct {
+	limiter    *rate.Limiter
+	dailyQuota int
+	now        func() time.Time
+
+	mu    sync.Mutex
+	day   string
+	count int
+}
+
+// newHostLimiter creates a hostLimiter for the given limits
+func newHostLimiter(limit RateLimit, now func() time.Time) *hostLimiter {
+	hl := &hostLimiter{
+		dailyQuota: limit.DailyQuota,
+		now:        now,
+	}
+	if limit.RequestsPerMinute > 0 {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		hl.limiter = rate.NewLimiter(rate.Limit(float64(limit.RequestsPerMinute)/60), burst)
+	}
+	return hl
+}
+
+// Wait reserves one request against the daily quota and then waits for a token. It fails
+// immediately with ErrQuotaExhausted when the quota is used up, and without waiting when the
+// token would not become available before the context's deadline.
+func (hl *hostLimiter) Wait(ctx context.Context) error {
+	hl.mu.Lock()
+	today := hl.now().UTC().Format("2006-01-02")
+	if hl.day != today {
+		hl.day = today
+		hl.count = 0
+	}
+	if hl.dailyQuota > 0 && hl.count >= hl.dailyQuota {
+		hl.mu.Unlock()
+		return ErrQuotaExhausted
+	}
+	hl.count++
+	hl.mu.Unlock()
+
+	if hl.limiter == nil {
+		return nil
+	}
+	if err := hl.limiter.Wait(ctx); err != nil {
+		// The request is never sent, so give its quota back
+		hl.mu.Lock()
+		hl.count--
+		hl.mu.Unlock()
+
+		// rate.Limiter reports waits past the deadline before they happen; surface them as deadline errors
+		if ctx.Err() == nil {
+			return fmt.Errorf("%w (rate limit wait exceeds deadline: %w)", context.DeadlineExceeded, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Status returns a snapshot of the quota usage
+func (hl *hostLimiter) Status() models.QuotaStatus {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	now := hl.now().UTC()
+	status := models.QuotaStatus{
+		DailyQuota: hl.dailyQuota,
+		ResetAt:    time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+	}
+	if hl.day == now.Format("2006-01-02") {
+		status.RequestsToday = hl.count
+	}
+	if hl.limiter != nil {
+		status.RequestsPerMinute = int(float64(hl.limiter.Limit()) * 60)
+	}
+	return status
+}
+
+// ParseRateLimit parses a rate limit of the form "60/min", "60/min:5000/day" or "5000/day",
+// optionally with a burst size as in "60/min+10"
+func ParseRateLimit(s string) (RateLimit, error) {
+	var limit RateLimit
+	for _, part := range strings.Split(s, ":") {
+		part = strings.TrimSpace(part)
+		value, unit, ok := strings.Cut(part, "/")
+		if !ok {
+			return limit, fmt.Errorf("invalid rate limit %q", part)
+		}
+
+		var burst string
+		unit, burst, _ = strings.Cut(unit, "+")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return limit, fmt.Errorf("invalid rate limit %q: %w", part, err)
+		}
+
+		switch unit {
+		case "min":
+			limit.RequestsPerMinute = n
+			if burst != "" {
+				if limit.Burst, err = strconv.Atoi(burst); err != nil {
+					return limit, fmt.Errorf("invalid burst in %q: %w", part, err)
+				}
+			}
+		case "day":
+			limit.DailyQuota = n
+		default:
+			return limit, fmt.Errorf("invalid rate limit unit %q", unit)
+		}
+	}
+	return limit, nil
+}
+
+// ParseRateLimits parses per-host rate limits of the form "api.a.com=60/min:5000/day,api.b.com=30/min"
+func ParseRateLimits(s string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	if strings.TrimSpace(s) == "" {
+		return limits, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		host, spec, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit entry %q", entry)
+		}
+		limit, err := ParseRateLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(host)] = limit
+	}
+	return limits, nil
+}
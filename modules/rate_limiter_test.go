@@ -0,0 +1,138 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	testCases := []struct {
+		spec        string
+		expected    RateLimit
+		expectError bool
+	}{
+		{spec: "60/min", expected: RateLimit{RequestsPerMinute: 60}},
+		{spec: "60/min+10:5000/day", expected: RateLimit{RequestsPerMinute: 60, Burst: 10, DailyQuota: 5000}},
+		{spec: "5000/day", expected: RateLimit{DailyQuota: 5000}},
+		{spec: "60/hour", expectError: true},
+		{spec: "sixty/min", expectError: true},
+		{spec: "60", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			result, err := ParseRateLimit(tc.spec)
+			if tc.expectError {
+				if err == nil {
+					t.Error("Expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %+v but got %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestFetchJSONDailyQuota(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultFetcherConfig()
+	cfg.DefaultRateLimit = RateLimit{DailyQuota: 2}
+	df := NewDataFetcherWithConfig(cfg)
+
+	var result map[string]interface{}
+	for i := 0; i < 2; i++ {
+		if err := df.FetchJSON(context.Background(), server.URL, &result); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+	}
+	if err := df.FetchJSON(context.Background(), server.URL, &result); !errors.Is(err, ErrQuotaExhausted) {
+		t.Errorf("Expected ErrQuotaExhausted but got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 upstream requests but got %d", requests)
+	}
+
+	for _, status := range df.QuotaStatuses() {
+		if status.RequestsToday != 2 || status.DailyQuota != 2 {
+			t.Errorf("Unexpected quota status: %+v", status)
+		}
+	}
+	for _, status := range df.BreakerStatuses() {
+		if status.State != BreakerClosed {
+			t.Errorf("Expected exhausted quota not to open the breaker but got %s", status.State)
+		}
+	}
+}
+
+func TestFetchJSONRateLimitDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultFetcherConfig()
+	cfg.DefaultRateLimit = RateLimit{RequestsPerMinute: 1}
+	df := NewDataFetcherWithConfig(cfg)
+
+	var result map[string]interface{}
+	if err := df.FetchJSON(context.Background(), server.URL, &result); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// The next token is a minute away, so a short deadline fails without waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := df.FetchJSON(ctx, server.URL, &result)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded but got %v", err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Errorf("Expected the wait to fail immediately but it took %v", time.Since(start))
+	}
+	if status := df.QuotaStatuses(); len(status) != 1 {
+		t.Errorf("Expected 1 upstream but got %d", len(status))
+	}
+}
+
+func TestCacheServesStaleWhenQuotaExhausted(t *testing.T) {
+	c, now := newTestCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Minute})
+	c.GetOrLoad(context.Background(), "key", func(ctx context.Context) (interface{}, error) { return "old", nil })
+
+	// Well past the stale window, but the upstream can't be called
+	*now = now.Add(time.Hour)
+	ctx, freshness := WithFreshness(context.Background())
+	value, err := c.GetOrLoad(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		return nil, ErrQuotaExhausted
+	})
+	if err != nil || value != "old" {
+		t.Fatalf("Expected stale value but got %v (%v)", value, err)
+	}
+	if freshness.Freshness() != models.DataFreshnessStale {
+		t.Errorf("Expected freshness stale but got %s", freshness.Freshness())
+	}
+
+	// Other errors are not masked
+	if _, err := c.GetOrLoad(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("bad request")
+	}); err == nil {
+		t.Error("Expected an error but got nil")
+	}
+}
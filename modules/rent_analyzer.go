@@ -0,0 +1,167 @@
+package modules
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/user/cma/models"
+)
+
+// GetRentalComparables finds leased rentals comparable to a property given by ID, address or
+// coordinates and estimates its monthly rent, using the same similarity ranking and outlier
+// filtering as sales comparables
+func (ca *CMAAnalyzer) GetRentalComparables(ctx context.Context, req models.CMARequest) (*models.RentCMAResponse, error) {
+	provider := ca.dataFetcher.Provider()
+	if provider == nil {
+		return ca.mockRentalComparables(req), nil
+	}
+	ctx, freshness := WithFreshness(ctx)
+
+	subject, err := ca.resolveSubject(ctx, provider, req)
+	if err != nil {
+		return nil, err
+	}
+
+	propertyType := req.PropertyType
+	if propertyType == "" {
+		propertyType = subject.PropertyType
+	}
+
+	// Search for leased rentals with similar characteristics in the given radius
+	rentals, err := provider.SearchRentals(ctx, models.RentalQuery{
+		PropertyType: propertyType,
+		Latitude:     subject.Latitude,
+		Longitude:    subject.Longitude,
+		RadiusMiles:  float64(req.Radius),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make([]models.Listing, 0, len(rentals))
+	for _, r := range rentals {
+		if r.MonthlyRent > 0 {
+			leases = append(leases, rentalListing(r))
+		}
+	}
+	comparables := ca.selectRentalComparables(*subject, leases, float64(req.Radius))
+	estimate, low, high := estimateRent(*subject, comparables)
+
+	return &models.RentCMAResponse{
+		PropertyID:    subject.ID,
+		Address:       ListingAddress(*subject).String(),
+		Comparables:   comparables,
+		EstimatedRent: estimate,
+		RentRangeLow:  low,
+		RentRangeHigh: high,
+		DataFreshness: freshness.Freshness(),
+	}, nil
+}
+
+// selectRentalComparables ranks leases by similarity to the subject, drops rent outliers and
+// returns the closest matches
+func (ca *CMAAnalyzer) selectRentalComparables(subject models.Listing, leases []models.Listing, radius float64) []models.RentalComparable {
+	comparables := make([]models.RentalComparable, 0, maxComparables)
+	for _, r := range rankListings(subject, leases, radius) {
+		comparables = append(comparables, toRentalComparable(r.listing, r.distance))
+	}
+
+	comparables = removeRentOutliers(comparables)
+	if len(comparables) > maxComparables {
+		comparables = comparables[:maxComparables]
+	}
+	return comparables
+}
+
+// toRentalComparable converts a lease in the form built by rentalListing into a RentalComparable
+func toRentalComparable(lease models.Listing, distance float64) models.RentalComparable {
+	comp := models.RentalComparable{
+		ID:            lease.ID,
+		Address:       NormalizeAddress(lease.Address),
+		MonthlyRent:   lease.SalePrice,
+		Sqft:          lease.Sqft,
+		Bedrooms:      lease.Bedrooms,
+		Bathrooms:     lease.Bathrooms,
+		LeaseDate:     formatDate(lease.SaleDate),
+		DistanceMiles: math.Round(distance*100) / 100,
+	}
+	if lease.Sqft > 0 {
+		comp.RentPerSqft = math.Round(float64(lease.SalePrice)/float64(lease.Sqft)*100) / 100
+	}
+	return comp
+}
+
+// removeRentOutliers drops rental comparables whose rent per square foot falls outside 1.5 IQR
+// of the others; small sets are returned unchanged. Leases of unknown size have no rent per
+// square foot, so they neither count toward the range nor are dropped.
+func removeRentOutliers(comparables []models.RentalComparable) []models.RentalComparable {
+	var values []float64
+	for _, comp := range comparables {
+		if comp.RentPerSqft > 0 {
+			values = append(values, comp.RentPerSqft)
+		}
+	}
+	if len(values) < 4 {
+		return comparables
+	}
+	low, high := outlierBounds(values)
+
+	filtered := comparables[:0:0]
+	for _, comp := range comparables {
+		if comp.RentPerSqft == 0 || (comp.RentPerSqft >= low && comp.RentPerSqft <= high) {
+			filtered = append(filtered, comp)
+		}
+	}
+	return filtered
+}
+
+// estimateRent applies the comparables' average rent per square foot to the subject's size, with
+// the interquartile range of their rent per square foot as the likely range. When the subject's
+// size is unknown the comparables' rents are used directly.
+func estimateRent(subject models.Listing, comparables []models.RentalComparable) (estimate, low, high int) {
+	if len(comparables) == 0 {
+		return 0, 0, 0
+	}
+
+	var rates, rents []float64
+	for _, comp := range comparables {
+		rents = append(rents, float64(comp.MonthlyRent))
+		if comp.RentPerSqft > 0 {
+			rates = append(rates, comp.RentPerSqft)
+		}
+	}
+
+	values, scale := rents, 1.0
+	if subject.Sqft > 0 && len(rates) > 0 {
+		values, scale = rates, float64(subject.Sqft)
+	}
+	sort.Float64s(values)
+
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	estimate = int(math.Round(total / float64(len(values)) * scale))
+	low = min(estimate, int(math.Round(percentile(values, 25)*scale)))
+	high = max(estimate, int(math.Round(percentile(values, 75)*scale)))
+	return estimate, low, high
+}
+
+// mockRentalComparables returns mock data when no listing provider is configured
+func (ca *CMAAnalyzer) mockRentalComparables(req models.CMARequest) *models.RentCMAResponse {
+	comparables := []models.RentalComparable{
+		{Address: "123 Main St", MonthlyRent: 4500, Sqft: 1300, RentPerSqft: 3.46},
+		{Address: "456 Elm St", MonthlyRent: 4800, Sqft: 1400, RentPerSqft: 3.43},
+		{Address: "789 Oak St", MonthlyRent: 5000, Sqft: 1380, RentPerSqft: 3.62},
+	}
+	estimate, low, high := estimateRent(models.Listing{}, comparables)
+
+	return &models.RentCMAResponse{
+		PropertyID:    req.PropertyID,
+		Comparables:   comparables,
+		EstimatedRent: estimate,
+		RentRangeLow:  low,
+		RentRangeHigh: high,
+	}
+}
@@ -0,0 +1,112 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/user/cma/models"
+)
+
+func TestGetRentalComparablesFromFile(t *testing.T) {
+	analyzer := newTestCMAAnalyzer(newFileDataFetcher(t))
+
+	result, err := analyzer.GetRentalComparables(context.Background(), models.CMARequest{
+		PropertyID: "S1",
+		Radius:     5,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// R6 is a rent outlier, R7 is a condo and R8 is outside the radius
+	if len(result.Comparables) != 5 {
+		t.Fatalf("Expected 5 comparables but got %d", len(result.Comparables))
+	}
+	for _, comp := range result.Comparables {
+		switch comp.ID {
+		case "R6", "R7", "R8":
+			t.Errorf("Unexpected comparable %s", comp.ID)
+		}
+	}
+
+	// Most similar rental comes first
+	if result.Comparables[0].ID != "R1" {
+		t.Errorf("Expected R1 to be the closest match but got %s", result.Comparables[0].ID)
+	}
+	if result.Comparables[0].RentPerSqft != 3.48 {
+		t.Errorf("Expected rent per sqft 3.48 but got %v", result.Comparables[0].RentPerSqft)
+	}
+
+	if result.EstimatedRent != 4911 {
+		t.Errorf("Expected estimated rent 4911 but got %d", result.EstimatedRent)
+	}
+	if result.RentRangeLow != 4858 || result.RentRangeHigh != 4928 {
+		t.Errorf("Expected rent range 4858-4928 but got %d-%d", result.RentRangeLow, result.RentRangeHigh)
+	}
+}
+
+func TestGetRentalComparablesUnavailable(t *testing.T) {
+	df := NewDataFetcher()
+	df.SetProvider(&staticProvider{listings: []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", Latitude: 37.7706, Longitude: -122.4222, Sqft: 1400},
+	}})
+	analyzer := newTestCMAAnalyzer(df)
+
+	_, err := analyzer.GetRentalComparables(context.Background(), models.CMARequest{PropertyID: "S1", Radius: 5})
+	if !errors.Is(err, ErrRentalsUnavailable) {
+		t.Errorf("Expected ErrRentalsUnavailable but got %v", err)
+	}
+}
+
+func TestEstimateRent(t *testing.T) {
+	comparables := []models.RentalComparable{
+		{MonthlyRent: 4000, RentPerSqft: 4},
+		{MonthlyRent: 3000, RentPerSqft: 3},
+		{MonthlyRent: 5000},
+	}
+
+	testCases := []struct {
+		name             string
+		subject          models.Listing
+		expectedEstimate int
+		expectedLow      int
+		expectedHigh     int
+	}{
+		{"by rent per sqft", models.Listing{Sqft: 1000}, 3500, 3250, 3750},
+		{"by rent", models.Listing{}, 4000, 3500, 4500},
+	}
+
+	for _, tc := range testCases {
+		estimate, low, high := estimateRent(tc.subject, comparables)
+		if estimate != tc.expectedEstimate || low != tc.expectedLow || high != tc.expectedHigh {
+			t.Errorf("%s: expected %d (%d-%d) but got %d (%d-%d)", tc.name,
+				tc.expectedEstimate, tc.expectedLow, tc.expectedHigh, estimate, low, high)
+		}
+	}
+
+	if estimate, low, high := estimateRent(models.Listing{Sqft: 1000}, nil); estimate != 0 || low != 0 || high != 0 {
+		t.Errorf("Expected no estimate without comparables but got %d (%d-%d)", estimate, low, high)
+	}
+}
+
+func TestRemoveRentOutliers(t *testing.T) {
+	comparables := []models.RentalComparable{
+		{ID: "A", MonthlyRent: 3600, RentPerSqft: 3.6},
+		{ID: "B", MonthlyRent: 3800, RentPerSqft: 3.8},
+		{ID: "U1", MonthlyRent: 4200},
+		{ID: "C", MonthlyRent: 4000, RentPerSqft: 4},
+		{ID: "D", MonthlyRent: 4200, RentPerSqft: 4.2},
+		{ID: "HIGH", MonthlyRent: 12000, RentPerSqft: 12},
+	}
+
+	// Leases of unknown size are kept for estimateRent's fallback to rents
+	var ids []string
+	for _, comp := range removeRentOutliers(comparables) {
+		ids = append(ids, comp.ID)
+	}
+	if expected := []string{"A", "B", "U1", "C", "D"}; !slices.Equal(ids, expected) {
+		t.Errorf("Expected %v but got %v", expected, ids)
+	}
+}
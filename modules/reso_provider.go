@@ -0,0 +1,441 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// resoSelectFields are the RESO Data Dictionary fields requested from the Property resource
+var resoSelectFields = []string{
+	"ListingKey", "UnparsedAddress", "City", "StateOrProvince", "PostalCode", "Latitude", "Longitude",
+	"PropertySubType", "StandardStatus", "BedroomsTotal", "BathroomsTotalInteger", "LivingArea",
+	"LotSizeSquareFeet", "YearBuilt", "ListPrice", "ClosePrice", "ListingContractDate", "CloseDate",
+	"DaysOnMarket", "SpecialListingConditions",
+}
+
+// resoStatuses maps listing statuses to RESO StandardStatus values
+var resoStatuses = map[string]string{
+	models.ListingStatusSold:    "Closed",
+	models.ListingStatusActive:  "Active",
+	models.ListingStatusPending: "Pending",
+}
+
+// resoPropertySubTypes maps our property types to RESO PropertySubType values
+var resoPropertySubTypes = map[string]string{
+	"single-family": "Single Family Residence",
+	"condo":         "Condominium",
+	"townhouse":     "Townhouse",
+	"multi-family":  "Duplex",
+}
+
+// resoLeaseType is the PropertyType of lease records, which share the Property resource with sales
+const resoLeaseType = "Residential Lease"
+
+var (
+	zipCodePattern   = regexp.MustCompile(`^\d{5}(-\d{4})?$`)
+	stateCodePattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+)
+
+// RESOConfig configures a RESOProvider
+type RESOConfig struct {
+	// Base URL of the OData service, e.g. https://api.example-mls.com/reso/odata
+	BaseURL string
+
+	// OAuth2 token endpoint for the client credentials grant
+	TokenURL string
+
+	ClientID     string
+	ClientSecret string
+	Scope        string
+
+	// Number of records requested per page ($top); defaults to 200
+	PageSize int
+}
+
+// RESOProvider queries the Property resource of a RESO Web API (OData) server
+type RESOProvider struct {
+	dataFetcher *DataFetcher
+	config      RESOConfig
+	now         func() time.Time
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// resoProperty is a Property record as returned by a RESO Web API server
+type resoProperty struct {
+	ListingKey            string   `json:"ListingKey"`
+	UnparsedAddress       string   `json:"UnparsedAddress"`
+	City                  string   `json:"City"`
+	StateOrProvince       string   `json:"StateOrProvince"`
+	PostalCode            string   `json:"PostalCode"`
+	Latitude              float64  `json:"Latitude"`
+	Longitude             float64  `json:"Longitude"`
+	PropertySubType       string   `json:"PropertySubType"`
+	StandardStatus        string   `json:"StandardStatus"`
+	BedroomsTotal         int      `json:"BedroomsTotal"`
+	BathroomsTotalInteger float64  `json:"BathroomsTotalInteger"`
+	LivingArea            float64  `json:"LivingArea"`
+	LotSizeSquareFeet     float64  `json:"LotSizeSquareFeet"`
+	YearBuilt             int      `json:"YearBuilt"`
+	ListPrice             float64  `json:"ListPrice"`
+	ClosePrice            *float64 `json:"ClosePrice"`
+	ListingContractDate   string   `json:"ListingContractDate"`
+	CloseDate             string   `json:"CloseDate"`
+	DaysOnMarket          int      `json:"DaysOnMarket"`
+
+	// SpecialListingConditions is a multi-select field, sent by servers either as a comma-separated
+	// string or as an array
+	SpecialListingConditions interface{} `json:"SpecialListingConditions"`
+}
+
+// resoPage is a page of an OData collection response
+type resoPage struct {
+	Value    []resoProperty `json:"value"`
+	NextLink string         `json:"@odata.nextLink"`
+}
+
+// oauthToken is an OAuth2 token endpoint response
+type oauthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// NewRESOProvider creates a new RESOProvider instance
+func NewRESOProvider(df *DataFetcher, cfg RESOConfig) *RESOProvider {
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 200
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+
+	return &RESOProvider{
+		dataFetcher: df,
+		config:      cfg,
+		now:         time.Now,
+	}
+}
+
+// GetListing returns the Property record with the given ListingKey
+func (rp *RESOProvider) GetListing(ctx context.Context, id string) (*models.Listing, error) {
+	listings, err := rp.query(ctx, fmt.Sprintf("ListingKey eq %s", odataString(id)), 1, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(listings) == 0 {
+		return nil, ErrListingNotFound
+	}
+	return &listings[0], nil
+}
+
+// SearchListings queries the Property resource for listings matching the query
+func (rp *RESOProvider) SearchListings(ctx context.Context, query models.ListingQuery) ([]models.Listing, error) {
+	// The bounding box filter is coarser than the radius, so apply the exact criteria locally
+	return rp.query(ctx, resoFilter(query, false), query.Limit, func(listing models.Listing) bool {
+		return MatchesQuery(listing, query)
+	})
+}
+
+// SearchRentals queries the Property resource for closed residential leases matching the query.
+// The close price of a lease is its monthly rent and the close date its lease date.
+func (rp *RESOProvider) SearchRentals(ctx context.Context, query models.RentalQuery) ([]models.Rental, error) {
+	listingQuery := rentalListingQuery(query)
+	leases, err := rp.query(ctx, resoFilter(listingQuery, true), query.Limit, func(lease models.Listing) bool {
+		return MatchesQuery(lease, listingQuery)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Rental
+	for _, lease := range leases {
+		results = append(results, rentalFromListing(lease))
+	}
+	return results, nil
+}
+
+// query fetches every page of Property records matching the OData filter and, when match is not
+// nil, the local criteria, until limit records have matched
+func (rp *RESOProvider) query(ctx context.Context, filter string, limit int, match func(models.Listing) bool) ([]models.Listing, error) {
+	params := url.Values{}
+	params.Set("$select", strings.Join(resoSelectFields, ","))
+	params.Set("$top", fmt.Sprint(rp.config.PageSize))
+	if filter != "" {
+		params.Set("$filter", filter)
+	}
+	next := rp.config.BaseURL + "/Property?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+
+	var listings []models.Listing
+	for next != "" {
+		page, pageURL, err := rp.fetchPage(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range page.Value {
+			listing := p.toListing()
+			if match != nil && !match(listing) {
+				continue
+			}
+			listings = append(listings, listing)
+			if limit > 0 && len(listings) >= limit {
+				return listings, nil
+			}
+		}
+
+		next = ""
+		if page.NextLink != "" {
+			if next, err = rp.nextLink(pageURL, page.NextLink); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return listings, nil
+}
+
+// fetchPage fetches a page of Property records, returning it with the URL it was fetched from.
+// Tokens can be revoked before they expire, so when the server rejects the cached token it is
+// dropped and the page is requested once more with a new one.
+func (rp *RESOProvider) fetchPage(ctx context.Context, pageURL string) (resoPage, *url.URL, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return resoPage{}, nil, fmt.Errorf("error creating RESO request: %w", err)
+		}
+		if err := rp.authorize(req); err != nil {
+			return resoPage{}, nil, err
+		}
+
+		var page resoPage
+		err = rp.dataFetcher.FetchRequestJSON(req, &page)
+		var statusErr *StatusError
+		if attempt == 0 && rp.config.TokenURL != "" && errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+			rp.dropToken(req.Header.Get("Authorization"))
+			continue
+		}
+		if err != nil {
+			return resoPage{}, nil, fmt.Errorf("error querying RESO Property resource: %w", err)
+		}
+		return page, req.URL, nil
+	}
+}
+
+// nextLink resolves the @odata.nextLink of a page. The bearer token is sent with every page, so
+// links off the scheme and host of the base URL are refused.
+func (rp *RESOProvider) nextLink(pageURL *url.URL, link string) (string, error) {
+	next, err := pageURL.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("error querying RESO Property resource: invalid next link: %w", err)
+	}
+	base, err := url.Parse(rp.config.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("error querying RESO Property resource: invalid base URL: %w", err)
+	}
+	if !strings.EqualFold(next.Scheme, base.Scheme) || !strings.EqualFold(next.Host, base.Host) {
+		return "", fmt.Errorf("error querying RESO Property resource: next link %s is not on %s://%s", next.Redacted(), base.Scheme, base.Host)
+	}
+	return next.String(), nil
+}
+
+// dropToken forgets the cached token if it is the one sent in a rejected Authorization header,
+// so the next request fetches a new one
+func (rp *RESOProvider) dropToken(authorization string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.accessToken != "" && authorization == "Bearer "+rp.accessToken {
+		rp.accessToken = ""
+	}
+}
+
+// authorize adds a bearer token to the request, fetching a new one with the client
+// credentials grant when the cached token is missing or about to expire
+func (rp *RESOProvider) authorize(req *http.Request) error {
+	if rp.config.TokenURL == "" {
+		return nil
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.accessToken == "" || !rp.now().Before(rp.tokenExpiry) {
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		if rp.config.Scope != "" {
+			form.Set("scope", rp.config.Scope)
+		}
+
+		tokenReq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, rp.config.TokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("error creating token request: %w", err)
+		}
+		tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		tokenReq.SetBasicAuth(url.QueryEscape(rp.config.ClientID), url.QueryEscape(rp.config.ClientSecret))
+
+		var token oauthToken
+		if err := rp.dataFetcher.FetchRequestJSON(tokenReq, &token); err != nil {
+			return fmt.Errorf("error fetching OAuth2 token: %w", err)
+		}
+		if token.AccessToken == "" {
+			return fmt.Errorf("error fetching OAuth2 token: empty access_token")
+		}
+
+		// Refresh a minute early so a token never expires mid-request
+		expiresIn := time.Duration(token.ExpiresIn) * time.Second
+		if expiresIn <= 0 {
+			expiresIn = time.Hour
+		}
+		rp.accessToken = token.AccessToken
+		rp.tokenExpiry = rp.now().Add(expiresIn - time.Minute)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+rp.accessToken)
+	return nil
+}
+
+// resoFilter builds an OData $filter expression for a listing query, over leases or over
+// everything else. Leases must be told apart from sales by PropertyType since both close with a
+// ClosePrice, which is the monthly rent of a lease.
+func resoFilter(q models.ListingQuery, leases bool) string {
+	clauses := []string{"PropertyType ne " + odataString(resoLeaseType)}
+	if leases {
+		clauses = []string{"PropertyType eq " + odataString(resoLeaseType)}
+	}
+
+	if location := strings.TrimSpace(q.Location); location != "" {
+		if before, zip := splitLocationZip(location); zip != "" && strings.Contains(before, ",") {
+			clauses = append(clauses, "PostalCode eq "+odataString(zip))
+			location = before
+		}
+		city, state, hasState := strings.Cut(location, ",")
+		switch {
+		case zipCodePattern.MatchString(location):
+			clauses = append(clauses, "PostalCode eq "+odataString(location))
+		case hasState:
+			clauses = append(clauses,
+				"City eq "+odataString(strings.TrimSpace(city)),
+				"StateOrProvince eq "+odataString(strings.TrimSpace(state)))
+		case stateCodePattern.MatchString(location):
+			clauses = append(clauses, "StateOrProvince eq "+odataString(strings.ToUpper(location)))
+		default:
+			clauses = append(clauses, "City eq "+odataString(location))
+		}
+	}
+
+	if q.PropertyType != "" {
+		subType, ok := resoPropertySubTypes[strings.ToLower(q.PropertyType)]
+		if !ok {
+			subType = q.PropertyType
+		}
+		clauses = append(clauses, "PropertySubType eq "+odataString(subType))
+	}
+
+	if len(q.Statuses) > 0 {
+		var statuses []string
+		for _, status := range q.Statuses {
+			if standard, ok := resoStatuses[strings.ToLower(status)]; ok {
+				statuses = append(statuses, "StandardStatus eq "+odataString(standard))
+			}
+		}
+		if len(statuses) > 0 {
+			clauses = append(clauses, "("+strings.Join(statuses, " or ")+")")
+		}
+	}
+
+	if q.RadiusMiles > 0 {
+		// One degree of latitude is ~69 miles; longitude degrees shrink with latitude
+		dLat := q.RadiusMiles / 69.0
+		dLng := q.RadiusMiles / (69.0 * math.Cos(q.Latitude*math.Pi/180))
+		clauses = append(clauses,
+			fmt.Sprintf("Latitude ge %.6f", q.Latitude-dLat),
+			fmt.Sprintf("Latitude le %.6f", q.Latitude+dLat),
+			fmt.Sprintf("Longitude ge %.6f", q.Longitude-math.Abs(dLng)),
+			fmt.Sprintf("Longitude le %.6f", q.Longitude+math.Abs(dLng)))
+	}
+
+	if !q.SoldAfter.IsZero() {
+		clauses = append(clauses, "CloseDate ge "+q.SoldAfter.Format("2006-01-02"))
+	}
+	if !q.SoldBefore.IsZero() {
+		clauses = append(clauses, "CloseDate le "+q.SoldBefore.Format("2006-01-02"))
+	}
+
+	return strings.Join(clauses, " and ")
+}
+
+// odataString quotes a string literal for use in an OData expression
+func odataString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// toListing maps a RESO Data Dictionary Property record to a Listing
+func (p resoProperty) toListing() models.Listing {
+	l := models.Listing{
+		ID:           p.ListingKey,
+		Address:      p.UnparsedAddress,
+		City:         p.City,
+		State:        p.StateOrProvince,
+		ZipCode:      p.PostalCode,
+		Latitude:     p.Latitude,
+		Longitude:    p.Longitude,
+		PropertyType: p.PropertySubType,
+		Bedrooms:     p.BedroomsTotal,
+		Bathrooms:    p.BathroomsTotalInteger,
+		Sqft:         int(p.LivingArea),
+		LotSize:      int(p.LotSizeSquareFeet),
+		YearBuilt:    p.YearBuilt,
+		ListPrice:    int(p.ListPrice),
+		DaysOnMarket: p.DaysOnMarket,
+	}
+
+	for propertyType, subType := range resoPropertySubTypes {
+		if strings.EqualFold(p.PropertySubType, subType) {
+			l.PropertyType = propertyType
+			break
+		}
+	}
+
+	for status, standard := range resoStatuses {
+		if strings.EqualFold(p.StandardStatus, standard) {
+			l.Status = status
+			break
+		}
+	}
+	if l.Status == "" {
+		l.Status = strings.ToLower(p.StandardStatus)
+	}
+
+	if p.ClosePrice != nil {
+		l.SalePrice = int(*p.ClosePrice)
+	}
+	if t, err := parseDate(p.ListingContractDate); err == nil {
+		l.ListDate = t
+	}
+	if t, err := parseDate(p.CloseDate); err == nil {
+		l.SaleDate = t
+	}
+
+	switch conditions := p.SpecialListingConditions.(type) {
+	case string:
+		l.SaleConditions = parseSaleConditions(conditions)
+	case []interface{}:
+		names := make([]string, len(conditions))
+		for i, name := range conditions {
+			names[i] = fmt.Sprint(name)
+		}
+		l.SaleConditions = parseSaleConditions(strings.Join(names, ","))
+	}
+
+	return l
+}
@@ -0,0 +1,320 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// newRESOTestServer starts a stand-in RESO Web API server with a token endpoint and a
+// two-page Property resource
+func newRESOTestServer(t *testing.T) (*httptest.Server, *int, *[]string) {
+	t.Helper()
+
+	tokenRequests := 0
+	var filters []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tokenRequests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	var server *httptest.Server
+	mux.HandleFunc("/odata/Property", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		filter := r.URL.Query().Get("$filter")
+		filters = append(filters, filter)
+
+		if strings.HasPrefix(filter, "ListingKey eq ") {
+			if filter != "ListingKey eq 'S1'" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"value": []interface{}{}})
+				return
+			}
+			w.Write([]byte(`{"value":[{"ListingKey":"S1","UnparsedAddress":"100 Valencia St","City":"San Francisco",
+				"StateOrProvince":"CA","PostalCode":"94103","Latitude":37.7706,"Longitude":-122.4222,
+				"PropertySubType":"Single Family Residence","StandardStatus":"Active","BedroomsTotal":3,
+				"BathroomsTotalInteger":2,"LivingArea":1400,"ListPrice":1195000,"ClosePrice":null,
+				"ListingContractDate":"2024-05-01"}]}`))
+			return
+		}
+
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`{"value":[{"ListingKey":"C2","UnparsedAddress":"456 Elm St","City":"San Francisco",
+				"StateOrProvince":"CA","Latitude":37.769,"Longitude":-122.424,"PropertySubType":"Single Family Residence",
+				"StandardStatus":"Closed","LivingArea":1400,"ClosePrice":1150000,"CloseDate":"2024-03-10"}]}`))
+			return
+		}
+
+		w.Write([]byte(`{"value":[{"ListingKey":"C1","UnparsedAddress":"123 Main St","City":"San Francisco",
+			"StateOrProvince":"CA","Latitude":37.7712,"Longitude":-122.421,"PropertySubType":"Single Family Residence",
+			"StandardStatus":"Closed","LivingArea":1300,"ClosePrice":1100000,"CloseDate":"2024-02-02"}],
+			"@odata.nextLink":"` + server.URL + `/odata/Property?page=2"}`))
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &tokenRequests, &filters
+}
+
+func TestRESOProviderGetListing(t *testing.T) {
+	server, tokenRequests, _ := newRESOTestServer(t)
+	rp := NewRESOProvider(NewDataFetcher(), RESOConfig{
+		BaseURL:      server.URL + "/odata/",
+		TokenURL:     server.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+
+	listing, err := rp.GetListing(context.Background(), "S1")
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if listing.Address != "100 Valencia St" || listing.Sqft != 1400 || listing.ListPrice != 1195000 {
+		t.Errorf("Unexpected listing mapping: %+v", listing)
+	}
+	if listing.PropertyType != "single-family" {
+		t.Errorf("Expected property type single-family but got %s", listing.PropertyType)
+	}
+	if listing.Status != models.ListingStatusActive {
+		t.Errorf("Expected status active but got %s", listing.Status)
+	}
+
+	if _, err := rp.GetListing(context.Background(), "missing"); err != ErrListingNotFound {
+		t.Errorf("Expected ErrListingNotFound but got %v", err)
+	}
+
+	// The token is cached across requests
+	if *tokenRequests != 1 {
+		t.Errorf("Expected 1 token request but got %d", *tokenRequests)
+	}
+}
+
+func TestRESOProviderSearchListingsPaging(t *testing.T) {
+	server, _, filters := newRESOTestServer(t)
+	rp := NewRESOProvider(NewDataFetcher(), RESOConfig{
+		BaseURL:      server.URL + "/odata",
+		TokenURL:     server.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+
+	listings, err := rp.SearchListings(context.Background(), models.ListingQuery{
+		Location:     "San Francisco, CA",
+		PropertyType: "Single-family",
+		Statuses:     []string{models.ListingStatusSold},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	if len(listings) != 2 {
+		t.Fatalf("Expected 2 listings across both pages but got %d", len(listings))
+	}
+	if listings[1].ID != "C2" || listings[1].SalePrice != 1150000 || listings[1].Status != models.ListingStatusSold {
+		t.Errorf("Unexpected second listing: %+v", listings[1])
+	}
+
+	expected := "PropertyType ne 'Residential Lease' and City eq 'San Francisco' and StateOrProvince eq 'CA' and " +
+		"PropertySubType eq 'Single Family Residence' and (StandardStatus eq 'Closed')"
+	if (*filters)[0] != expected {
+		t.Errorf("Expected filter %q but got %q", expected, (*filters)[0])
+	}
+}
+
+func TestRESOProviderSearchListingsLimit(t *testing.T) {
+	pages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		if r.URL.Query().Get("page") == "" {
+			// F1 lies outside the radius
+			w.Write([]byte(`{"value":[
+				{"ListingKey":"F1","StandardStatus":"Active","City":"San Francisco","StateOrProvince":"CA","PostalCode":"94110","Latitude":37.7570,"Longitude":-122.4040},
+				{"ListingKey":"N1","StandardStatus":"Active","City":"San Francisco","StateOrProvince":"CA","PostalCode":"94110","Latitude":37.7500,"Longitude":-122.4150}],
+				"@odata.nextLink":"` + "http://" + r.Host + `/odata/Property?page=2"}`))
+			return
+		}
+		w.Write([]byte(`{"value":[
+			{"ListingKey":"N2","StandardStatus":"Active","City":"San Francisco","StateOrProvince":"CA","PostalCode":"94110-1234","Latitude":37.7510,"Longitude":-122.4160}]}`))
+	}))
+	defer server.Close()
+
+	rp := NewRESOProvider(NewDataFetcher(), RESOConfig{BaseURL: server.URL + "/odata"})
+
+	// The limit counts only listings within the radius, so the search pages on past F1
+	listings, err := rp.SearchListings(context.Background(), models.ListingQuery{
+		Location:    "San Francisco, CA 94110",
+		Latitude:    37.7500,
+		Longitude:   -122.4150,
+		RadiusMiles: 0.5,
+		Limit:       2,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	if len(listings) != 2 || listings[0].ID != "N1" || listings[1].ID != "N2" {
+		t.Errorf("Expected listings N1 and N2 but got %+v", listings)
+	}
+	if pages != 2 {
+		t.Errorf("Expected 2 pages but got %d", pages)
+	}
+}
+
+func TestRESOProviderUnauthorized(t *testing.T) {
+	server, _, _ := newRESOTestServer(t)
+	rp := NewRESOProvider(NewDataFetcher(), RESOConfig{
+		BaseURL:      server.URL + "/odata",
+		TokenURL:     server.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "wrong",
+	})
+
+	if _, err := rp.GetListing(context.Background(), "S1"); err == nil {
+		t.Error("Expected an error but got nil")
+	}
+}
+
+func TestRESOProviderNextLinkOffHost(t *testing.T) {
+	var tokenSent bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenSent = r.Header.Get("Authorization") != ""
+		w.Write([]byte(`{"value":[]}`))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value":[{"ListingKey":"C1","StandardStatus":"Closed"}],
+			"@odata.nextLink":"` + other.URL + `/odata/Property?page=2"}`))
+	}))
+	defer server.Close()
+
+	rp := NewRESOProvider(NewDataFetcher(), RESOConfig{BaseURL: server.URL + "/odata", TokenURL: server.URL + "/token"})
+	rp.accessToken, rp.tokenExpiry = "secret-token", time.Now().Add(time.Hour)
+
+	// The token must never be sent to a host other than the configured server
+	if _, err := rp.SearchListings(context.Background(), models.ListingQuery{}); err == nil || !strings.Contains(err.Error(), "next link") {
+		t.Errorf("Expected a next link error but got %v", err)
+	}
+	if tokenSent {
+		t.Error("Expected no request with the token to the other host")
+	}
+}
+
+func TestRESOProviderRevokedToken(t *testing.T) {
+	tokens := 0
+	valid := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokens++
+		valid = fmt.Sprintf("token-%d", tokens)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": valid, "expires_in": 3600})
+	})
+	mux.HandleFunc("/odata/Property", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"value":[{"ListingKey":"S1","StandardStatus":"Active"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rp := NewRESOProvider(NewDataFetcher(), RESOConfig{
+		BaseURL:  server.URL + "/odata",
+		TokenURL: server.URL + "/token",
+	})
+	if _, err := rp.GetListing(context.Background(), "S1"); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// The server revokes the cached token long before its expiry
+	valid = "revoked-elsewhere"
+	if _, err := rp.GetListing(context.Background(), "S1"); err != nil {
+		t.Fatalf("Expected the request to be retried with a new token but got: %v", err)
+	}
+	if tokens != 2 {
+		t.Errorf("Expected 2 token requests but got %d", tokens)
+	}
+}
+
+func TestRESOFilter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    models.ListingQuery
+		leases   bool
+		expected string
+	}{
+		{
+			name:     "ZIP Code",
+			query:    models.ListingQuery{Location: "94110"},
+			expected: "PropertyType ne 'Residential Lease' and PostalCode eq '94110'",
+		},
+		{
+			name:     "City, State and ZIP Code",
+			query:    models.ListingQuery{Location: "San Francisco, CA 94110"},
+			expected: "PropertyType ne 'Residential Lease' and PostalCode eq '94110' and City eq 'San Francisco' and StateOrProvince eq 'CA'",
+		},
+		{
+			name:     "State",
+			query:    models.ListingQuery{Location: "ca"},
+			expected: "PropertyType ne 'Residential Lease' and StateOrProvince eq 'CA'",
+		},
+		{
+			name:     "Quoted City",
+			query:    models.ListingQuery{Location: "Coeur d'Alene"},
+			expected: "PropertyType ne 'Residential Lease' and City eq 'Coeur d''Alene'",
+		},
+		{
+			name: "Statuses",
+			query: models.ListingQuery{
+				Statuses: []string{models.ListingStatusActive, models.ListingStatusPending},
+			},
+			expected: "PropertyType ne 'Residential Lease' and (StandardStatus eq 'Active' or StandardStatus eq 'Pending')",
+		},
+		{
+			// Closed leases would otherwise come back as sales priced at their monthly rent
+			name:     "Sales Exclude Leases",
+			query:    models.ListingQuery{Statuses: []string{models.ListingStatusSold}},
+			expected: "PropertyType ne 'Residential Lease' and (StandardStatus eq 'Closed')",
+		},
+		{
+			name:     "Leases",
+			query:    models.ListingQuery{Location: "94110", Statuses: []string{models.ListingStatusSold}},
+			leases:   true,
+			expected: "PropertyType eq 'Residential Lease' and PostalCode eq '94110' and (StandardStatus eq 'Closed')",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := resoFilter(tc.query, tc.leases); result != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, result)
+			}
+		})
+	}
+}
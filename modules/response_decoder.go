@@ -0,0 +1,121 @@
+package modules
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding lists the content encodings the DataFetcher can decode
+const acceptEncoding = "gzip, deflate, br"
+
+// ErrBodyTooLarge is returned when a response body exceeds the configured maximum size
+var ErrBodyTooLarge = errors.New("response body exceeds maximum size")
+
+// DecodeError is returned when a response was received but could not be decoded; it is not retried
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "error unmarshaling JSON: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodedBody returns the response body with its Content-Encoding removed, limited to maxBytes
+// of decoded data so a runaway or malicious upstream can't exhaust memory
+func decodedBody(resp *http.Response, maxBytes int64) (io.ReadCloser, error) {
+	var reader io.Reader = resp.Body
+	var closer io.Closer
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading gzip response: %w", err)
+		}
+		reader, closer = gz, gz
+	case "deflate":
+		fl := flate.NewReader(resp.Body)
+		reader, closer = fl, fl
+	case "br":
+		reader = brotli.NewReader(resp.Body)
+	default:
+		return nil, &DecodeError{Err: fmt.Errorf("unsupported content encoding %q", resp.Header.Get("Content-Encoding"))}
+	}
+
+	if maxBytes > 0 {
+		reader = &limitedReader{r: reader, remaining: maxBytes}
+	}
+	return &decodedReadCloser{Reader: reader, closer: closer}, nil
+}
+
+// decodeJSON streams a JSON document into target. The document is decoded into a fresh value
+// first so a failed attempt never leaves target partially populated.
+func decodeJSON(r io.Reader, target interface{}) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return &DecodeError{Err: fmt.Errorf("target must be a non-nil pointer")}
+	}
+
+	fresh := reflect.New(targetValue.Elem().Type())
+	if err := json.NewDecoder(r).Decode(fresh.Interface()); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.Is(err, ErrBodyTooLarge) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || err == io.EOF {
+			return &DecodeError{Err: err}
+		}
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	targetValue.Elem().Set(fresh.Elem())
+	return nil
+}
+
+// limitedReader fails with ErrBodyTooLarge once more than the allowed number of bytes is read
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Distinguish a body of exactly the limit from one that is larger
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// decodedReadCloser closes the decompressor, if any; the response body is closed by the caller
+type decodedReadCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (d *decodedReadCloser) Close() error {
+	if d.closer != nil {
+		return d.closer.Close()
+	}
+	return nil
+}
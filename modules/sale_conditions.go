@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/user/cma/models"
+)
+
+// saleConditionAliases maps the sale condition names used by providers, lowercased and with
+// punctuation removed, to sale condition values
+var saleConditionAliases = map[string]string{
+	"standard":               models.SaleConditionStandard,
+	"normal":                 models.SaleConditionStandard,
+	"arms length":            models.SaleConditionStandard,
+	"short sale":             models.SaleConditionShortSale,
+	"shortsale":              models.SaleConditionShortSale,
+	"short sale approved":    models.SaleConditionShortSale,
+	"third party approval":   models.SaleConditionShortSale,
+	"lender approval needed": models.SaleConditionShortSale,
+	"foreclosure":            models.SaleConditionForeclosure,
+	"in foreclosure":         models.SaleConditionForeclosure,
+	"notice of default":      models.SaleConditionForeclosure,
+	"preforeclosure":         models.SaleConditionForeclosure,
+	"pre foreclosure":        models.SaleConditionForeclosure,
+	"reo":                    models.SaleConditionREO,
+	"bank owned":             models.SaleConditionREO,
+	"reo bank owned":         models.SaleConditionREO,
+	"real estate owned":      models.SaleConditionREO,
+	"hud owned":              models.SaleConditionREO,
+	"government owned":       models.SaleConditionREO,
+	"auction":                models.SaleConditionAuction,
+	"probate":                models.SaleConditionProbate,
+	"probate listing":        models.SaleConditionProbate,
+	"estate sale":            models.SaleConditionProbate,
+	"related party":          models.SaleConditionRelatedParty,
+	"non arms length":        models.SaleConditionRelatedParty,
+	"family transfer":        models.SaleConditionRelatedParty,
+	"intrafamily transfer":   models.SaleConditionRelatedParty,
+	"intra family transfer":  models.SaleConditionRelatedParty,
+}
+
+// SaleConditions are the known sale condition values
+var SaleConditions = []string{
+	models.SaleConditionStandard,
+	models.SaleConditionShortSale,
+	models.SaleConditionForeclosure,
+	models.SaleConditionREO,
+	models.SaleConditionAuction,
+	models.SaleConditionProbate,
+	models.SaleConditionRelatedParty,
+}
+
+// NormalizeSaleCondition returns the sale condition value for a provider's name of a sale condition,
+// e.g. "REO/Bank Owned" or "Non-Arm's Length", or an empty string when the name is not known
+func NormalizeSaleCondition(condition string) string {
+	condition = strings.Map(func(r rune) rune {
+		switch r {
+		case '\'', '’':
+			return -1
+		case '-', '/', '_', '(', ')':
+			return ' '
+		}
+		return r
+	}, strings.ToLower(condition))
+	return saleConditionAliases[strings.Join(strings.Fields(condition), " ")]
+}
+
+// parseSaleConditions parses a list of sale conditions separated by commas, semicolons or pipes.
+// Unknown conditions are dropped, so a list of only unknown conditions is empty.
+func parseSaleConditions(s string) []string {
+	var conditions []string
+	seen := make(map[string]bool)
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '|' }) {
+		condition := NormalizeSaleCondition(name)
+		if condition != "" && !seen[condition] {
+			seen[condition] = true
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+// IsStandardSale reports whether a listing was sold under standard conditions. Listings whose
+// provider doesn't report sale conditions are treated as standard sales.
+func IsStandardSale(l models.Listing) bool {
+	for _, condition := range l.SaleConditions {
+		if condition != models.SaleConditionStandard {
+			return false
+		}
+	}
+	return true
+}
+
+// saleConditionsAllowed reports whether every condition of a listing's sale is accepted by a sale
+// conditions policy; an empty policy accepts standard sales only
+func saleConditionsAllowed(l models.Listing, policy []string) bool {
+	if len(policy) == 0 {
+		return IsStandardSale(l)
+	}
+
+	allowed := make(map[string]bool)
+	for _, condition := range policy {
+		if condition == models.SaleConditionsAll {
+			return true
+		}
+		allowed[condition] = true
+	}
+
+	conditions := l.SaleConditions
+	if len(conditions) == 0 {
+		conditions = []string{models.SaleConditionStandard}
+	}
+	for _, condition := range conditions {
+		if !allowed[condition] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/user/cma/models"
+)
+
+func TestNormalizeSaleCondition(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"Standard", models.SaleConditionStandard},
+		{"Short Sale", models.SaleConditionShortSale},
+		{"Third Party Approval", models.SaleConditionShortSale},
+		{"In Foreclosure", models.SaleConditionForeclosure},
+		{"REO/Bank Owned", models.SaleConditionREO},
+		{"HUD Owned", models.SaleConditionREO},
+		{"auction", models.SaleConditionAuction},
+		{"Probate Listing", models.SaleConditionProbate},
+		{"Non-Arm's Length", models.SaleConditionRelatedParty},
+		{"  family   transfer ", models.SaleConditionRelatedParty},
+		{"related-party", models.SaleConditionRelatedParty},
+		{"Bankruptcy Property", ""},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		result := NormalizeSaleCondition(tc.input)
+		if result != tc.expected {
+			t.Errorf("For input %q, expected %q but got %q", tc.input, tc.expected, result)
+		}
+	}
+}
+
+func TestParseSaleConditions(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{"Short Sale,Probate Listing", []string{models.SaleConditionShortSale, models.SaleConditionProbate}},
+		{"REO; Bank Owned | Auction", []string{models.SaleConditionREO, models.SaleConditionAuction}},
+		{"Unknown", nil},
+	}
+
+	for _, tc := range testCases {
+		result := parseSaleConditions(tc.input)
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("For input %q, expected %v but got %v", tc.input, tc.expected, result)
+		}
+	}
+}
+
+func TestSaleConditionsAllowed(t *testing.T) {
+	standard := models.Listing{}
+	shortSale := models.Listing{SaleConditions: []string{models.SaleConditionShortSale}}
+	mixed := models.Listing{SaleConditions: []string{models.SaleConditionShortSale, models.SaleConditionProbate}}
+
+	testCases := []struct {
+		name     string
+		listing  models.Listing
+		policy   []string
+		expected bool
+	}{
+		{"unreported is standard", standard, nil, true},
+		{"distressed excluded by default", shortSale, nil, false},
+		{"distressed accepted by all", mixed, []string{models.SaleConditionsAll}, true},
+		{"accepted condition", shortSale, []string{models.SaleConditionStandard, models.SaleConditionShortSale}, true},
+		{"every condition must be accepted", mixed, []string{models.SaleConditionShortSale}, false},
+		{"standard not accepted", standard, []string{models.SaleConditionShortSale}, false},
+	}
+
+	for _, tc := range testCases {
+		result := saleConditionsAllowed(tc.listing, tc.policy)
+		if result != tc.expected {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.expected, result)
+		}
+	}
+}
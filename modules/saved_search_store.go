@@ -0,0 +1,271 @@
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// ErrSavedSearchNotFound is returned when a saved search is unknown or has been deleted
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+// maxStoredAlerts is the number of most recent alerts kept in the alerts feed
+const maxStoredAlerts = 1000
+
+// SearchBaseline is what the next evaluation of a saved search is compared against
+type SearchBaseline struct {
+	// Whether the search has been evaluated successfully; the first evaluation only sets the baseline
+	Evaluated bool `json:"evaluated"`
+
+	// Median price at the first evaluation or the last median price alert
+	ReferenceMedianPrice int `json:"reference_median_price,omitempty"`
+
+	// Number of active listings at the previous evaluation
+	ActiveInventory int `json:"active_inventory,omitempty"`
+
+	// Day the sales search of the next cma evaluation starts from: the day of the previous one
+	SalesSince *time.Time `json:"sales_since,omitempty"`
+
+	// Identifiers of the sales closed on or after SalesSince that were already seen, so a sale
+	// isn't reported again by the next evaluation
+	SeenSales []string `json:"seen_sales,omitempty"`
+}
+
+// storedSearch is a saved search with its baseline
+type storedSearch struct {
+	models.SavedSearch
+	Baseline SearchBaseline `json:"baseline"`
+}
+
+// savedSearchFile is the layout of the file a SavedSearchStore persists to
+type savedSearchFile struct {
+	Searches []storedSearch `json:"searches"`
+	Alerts   []models.Alert `json:"alerts"`
+}
+
+// AlertFilter selects alerts from the feed
+type AlertFilter struct {
+	// Only alerts of this saved search, when set
+	SearchID string
+
+	// Only alerts raised after this time, when set
+	Since time.Time
+
+	// Largest number of alerts returned, or all when 0
+	Limit int
+}
+
+// SavedSearchStore keeps saved searches, their baselines and the alerts they raised. With a file
+// path, every change is written to the file so searches and alerts survive a restart.
+type SavedSearchStore struct {
+	path string
+	now  func() time.Time
+
+	mu       sync.Mutex
+	searches map[string]*storedSearch
+	alerts   []models.Alert
+}
+
+// NewSavedSearchStore creates a new SavedSearchStore, loading path if it exists; an empty path
+// keeps everything in memory only
+func NewSavedSearchStore(path string) (*SavedSearchStore, error) {
+	store := &SavedSearchStore{
+		path:     path,
+		now:      time.Now,
+		searches: make(map[string]*storedSearch),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading saved searches file: %w", err)
+	}
+	var file savedSearchFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing saved searches file: %w", err)
+	}
+	for i := range file.Searches {
+		store.searches[file.Searches[i].ID] = &file.Searches[i]
+	}
+	store.alerts = file.Alerts
+	return store, nil
+}
+
+// Create saves a search
+func (ss *SavedSearchStore) Create(req models.SavedSearchRequest) (models.SavedSearch, error) {
+	search := &storedSearch{SavedSearch: models.SavedSearch{
+		ID:           newID(),
+		Name:         req.Name,
+		Type:         req.Type,
+		MarketTrends: req.MarketTrends,
+		CMA:          req.CMA,
+		Alerts:       req.Alerts,
+		CreatedAt:    ss.now().UTC(),
+	}}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.searches[search.ID] = search
+	if err := ss.save(); err != nil {
+		delete(ss.searches, search.ID)
+		return models.SavedSearch{}, err
+	}
+	return search.SavedSearch, nil
+}
+
+// List returns the saved searches, oldest first
+func (ss *SavedSearchStore) List() []models.SavedSearch {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	searches := make([]models.SavedSearch, 0, len(ss.searches))
+	for _, search := range ss.sorted() {
+		searches = append(searches, search.SavedSearch)
+	}
+	return searches
+}
+
+// Get returns a saved search
+func (ss *SavedSearchStore) Get(id string) (models.SavedSearch, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	search, ok := ss.searches[id]
+	if !ok {
+		return models.SavedSearch{}, ErrSavedSearchNotFound
+	}
+	return search.SavedSearch, nil
+}
+
+// Delete removes a saved search; the alerts it raised stay in the feed
+func (ss *SavedSearchStore) Delete(id string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	search, ok := ss.searches[id]
+	if !ok {
+		return ErrSavedSearchNotFound
+	}
+	delete(ss.searches, id)
+	if err := ss.save(); err != nil {
+		ss.searches[id] = search
+		return err
+	}
+	return nil
+}
+
+// Alerts returns the alerts matching a filter, newest first
+func (ss *SavedSearchStore) Alerts(filter AlertFilter) []models.Alert {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	alerts := []models.Alert{}
+	for i := len(ss.alerts) - 1; i >= 0; i-- {
+		alert := ss.alerts[i]
+		if filter.SearchID != "" && alert.SearchID != filter.SearchID {
+			continue
+		}
+		if !filter.Since.IsZero() && !alert.CreatedAt.After(filter.Since) {
+			continue
+		}
+		alerts = append(alerts, alert)
+		if filter.Limit > 0 && len(alerts) == filter.Limit {
+			break
+		}
+	}
+	return alerts
+}
+
+// snapshot returns copies of the saved searches with their baselines, oldest first
+func (ss *SavedSearchStore) snapshot() []storedSearch {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	searches := make([]storedSearch, 0, len(ss.searches))
+	for _, search := range ss.sorted() {
+		copied := *search
+		copied.Baseline.SeenSales = append([]string(nil), search.Baseline.SeenSales...)
+		searches = append(searches, copied)
+	}
+	return searches
+}
+
+// record stores the outcome of evaluating a saved search: its new baseline and alerts when it
+// succeeded, or its error. Searches deleted during the evaluation are left deleted.
+func (ss *SavedSearchStore) record(id string, baseline SearchBaseline, alerts []models.Alert, evalErr error) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	search, ok := ss.searches[id]
+	if !ok {
+		return nil
+	}
+	evaluated := ss.now().UTC()
+	search.LastEvaluatedAt = &evaluated
+	if evalErr != nil {
+		search.LastError = evalErr.Error()
+		return ss.save()
+	}
+
+	search.LastError = ""
+	search.Baseline = baseline
+	for _, alert := range alerts {
+		alert.ID = newID()
+		alert.SearchID = id
+		alert.SearchName = search.Name
+		alert.CreatedAt = evaluated
+		ss.alerts = append(ss.alerts, alert)
+	}
+	if over := len(ss.alerts) - maxStoredAlerts; over > 0 {
+		ss.alerts = ss.alerts[over:]
+	}
+	return ss.save()
+}
+
+// sorted returns the saved searches oldest first; the caller must hold ss.mu
+func (ss *SavedSearchStore) sorted() []*storedSearch {
+	searches := make([]*storedSearch, 0, len(ss.searches))
+	for _, search := range ss.searches {
+		searches = append(searches, search)
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		if !searches[i].CreatedAt.Equal(searches[j].CreatedAt) {
+			return searches[i].CreatedAt.Before(searches[j].CreatedAt)
+		}
+		return searches[i].ID < searches[j].ID
+	})
+	return searches
+}
+
+// save writes the saved searches and alerts to the store's file, if it has one; the caller must hold ss.mu
+func (ss *SavedSearchStore) save() error {
+	if ss.path == "" {
+		return nil
+	}
+	file := savedSearchFile{Alerts: ss.alerts}
+	for _, search := range ss.sorted() {
+		file.Searches = append(file.Searches, *search)
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated file behind
+	tmp := ss.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing saved searches file: %w", err)
+	}
+	return os.Rename(tmp, ss.path)
+}
@@ -0,0 +1,182 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// SearchMonitor periodically re-evaluates saved searches with the analyzers and raises alerts
+// for the changes their rules ask for
+type SearchMonitor struct {
+	store          *SavedSearchStore
+	marketAnalyzer *MarketAnalyzer
+	cmaAnalyzer    *CMAAnalyzer
+	now            func() time.Time
+}
+
+// NewSearchMonitor creates a new SearchMonitor instance
+func NewSearchMonitor(store *SavedSearchStore, ma *MarketAnalyzer, ca *CMAAnalyzer) *SearchMonitor {
+	return &SearchMonitor{
+		store:          store,
+		marketAnalyzer: ma,
+		cmaAnalyzer:    ca,
+		now:            time.Now,
+	}
+}
+
+// Run evaluates the saved searches every interval until ctx is canceled
+func (sm *SearchMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failed evaluations are recorded on their searches and retried next time
+			_ = sm.Check(ctx)
+		}
+	}
+}
+
+// Check evaluates every saved search, storing its new baseline and alerts or its error. The
+// first evaluation of a search only sets its baseline.
+func (sm *SearchMonitor) Check(ctx context.Context) error {
+	var errs []error
+	for _, search := range sm.store.snapshot() {
+		alerts, baseline, err := sm.evaluate(ctx, search)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error evaluating saved search %s: %w", search.ID, err))
+		}
+		if err := sm.store.record(search.ID, baseline, alerts, err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate runs a saved search's query and compares the result with its baseline
+func (sm *SearchMonitor) evaluate(ctx context.Context, search storedSearch) ([]models.Alert, SearchBaseline, error) {
+	switch search.Type {
+	case models.SavedSearchTypeMarketTrends:
+		return sm.evaluateMarket(ctx, search)
+	case models.SavedSearchTypeCMA:
+		return sm.evaluateCMA(ctx, search)
+	}
+	return nil, search.Baseline, fmt.Errorf("unknown saved search type %s", search.Type)
+}
+
+// evaluateMarket alerts on median price moves and inventory jumps of a market-trends search
+func (sm *SearchMonitor) evaluateMarket(ctx context.Context, search storedSearch) ([]models.Alert, SearchBaseline, error) {
+	query := *search.MarketTrends
+	baseline := search.Baseline
+	var alerts []models.Alert
+
+	if threshold := search.Alerts.MedianPriceChange; threshold > 0 {
+		trends, err := sm.marketAnalyzer.GetMarketTrends(ctx, query)
+		if err != nil {
+			return nil, search.Baseline, err
+		}
+
+		current, reference := trends.MedianPrice, baseline.ReferenceMedianPrice
+		switch {
+		case current <= 0:
+			// No sales in the period to compare
+		case reference <= 0:
+			baseline.ReferenceMedianPrice = current
+		default:
+			change := float64(current-reference) / float64(reference)
+			if math.Abs(change) >= threshold {
+				direction := "rose"
+				if change < 0 {
+					direction = "fell"
+				}
+				alerts = append(alerts, models.Alert{
+					Type:          models.AlertMedianPriceChange,
+					Message:       fmt.Sprintf("Median price %s %.1f%% from $%d to $%d", direction, math.Abs(change)*100, reference, current),
+					PreviousValue: reference,
+					CurrentValue:  current,
+					Change:        math.Round(change*1000) / 1000,
+				})
+				baseline.ReferenceMedianPrice = current
+			}
+		}
+	}
+
+	if threshold := search.Alerts.InventoryChange; threshold > 0 {
+		current, err := sm.marketAnalyzer.ActiveInventory(ctx, query.Location, query.PropertyType)
+		if err != nil {
+			return nil, search.Baseline, err
+		}
+
+		previous := baseline.ActiveInventory
+		if baseline.Evaluated && previous > 0 {
+			change := float64(current-previous) / float64(previous)
+			if change >= threshold {
+				alerts = append(alerts, models.Alert{
+					Type:          models.AlertInventoryJump,
+					Message:       fmt.Sprintf("Active listings jumped %.1f%% from %d to %d", change*100, previous, current),
+					PreviousValue: previous,
+					CurrentValue:  current,
+					Change:        math.Round(change*1000) / 1000,
+				})
+			}
+		}
+		baseline.ActiveInventory = current
+	}
+
+	baseline.Evaluated = true
+	return alerts, baseline, nil
+}
+
+// evaluateCMA alerts on sales near a cma search's subject that closed since its previous
+// evaluation, whether or not they would be among the CMA's comparables
+func (sm *SearchMonitor) evaluateCMA(ctx context.Context, search storedSearch) ([]models.Alert, SearchBaseline, error) {
+	today := sm.now().UTC().Truncate(24 * time.Hour)
+	baseline := search.Baseline
+	since := today
+	if baseline.Evaluated && baseline.SalesSince != nil {
+		since = *baseline.SalesSince
+	}
+
+	subject, sales, err := sm.cmaAnalyzer.salesNear(ctx, *search.CMA, since)
+	if err != nil {
+		return nil, search.Baseline, err
+	}
+
+	var alerts []models.Alert
+	var seen []string
+	for _, sale := range sales {
+		if sale.ID == "" {
+			continue
+		}
+		// Sales before today won't be searched again, so only today's need to be remembered;
+		// sale dates are ISO dates, which sort as strings
+		if sale.SaleDate >= formatDate(today) {
+			seen = append(seen, sale.ID)
+		}
+		if !baseline.Evaluated || !search.Alerts.NewComparables || slices.Contains(baseline.SeenSales, sale.ID) {
+			continue
+		}
+
+		sale := sale
+		alerts = append(alerts, models.Alert{
+			Type:         models.AlertNewComparable,
+			Message:      fmt.Sprintf("New comparable sale at %s for $%d on %s, %.1f miles from %s", sale.Address, sale.SalePrice, sale.SaleDate, sale.DistanceMiles, ListingAddress(*subject)),
+			CurrentValue: sale.SalePrice,
+			Comparable:   &sale,
+		})
+	}
+
+	baseline.SalesSince = &today
+	baseline.SeenSales = seen
+	baseline.Evaluated = true
+	return alerts, baseline, nil
+}
@@ -0,0 +1,220 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func soldListing(id string, price int, saleDate time.Time) models.Listing {
+	return models.Listing{ID: id, Address: id + " Valencia St", City: "San Francisco", State: "CA",
+		Latitude: 37.7712, Longitude: -122.4210, Sqft: 1300, PropertyType: "Single-family",
+		Status: models.ListingStatusSold, SalePrice: price, SaleDate: saleDate}
+}
+
+func activeListing(id string) models.Listing {
+	return models.Listing{ID: id, Address: id + " Mission St", City: "San Francisco", State: "CA",
+		Sqft: 1300, PropertyType: "Single-family", Status: models.ListingStatusActive, ListPrice: 1200000}
+}
+
+func newTestSearchMonitor(t *testing.T, provider ListingProvider, path string) (*SearchMonitor, *SavedSearchStore) {
+	t.Helper()
+	store, err := NewSavedSearchStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	df := NewDataFetcher()
+	df.SetProvider(provider)
+	ma := NewMarketAnalyzer(df)
+	ma.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	monitor := NewSearchMonitor(store, ma, newTestCMAAnalyzer(df))
+	monitor.now = ma.now
+	return monitor, store
+}
+
+func TestSearchMonitorMarketAlerts(t *testing.T) {
+	provider := &staticProvider{listings: []models.Listing{
+		soldListing("A", 1000000, time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)),
+		activeListing("L1"),
+		activeListing("L2"),
+	}}
+	monitor, store := newTestSearchMonitor(t, provider, "")
+	search, err := store.Create(models.SavedSearchRequest{
+		Name:         "San Francisco",
+		Type:         models.SavedSearchTypeMarketTrends,
+		MarketTrends: &models.MarketTrendsRequest{Location: "San Francisco, CA", TimeRange: "6 months"},
+		Alerts:       models.AlertRules{MedianPriceChange: 0.05, InventoryChange: 0.25},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// The first evaluation only sets the baseline
+	if err := monitor.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if alerts := store.Alerts(AlertFilter{}); len(alerts) != 0 {
+		t.Fatalf("Expected no alerts after the first evaluation but got %+v", alerts)
+	}
+
+	provider.listings = append(provider.listings,
+		soldListing("B", 1200000, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)),
+		activeListing("L3"),
+	)
+	if err := monitor.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	alerts := store.Alerts(AlertFilter{SearchID: search.ID})
+	if len(alerts) != 2 {
+		t.Fatalf("Expected 2 alerts but got %+v", alerts)
+	}
+	byType := map[string]models.Alert{}
+	for _, alert := range alerts {
+		if alert.SearchName != "San Francisco" || alert.ID == "" {
+			t.Errorf("Expected an identified alert of the search but got %+v", alert)
+		}
+		byType[alert.Type] = alert
+	}
+	if alert := byType[models.AlertMedianPriceChange]; alert.PreviousValue != 1000000 || alert.Change != 0.1 {
+		t.Errorf("Expected a 10%% median price rise from 1000000 but got %+v", alert)
+	}
+	if alert := byType[models.AlertInventoryJump]; alert.PreviousValue != 2 || alert.CurrentValue != 3 || alert.Change != 0.5 {
+		t.Errorf("Expected an inventory jump from 2 to 3 but got %+v", alert)
+	}
+
+	// Unchanged results raise nothing new
+	if err := monitor.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if alerts := store.Alerts(AlertFilter{}); len(alerts) != 2 {
+		t.Errorf("Expected still 2 alerts but got %d", len(alerts))
+	}
+	if saved, _ := store.Get(search.ID); saved.LastEvaluatedAt == nil || saved.LastError != "" {
+		t.Errorf("Expected a successful evaluation time but got %+v", saved)
+	}
+}
+
+func TestSearchMonitorNewComparables(t *testing.T) {
+	// Close matches sold earlier in the year fill every comparable slot of the CMA
+	provider := &staticProvider{listings: []models.Listing{
+		{ID: "S1", Address: "100 Valencia St", Latitude: 37.7706, Longitude: -122.4222, Sqft: 1400, PropertyType: "Single-family"},
+	}}
+	for i := 1; i <= maxComparables; i++ {
+		provider.listings = append(provider.listings, soldListing(fmt.Sprintf("C%d", i), 1300000, time.Date(2024, 1, i, 0, 0, 0, 0, time.UTC)))
+	}
+	monitor, store := newTestSearchMonitor(t, provider, "")
+	search, _ := store.Create(models.SavedSearchRequest{
+		Name:   "100 Valencia",
+		Type:   models.SavedSearchTypeCMA,
+		CMA:    &models.CMARequest{PropertyID: "S1", Radius: 5},
+		Alerts: models.AlertRules{NewComparables: true},
+	})
+	_ = monitor.Check(context.Background())
+
+	// A sale too unlike the subject to be one of its comparables still sells nearby; one sells
+	// outside the radius
+	large := soldListing("L1", 2600000, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	large.Sqft = 3200
+	far := soldListing("F1", 1300000, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	far.Latitude = 37.90
+	provider.listings = append(provider.listings, large, far)
+	cma, _ := monitor.cmaAnalyzer.GetComparableProperties(context.Background(), *search.CMA)
+	if slices.ContainsFunc(cma.Comparables, func(c models.Comparable) bool { return c.ID == "L1" }) {
+		t.Fatalf("Expected L1 not to be among the CMA's comparables but got %+v", cma.Comparables)
+	}
+
+	monitor.now = func() time.Time { return time.Date(2024, 6, 2, 9, 0, 0, 0, time.UTC) }
+	if err := monitor.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	alerts := store.Alerts(AlertFilter{SearchID: search.ID})
+	if len(alerts) != 1 || alerts[0].Type != models.AlertNewComparable {
+		t.Fatalf("Expected one new comparable alert but got %+v", alerts)
+	}
+	if alerts[0].Comparable == nil || alerts[0].Comparable.ID != "L1" || alerts[0].CurrentValue != 2600000 {
+		t.Errorf("Expected the new sale L1 but got %+v", alerts[0])
+	}
+
+	// A sale closing today is reported once, although today's sales are searched again
+	provider.listings = append(provider.listings, soldListing("C7", 1350000, time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)))
+	_ = monitor.Check(context.Background())
+	_ = monitor.Check(context.Background())
+	alerts = store.Alerts(AlertFilter{SearchID: search.ID})
+	if len(alerts) != 2 || alerts[0].Comparable.ID != "C7" {
+		t.Fatalf("Expected C7 to be reported once but got %+v", alerts)
+	}
+
+	// The baseline keeps the day to search from and today's sales, not every sale ever seen
+	baseline := store.snapshot()[0].Baseline
+	if baseline.SalesSince == nil || !baseline.SalesSince.Equal(time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected sales to be searched from 2024-06-02 but got %v", baseline.SalesSince)
+	}
+	if len(baseline.SeenSales) != 1 || baseline.SeenSales[0] != "C7" {
+		t.Errorf("Expected only C7 to be remembered but got %v", baseline.SeenSales)
+	}
+
+	// A failing evaluation is recorded on the search
+	provider.err = errors.New("upstream down")
+	if err := monitor.Check(context.Background()); err == nil {
+		t.Error("Expected an evaluation error but got none")
+	}
+	if saved, _ := store.Get(search.ID); saved.LastError == "" {
+		t.Errorf("Expected the evaluation error on the search but got %+v", saved)
+	}
+}
+
+func TestSavedSearchStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "searches.json")
+	provider := &staticProvider{listings: []models.Listing{activeListing("L1")}}
+	monitor, store := newTestSearchMonitor(t, provider, path)
+
+	kept, _ := store.Create(models.SavedSearchRequest{
+		Name:         "Kept",
+		Type:         models.SavedSearchTypeMarketTrends,
+		MarketTrends: &models.MarketTrendsRequest{Location: "San Francisco, CA", TimeRange: "6 months"},
+		Alerts:       models.AlertRules{InventoryChange: 0.5},
+	})
+	deleted, _ := store.Create(models.SavedSearchRequest{
+		Name:         "Deleted",
+		Type:         models.SavedSearchTypeMarketTrends,
+		MarketTrends: &models.MarketTrendsRequest{Location: "Oakland, CA", TimeRange: "6 months"},
+		Alerts:       models.AlertRules{InventoryChange: 0.5},
+	})
+	_ = monitor.Check(context.Background())
+	provider.listings = append(provider.listings, activeListing("L2"))
+	_ = monitor.Check(context.Background())
+	if err := store.Delete(deleted.ID); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// After a restart, searches keep their baselines and the alerts feed is restored
+	restarted, err := NewSavedSearchStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	searches := restarted.List()
+	if len(searches) != 1 || searches[0].ID != kept.ID {
+		t.Fatalf("Expected only the kept search to be restored but got %+v", searches)
+	}
+	if alerts := restarted.Alerts(AlertFilter{}); len(alerts) != 1 || alerts[0].SearchID != kept.ID {
+		t.Errorf("Expected the inventory alert to be restored but got %+v", alerts)
+	}
+	if baseline := restarted.snapshot()[0].Baseline; !baseline.Evaluated || baseline.ActiveInventory != 2 {
+		t.Errorf("Expected the restored baseline to have 2 active listings but got %+v", baseline)
+	}
+	if _, err := restarted.Get(deleted.ID); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("Expected ErrSavedSearchNotFound but got %v", err)
+	}
+
+	since := time.Now().Add(time.Hour)
+	if alerts := restarted.Alerts(AlertFilter{Since: since}); len(alerts) != 0 {
+		t.Errorf("Expected no alerts after %s but got %d", since, len(alerts))
+	}
+}
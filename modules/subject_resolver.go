@@ -0,0 +1,256 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+const (
+	// addressSearchRadiusMiles is the radius searched around a located address for listings at that address
+	addressSearchRadiusMiles = 0.25
+
+	// locationMatchRadiusMiles is the distance within which a listing matches a bare latitude/longitude
+	locationMatchRadiusMiles = 0.02
+)
+
+// ErrIncompleteAddress is returned when an address can't be located without a city, ZIP code or coordinates
+var ErrIncompleteAddress = errors.New("address must include a city or ZIP code unless latitude and longitude are given")
+
+// ErrSubjectNotLocated is returned when an ad-hoc subject has no coordinates and its address can't be geocoded
+var ErrSubjectNotLocated = errors.New("subject has no coordinates and its address could not be geocoded")
+
+// AmbiguousSubjectError is returned when an address or location matches more than one property
+type AmbiguousSubjectError struct {
+	Candidates []models.Listing
+}
+
+func (e *AmbiguousSubjectError) Error() string {
+	return fmt.Sprintf("%d properties match the requested address or location", len(e.Candidates))
+}
+
+// resolveSubject finds the subject property of a CMA by property ID, address or coordinates, or
+// builds it from the attributes given in the request
+func (ca *CMAAnalyzer) resolveSubject(ctx context.Context, provider ListingProvider, req models.CMARequest) (*models.Listing, error) {
+	if req.Subject != nil {
+		return ca.subjectFromAttributes(ctx, *req.Subject)
+	}
+
+	var subject *models.Listing
+	var err error
+	if req.PropertyID != "" {
+		subject, err = provider.GetListing(ctx, req.PropertyID)
+	} else {
+		subject, err = ca.findSubject(ctx, provider, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Radius searches for comparables need the subject's location
+	if !hasCoordinates(*subject) && ca.geocoder != nil {
+		if result, err := ca.geocoder.Geocode(ctx, ListingAddress(*subject)); err == nil {
+			subject.Latitude, subject.Longitude = result.Latitude, result.Longitude
+		}
+	}
+	return subject, nil
+}
+
+// subjectFromAttributes builds the subject listing for a property that is not in the provider,
+// geocoding its address when no coordinates are given
+func (ca *CMAAnalyzer) subjectFromAttributes(ctx context.Context, s models.SubjectProperty) (*models.Listing, error) {
+	address := ParseAddress(s.Address)
+	if s.City != "" {
+		address.City = titleCase(s.City)
+	}
+	if s.State != "" {
+		address.State = strings.ToUpper(s.State)
+	}
+	if s.ZipCode != "" {
+		address.ZipCode = s.ZipCode
+	}
+
+	subject := &models.Listing{
+		Address:      address.Street(),
+		City:         address.City,
+		State:        address.State,
+		ZipCode:      address.ZipCode,
+		Latitude:     s.Latitude,
+		Longitude:    s.Longitude,
+		PropertyType: s.PropertyType,
+		Bedrooms:     s.Bedrooms,
+		Bathrooms:    s.Bathrooms,
+		Sqft:         s.Sqft,
+		LotSize:      s.LotSize,
+		YearBuilt:    s.YearBuilt,
+	}
+	for _, feature := range s.Features {
+		if feature = NormalizeFeature(feature); feature != "" {
+			subject.Features = append(subject.Features, feature)
+		}
+	}
+
+	if !hasCoordinates(*subject) {
+		if ca.geocoder == nil {
+			return nil, ErrSubjectNotLocated
+		}
+		result, err := ca.geocoder.Geocode(ctx, address)
+		if errors.Is(err, ErrAddressNotGeocoded) {
+			return nil, ErrSubjectNotLocated
+		}
+		if err != nil {
+			return nil, err
+		}
+		subject.Latitude, subject.Longitude = result.Latitude, result.Longitude
+	}
+	return subject, nil
+}
+
+// findSubject searches for the property at an address or coordinates. Records of the same property
+// are collapsed into its most recent one; when several properties match, an AmbiguousSubjectError
+// lists them.
+func (ca *CMAAnalyzer) findSubject(ctx context.Context, provider ListingProvider, req models.CMARequest) (*models.Listing, error) {
+	var address Address
+	if req.Address != "" {
+		address = ParseAddress(req.Address)
+	}
+
+	query, err := ca.subjectQuery(ctx, req, address)
+	if err != nil {
+		return nil, err
+	}
+	listings, err := provider.SearchListings(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group matching records by property
+	var keys []string
+	properties := make(map[string]models.Listing)
+	for _, l := range listings {
+		candidate := ListingAddress(l)
+		if req.Address != "" && !matchesAddress(address, candidate) {
+			continue
+		}
+
+		key := candidate.StreetKey() + "|" + candidate.Unit + "|" + zip5(candidate.ZipCode)
+		current, ok := properties[key]
+		if !ok {
+			keys = append(keys, key)
+		}
+		if !ok || moreRecent(l, current) {
+			properties[key] = l
+		}
+	}
+
+	switch len(keys) {
+	case 0:
+		return nil, ErrListingNotFound
+	case 1:
+		subject := properties[keys[0]]
+		return &subject, nil
+	}
+
+	sort.Strings(keys)
+	candidates := make([]models.Listing, 0, len(keys))
+	for _, key := range keys {
+		candidates = append(candidates, properties[key])
+	}
+	return nil, &AmbiguousSubjectError{Candidates: candidates}
+}
+
+// subjectQuery builds the search for listings at an address or coordinates. Given coordinates
+// are searched by radius, then the address's ZIP code. An address with only a city is located
+// with the geocoder so that the whole city isn't searched.
+func (ca *CMAAnalyzer) subjectQuery(ctx context.Context, req models.CMARequest, address Address) (models.ListingQuery, error) {
+	if req.Latitude != 0 || req.Longitude != 0 {
+		radius := locationMatchRadiusMiles
+		if req.Address != "" {
+			radius = addressSearchRadiusMiles
+		}
+		return models.ListingQuery{Latitude: req.Latitude, Longitude: req.Longitude, RadiusMiles: radius}, nil
+	}
+
+	if address.ZipCode != "" {
+		return models.ListingQuery{Location: zip5(address.ZipCode)}, nil
+	}
+	if address.City == "" {
+		return models.ListingQuery{}, ErrIncompleteAddress
+	}
+
+	if ca.geocoder != nil {
+		result, err := ca.geocoder.Geocode(ctx, address)
+		if err != nil && !errors.Is(err, ErrAddressNotGeocoded) {
+			return models.ListingQuery{}, err
+		}
+		if err == nil && result.Precision == GeocodePrecisionAddress {
+			return models.ListingQuery{
+				Latitude:    result.Latitude,
+				Longitude:   result.Longitude,
+				RadiusMiles: addressSearchRadiusMiles,
+			}, nil
+		}
+	}
+
+	if address.State != "" {
+		return models.ListingQuery{Location: address.City + ", " + address.State}, nil
+	}
+	return models.ListingQuery{Location: address.City}, nil
+}
+
+// matchesAddress reports whether a listing's address is the requested one; the unit, city and
+// ZIP code are only compared when both sides have them
+func matchesAddress(requested, candidate Address) bool {
+	if requested.StreetKey() != candidate.StreetKey() {
+		return false
+	}
+	if requested.Unit != "" && requested.Unit != candidate.Unit {
+		return false
+	}
+	if requested.ZipCode != "" && candidate.ZipCode != "" && zip5(requested.ZipCode) != zip5(candidate.ZipCode) {
+		return false
+	}
+	if requested.City != "" && candidate.City != "" && !strings.EqualFold(requested.City, candidate.City) {
+		return false
+	}
+	return true
+}
+
+// zip5 returns the 5-digit part of a ZIP or ZIP+4 code
+func zip5(zip string) string {
+	base, _, _ := strings.Cut(zip, "-")
+	return base
+}
+
+// moreRecent reports whether listing a is a more recent record of a property than b: current
+// listings before sold ones, then by latest list or sale date
+func moreRecent(a, b models.Listing) bool {
+	aCurrent := a.Status != models.ListingStatusSold
+	bCurrent := b.Status != models.ListingStatusSold
+	if aCurrent != bCurrent {
+		return aCurrent
+	}
+	return latestDate(a).After(latestDate(b))
+}
+
+// latestDate returns the later of a listing's list and sale dates
+func latestDate(l models.Listing) time.Time {
+	if l.SaleDate.After(l.ListDate) {
+		return l.SaleDate
+	}
+	return l.ListDate
+}
+
+// ListingAddress returns the parsed address of a listing, including its city, state and ZIP code
+func ListingAddress(l models.Listing) Address {
+	address := ParseAddress(l.Address)
+	address.City = titleCase(l.City)
+	address.State = strings.ToUpper(l.State)
+	address.ZipCode = l.ZipCode
+	return address
+}
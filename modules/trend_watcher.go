@@ -0,0 +1,87 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// watchTimeRange is the time range the trend of a watched location is classified over, the
+// same as the /market-trends default
+const watchTimeRange = "6 months"
+
+// TrendWatcher periodically classifies the market trend of the locations webhooks watch and
+// publishes a market.trend_changed event when a location's classification changes
+type TrendWatcher struct {
+	marketAnalyzer *MarketAnalyzer
+	webhooks       *WebhookDispatcher
+
+	mu     sync.Mutex
+	trends map[string]string
+}
+
+// NewTrendWatcher creates a new TrendWatcher instance
+func NewTrendWatcher(ma *MarketAnalyzer, wd *WebhookDispatcher) *TrendWatcher {
+	return &TrendWatcher{
+		marketAnalyzer: ma,
+		webhooks:       wd,
+		trends:         make(map[string]string),
+	}
+}
+
+// Run checks the watched locations every interval until ctx is canceled
+func (tw *TrendWatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Locations that fail keep their last trend and are checked again next time
+			_ = tw.Check(ctx)
+		}
+	}
+}
+
+// Check classifies the market trend of every watched location and publishes a change for each
+// location whose trend differs from the last check. The first check of a location only records
+// its trend.
+func (tw *TrendWatcher) Check(ctx context.Context) error {
+	var errs []error
+	for _, location := range tw.webhooks.WatchedLocations() {
+		trends, err := tw.marketAnalyzer.GetMarketTrends(ctx, models.MarketTrendsRequest{
+			Location:  location,
+			TimeRange: watchTimeRange,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error checking the market trend of %s: %w", location, err))
+			continue
+		}
+
+		key := strings.ToLower(location)
+		tw.mu.Lock()
+		previous, seen := tw.trends[key]
+		tw.trends[key] = trends.Trend
+		tw.mu.Unlock()
+
+		if seen && previous != trends.Trend {
+			err := tw.webhooks.Publish(models.EventMarketTrendChange, location, models.TrendChange{
+				Location:      location,
+				PreviousTrend: previous,
+				Trend:         trends.Trend,
+				Trends:        trends,
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StoredResponse is an upstream response body kept with its cache validators so it can be
+// revalidated with a conditional request
+type StoredResponse struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// ValidatorStore persists upstream responses for ETag and Last-Modified revalidation in a local directory
+type ValidatorStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewValidatorStore creates a new ValidatorStore writing to dir, creating it if necessary
+func NewValidatorStore(dir string) (*ValidatorStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating validator store directory: %w", err)
+	}
+	return &ValidatorStore{dir: dir}, nil
+}
+
+// Get returns the stored response for a URL, if any
+func (vs *ValidatorStore) Get(url string) (*StoredResponse, bool) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	data, err := os.ReadFile(vs.path(url))
+	if err != nil {
+		return nil, false
+	}
+
+	var stored StoredResponse
+	if err := json.Unmarshal(data, &stored); err != nil || stored.URL != url {
+		return nil, false
+	}
+	return &stored, true
+}
+
+// Put stores a response for a URL, replacing any previous one
+func (vs *ValidatorStore) Put(stored StoredResponse) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	// Write to a temporary file first so a crash never leaves a truncated entry behind
+	path := vs.path(stored.URL)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing validator store entry: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// path returns the file holding the stored response for a URL
+func (vs *ValidatorStore) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(vs.dir, hex.EncodeToString(sum[:])+".json")
+}
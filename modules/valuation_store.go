@@ -0,0 +1,226 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// maxValuationsPerProperty is the number of most recent valuations kept in memory for a property
+const maxValuationsPerProperty = 1000
+
+// valuationRecord is a recorded valuation as written to the valuations file, one per line
+type valuationRecord struct {
+	PropertyID string `json:"property_id"`
+	Address    string `json:"address,omitempty"`
+	models.Valuation
+}
+
+// ValuationStore records the estimated value of every CMA computed for a property so its value
+// can be followed over time. With a file path, valuations are appended to the file and loaded
+// from it on startup.
+type ValuationStore struct {
+	now func() time.Time
+
+	mu         sync.Mutex
+	file       *os.File
+	valuations map[string][]valuationRecord
+}
+
+// NewValuationStore creates a new ValuationStore, loading the valuations recorded in path if it
+// exists; an empty path keeps valuations in memory only
+func NewValuationStore(path string) (*ValuationStore, error) {
+	store := &ValuationStore{
+		now:        time.Now,
+		valuations: make(map[string][]valuationRecord),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading valuations file: %w", err)
+	}
+	complete, err := store.load(data)
+	if err != nil {
+		return nil, err
+	}
+	if complete < len(data) {
+		// Drop the incomplete record so the next one starts on a line of its own
+		if err := os.Truncate(path, int64(complete)); err != nil {
+			return nil, fmt.Errorf("error repairing valuations file: %w", err)
+		}
+	}
+
+	store.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening valuations file: %w", err)
+	}
+	return store, nil
+}
+
+// Record stores the estimated value of a current CMA. CMAs of subjects that aren't listed
+// properties, retroactive CMAs and CMAs whose comparables were chosen or supplied by the caller
+// are not recorded, so the history only follows the analyzer's own valuations.
+func (vs *ValuationStore) Record(req models.CMARequest, cma *models.CMAResponse) error {
+	if cma.PropertyID == "" || cma.AsOf != "" || overridesComparables(req) {
+		return nil
+	}
+
+	valuedAt := vs.now().UTC()
+	record := valuationRecord{
+		PropertyID: cma.PropertyID,
+		Address:    cma.Address,
+		Valuation: models.Valuation{
+			AsOf:           valuedAt.Format(asOfLayout),
+			ValuedAt:       valuedAt,
+			EstimatedValue: cma.EstimatedValue,
+			Comparables:    len(cma.Comparables),
+		},
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.file != nil {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := vs.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("error writing valuations file: %w", err)
+		}
+	}
+	vs.add(record)
+	return nil
+}
+
+// Retroactive returns the valuation of a retroactive CMA, valued now. It isn't recorded: a
+// retroactive valuation is recomputed whenever it is asked for.
+func (vs *ValuationStore) Retroactive(cma *models.CMAResponse) models.Valuation {
+	return models.Valuation{
+		AsOf:           cma.AsOf,
+		ValuedAt:       vs.now().UTC(),
+		EstimatedValue: cma.EstimatedValue,
+		Comparables:    len(cma.Comparables),
+		Retroactive:    true,
+	}
+}
+
+// History returns the recorded valuations of a property, oldest first, and its last recorded
+// address
+func (vs *ValuationStore) History(propertyID string) ([]models.Valuation, string) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	records := vs.valuations[propertyID]
+	valuations := make([]models.Valuation, 0, len(records))
+	var address string
+	for _, record := range records {
+		valuations = append(valuations, record.Valuation)
+		if record.Address != "" {
+			address = record.Address
+		}
+	}
+	return valuations, address
+}
+
+// Close closes the valuations file
+func (vs *ValuationStore) Close() error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.file == nil {
+		return nil
+	}
+	err := vs.file.Close()
+	vs.file = nil
+	return err
+}
+
+// load reads the valuations recorded in a valuations file, returning the length of the complete
+// records read
+func (vs *ValuationStore) load(data []byte) (int, error) {
+	// Every record ends with a newline, so only a crash while appending leaves text after the last one
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	for i, text := range bytes.Split(data[:complete], []byte("\n")) {
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		var record valuationRecord
+		if err := json.Unmarshal(text, &record); err != nil {
+			return 0, fmt.Errorf("error parsing valuations file on line %d: %w", i+1, err)
+		}
+		vs.add(record)
+	}
+	return complete, nil
+}
+
+// add appends a valuation to its property's history; the caller must hold vs.mu. Property IDs
+// are kept as given since providers may tell IDs apart by case.
+func (vs *ValuationStore) add(record valuationRecord) {
+	records := append(vs.valuations[record.PropertyID], record)
+	if over := len(records) - maxValuationsPerProperty; over > 0 {
+		records = records[over:]
+	}
+	vs.valuations[record.PropertyID] = records
+}
+
+// overridesComparables reports whether a CMA request changes which comparables are used: pinned,
+// excluded or supplied comparables, or sale conditions other than standard sales
+func overridesComparables(req models.CMARequest) bool {
+	if len(req.IncludeIDs) > 0 || len(req.ExcludeIDs) > 0 || len(req.Comparables) > 0 {
+		return true
+	}
+	for _, condition := range req.SaleConditions {
+		if !strings.EqualFold(condition, models.SaleConditionStandard) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValuationTimeline orders valuations by their as-of date, then by when they were computed, and
+// fills in the change of each from the one before it
+func ValuationTimeline(propertyID, address string, valuations []models.Valuation) models.ValuationHistory {
+	sort.SliceStable(valuations, func(i, j int) bool {
+		if valuations[i].AsOf != valuations[j].AsOf {
+			return valuations[i].AsOf < valuations[j].AsOf
+		}
+		return valuations[i].ValuedAt.Before(valuations[j].ValuedAt)
+	})
+
+	history := models.ValuationHistory{
+		PropertyID: propertyID,
+		Address:    address,
+		Valuations: valuations,
+	}
+	for i := range valuations {
+		valuations[i].Change, valuations[i].RelativeChange = 0, 0
+		if i > 0 {
+			valuations[i].Change, valuations[i].RelativeChange = valueChange(valuations[i-1].EstimatedValue, valuations[i].EstimatedValue)
+		}
+	}
+	if n := len(valuations); n > 1 {
+		history.TotalChange, history.TotalRelativeChange = valueChange(valuations[0].EstimatedValue, valuations[n-1].EstimatedValue)
+	}
+	return history
+}
+
+// valueChange returns the change from one estimated value to another, absolute and relative to
+// the first rounded to 3 decimals
+func valueChange(from, to int) (int, float64) {
+	change := to - from
+	if from == 0 {
+		return change, 0
+	}
+	return change, math.Round(float64(change)/float64(from)*1000) / 1000
+}
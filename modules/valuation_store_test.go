@@ -0,0 +1,121 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+func TestValuationStoreRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valuations.ndjson")
+	store, err := NewValuationStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	day := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return day }
+
+	for _, tc := range []struct {
+		req models.CMARequest
+		cma *models.CMAResponse
+	}{
+		{models.CMARequest{PropertyID: "S1"}, &models.CMAResponse{PropertyID: "S1", Address: "100 Valencia St", EstimatedValue: 1100000, Comparables: make([]models.Comparable, 4)}},
+		{models.CMARequest{PropertyID: "S2", SaleConditions: []string{"standard"}}, &models.CMAResponse{PropertyID: "S2", EstimatedValue: 900000}},
+		// Ad hoc subjects, retroactive CMAs and CMAs with the caller's own comparables are not recorded
+		{models.CMARequest{}, &models.CMAResponse{EstimatedValue: 800000}},
+		{models.CMARequest{PropertyID: "S1", AsOf: "2024-01-01"}, &models.CMAResponse{PropertyID: "S1", EstimatedValue: 1000000, AsOf: "2024-01-01"}},
+		{models.CMARequest{PropertyID: "S1", IncludeIDs: []string{"C9"}}, &models.CMAResponse{PropertyID: "S1", EstimatedValue: 1500000}},
+		{models.CMARequest{PropertyID: "S1", ExcludeIDs: []string{"C1"}}, &models.CMAResponse{PropertyID: "S1", EstimatedValue: 1500000}},
+		{models.CMARequest{PropertyID: "S1", SaleConditions: []string{"all"}}, &models.CMAResponse{PropertyID: "S1", EstimatedValue: 700000}},
+		{models.CMARequest{PropertyID: "S1", Comparables: []models.Comparable{{Address: "1 Main St", SalePrice: 2000000}}}, &models.CMAResponse{PropertyID: "S1", EstimatedValue: 2000000}},
+	} {
+		if err := store.Record(tc.req, tc.cma); err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+	}
+	day = day.AddDate(0, 1, 0)
+	_ = store.Record(models.CMARequest{PropertyID: "S1"}, &models.CMAResponse{PropertyID: "S1", Address: "100 Valencia St", EstimatedValue: 1155000})
+
+	// Property IDs that differ only by case are different properties
+	if valuations, _ := store.History("s1"); len(valuations) != 0 {
+		t.Errorf("Expected no valuations of s1 but got %+v", valuations)
+	}
+	valuations, address := store.History("S1")
+	if len(valuations) != 2 || address != "100 Valencia St" {
+		t.Fatalf("Expected 2 valuations of 100 Valencia St but got %+v at %q", valuations, address)
+	}
+	if valuations[0].AsOf != "2024-06-01" || valuations[0].Comparables != 4 || valuations[1].AsOf != "2024-07-01" {
+		t.Errorf("Expected valuations as of 2024-06-01 and 2024-07-01 but got %+v", valuations)
+	}
+
+	// A retroactive valuation is valued on the store's clock and not recorded
+	retroactive := store.Retroactive(&models.CMAResponse{PropertyID: "S1", EstimatedValue: 1000000, AsOf: "2024-01-01", Comparables: make([]models.Comparable, 3)})
+	if !retroactive.Retroactive || retroactive.AsOf != "2024-01-01" || !retroactive.ValuedAt.Equal(day) || retroactive.Comparables != 3 {
+		t.Errorf("Expected a retroactive valuation as of 2024-01-01 valued at %s but got %+v", day, retroactive)
+	}
+	if valuations, _ := store.History("S1"); len(valuations) != 2 {
+		t.Errorf("Expected still 2 valuations of S1 but got %d", len(valuations))
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// A record cut short by a crash is dropped on restart, and later records are appended after it
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	_, _ = file.WriteString(`{"property_id":"S1","estim`)
+	file.Close()
+
+	restarted, err := NewValuationStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	_ = restarted.Record(models.CMARequest{PropertyID: "S2"}, &models.CMAResponse{PropertyID: "S2", EstimatedValue: 920000})
+	restarted.Close()
+
+	reloaded, err := NewValuationStore(path)
+	if err != nil {
+		t.Fatalf("Expected the repaired file to load but got: %v", err)
+	}
+	defer reloaded.Close()
+	if valuations, _ := reloaded.History("S1"); len(valuations) != 2 || valuations[1].EstimatedValue != 1155000 {
+		t.Errorf("Expected the 2 valuations of S1 to be restored but got %+v", valuations)
+	}
+	if valuations, _ := reloaded.History("S2"); len(valuations) != 2 {
+		t.Errorf("Expected 2 valuations of S2 but got %+v", valuations)
+	}
+}
+
+func TestValuationTimeline(t *testing.T) {
+	valued := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	history := ValuationTimeline("S1", "100 Valencia St", []models.Valuation{
+		{AsOf: "2024-06-01", ValuedAt: valued, EstimatedValue: 1100000},
+		{AsOf: "2024-01-01", ValuedAt: valued.Add(time.Minute), EstimatedValue: 1000000, Retroactive: true},
+		{AsOf: "2024-06-01", ValuedAt: valued.Add(time.Hour), EstimatedValue: 1155000},
+	})
+
+	expected := []struct {
+		asOf   string
+		value  int
+		change int
+		rate   float64
+	}{
+		{"2024-01-01", 1000000, 0, 0},
+		{"2024-06-01", 1100000, 100000, 0.1},
+		{"2024-06-01", 1155000, 55000, 0.05},
+	}
+	if len(history.Valuations) != len(expected) {
+		t.Fatalf("Expected %d valuations but got %d", len(expected), len(history.Valuations))
+	}
+	for i, e := range expected {
+		v := history.Valuations[i]
+		if v.AsOf != e.asOf || v.EstimatedValue != e.value || v.Change != e.change || v.RelativeChange != e.rate {
+			t.Errorf("Expected valuation %d to be %+v but got %+v", i, e, v)
+		}
+	}
+	if history.TotalChange != 155000 || history.TotalRelativeChange != 0.155 {
+		t.Errorf("Expected a total change of 155000 (0.155) but got %d (%v)", history.TotalChange, history.TotalRelativeChange)
+	}
+}
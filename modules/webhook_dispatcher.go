@@ -0,0 +1,516 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookEventHeader     = "X-CMA-Event"
+	WebhookDeliveryHeader  = "X-CMA-Delivery"
+	WebhookTimestampHeader = "X-CMA-Timestamp"
+	WebhookSignatureHeader = "X-CMA-Signature"
+)
+
+var (
+	// ErrWebhookNotFound is returned when a webhook is unknown or has been deleted
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrDeliveryNotFound is returned when a delivery is unknown or has left the delivery log
+	ErrDeliveryNotFound = errors.New("delivery not found")
+
+	// ErrPrivateAddress is returned when a webhook URL points to a loopback, private or link-local
+	// address and private networks aren't allowed
+	ErrPrivateAddress = errors.New("webhook URL points to a loopback, private or link-local address")
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which IsPrivate doesn't cover
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// WebhookConfig configures a WebhookDispatcher
+type WebhookConfig struct {
+	// Timeout for a single delivery attempt
+	Timeout time.Duration
+
+	// Attempts made to deliver an event before giving up
+	MaxAttempts int
+
+	// Initial and maximum backoff between attempts; each retry waits a random duration up to
+	// BaseBackoff * 2^attempt, capped at MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Number of deliveries kept in the delivery log
+	LogSize int
+
+	// Whether deliveries may go to loopback, private and link-local addresses. Off by default so
+	// webhooks can't be used to reach the server's own network or a cloud metadata service.
+	AllowPrivateNetworks bool
+
+	// JSON file webhooks are persisted to so they survive a restart; empty keeps them in memory
+	// only. The delivery log is always kept in memory.
+	Path string
+}
+
+// DefaultWebhookConfig returns the default webhook configuration
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  5 * time.Minute,
+		LogSize:     1000,
+	}
+}
+
+// SignWebhookPayload returns the signature of a webhook payload sent at a Unix timestamp: the
+// hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with the webhook's secret, prefixed with
+// "sha256=". Receivers recompute it to check a delivery came from this server and reject old
+// timestamps to prevent replays.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher keeps the registered webhooks and delivers events to them in the background,
+// retrying failed deliveries with backoff and logging every delivery
+type WebhookDispatcher struct {
+	config WebhookConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu         sync.Mutex
+	webhooks   map[string]models.Webhook
+	deliveries []*models.WebhookDelivery
+	closed     bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewWebhookDispatcher creates a new WebhookDispatcher instance, loading the webhooks persisted
+// in cfg.Path if it exists
+func NewWebhookDispatcher(cfg WebhookConfig) (*WebhookDispatcher, error) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	wd := &WebhookDispatcher{
+		config:   cfg,
+		client:   &http.Client{Timeout: cfg.Timeout, Transport: webhookTransport(cfg.AllowPrivateNetworks)},
+		now:      time.Now,
+		webhooks: make(map[string]models.Webhook),
+	}
+	if cfg.Path != "" {
+		data, err := os.ReadFile(cfg.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error reading webhooks file: %w", err)
+		}
+		if err == nil {
+			var webhooks []models.Webhook
+			if err := json.Unmarshal(data, &webhooks); err != nil {
+				return nil, fmt.Errorf("error parsing webhooks file: %w", err)
+			}
+			for _, webhook := range webhooks {
+				wd.webhooks[webhook.ID] = webhook
+			}
+		}
+	}
+	wd.ctx, wd.cancel = context.WithCancel(context.Background())
+	return wd, nil
+}
+
+// webhookTransport returns the transport deliveries are sent with. Unless private networks are
+// allowed, every connection, including those of redirects, is checked against the address it
+// actually dials, so a host name resolving to a private address is refused too.
+func webhookTransport(allowPrivate bool) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if allowPrivate {
+		return transport
+	}
+	// A proxy would make the request on the server's behalf, out of reach of the dial check
+	transport.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if IsPrivateAddress(addr.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, addr.Addr())
+			}
+			return nil
+		},
+	}
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// IsPrivateAddress reports whether an address is loopback, private, link-local, multicast,
+// unspecified or in the carrier-grade NAT range
+func IsPrivateAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL returns ErrPrivateAddress when private networks aren't allowed and a webhook URL's
+// host is localhost or a private IP address. Host names are checked again against the
+// addresses they resolve to on every delivery.
+func (wd *WebhookDispatcher) CheckURL(rawURL string) error {
+	if wd.config.AllowPrivateNetworks {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && IsPrivateAddress(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// Close stops retrying deliveries and waits for attempts in flight. Events published after Close
+// are dropped.
+func (wd *WebhookDispatcher) Close() {
+	wd.mu.Lock()
+	wd.closed = true
+	wd.mu.Unlock()
+	wd.cancel()
+	wd.wg.Wait()
+}
+
+// Register adds a webhook, generating its secret when the request has none. The returned
+// webhook is the only one that includes the secret.
+func (wd *WebhookDispatcher) Register(req models.WebhookRequest) (models.Webhook, error) {
+	webhook := models.Webhook{
+		ID:        newID(),
+		URL:       req.URL,
+		Events:    req.Events,
+		Locations: req.Locations,
+		Secret:    req.Secret,
+		CreatedAt: wd.now().UTC(),
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = newID() + newID()
+	}
+
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.webhooks[webhook.ID] = webhook
+	if err := wd.save(); err != nil {
+		delete(wd.webhooks, webhook.ID)
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Webhooks returns the registered webhooks, oldest first, without their secrets
+func (wd *WebhookDispatcher) Webhooks() []models.Webhook {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	webhooks := make([]models.Webhook, 0, len(wd.webhooks))
+	for _, webhook := range wd.webhooks {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks
+}
+
+// Get returns a webhook without its secret
+func (wd *WebhookDispatcher) Get(id string) (models.Webhook, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	webhook, ok := wd.webhooks[id]
+	if !ok {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// Delete removes a webhook; deliveries in progress to it stop retrying
+func (wd *WebhookDispatcher) Delete(id string) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	webhook, ok := wd.webhooks[id]
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	delete(wd.webhooks, id)
+	if err := wd.save(); err != nil {
+		wd.webhooks[id] = webhook
+		return err
+	}
+	return nil
+}
+
+// save writes the webhooks, oldest first, to the webhooks file if there is one; the caller must
+// hold wd.mu
+func (wd *WebhookDispatcher) save() error {
+	if wd.config.Path == "" {
+		return nil
+	}
+	webhooks := make([]models.Webhook, 0, len(wd.webhooks))
+	for _, webhook := range wd.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	data, err := json.Marshal(webhooks)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated file behind. The file
+	// holds the webhooks' signing secrets, so only the owner may read it.
+	tmp := wd.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing webhooks file: %w", err)
+	}
+	return os.Rename(tmp, wd.config.Path)
+}
+
+// WatchedLocations returns the locations watched for market.trend_changed by any webhook
+func (wd *WebhookDispatcher) WatchedLocations() []string {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var locations []string
+	for _, webhook := range wd.webhooks {
+		if !slices.Contains(webhook.Events, models.EventMarketTrendChange) {
+			continue
+		}
+		for _, location := range webhook.Locations {
+			key := strings.ToLower(location)
+			if !seen[key] {
+				seen[key] = true
+				locations = append(locations, location)
+			}
+		}
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+// Publish delivers an event to every webhook subscribed to its type. When location is set, only
+// webhooks watching that location receive it.
+func (wd *WebhookDispatcher) Publish(eventType, location string, data interface{}) error {
+	event := models.WebhookEvent{
+		ID:        newID(),
+		Type:      eventType,
+		CreatedAt: wd.now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook event: %w", err)
+	}
+
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if wd.closed {
+		return nil
+	}
+	for _, webhook := range wd.webhooks {
+		if !slices.Contains(webhook.Events, eventType) {
+			continue
+		}
+		if location != "" && !slices.ContainsFunc(webhook.Locations, func(l string) bool {
+			return strings.EqualFold(l, location)
+		}) {
+			continue
+		}
+		wd.deliver(webhook, &models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			Event:     eventType,
+			Payload:   payload,
+		})
+	}
+	return nil
+}
+
+// Deliveries returns the logged deliveries to a webhook, newest first
+func (wd *WebhookDispatcher) Deliveries(webhookID string) ([]models.WebhookDelivery, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	if _, ok := wd.webhooks[webhookID]; !ok {
+		return nil, ErrWebhookNotFound
+	}
+	deliveries := []models.WebhookDelivery{}
+	for i := len(wd.deliveries) - 1; i >= 0; i-- {
+		if wd.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, *wd.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends the payload of a logged delivery to its webhook again, as a new delivery
+func (wd *WebhookDispatcher) Redeliver(webhookID, deliveryID string) (models.WebhookDelivery, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	webhook, ok := wd.webhooks[webhookID]
+	if !ok {
+		return models.WebhookDelivery{}, ErrWebhookNotFound
+	}
+	i := slices.IndexFunc(wd.deliveries, func(d *models.WebhookDelivery) bool {
+		return d.ID == deliveryID && d.WebhookID == webhookID
+	})
+	if i < 0 {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	original := wd.deliveries[i]
+	delivery := &models.WebhookDelivery{
+		WebhookID:    webhookID,
+		EventID:      original.EventID,
+		Event:        original.Event,
+		Payload:      original.Payload,
+		RedeliveryOf: original.ID,
+	}
+	wd.deliver(webhook, delivery)
+	return *delivery, nil
+}
+
+// deliver logs a delivery and sends it in the background; the caller must hold wd.mu
+func (wd *WebhookDispatcher) deliver(webhook models.Webhook, delivery *models.WebhookDelivery) {
+	delivery.ID = newID()
+	delivery.Status = models.DeliveryStatusPending
+	delivery.CreatedAt = wd.now().UTC()
+
+	wd.deliveries = append(wd.deliveries, delivery)
+	if over := len(wd.deliveries) - max(wd.config.LogSize, 1); over > 0 {
+		wd.deliveries = slices.Delete(wd.deliveries, 0, over)
+	}
+
+	// Close waits for the attempts in flight, so none may start once it has been called
+	if wd.closed {
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.Error = "delivery stopped on shutdown"
+		return
+	}
+	wd.wg.Add(1)
+	go func() {
+		defer wd.wg.Done()
+		wd.attempt(webhook, delivery)
+	}()
+}
+
+// attempt sends a delivery until the receiver accepts it or the attempts run out
+func (wd *WebhookDispatcher) attempt(webhook models.Webhook, delivery *models.WebhookDelivery) {
+	for attempt := 0; attempt < wd.config.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(wd.ctx, jitteredBackoff(wd.config.BaseBackoff, wd.config.MaxBackoff, attempt-1)); err != nil {
+				wd.giveUp(delivery, "delivery stopped on shutdown")
+				return
+			}
+			if _, err := wd.Get(webhook.ID); err != nil {
+				wd.giveUp(delivery, "webhook was deleted")
+				return
+			}
+		}
+
+		statusCode, err := wd.send(webhook, delivery)
+		if err == nil {
+			wd.record(delivery, models.DeliveryStatusSucceeded, statusCode, "")
+			return
+		}
+		status := models.DeliveryStatusPending
+		if attempt == wd.config.MaxAttempts-1 {
+			status = models.DeliveryStatusFailed
+		}
+		wd.record(delivery, status, statusCode, err.Error())
+	}
+}
+
+// send POSTs a delivery's payload, signed with the webhook's secret, returning the receiver's
+// status code; any status other than 2xx is an error
+func (wd *WebhookDispatcher) send(webhook models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(wd.ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := wd.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// record updates a delivery with the outcome of an attempt
+func (wd *WebhookDispatcher) record(delivery *models.WebhookDelivery, status string, statusCode int, message string) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	attempted := wd.now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &attempted
+	delivery.Status = status
+	delivery.StatusCode = statusCode
+	delivery.Error = message
+}
+
+// giveUp marks a delivery as failed without another attempt
+func (wd *WebhookDispatcher) giveUp(delivery *models.WebhookDelivery, message string) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	delivery.Status = models.DeliveryStatusFailed
+	delivery.Error = message
+}
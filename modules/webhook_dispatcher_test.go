@@ -0,0 +1,401 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/cma/models"
+)
+
+// webhookReceiver is a local webhook endpoint that checks signatures and answers with queued
+// status codes, then 200
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	events   []models.WebhookEvent
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		wr.t.Errorf("Expected a Unix timestamp header but got %q", r.Header.Get(WebhookTimestampHeader))
+	}
+	if got, want := r.Header.Get(WebhookSignatureHeader), SignWebhookPayload(wr.secret, timestamp, body); got != want {
+		wr.t.Errorf("Expected signature %s but got %s", want, got)
+	}
+	if r.Header.Get(WebhookDeliveryHeader) == "" {
+		wr.t.Error("Expected a delivery header but got none")
+	}
+
+	var event models.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		wr.t.Errorf("Expected a JSON event but got: %v", err)
+	}
+	if r.Header.Get(WebhookEventHeader) != event.Type {
+		wr.t.Errorf("Expected event header %s but got %s", event.Type, r.Header.Get(WebhookEventHeader))
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	status := http.StatusOK
+	if len(wr.statuses) > 0 {
+		status, wr.statuses = wr.statuses[0], wr.statuses[1:]
+	}
+	if status == http.StatusOK {
+		wr.events = append(wr.events, event)
+	}
+	w.WriteHeader(status)
+}
+
+func (wr *webhookReceiver) received() []models.WebhookEvent {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return append([]models.WebhookEvent(nil), wr.events...)
+}
+
+// waitForDelivery polls a webhook's latest delivery until it is no longer pending
+func waitForDelivery(t *testing.T, wd *WebhookDispatcher, webhookID string) models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := wd.Deliveries(webhookID)
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if len(deliveries) > 0 && deliveries[0].Status != models.DeliveryStatusPending {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a finished delivery but got %+v", deliveries)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestWebhookDispatcher(t *testing.T, maxAttempts int) *WebhookDispatcher {
+	cfg := DefaultWebhookConfig()
+	cfg.MaxAttempts = maxAttempts
+	cfg.BaseBackoff = time.Millisecond
+	cfg.MaxBackoff = 5 * time.Millisecond
+	// Test receivers listen on loopback
+	cfg.AllowPrivateNetworks = true
+	wd, _ := NewWebhookDispatcher(cfg)
+	t.Cleanup(wd.Close)
+	return wd
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	receiver := &webhookReceiver{t: t, secret: "0123456789abcdef", statuses: []int{503, 500}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	wd := newTestWebhookDispatcher(t, 3)
+	webhook, _ := wd.Register(models.WebhookRequest{
+		URL:    server.URL,
+		Events: []string{models.EventJobFinished},
+		Secret: receiver.secret,
+	})
+
+	job := models.Job{ID: "job1", Type: models.JobTypeCMABatch, Status: models.JobStatusSucceeded}
+	if err := wd.Publish(models.EventJobFinished, "", job); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// The first two attempts fail and are retried
+	delivery := waitForDelivery(t, wd, webhook.ID)
+	if delivery.Status != models.DeliveryStatusSucceeded || delivery.Attempts != 3 || delivery.StatusCode != 200 {
+		t.Errorf("Expected a delivery succeeding on the third attempt but got %+v", delivery)
+	}
+	events := receiver.received()
+	if len(events) != 1 || events[0].Type != models.EventJobFinished || events[0].ID != delivery.EventID {
+		t.Fatalf("Expected one job.finished event but got %+v", events)
+	}
+	data, _ := json.Marshal(events[0].Data)
+	var received models.Job
+	if err := json.Unmarshal(data, &received); err != nil || received.ID != "job1" {
+		t.Errorf("Expected the finished job in the event but got %s", data)
+	}
+}
+
+func TestWebhookRedelivery(t *testing.T) {
+	receiver := &webhookReceiver{t: t, statuses: []int{500, 500}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	wd := newTestWebhookDispatcher(t, 2)
+	webhook, _ := wd.Register(models.WebhookRequest{URL: server.URL, Events: []string{models.EventJobFinished}})
+	if webhook.Secret == "" {
+		t.Fatal("Expected a generated secret but got none")
+	}
+	receiver.secret = webhook.Secret
+	if got, _ := wd.Get(webhook.ID); got.Secret != "" {
+		t.Error("Expected the secret to be returned only on registration")
+	}
+
+	_ = wd.Publish(models.EventJobFinished, "", models.Job{ID: "job1"})
+	failed := waitForDelivery(t, wd, webhook.ID)
+	if failed.Status != models.DeliveryStatusFailed || failed.Attempts != 2 || failed.StatusCode != 500 {
+		t.Errorf("Expected a delivery failing after 2 attempts but got %+v", failed)
+	}
+	if failed.Error != "receiver responded with status 500" {
+		t.Errorf("Expected the receiver's status in the error but got %q", failed.Error)
+	}
+
+	redelivery, err := wd.Redeliver(webhook.ID, failed.ID)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if redelivery.RedeliveryOf != failed.ID || redelivery.EventID != failed.EventID {
+		t.Errorf("Expected a redelivery of %s but got %+v", failed.ID, redelivery)
+	}
+	delivered := waitForDelivery(t, wd, webhook.ID)
+	if delivered.ID != redelivery.ID || delivered.Status != models.DeliveryStatusSucceeded {
+		t.Errorf("Expected the redelivery to succeed but got %+v", delivered)
+	}
+	if events := receiver.received(); len(events) != 1 || events[0].ID != failed.EventID {
+		t.Errorf("Expected the original event to be received but got %+v", events)
+	}
+
+	deliveries, _ := wd.Deliveries(webhook.ID)
+	if len(deliveries) != 2 {
+		t.Errorf("Expected 2 deliveries in the log but got %d", len(deliveries))
+	}
+	if _, err := wd.Redeliver(webhook.ID, "unknown"); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("Expected ErrDeliveryNotFound but got %v", err)
+	}
+	if err := wd.Delete(webhook.ID); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if _, err := wd.Deliveries(webhook.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound but got %v", err)
+	}
+}
+
+func TestWebhookPublishAfterClose(t *testing.T) {
+	receiver := &webhookReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	wd := newTestWebhookDispatcher(t, 1)
+	webhook, _ := wd.Register(models.WebhookRequest{URL: server.URL, Events: []string{models.EventJobFinished}})
+	receiver.secret = webhook.Secret
+	_ = wd.Publish(models.EventJobFinished, "", models.Job{ID: "job1"})
+	delivered := waitForDelivery(t, wd, webhook.ID)
+	wd.Close()
+
+	// Nothing is sent once the dispatcher is closed
+	if err := wd.Publish(models.EventJobFinished, "", models.Job{ID: "job2"}); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	redelivery, err := wd.Redeliver(webhook.ID, delivered.ID)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if redelivery.Status != models.DeliveryStatusFailed {
+		t.Errorf("Expected the redelivery to fail but got %+v", redelivery)
+	}
+	if deliveries, _ := wd.Deliveries(webhook.ID); len(deliveries) != 2 {
+		t.Errorf("Expected 2 deliveries in the log but got %d", len(deliveries))
+	}
+	if events := receiver.received(); len(events) != 1 {
+		t.Errorf("Expected 1 event to be received but got %d", len(events))
+	}
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	wd := newTestWebhookDispatcher(t, 1)
+	jobs, _ := wd.Register(models.WebhookRequest{URL: server.URL + "/jobs", Events: []string{models.EventJobFinished}})
+	sf, _ := wd.Register(models.WebhookRequest{
+		URL:       server.URL + "/sf",
+		Events:    []string{models.EventMarketTrendChange},
+		Locations: []string{"San Francisco, CA", "94110"},
+	})
+	oakland, _ := wd.Register(models.WebhookRequest{
+		URL:       server.URL + "/oakland",
+		Events:    []string{models.EventJobFinished, models.EventMarketTrendChange},
+		Locations: []string{"Oakland, CA", "san francisco, ca"},
+	})
+
+	locations := wd.WatchedLocations()
+	if len(locations) != 3 {
+		t.Errorf("Expected 3 distinct watched locations but got %v", locations)
+	}
+
+	_ = wd.Publish(models.EventMarketTrendChange, "San Francisco, CA", models.TrendChange{Location: "San Francisco, CA"})
+	_ = wd.Publish(models.EventMarketTrendChange, "Oakland, CA", models.TrendChange{Location: "Oakland, CA"})
+	_ = wd.Publish(models.EventJobFinished, "", models.Job{ID: "job1"})
+
+	for _, tc := range []struct {
+		webhook models.Webhook
+		want    int
+	}{
+		{jobs, 1},
+		{sf, 1},
+		{oakland, 3},
+	} {
+		deliveries, _ := wd.Deliveries(tc.webhook.ID)
+		if len(deliveries) != tc.want {
+			t.Errorf("Expected %d deliveries to %s but got %d", tc.want, tc.webhook.URL, len(deliveries))
+		}
+	}
+}
+
+func TestTrendWatcherCheck(t *testing.T) {
+	receiver := &webhookReceiver{t: t, secret: "0123456789abcdef"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	provider := &staticProvider{}
+	df := NewDataFetcher()
+	df.SetProvider(provider)
+	analyzer := NewMarketAnalyzer(df)
+	analyzer.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	wd := newTestWebhookDispatcher(t, 1)
+	webhook, _ := wd.Register(models.WebhookRequest{
+		URL:       server.URL,
+		Events:    []string{models.EventMarketTrendChange},
+		Locations: []string{"San Francisco, CA"},
+		Secret:    receiver.secret,
+	})
+	watcher := NewTrendWatcher(analyzer, wd)
+
+	// The first check records the trend without publishing
+	if err := watcher.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if err := watcher.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if deliveries, _ := wd.Deliveries(webhook.ID); len(deliveries) != 0 {
+		t.Fatalf("Expected no deliveries while the trend is unchanged but got %d", len(deliveries))
+	}
+
+	sale := func(id string, price int, month time.Month) models.Listing {
+		return models.Listing{ID: id, City: "San Francisco", State: "CA", Sqft: 1000, Status: models.ListingStatusSold,
+			SalePrice: price, SaleDate: time.Date(2024, month, 10, 0, 0, 0, 0, time.UTC)}
+	}
+	provider.listings = []models.Listing{sale("A", 1000000, time.January), sale("B", 1200000, time.May)}
+
+	if err := watcher.Check(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	delivery := waitForDelivery(t, wd, webhook.ID)
+	if delivery.Status != models.DeliveryStatusSucceeded {
+		t.Fatalf("Expected the trend change to be delivered but got %+v", delivery)
+	}
+	data, _ := json.Marshal(receiver.received()[0].Data)
+	var change models.TrendChange
+	if err := json.Unmarshal(data, &change); err != nil {
+		t.Fatalf("Expected a trend change but got %s", data)
+	}
+	if change.PreviousTrend != "stable" || change.Trend != "upward" || change.Trends == nil {
+		t.Errorf("Expected a change from stable to upward but got %+v", change)
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	receiver := &webhookReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cfg := DefaultWebhookConfig()
+	cfg.MaxAttempts = 1
+	wd, _ := NewWebhookDispatcher(cfg)
+	defer wd.Close()
+
+	for _, rawURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.1.1]/hook",
+		"http://100.64.1.1/hook",
+	} {
+		if err := wd.CheckURL(rawURL); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Expected ErrPrivateAddress for %s but got %v", rawURL, err)
+		}
+	}
+	if err := wd.CheckURL("https://hooks.example.com/cma"); err != nil {
+		t.Errorf("Expected a public URL to be accepted but got %v", err)
+	}
+
+	// A receiver that is only reachable on loopback is refused when the delivery is sent, which
+	// also covers host names resolving to private addresses
+	webhook, _ := wd.Register(models.WebhookRequest{URL: server.URL, Events: []string{models.EventJobFinished}})
+	_ = wd.Publish(models.EventJobFinished, "", models.Job{ID: "job1"})
+	delivery := waitForDelivery(t, wd, webhook.ID)
+	if delivery.Status != models.DeliveryStatusFailed || !strings.Contains(delivery.Error, ErrPrivateAddress.Error()) {
+		t.Errorf("Expected the delivery to be refused but got %+v", delivery)
+	}
+	if len(receiver.received()) != 0 {
+		t.Error("Expected no event to reach the loopback receiver")
+	}
+}
+
+func TestWebhookPersistence(t *testing.T) {
+	cfg := DefaultWebhookConfig()
+	cfg.Path = filepath.Join(t.TempDir(), "webhooks.json")
+	wd, err := NewWebhookDispatcher(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	kept, _ := wd.Register(models.WebhookRequest{
+		URL:       "https://example.com/kept",
+		Events:    []string{models.EventMarketTrendChange},
+		Locations: []string{"94110"},
+	})
+	deleted, _ := wd.Register(models.WebhookRequest{URL: "https://example.com/deleted", Events: []string{models.EventJobFinished}})
+	if err := wd.Delete(deleted.ID); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	wd.Close()
+
+	// The file holds signing secrets, so only the owner may read it
+	info, err := os.Stat(cfg.Path)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected file mode 0600 but got %o", perm)
+	}
+
+	// After a restart, the kept webhook is restored with its secret and still watches its location
+	restarted, err := NewWebhookDispatcher(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+	defer restarted.Close()
+	webhooks := restarted.Webhooks()
+	if len(webhooks) != 1 || webhooks[0].ID != kept.ID || webhooks[0].URL != kept.URL {
+		t.Fatalf("Expected only the kept webhook to be restored but got %+v", webhooks)
+	}
+	if restarted.webhooks[kept.ID].Secret != kept.Secret {
+		t.Errorf("Expected the secret to be restored but got %q", restarted.webhooks[kept.ID].Secret)
+	}
+	if locations := restarted.WatchedLocations(); len(locations) != 1 || locations[0] != "94110" {
+		t.Errorf("Expected [94110] to be watched but got %v", locations)
+	}
+	if _, err := restarted.Get(deleted.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound but got %v", err)
+	}
+}